@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/polkiloo/gophermart/internal/logger"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
+	"github.com/polkiloo/gophermart/internal/storage/postgres"
+)
+
+const migrateUsage = "usage: gophermart migrate [-d DSN] up|down [N]|status"
+
+// runMigrate executes `gophermart migrate` subcommands and returns exit code.
+// Results go to out and errors to errOut.
+func runMigrate(ctx context.Context, args []string, out, errOut io.Writer, lookup func(string) (string, bool)) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	dsn, _ := lookup("DATABASE_URI")
+	fs.StringVar(&dsn, "d", dsn, "PostgreSQL DSN")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		fmt.Fprintln(errOut, migrateUsage)
+		return 2
+	}
+	if dsn == "" {
+		fmt.Fprintln(errOut, "database URI must be provided")
+		return 2
+	}
+
+	command := fs.Arg(0)
+	steps := 1
+	if command == "down" && fs.NArg() > 1 {
+		n, err := strconv.Atoi(fs.Arg(1))
+		if err != nil || n <= 0 {
+			fmt.Fprintln(errOut, migrateUsage)
+			return 2
+		}
+		steps = n
+	}
+
+	if memory.IsDSN(dsn) {
+		fmt.Fprintln(out, "in-memory storage has no schema to migrate")
+		return 0
+	}
+
+	storage, err := postgres.Connect(ctx, dsn, logger.New())
+	if err != nil {
+		fmt.Fprintf(errOut, "failed to connect: %v\n", err)
+		return 1
+	}
+	defer storage.Close()
+
+	migrator, err := storage.Migrator()
+	if err != nil {
+		fmt.Fprintf(errOut, "failed to load migrations: %v\n", err)
+		return 1
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fmt.Fprintf(errOut, "migrate up failed: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "applied %d migration(s)\n", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			fmt.Fprintf(errOut, "migrate down failed: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "reverted %d migration(s)\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(errOut, "migrate status failed: %v\n", err)
+			return 1
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.AppliedAt != nil {
+				state = "applied " + st.AppliedAt.Format("2006-01-02T15:04:05Z07:00")
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", st.Version, st.Name, state)
+		}
+	default:
+		fmt.Fprintln(errOut, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/logger"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
+	"github.com/polkiloo/gophermart/internal/storage/postgres"
+	"github.com/polkiloo/gophermart/internal/usecase"
+)
+
+const reconcileUsage = "usage: gophermart reconcile [-d DSN] [--repair] [--reason TEXT]"
+
+// exitDrift reports unrepaired drift, so the check can gate scripts.
+const exitDrift = 3
+
+type driftOutput struct {
+	UserID            int64       `json:"user_id"`
+	ExpectedCurrent   model.Money `json:"expected_current"`
+	ActualCurrent     model.Money `json:"actual_current"`
+	ExpectedWithdrawn model.Money `json:"expected_withdrawn"`
+	ActualWithdrawn   model.Money `json:"actual_withdrawn"`
+	LedgerCurrent     model.Money `json:"ledger_current"`
+	Repaired          bool        `json:"repaired"`
+}
+
+type reconcileOutput struct {
+	Drifts   []driftOutput `json:"drifts"`
+	Repaired int           `json:"repaired"`
+}
+
+// runReconcile executes `gophermart reconcile`: it prints balance drift as
+// JSON to out, errors to errOut, and returns exit code, exitDrift when drift
+// was found but not repaired.
+func runReconcile(ctx context.Context, args []string, out, errOut io.Writer, lookup func(string) (string, bool)) int {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	dsn, _ := lookup("DATABASE_URI")
+	var (
+		repair bool
+		reason = "reconcile command"
+	)
+	fs.StringVar(&dsn, "d", dsn, "PostgreSQL DSN")
+	fs.BoolVar(&repair, "repair", false, "Rewrite drifting balances")
+	fs.StringVar(&reason, "reason", reason, "Reason recorded with each repair")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fmt.Fprintln(errOut, reconcileUsage)
+		return 2
+	}
+	if dsn == "" {
+		fmt.Fprintln(errOut, "database URI must be provided")
+		return 2
+	}
+	if memory.IsDSN(dsn) {
+		fmt.Fprintln(out, "in-memory storage has no balances to reconcile")
+		return 0
+	}
+
+	log := logger.New()
+	storage, err := postgres.New(ctx, dsn, postgres.Options{}, log)
+	if err != nil {
+		fmt.Fprintf(errOut, "failed to open storage: %v\n", err)
+		return 1
+	}
+	defer storage.Close()
+
+	audit := usecase.NewAuditUseCase(storage.Audit(), storage.Transactions(), log)
+	balances := usecase.NewBalanceUseCase(storage.Balances(), storage.Withdrawals(), audit)
+	ctx = model.WithRequestMeta(ctx, model.RequestMeta{Actor: operatorActor(lookup)})
+	report, err := balances.Reconcile(ctx, repair, reason)
+	if report != nil {
+		if werr := writeReconcileReport(out, report); werr != nil {
+			fmt.Fprintf(errOut, "write report: %v\n", werr)
+			return 1
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "reconcile failed: %v\n", err)
+		return 1
+	}
+	// A drift that Repair left alone had already been corrected.
+	if !repair && len(report.Drifts) > 0 {
+		return exitDrift
+	}
+	return 0
+}
+
+// operatorActor names the person running the command in the audit log.
+func operatorActor(lookup func(string) (string, bool)) string {
+	if user, ok := lookup("USER"); ok && user != "" {
+		return "operator:" + user
+	}
+	return "operator"
+}
+
+func writeReconcileReport(out io.Writer, report *model.ReconcileReport) error {
+	repaired := make(map[int64]bool, len(report.Repairs))
+	for _, adj := range report.Repairs {
+		repaired[adj.UserID] = true
+	}
+
+	output := reconcileOutput{Drifts: make([]driftOutput, 0, len(report.Drifts)), Repaired: len(report.Repairs)}
+	for _, d := range report.Drifts {
+		output.Drifts = append(output.Drifts, driftOutput{
+			UserID:            d.UserID,
+			ExpectedCurrent:   d.Expected.Current,
+			ActualCurrent:     d.Actual.Current,
+			ExpectedWithdrawn: d.Expected.Withdrawn,
+			ActualWithdrawn:   d.Actual.Withdrawn,
+			LedgerCurrent:     d.Ledger,
+			Repaired:          repaired[d.UserID],
+		})
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestRunReconcileUsage(t *testing.T) {
+	for _, args := range [][]string{{"--unknown"}, {"extra"}} {
+		var out, errOut bytes.Buffer
+		code := runReconcile(context.Background(), args, &out, &errOut, lookupFrom(nil))
+		if code != 2 || !strings.Contains(errOut.String(), reconcileUsage) || out.Len() != 0 {
+			t.Fatalf("args %v: expected usage error, got code=%d out=%q err=%q", args, code, out.String(), errOut.String())
+		}
+	}
+}
+
+func TestRunReconcileRequiresDSN(t *testing.T) {
+	var out, errOut bytes.Buffer
+	code := runReconcile(context.Background(), nil, &out, &errOut, lookupFrom(nil))
+	if code != 2 || !strings.Contains(errOut.String(), "database URI must be provided") || out.Len() != 0 {
+		t.Fatalf("expected missing DSN error, got code=%d out=%q err=%q", code, out.String(), errOut.String())
+	}
+}
+
+func TestRunReconcileInMemory(t *testing.T) {
+	var out, errOut bytes.Buffer
+	code := runReconcile(context.Background(), nil, &out, &errOut, lookupFrom(map[string]string{"DATABASE_URI": "memory://"}))
+	if code != 0 || !strings.Contains(out.String(), "in-memory storage") || errOut.Len() != 0 {
+		t.Fatalf("unexpected result code=%d out=%q err=%q", code, out.String(), errOut.String())
+	}
+}
+
+func TestRunReconcileReportsStorageError(t *testing.T) {
+	var out, errOut bytes.Buffer
+	code := runReconcile(context.Background(), []string{"-d", "postgres://%zz"}, &out, &errOut, lookupFrom(nil))
+	if code != 1 || !strings.Contains(errOut.String(), "failed to open storage") || out.Len() != 0 {
+		t.Fatalf("expected storage error, got code=%d out=%q err=%q", code, out.String(), errOut.String())
+	}
+}
+
+func TestWriteReconcileReport(t *testing.T) {
+	report := &model.ReconcileReport{
+		Drifts: []model.BalanceDrift{
+			{UserID: 1, Expected: model.BalanceSummary{Current: model.MustParseMoney("7"), Withdrawn: model.MustParseMoney("3")}, Actual: model.BalanceSummary{Current: model.MustParseMoney("100"), Withdrawn: model.MustParseMoney("3")}, Ledger: model.MustParseMoney("7")},
+			{UserID: 2, Expected: model.BalanceSummary{}, Actual: model.BalanceSummary{Withdrawn: model.MustParseMoney("1")}},
+		},
+		Repairs: []model.BalanceAdjustment{{UserID: 1}},
+	}
+	var out bytes.Buffer
+	if err := writeReconcileReport(&out, report); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	var got reconcileOutput
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, out.String())
+	}
+	want := reconcileOutput{
+		Drifts: []driftOutput{
+			{UserID: 1, ExpectedCurrent: model.MustParseMoney("7"), ActualCurrent: model.MustParseMoney("100"), ExpectedWithdrawn: model.MustParseMoney("3"), ActualWithdrawn: model.MustParseMoney("3"), LedgerCurrent: model.MustParseMoney("7"), Repaired: true},
+			{UserID: 2, ActualWithdrawn: model.MustParseMoney("1")},
+		},
+		Repaired: 1,
+	}
+	if len(got.Drifts) != len(want.Drifts) || got.Repaired != want.Repaired {
+		t.Fatalf("unexpected report %+v", got)
+	}
+	for i := range want.Drifts {
+		if got.Drifts[i] != want.Drifts[i] {
+			t.Fatalf("drift %d: expected %+v, got %+v", i, want.Drifts[i], got.Drifts[i])
+		}
+	}
+
+	out.Reset()
+	if err := writeReconcileReport(&out, &model.ReconcileReport{}); err != nil || !strings.Contains(out.String(), `"drifts": []`) {
+		t.Fatalf("expected an empty drift list, got %q err=%v", out.String(), err)
+	}
+}
@@ -0,0 +1,241 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// ErrCircuitOpen reports a call refused because the accrual system is
+// considered down.
+var ErrCircuitOpen = errors.New("accrual circuit open")
+
+// BreakerState is the position of a Breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen refuses calls until the cool-down ends.
+	BreakerOpen
+	// BreakerHalfOpen lets one probe through at a time to test recovery.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerSettings tunes a Breaker.
+type BreakerSettings struct {
+	// FailureThreshold is how many consecutive failures open the circuit.
+	FailureThreshold int
+	// SuccessThreshold is how many successful probes close it again.
+	SuccessThreshold int
+	// CoolDown is how long the circuit stays open before probing.
+	CoolDown time.Duration
+}
+
+// DefaultBreakerSettings opens after five straight failures and probes every 30s.
+var DefaultBreakerSettings = BreakerSettings{FailureThreshold: 5, SuccessThreshold: 1, CoolDown: 30 * time.Second}
+
+// Breaker stops calls to the accrual system while it keeps failing. Only
+// transport errors and 5xx answers count as failures; an unknown order or a
+// rate limit shows the system is up.
+type Breaker struct {
+	settings BreakerSettings
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	probing   bool
+	openedAt  time.Time
+	lastError string
+}
+
+// NewBreaker builds a closed Breaker; non-positive settings keep the defaults.
+func NewBreaker(settings BreakerSettings, logger *slog.Logger) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultBreakerSettings.FailureThreshold
+	}
+	if settings.SuccessThreshold <= 0 {
+		settings.SuccessThreshold = DefaultBreakerSettings.SuccessThreshold
+	}
+	if settings.CoolDown <= 0 {
+		settings.CoolDown = DefaultBreakerSettings.CoolDown
+	}
+	return &Breaker{settings: settings, logger: logger, now: time.Now}
+}
+
+// Allow admits a call or returns ErrCircuitOpen. An admitted call must be
+// followed by Done.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.settings.CoolDown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.successes = 0
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Done records the outcome of an admitted call.
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		// A call admitted before the circuit opened; the cool-down stands.
+		return
+	case BreakerHalfOpen:
+		b.probing = false
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The caller gave up; the call says nothing about the accrual system.
+	case isOutage(err):
+		b.lastError = err.Error()
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.settings.FailureThreshold {
+			b.open()
+		}
+	default:
+		b.failures = 0
+		if b.state != BreakerHalfOpen {
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.SuccessThreshold {
+			b.setState(BreakerClosed)
+			b.lastError = ""
+		}
+	}
+}
+
+func (b *Breaker) open() {
+	b.openedAt = b.now()
+	b.failures = 0
+	b.setState(BreakerOpen)
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	previous := b.state
+	b.state = state
+	attrs := []any{slog.String("from", previous.String()), slog.String("to", state.String())}
+	switch state {
+	case BreakerOpen:
+		b.logger.Warn("accrual circuit opened", append(attrs, slog.Duration("cool_down", b.settings.CoolDown), slog.String("error", b.lastError))...)
+	default:
+		b.logger.Info("accrual circuit "+state.String(), attrs...)
+	}
+}
+
+// IsOpen reports whether calls are currently refused outright, so callers
+// can skip work that would only be rejected.
+func (b *Breaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == BreakerOpen && b.now().Sub(b.openedAt) < b.settings.CoolDown
+}
+
+// State returns the current position of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Health reports the breaker as the accrual component: degraded unless closed.
+func (b *Breaker) Health(context.Context) model.ComponentHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	health := model.ComponentHealth{Name: "accrual", Status: model.HealthUp, State: b.state.String()}
+	if b.state == BreakerClosed {
+		return health
+	}
+	health.Status = model.HealthDegraded
+	health.Detail = b.lastError
+	if b.state == BreakerOpen {
+		health.Detail = fmt.Sprintf("%s; probing after %s", b.lastError, b.openedAt.Add(b.settings.CoolDown).UTC().Format(time.RFC3339))
+	}
+	return health
+}
+
+// isOutage reports whether err suggests the accrual system is unavailable.
+// An answer it could not make sense of still came from a working system.
+func isOutage(err error) bool {
+	if err == nil || errors.Is(err, ErrOrderNotRegistered) {
+		return false
+	}
+	var rateLimited TooManyRequestsError
+	if errors.As(err, &rateLimited) {
+		return false
+	}
+	var invalid ResponseError
+	if errors.As(err, &invalid) {
+		return false
+	}
+	var status StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// BreakerClient refuses fetches while its Breaker is open.
+type BreakerClient struct {
+	next    Client
+	breaker *Breaker
+}
+
+// NewBreakerClient wraps next with breaker.
+func NewBreakerClient(next Client, breaker *Breaker) *BreakerClient {
+	return &BreakerClient{next: next, breaker: breaker}
+}
+
+// Fetch queries the wrapped client unless the circuit is open.
+func (c *BreakerClient) Fetch(ctx context.Context, number string) (*model.Accrual, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	result, err := c.next.Fetch(ctx, number)
+	c.breaker.Done(err)
+	return result, err
+}
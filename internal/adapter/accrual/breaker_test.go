@@ -0,0 +1,141 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+var errUnavailable = StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+
+func newTestBreaker(settings BreakerSettings) (*Breaker, *time.Time) {
+	b := NewBreaker(settings, testLogger())
+	now := time.Unix(1700000000, 0)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func call(b *Breaker, err error) error {
+	if allowErr := b.Allow(); allowErr != nil {
+		return allowErr
+	}
+	b.Done(err)
+	return nil
+}
+
+func TestBreakerOpensAfterConsecutiveOutages(t *testing.T) {
+	b, now := newTestBreaker(BreakerSettings{FailureThreshold: 3, CoolDown: time.Minute})
+
+	for _, err := range []error{errUnavailable, errUnavailable, nil, errUnavailable, errors.New("dial tcp: connection refused")} {
+		if err := call(b, err); err != nil {
+			t.Fatalf("expected closed circuit, got %v", err)
+		}
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected a success to reset the failure count, got %s", b.State())
+	}
+
+	if err := call(b, errUnavailable); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.State() != BreakerOpen || !b.IsOpen() {
+		t.Fatalf("expected circuit to open, got %s", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected calls refused while open, got %v", err)
+	}
+	if health := b.Health(context.Background()); health.Status != model.HealthDegraded || health.State != "open" || health.Detail == "" {
+		t.Fatalf("unexpected health %+v", health)
+	}
+
+	*now = now.Add(time.Minute)
+	if b.IsOpen() {
+		t.Fatal("expected cool-down to end")
+	}
+}
+
+func TestBreakerIgnoresHealthyAnswers(t *testing.T) {
+	b, _ := newTestBreaker(BreakerSettings{FailureThreshold: 1})
+	for _, err := range []error{
+		ErrOrderNotRegistered,
+		TooManyRequestsError{RetryAfter: time.Second},
+		StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"},
+		ResponseError{Err: errors.New("unexpected end of JSON input")},
+		context.Canceled,
+	} {
+		if err := call(b, err); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected circuit to stay closed, got %s", b.State())
+	}
+	if health := b.Health(context.Background()); health.Status != model.HealthUp || health.State != "closed" {
+		t.Fatalf("unexpected health %+v", health)
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	b, now := newTestBreaker(BreakerSettings{FailureThreshold: 1, SuccessThreshold: 2, CoolDown: time.Minute})
+	_ = call(b, errUnavailable)
+
+	*now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected a probe after the cool-down, got %v", err)
+	}
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open circuit, got %s", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected one probe at a time, got %v", err)
+	}
+	b.Done(errUnavailable)
+	if b.State() != BreakerOpen || !b.IsOpen() {
+		t.Fatalf("expected failed probe to reopen the circuit, got %s", b.State())
+	}
+
+	*now = now.Add(time.Minute)
+	if err := call(b, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected circuit to wait for a second probe, got %s", b.State())
+	}
+	if err := call(b, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected successful probes to close the circuit, got %s", b.State())
+	}
+}
+
+func TestBreakerClient(t *testing.T) {
+	b, _ := newTestBreaker(BreakerSettings{FailureThreshold: 1, CoolDown: time.Minute})
+	calls := 0
+	client := NewBreakerClient(clientFunc(func(context.Context, string) (*model.Accrual, error) {
+		calls++
+		return nil, errUnavailable
+	}), b)
+
+	if _, err := client.Fetch(context.Background(), "1"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expected upstream error, got %v", err)
+	}
+	if _, err := client.Fetch(context.Background(), "1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected open circuit to skip the accrual system, got %d calls", calls)
+	}
+}
+
+func TestBreakerStateString(t *testing.T) {
+	for state, want := range map[BreakerState]string{BreakerClosed: "closed", BreakerOpen: "open", BreakerHalfOpen: "half_open", BreakerState(9): "unknown"} {
+		if got := state.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", state, got, want)
+		}
+	}
+}
@@ -28,6 +28,30 @@ func (e TooManyRequestsError) Error() string {
 	return fmt.Sprintf("too many requests, retry after %s", e.RetryAfter)
 }
 
+// StatusError reports an unexpected HTTP status from the accrual system.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("accrual error: %s", e.Status)
+}
+
+// ResponseError reports an answer from the accrual system that could not be
+// decoded or carries an unknown status.
+type ResponseError struct {
+	Err error
+}
+
+func (e ResponseError) Error() string {
+	return fmt.Sprintf("invalid accrual response: %v", e.Err)
+}
+
+func (e ResponseError) Unwrap() error {
+	return e.Err
+}
+
 // Client exposes operations to query accrual service.
 type Client interface {
 	Fetch(ctx context.Context, number string) (*model.Accrual, error)
@@ -40,11 +64,12 @@ type HTTPClient struct {
 	logger     *slog.Logger
 }
 
-// response mirrors JSON payload from accrual system.
+// response mirrors JSON payload from accrual system. The accrual is kept as
+// text so that amounts finer than hundredths are rounded rather than refused.
 type response struct {
-	Order   string   `json:"order"`
-	Status  string   `json:"status"`
-	Accrual *float64 `json:"accrual,omitempty"`
+	Order   string       `json:"order"`
+	Status  string       `json:"status"`
+	Accrual *json.Number `json:"accrual,omitempty"`
 }
 
 // NewHTTPClient creates HTTP accrual client with default timeout.
@@ -65,7 +90,8 @@ func NewHTTPClient(baseURL string, logger *slog.Logger) (*HTTPClient, error) {
 	}, nil
 }
 
-// Fetch queries accrual system for order status.
+// Fetch queries accrual system for order status and records the round trip
+// for CallTime.
 func (c *HTTPClient) Fetch(ctx context.Context, number string) (*model.Accrual, error) {
 	endpoint := *c.baseURL
 	endpoint.Path = path.Join(endpoint.Path, "/api/orders/", number)
@@ -76,7 +102,9 @@ func (c *HTTPClient) Fetch(ctx context.Context, number string) (*model.Accrual,
 	}
 	req.Header.Set("Accept", "application/json")
 
+	started := time.Now()
 	resp, err := c.httpClient.Do(req)
+	recordCallTime(ctx, time.Since(started))
 	if err != nil {
 		return nil, err
 	}
@@ -90,9 +118,23 @@ func (c *HTTPClient) Fetch(ctx context.Context, number string) (*model.Accrual,
 		}
 		var data response
 		if err := json.Unmarshal(body, &data); err != nil {
-			return nil, err
+			return nil, ResponseError{Err: err}
+		}
+		status := model.AccrualStatus(data.Status)
+		switch status {
+		case model.AccrualStatusRegistered, model.AccrualStatusProcessing, model.AccrualStatusInvalid, model.AccrualStatusProcessed:
+		default:
+			return nil, ResponseError{Err: fmt.Errorf("unknown status %q", data.Status)}
+		}
+		result := &model.Accrual{Order: data.Order, Status: status}
+		if data.Accrual != nil {
+			amount, err := model.RoundMoney(data.Accrual.String())
+			if err != nil {
+				return nil, ResponseError{Err: err}
+			}
+			result.Accrual = &amount
 		}
-		return &model.Accrual{Order: data.Order, Status: model.AccrualStatus(data.Status), Accrual: data.Accrual}, nil
+		return result, nil
 	case http.StatusNoContent:
 		return nil, ErrOrderNotRegistered
 	case http.StatusTooManyRequests:
@@ -101,7 +143,7 @@ func (c *HTTPClient) Fetch(ctx context.Context, number string) (*model.Accrual,
 	default:
 		body, _ := io.ReadAll(resp.Body)
 		c.logger.Error("accrual request failed", slog.Int("status", resp.StatusCode), slog.String("body", string(body)))
-		return nil, fmt.Errorf("accrual error: %s", resp.Status)
+		return nil, StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 }
 
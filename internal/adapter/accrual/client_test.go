@@ -158,6 +158,48 @@ func TestFetchHandlesSpecialStatuses(t *testing.T) {
 	}
 }
 
+func TestFetchRoundsFineAccruals(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"order":"1","status":"PROCESSED","accrual":729.985}`)
+	}))
+	defer srv.Close()
+
+	client, err := NewHTTPClient(srv.URL, testLogger())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	result, err := client.Fetch(context.Background(), "1")
+	if err != nil || result.Accrual == nil || *result.Accrual != model.MustParseMoney("729.98") {
+		t.Fatalf("expected the accrual rounded half to even, got %+v err=%v", result, err)
+	}
+}
+
+func TestFetchRejectsInvalidResponses(t *testing.T) {
+	for name, body := range map[string]string{
+		"malformed":      `{"order":`,
+		"unknown status": `{"order":"1","status":"DONE"}`,
+		"huge accrual":   `{"order":"1","status":"PROCESSED","accrual":1e30}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, body)
+			}))
+			defer srv.Close()
+
+			client, err := NewHTTPClient(srv.URL, testLogger())
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			var invalid ResponseError
+			if _, err := client.Fetch(context.Background(), "1"); !errors.As(err, &invalid) {
+				t.Fatalf("expected ResponseError, got %v", err)
+			}
+		})
+	}
+}
+
 func TestFetchLogsErrorResponses(t *testing.T) {
 	called := make(chan struct{}, 1)
 	handler := slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
@@ -181,8 +223,9 @@ func TestFetchLogsErrorResponses(t *testing.T) {
 		t.Fatalf("failed to create client: %v", err)
 	}
 
-	if _, err := client.Fetch(context.Background(), "123"); err == nil {
-		t.Fatal("expected error from server")
+	var status StatusError
+	if _, err := client.Fetch(context.Background(), "123"); !errors.As(err, &status) || status.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status error from server, got %v", err)
 	}
 
 	select {
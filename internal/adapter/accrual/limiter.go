@@ -0,0 +1,119 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// Limiter paces calls to the accrual system for every caller in the process.
+// It spaces calls to an optional steady rate and holds all of them while the
+// accrual system asks to back off.
+type Limiter struct {
+	interval time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu          sync.Mutex
+	next        time.Time
+	pausedUntil time.Time
+	paused      bool
+}
+
+// NewLimiter builds a Limiter admitting up to rps calls per second; zero or
+// less leaves calls unpaced until the accrual system pushes back.
+func NewLimiter(rps int, logger *slog.Logger) *Limiter {
+	l := &Limiter{logger: logger, now: time.Now}
+	if rps > 0 {
+		l.interval = time.Second / time.Duration(rps)
+	}
+	return l
+}
+
+// Wait blocks until the caller may call the accrual system or ctx ends.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve claims the next call slot and returns zero, or returns how long to
+// wait before asking again. Waiters ask again after sleeping, so a pause that
+// starts meanwhile still holds them.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.paused {
+		l.paused = false
+		l.logger.Info("accrual calls resumed")
+	}
+	if now.Before(l.next) {
+		return l.next.Sub(now)
+	}
+	l.next = now.Add(l.interval)
+	return 0
+}
+
+// Pause holds every call for d, extending an earlier pause if it ends sooner.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := l.now().Add(d)
+	if !until.After(l.pausedUntil) {
+		return
+	}
+	l.pausedUntil, l.paused = until, true
+	l.logger.Warn("accrual calls paused", slog.Duration("retry_after", d), slog.Time("until", until))
+}
+
+// PausedUntil reports when the current pause ends, if calls are paused.
+func (l *Limiter) PausedUntil() (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pausedUntil, l.now().Before(l.pausedUntil)
+}
+
+// RateLimitedClient routes every fetch through a shared Limiter and pauses it
+// whenever the accrual system answers 429.
+type RateLimitedClient struct {
+	next    Client
+	limiter *Limiter
+}
+
+// NewRateLimitedClient wraps next with limiter.
+func NewRateLimitedClient(next Client, limiter *Limiter) *RateLimitedClient {
+	return &RateLimitedClient{next: next, limiter: limiter}
+}
+
+// Fetch waits for a call slot and queries the wrapped client.
+func (c *RateLimitedClient) Fetch(ctx context.Context, number string) (*model.Accrual, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	result, err := c.next.Fetch(ctx, number)
+	var rateLimited TooManyRequestsError
+	if errors.As(err, &rateLimited) {
+		c.limiter.Pause(rateLimited.RetryAfter)
+	}
+	return result, err
+}
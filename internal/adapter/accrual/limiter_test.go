@@ -0,0 +1,114 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+func newTestLimiter(rps int) (*Limiter, *time.Time) {
+	l := NewLimiter(rps, testLogger())
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterPacesCalls(t *testing.T) {
+	l, now := newTestLimiter(100)
+	if delay := l.reserve(); delay != 0 {
+		t.Fatalf("expected first call admitted, got %v", delay)
+	}
+	if delay := l.reserve(); delay != 10*time.Millisecond {
+		t.Fatalf("expected second call spaced by 10ms, got %v", delay)
+	}
+	*now = now.Add(10 * time.Millisecond)
+	if delay := l.reserve(); delay != 0 {
+		t.Fatalf("expected call admitted after the interval, got %v", delay)
+	}
+
+	unpaced, _ := newTestLimiter(0)
+	for i := 0; i < 3; i++ {
+		if delay := unpaced.reserve(); delay != 0 {
+			t.Fatalf("expected unpaced calls, got %v", delay)
+		}
+	}
+}
+
+func TestLimiterPause(t *testing.T) {
+	l, now := newTestLimiter(0)
+	l.Pause(time.Second)
+	l.Pause(100 * time.Millisecond)
+
+	if until, paused := l.PausedUntil(); !paused || !until.Equal(now.Add(time.Second)) {
+		t.Fatalf("expected the longer pause to win, got %v paused=%v", until, paused)
+	}
+	if delay := l.reserve(); delay != time.Second {
+		t.Fatalf("expected calls held for 1s, got %v", delay)
+	}
+
+	*now = now.Add(time.Second)
+	if delay := l.reserve(); delay != 0 {
+		t.Fatalf("expected calls resumed, got %v", delay)
+	}
+	if _, paused := l.PausedUntil(); paused || l.paused {
+		t.Fatal("expected pause to be over")
+	}
+}
+
+func TestLimiterWaitHonorsContext(t *testing.T) {
+	l := NewLimiter(0, testLogger())
+	l.Pause(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	l = NewLimiter(1000, testLogger())
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Millisecond {
+		t.Fatalf("expected calls spaced by 1ms, took %v", elapsed)
+	}
+}
+
+type clientFunc func(ctx context.Context, number string) (*model.Accrual, error)
+
+func (f clientFunc) Fetch(ctx context.Context, number string) (*model.Accrual, error) {
+	return f(ctx, number)
+}
+
+func TestRateLimitedClientPausesEveryCaller(t *testing.T) {
+	var calls int32
+	next := clientFunc(func(context.Context, string) (*model.Accrual, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, TooManyRequestsError{RetryAfter: time.Hour}
+	})
+	limiter := NewLimiter(0, testLogger())
+	client := NewRateLimitedClient(next, limiter)
+
+	var rateLimited TooManyRequestsError
+	if _, err := client.Fetch(context.Background(), "1"); !errors.As(err, &rateLimited) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if _, paused := limiter.PausedUntil(); !paused {
+		t.Fatal("expected limiter paused by 429")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Fetch(ctx, "2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected paused call to wait, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected no call during the pause, got %d calls", got)
+	}
+}
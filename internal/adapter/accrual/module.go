@@ -9,15 +9,31 @@ import (
 )
 
 // Module exposes accrual client implementation to fx graph.
-var Module = fx.Provide(newClient)
+var Module = fx.Provide(newBreaker, newClient)
 
 type clientParams struct {
 	fx.In
 
-	Config *config.Config
-	Logger *slog.Logger
+	Config  *config.Config
+	Logger  *slog.Logger
+	Breaker *Breaker
 }
 
+func newBreaker(cfg *config.Config, logger *slog.Logger) *Breaker {
+	return NewBreaker(BreakerSettings{
+		FailureThreshold: cfg.BreakerFailures,
+		SuccessThreshold: cfg.BreakerSuccesses,
+		CoolDown:         cfg.BreakerCoolDown,
+	}, logger)
+}
+
+// newClient checks the breaker before waiting for a rate limiter slot, so
+// an outage never holds callers in the limiter.
 func newClient(p clientParams) (Client, error) {
-	return NewHTTPClient(p.Config.AccrualSystemAddress, p.Logger)
+	client, err := NewHTTPClient(p.Config.AccrualSystemAddress, p.Logger)
+	if err != nil {
+		return nil, err
+	}
+	limited := NewRateLimitedClient(client, NewLimiter(p.Config.AccrualRPS, p.Logger))
+	return NewBreakerClient(limited, p.Breaker), nil
 }
@@ -11,11 +11,23 @@ import (
 func TestNewClientUsesConfig(t *testing.T) {
 	cfg := &config.Config{AccrualSystemAddress: "http://example.com"}
 	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
-	client, err := newClient(clientParams{Config: cfg, Logger: logger})
+	breaker := newBreaker(cfg, logger)
+	client, err := newClient(clientParams{Config: cfg, Logger: logger, Breaker: breaker})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if client == nil {
-		t.Fatal("expected client instance")
+	guarded, ok := client.(*BreakerClient)
+	if !ok || guarded.breaker != breaker {
+		t.Fatalf("expected breaker client, got %T", client)
+	}
+	if _, ok := guarded.next.(*RateLimitedClient); !ok {
+		t.Fatalf("expected breaker to wrap rate limited client, got %T", guarded.next)
+	}
+	if breaker.settings != DefaultBreakerSettings {
+		t.Fatalf("expected default breaker settings, got %+v", breaker.settings)
+	}
+
+	if _, err := newClient(clientParams{Config: &config.Config{AccrualSystemAddress: "/relative"}, Logger: logger, Breaker: breaker}); err == nil {
+		t.Fatal("expected invalid address error")
 	}
 }
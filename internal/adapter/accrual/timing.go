@@ -0,0 +1,35 @@
+package accrual
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type callTimeKey struct{}
+
+// WithCallTime returns a context in which Fetch records how long the accrual
+// system took to answer. Time spent waiting in the limiter or a back-off pause
+// is not part of it.
+func WithCallTime(ctx context.Context) context.Context {
+	took := new(atomic.Int64)
+	took.Store(-1)
+	return context.WithValue(ctx, callTimeKey{}, took)
+}
+
+// CallTime reports the duration recorded by the last Fetch made with ctx, or
+// false when no request reached the accrual system.
+func CallTime(ctx context.Context) (time.Duration, bool) {
+	took, ok := ctx.Value(callTimeKey{}).(*atomic.Int64)
+	if !ok || took.Load() < 0 {
+		return 0, false
+	}
+	return time.Duration(took.Load()), true
+}
+
+// recordCallTime stores d for CallTime. It is a no-op outside WithCallTime.
+func recordCallTime(ctx context.Context, d time.Duration) {
+	if took, ok := ctx.Value(callTimeKey{}).(*atomic.Int64); ok {
+		took.Store(int64(d))
+	}
+}
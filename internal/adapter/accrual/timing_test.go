@@ -0,0 +1,48 @@
+package accrual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCallTimeExcludesLimiterWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"order":"1","status":"PROCESSING"}`))
+	}))
+	defer server.Close()
+	client, err := NewHTTPClient(server.URL, testLogger())
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	limiter := NewLimiter(0, testLogger())
+	limited := NewRateLimitedClient(client, limiter)
+
+	const pause = 200 * time.Millisecond
+	limiter.Pause(pause)
+	ctx := WithCallTime(context.Background())
+	started := time.Now()
+	if _, err := limited.Fetch(ctx, "1"); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	took, reached := CallTime(ctx)
+	if !reached || took <= 0 || took >= pause || time.Since(started) < pause {
+		t.Fatalf("expected only the round trip to be timed, got %v reached=%v", took, reached)
+	}
+
+	limiter.Pause(time.Hour)
+	waiting, cancel := context.WithTimeout(WithCallTime(context.Background()), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limited.Fetch(waiting, "1"); err == nil {
+		t.Fatal("expected the paused call to give up")
+	}
+	if _, reached := CallTime(waiting); reached {
+		t.Fatal("expected a call that never left the limiter not to be timed")
+	}
+	if _, reached := CallTime(context.Background()); reached {
+		t.Fatal("expected no timing outside WithCallTime")
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/fx"
 
+	"github.com/polkiloo/gophermart/internal/adapter/accrual"
 	"github.com/polkiloo/gophermart/internal/config"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
 	"github.com/polkiloo/gophermart/internal/worker"
 )
 
@@ -18,7 +20,10 @@ var Module = fx.Options(
 	fx.Provide(
 		NewLoyaltyFacade,
 		newHTTPServer,
+		newCoordinator,
 		newOrderProcessor,
+		newOrderArchiver,
+		newBalanceReconciler,
 	),
 	fx.Invoke(registerLifecycle),
 )
@@ -37,40 +42,110 @@ func newHTTPServer(p serverParams) *http.Server {
 	}
 }
 
+type coordinatorParams struct {
+	fx.In
+
+	Factory repository.Factory
+	Config  *config.Config
+	Logger  *slog.Logger
+}
+
+func newCoordinator(p coordinatorParams) *worker.Coordinator {
+	return worker.NewCoordinator(
+		worker.CoordinationMode(p.Config.WorkerCoordination),
+		p.Config.InstanceID,
+		p.Factory.Leader(),
+		p.Factory.Instances(),
+		p.Config.WorkerHeartbeat,
+		p.Config.WorkerInstanceTTL,
+		p.Logger,
+	)
+}
+
 type workerParams struct {
 	fx.In
 
-	Facade *LoyaltyFacade
-	Config *config.Config
-	Logger *slog.Logger
+	Facade      *LoyaltyFacade
+	Coordinator *worker.Coordinator
+	Factory     repository.Factory
+	Notifier    repository.OrderNotifier `optional:"true"`
+	Breaker     *accrual.Breaker         `optional:"true"`
+	Config      *config.Config
+	Logger      *slog.Logger
 }
 
 func newOrderProcessor(p workerParams) *worker.OrderProcessor {
+	opts := []worker.Option{
+		worker.WithOwner(p.Config.InstanceID),
+		worker.WithAssigner(p.Coordinator),
+		worker.WithStateStore(p.Factory.ProcessorState()),
+		worker.WithLeaseDuration(p.Config.OrderLeaseDuration),
+		worker.WithRetryPolicy(worker.RetryPolicy{
+			BaseDelay:   p.Config.OrderRetryBaseDelay,
+			MaxDelay:    p.Config.OrderRetryMaxDelay,
+			MaxFailures: p.Config.OrderMaxFailures,
+			MaxAge:      p.Config.OrderMaxFailingAge,
+		}),
+		worker.WithScaling(worker.ScalingPolicy{
+			MinWorkers: p.Config.WorkerPoolMin,
+			MaxWorkers: p.Config.WorkerPoolMax,
+			Interval:   p.Config.WorkerScaleInterval,
+			MaxLatency: p.Config.WorkerScaleLatency,
+		}),
+	}
+	if p.Notifier != nil {
+		opts = append(opts, worker.WithNotifier(p.Notifier))
+	}
+	if p.Breaker != nil {
+		opts = append(opts, worker.WithBreaker(p.Breaker))
+	}
 	return worker.NewOrderProcessor(
 		p.Facade,
 		p.Config.OrderPollInterval,
 		p.Config.MaxOrdersBatch,
 		p.Config.WorkerPoolSize,
 		p.Logger,
+		opts...,
 	)
 }
 
+// archiveBatchSize bounds how many orders one archival transaction moves.
+const archiveBatchSize = 500
+
+func newOrderArchiver(facade *LoyaltyFacade, cfg *config.Config, logger *slog.Logger) *worker.OrderArchiver {
+	return worker.NewOrderArchiver(facade, cfg.OrderArchiveAfter, cfg.OrderArchiveInterval, archiveBatchSize, logger)
+}
+
+func newBalanceReconciler(facade *LoyaltyFacade, coordinator *worker.Coordinator, cfg *config.Config, logger *slog.Logger) *worker.BalanceReconciler {
+	return worker.NewBalanceReconciler(facade, coordinator, cfg.ReconcileInterval, cfg.ReconcileRepair, logger)
+}
+
 type lifecycleParams struct {
 	fx.In
 
-	Lifecycle  fx.Lifecycle
-	Shutdowner fx.Shutdowner
-	Logger     *slog.Logger
-	Server     *http.Server
-	Worker     *worker.OrderProcessor
-	Config     *config.Config
+	Lifecycle   fx.Lifecycle
+	Shutdowner  fx.Shutdowner
+	Logger      *slog.Logger
+	Server      *http.Server
+	Coordinator *worker.Coordinator
+	Worker      *worker.OrderProcessor
+	Archiver    *worker.OrderArchiver
+	Reconciler  *worker.BalanceReconciler
+	Config      *config.Config
 }
 
 func registerLifecycle(p lifecycleParams) {
 	p.Lifecycle.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			p.Logger.Info("starting gophermart", slog.String("addr", p.Server.Addr))
-			p.Worker.Start(ctx)
+			// The start context ends with the first signal; the background
+			// jobs run until OnStop shuts them down, so in-flight orders are
+			// drained rather than aborted.
+			runCtx := context.WithoutCancel(ctx)
+			p.Coordinator.Start(runCtx)
+			p.Worker.Start(runCtx)
+			p.Archiver.Start(runCtx)
+			p.Reconciler.Start(runCtx)
 			go func() {
 				if err := p.Server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					p.Logger.Error("http server terminated", slog.String("error", err.Error()))
@@ -80,17 +155,22 @@ func registerLifecycle(p lifecycleParams) {
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
-			p.Worker.Stop()
+			// Stop taking requests first. The server and the worker each get
+			// a budget of their own, so a slow drain of one cannot leave the
+			// other without time.
+			serverCtx, cancelServer := context.WithTimeout(ctx, p.Config.ShutdownTimeout)
+			serverErr := p.Server.Shutdown(serverCtx)
+			cancelServer()
 
-			shutdownCtx := ctx
-			cancel := func() {}
-			if _, ok := ctx.Deadline(); !ok {
-				shutdownCtx, cancel = context.WithTimeout(ctx, p.Config.ShutdownTimeout)
-			}
-			defer cancel()
+			workerCtx, cancelWorker := context.WithTimeout(ctx, p.Config.ShutdownTimeout)
+			p.Worker.Shutdown(workerCtx)
+			cancelWorker()
+			p.Coordinator.Stop()
+			p.Archiver.Stop()
+			p.Reconciler.Stop()
 
-			if err := p.Server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
-				return err
+			if serverErr != nil && !errors.Is(serverErr, http.ErrServerClosed) {
+				return serverErr
 			}
 			p.Logger.Info("gophermart stopped")
 			return nil
@@ -13,15 +13,37 @@ import (
 
 	"github.com/polkiloo/gophermart/internal/config"
 	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
 	testhelpers "github.com/polkiloo/gophermart/internal/test"
+	"github.com/polkiloo/gophermart/internal/usecase"
 	"github.com/polkiloo/gophermart/internal/worker"
 )
 
+func newTestAudit() *usecase.AuditUseCase {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return usecase.NewAuditUseCase(&testhelpers.AuditRepositoryStub{}, &testhelpers.TxManagerStub{}, logger)
+}
+
 func newTestOrderProcessor() *worker.OrderProcessor {
 	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
 	return worker.NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, 10*time.Millisecond, 1, 1, logger)
 }
 
+func newTestCoordinator() *worker.Coordinator {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return worker.NewCoordinator(worker.CoordinationNone, "test", nil, nil, time.Second, 0, logger)
+}
+
+func newTestOrderArchiver() *worker.OrderArchiver {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return worker.NewOrderArchiver(&LoyaltyFacade{orders: usecase.NewOrderUseCase(&testhelpers.OrderRepositoryStub{}, newTestAudit())}, time.Hour, time.Hour, 1, logger)
+}
+
+func newTestBalanceReconciler() *worker.BalanceReconciler {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return worker.NewBalanceReconciler(&LoyaltyFacade{}, nil, time.Hour, false, logger)
+}
+
 func TestNewHTTPServer(t *testing.T) {
 	cfg := &config.Config{RunAddress: ":9999"}
 	router := gin.New()
@@ -36,15 +58,31 @@ func TestNewHTTPServer(t *testing.T) {
 
 func TestNewOrderProcessorUsesConfig(t *testing.T) {
 	proc := newOrderProcessor(workerParams{
-		Facade: &LoyaltyFacade{},
-		Config: &config.Config{OrderPollInterval: 15 * time.Second, MaxOrdersBatch: 3, WorkerPoolSize: 4},
-		Logger: slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		Facade:      &LoyaltyFacade{},
+		Coordinator: newTestCoordinator(),
+		Factory:     memory.New(),
+		Config:      &config.Config{OrderPollInterval: 15 * time.Second, MaxOrdersBatch: 3, WorkerPoolSize: 4},
+		Logger:      slog.New(slog.NewJSONHandler(io.Discard, nil)),
 	})
 	if proc == nil {
 		t.Fatal("expected order processor instance")
 	}
 }
 
+func TestNewCoordinatorUsesConfig(t *testing.T) {
+	coordinator := newCoordinator(coordinatorParams{
+		Factory: memory.New(),
+		Config:  &config.Config{WorkerCoordination: config.CoordinationSharded, InstanceID: "node-a", WorkerHeartbeat: time.Hour},
+		Logger:  slog.New(slog.NewJSONHandler(io.Discard, nil)),
+	})
+	coordinator.Start(context.Background())
+	defer coordinator.Stop()
+
+	if shard, ok := coordinator.Assignment(); !ok || shard != (model.Shard{Index: 0, Count: 1}) {
+		t.Fatalf("expected the only instance to own every order, got %+v %v", shard, ok)
+	}
+}
+
 func TestRegisterLifecycleStartStop(t *testing.T) {
 	recorder := &testhelpers.LifecycleRecorder{}
 	shutdowner := &testhelpers.ShutdownerStub{Called: make(chan struct{}, 1)}
@@ -54,12 +92,15 @@ func TestRegisterLifecycleStartStop(t *testing.T) {
 	cfg := &config.Config{ShutdownTimeout: 100 * time.Millisecond}
 
 	registerLifecycle(lifecycleParams{
-		Lifecycle:  recorder,
-		Shutdowner: shutdowner,
-		Logger:     logger,
-		Server:     server,
-		Worker:     worker,
-		Config:     cfg,
+		Lifecycle:   recorder,
+		Shutdowner:  shutdowner,
+		Logger:      logger,
+		Server:      server,
+		Coordinator: newTestCoordinator(),
+		Worker:      worker,
+		Archiver:    newTestOrderArchiver(),
+		Reconciler:  newTestBalanceReconciler(),
+		Config:      cfg,
 	})
 
 	if len(recorder.Hooks) != 1 {
@@ -87,6 +128,69 @@ func TestRegisterLifecycleStartStop(t *testing.T) {
 	}
 }
 
+func TestRegisterLifecycleDrainsJobsAfterStartContextEnds(t *testing.T) {
+	recorder := &testhelpers.LifecycleRecorder{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	facade := &testhelpers.WorkerFacadeStub{
+		Orders: [][]model.Order{{{ID: 1, Number: "1"}}},
+		CheckFn: func(ctx context.Context, _ string) (*model.Accrual, error) {
+			close(started)
+			select {
+			case <-proceed:
+				return &model.Accrual{Order: "1", Status: model.AccrualStatusInvalid}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+
+	registerLifecycle(lifecycleParams{
+		Lifecycle:   recorder,
+		Shutdowner:  &testhelpers.ShutdownerStub{Called: make(chan struct{}, 1)},
+		Logger:      logger,
+		Server:      &http.Server{Addr: "127.0.0.1:0", Handler: http.NewServeMux()},
+		Coordinator: newTestCoordinator(),
+		Worker:      worker.NewOrderProcessor(facade, 10*time.Millisecond, 1, 1, logger),
+		Archiver:    newTestOrderArchiver(),
+		Reconciler:  newTestBalanceReconciler(),
+		Config:      &config.Config{ShutdownTimeout: time.Second},
+	})
+
+	// cmd/gophermart starts the app with a context the first signal cancels.
+	signalCtx, signal := context.WithCancel(context.Background())
+	hook := recorder.Hooks[0]
+	if err := hook.OnStart(signalCtx); err != nil {
+		t.Fatalf("on start failed: %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected the order to be picked up")
+	}
+	signal()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = hook.OnStop(context.Background())
+	}()
+	close(proceed)
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected on stop to finish")
+	}
+
+	facade.Lock()
+	updates, releases := len(facade.Updates), len(facade.Releases)
+	facade.Unlock()
+	if updates != 1 || releases != 0 {
+		t.Fatalf("expected the in-flight order to complete, got %d updates and %d releases", updates, releases)
+	}
+}
+
 func TestRegisterLifecycleShutdownOnServerError(t *testing.T) {
 	recorder := &testhelpers.LifecycleRecorder{}
 	shutdowner := &testhelpers.ShutdownerStub{Called: make(chan struct{}, 1)}
@@ -96,12 +200,15 @@ func TestRegisterLifecycleShutdownOnServerError(t *testing.T) {
 	worker := newTestOrderProcessor()
 
 	registerLifecycle(lifecycleParams{
-		Lifecycle:  recorder,
-		Shutdowner: shutdowner,
-		Logger:     logger,
-		Server:     server,
-		Worker:     worker,
-		Config:     &config.Config{ShutdownTimeout: time.Second},
+		Lifecycle:   recorder,
+		Shutdowner:  shutdowner,
+		Logger:      logger,
+		Server:      server,
+		Coordinator: newTestCoordinator(),
+		Worker:      worker,
+		Archiver:    newTestOrderArchiver(),
+		Reconciler:  newTestBalanceReconciler(),
+		Config:      &config.Config{ShutdownTimeout: time.Second},
 	})
 
 	hook := recorder.Hooks[0]
@@ -120,7 +227,7 @@ func TestRegisterLifecycleShutdownOnServerError(t *testing.T) {
 
 func TestWorkerFacadeStubRecording(t *testing.T) {
 	facade := &testhelpers.WorkerFacadeStub{}
-	if err := facade.UpdateOrderStatus(context.Background(), 1, model.OrderStatusProcessed, nil); err != nil {
+	if _, err := facade.UpdateOrderStatus(context.Background(), 1, model.OrderStatusProcessed, nil); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if len(facade.Updates) != 1 {
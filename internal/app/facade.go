@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
@@ -16,11 +17,13 @@ type LoyaltyFacade struct {
 	auth     *usecase.AuthUseCase
 	orders   *usecase.OrderUseCase
 	balance  *usecase.BalanceUseCase
+	accounts *usecase.AccountUseCase
+	audit    *usecase.AuditUseCase
 	accruals AccrualProvider
 }
 
-func NewLoyaltyFacade(auth *usecase.AuthUseCase, orders *usecase.OrderUseCase, balance *usecase.BalanceUseCase, accruals AccrualProvider) *LoyaltyFacade {
-	return &LoyaltyFacade{auth: auth, orders: orders, balance: balance, accruals: accruals}
+func NewLoyaltyFacade(auth *usecase.AuthUseCase, orders *usecase.OrderUseCase, balance *usecase.BalanceUseCase, accounts *usecase.AccountUseCase, audit *usecase.AuditUseCase, accruals AccrualProvider) *LoyaltyFacade {
+	return &LoyaltyFacade{auth: auth, orders: orders, balance: balance, accounts: accounts, audit: audit, accruals: accruals}
 }
 
 func (f *LoyaltyFacade) Register(ctx context.Context, login, password string) (string, error) {
@@ -37,22 +40,78 @@ func (f *LoyaltyFacade) ParseToken(token string) (int64, error) {
 	return f.auth.ParseToken(token)
 }
 
+func (f *LoyaltyFacade) TokenRejected(ctx context.Context, reason string) {
+	f.auth.TokenRejected(ctx, reason)
+}
+
+func (f *LoyaltyFacade) AccountActive(ctx context.Context, userID int64) (bool, error) {
+	return f.auth.Active(ctx, userID)
+}
+
+func (f *LoyaltyFacade) ExportAccount(ctx context.Context, userID int64) (*model.AccountExport, error) {
+	return f.accounts.Export(ctx, userID)
+}
+
+func (f *LoyaltyFacade) DeleteAccount(ctx context.Context, userID int64) error {
+	return f.accounts.Delete(ctx, userID)
+}
+
 func (f *LoyaltyFacade) UploadOrder(ctx context.Context, userID int64, number string) (*model.Order, bool, error) {
 	return f.orders.Register(ctx, userID, number)
 }
 
+func (f *LoyaltyFacade) UploadOrders(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+	return f.orders.RegisterBatch(ctx, userID, numbers)
+}
+
 func (f *LoyaltyFacade) Orders(ctx context.Context, userID int64) ([]model.Order, error) {
 	return f.orders.ListByUser(ctx, userID)
 }
 
-func (f *LoyaltyFacade) OrdersForProcessing(ctx context.Context, limit int) ([]model.Order, error) {
-	return f.orders.SelectBatchForProcessing(ctx, limit)
+func (f *LoyaltyFacade) FindOrders(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, *model.Cursor, error) {
+	return f.orders.Find(ctx, userID, filter, page)
+}
+
+func (f *LoyaltyFacade) OrdersForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
+	return f.orders.SelectBatchForProcessing(ctx, claim)
+}
+
+func (f *LoyaltyFacade) OrderBacklog(ctx context.Context, shard model.Shard) (int64, error) {
+	return f.orders.Backlog(ctx, shard)
+}
+
+func (f *LoyaltyFacade) ReleaseOrder(ctx context.Context, orderID int64, owner string) error {
+	return f.orders.Release(ctx, orderID, owner)
+}
+
+func (f *LoyaltyFacade) RescheduleOrder(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	return f.orders.Reschedule(ctx, orderID, owner, delay, lastErr)
+}
+
+func (f *LoyaltyFacade) RecordOrderFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	return f.orders.RecordFailure(ctx, orderID, owner, delay, lastErr)
+}
+
+func (f *LoyaltyFacade) DeadLetterOrder(ctx context.Context, orderID int64, owner string, lastErr string) error {
+	return f.orders.DeadLetter(ctx, orderID, owner, lastErr)
+}
+
+func (f *LoyaltyFacade) DeadLetteredOrders(ctx context.Context, page model.Page) ([]model.Order, *model.Cursor, error) {
+	return f.orders.DeadLettered(ctx, page)
 }
 
-func (f *LoyaltyFacade) UpdateOrderStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *float64) error {
+func (f *LoyaltyFacade) RequeueOrder(ctx context.Context, number string) (*model.Order, error) {
+	return f.orders.Requeue(ctx, number)
+}
+
+func (f *LoyaltyFacade) UpdateOrderStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusUpdate, error) {
 	return f.orders.UpdateStatus(ctx, orderID, status, accrual)
 }
 
+func (f *LoyaltyFacade) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return f.orders.Archive(ctx, before, limit)
+}
+
 func (f *LoyaltyFacade) Balance(ctx context.Context, userID int64) (*model.BalanceSummary, error) {
 	summary, err := f.balance.Summary(ctx, userID)
 	if err != nil {
@@ -64,14 +123,34 @@ func (f *LoyaltyFacade) Balance(ctx context.Context, userID int64) (*model.Balan
 	return summary, nil
 }
 
-func (f *LoyaltyFacade) Withdraw(ctx context.Context, userID int64, order string, sum float64) error {
-	return f.balance.Withdraw(ctx, userID, order, sum)
+func (f *LoyaltyFacade) Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+	return f.balance.Withdraw(ctx, req)
+}
+
+func (f *LoyaltyFacade) BalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	return f.balance.History(ctx, userID)
 }
 
 func (f *LoyaltyFacade) Withdrawals(ctx context.Context, userID int64) ([]model.Withdrawal, error) {
 	return f.balance.WithdrawalsHistory(ctx, userID)
 }
 
+func (f *LoyaltyFacade) WithdrawalsPage(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, *model.Cursor, error) {
+	return f.balance.WithdrawalsPage(ctx, userID, page)
+}
+
+func (f *LoyaltyFacade) ReconcileBalances(ctx context.Context, repair bool, reason string) (*model.ReconcileReport, error) {
+	return f.balance.Reconcile(ctx, repair, reason)
+}
+
+func (f *LoyaltyFacade) AuditEvents(ctx context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, *model.Cursor, error) {
+	return f.audit.Find(ctx, filter, page)
+}
+
+func (f *LoyaltyFacade) VerifyAudit(ctx context.Context) (*model.AuditVerification, error) {
+	return f.audit.Verify(ctx)
+}
+
 func (f *LoyaltyFacade) CheckAccrual(ctx context.Context, number string) (*model.Accrual, error) {
 	return f.accruals.Fetch(ctx, number)
 }
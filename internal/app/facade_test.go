@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
@@ -12,20 +13,23 @@ import (
 )
 
 func newFacade() (*LoyaltyFacade, *testhelpers.UserRepositoryStub, *testhelpers.OrderRepositoryStub, *testhelpers.BalanceRepositoryStub, *testhelpers.WithdrawalRepositoryStub, *testhelpers.AccrualProviderStub) {
+	audit := newTestAudit()
 	userRepo := testhelpers.NewUserRepositoryStub()
 	strategy := testhelpers.StrategyStub{ParseFn: func(string) (int64, error) { return 99, nil }}
-	authUC := usecase.NewAuthUseCase(userRepo, testhelpers.HasherStub{}, strategy)
+	authUC := usecase.NewAuthUseCase(userRepo, testhelpers.HasherStub{}, strategy, audit)
 
 	orderRepo := &testhelpers.OrderRepositoryStub{}
-	orderUC := usecase.NewOrderUseCase(orderRepo)
+	orderUC := usecase.NewOrderUseCase(orderRepo, audit)
 
 	balanceRepo := &testhelpers.BalanceRepositoryStub{Summary: &model.BalanceSummary{Current: 10, Withdrawn: 5}}
 	withdrawals := &testhelpers.WithdrawalRepositoryStub{Items: []model.Withdrawal{{OrderNumber: "123", Sum: 7}}}
-	balanceUC := usecase.NewBalanceUseCase(balanceRepo, withdrawals)
+	balanceUC := usecase.NewBalanceUseCase(balanceRepo, withdrawals, audit)
+
+	accountUC := usecase.NewAccountUseCase(userRepo, orderRepo, balanceRepo, withdrawals, &testhelpers.TxManagerStub{}, audit)
 
 	accrual := &testhelpers.AccrualProviderStub{}
 
-	facade := NewLoyaltyFacade(authUC, orderUC, balanceUC, accrual)
+	facade := NewLoyaltyFacade(authUC, orderUC, balanceUC, accountUC, audit, accrual)
 	return facade, userRepo, orderRepo, balanceRepo, withdrawals, accrual
 }
 
@@ -77,23 +81,68 @@ func TestLoyaltyFacadeOrders(t *testing.T) {
 		t.Fatalf("unexpected upload result: order=%v created=%v err=%v", order, created, err)
 	}
 
+	uploads, err := facade.UploadOrders(context.Background(), 7, []string{"79927398713", "1"})
+	if err != nil || len(uploads) != 2 || uploads[0].Result != model.OrderUploadAccepted || uploads[1].Result != model.OrderUploadInvalid {
+		t.Fatalf("unexpected batch upload result: %+v err=%v", uploads, err)
+	}
+
 	listed, err := facade.Orders(context.Background(), 7)
 	if err != nil || len(listed) != 2 {
 		t.Fatalf("expected two orders, got %v err=%v", listed, err)
 	}
 
-	batch, err := facade.OrdersForProcessing(context.Background(), 1)
+	paged, next, err := facade.FindOrders(context.Background(), 7, model.OrderFilter{}, model.Page{Limit: 1})
+	if err != nil || len(paged) != 1 || next == nil {
+		t.Fatalf("expected page of one with next cursor, got %v next=%v err=%v", paged, next, err)
+	}
+
+	batch, err := facade.OrdersForProcessing(context.Background(), model.OrderClaim{Owner: "a", Limit: 1})
 	if err != nil || len(batch) != 1 {
 		t.Fatalf("expected batch of one, got %v err=%v", batch, err)
 	}
+	if backlog, err := facade.OrderBacklog(context.Background(), model.Shard{}); err != nil || backlog != 1 {
+		t.Fatalf("expected backlog of one, got %d err=%v", backlog, err)
+	}
 
-	accr := 12.0
-	if err := facade.UpdateOrderStatus(context.Background(), 1, model.OrderStatusProcessed, &accr); err != nil {
+	accr := model.MustParseMoney("12")
+	if _, err := facade.UpdateOrderStatus(context.Background(), 1, model.OrderStatusProcessed, &accr); err != nil {
 		t.Fatalf("update status error: %v", err)
 	}
 	if len(orders.UpdateCalls) != 1 {
 		t.Fatalf("expected update call, got %d", len(orders.UpdateCalls))
 	}
+
+	if err := facade.RescheduleOrder(context.Background(), 1, "a", time.Second, "boom"); err != nil {
+		t.Fatalf("reschedule error: %v", err)
+	}
+	if len(orders.RescheduleCalls) != 1 || orders.RescheduleCalls[0].LastError != "boom" {
+		t.Fatalf("expected reschedule call, got %+v", orders.RescheduleCalls)
+	}
+
+	if err := facade.RecordOrderFailure(context.Background(), 1, "a", 2*time.Second, "boom"); err != nil {
+		t.Fatalf("record failure error: %v", err)
+	}
+	if err := facade.DeadLetterOrder(context.Background(), 1, "a", "boom"); err != nil {
+		t.Fatalf("dead-letter error: %v", err)
+	}
+	if len(orders.FailureCalls) != 1 || orders.FailureCalls[0].Delay != 2*time.Second || len(orders.DeadLetterCalls) != 1 {
+		t.Fatalf("expected failure and dead-letter calls, got %+v %+v", orders.FailureCalls, orders.DeadLetterCalls)
+	}
+
+	orders.DeadLettered = []model.Order{{ID: 9, Number: "9"}}
+	if parked, _, err := facade.DeadLetteredOrders(context.Background(), model.Page{}); err != nil || len(parked) != 1 {
+		t.Fatalf("expected one dead-lettered order, got %v err=%v", parked, err)
+	}
+	if requeued, err := facade.RequeueOrder(context.Background(), "9"); err != nil || requeued.ID != 9 {
+		t.Fatalf("expected requeued order, got %+v err=%v", requeued, err)
+	}
+
+	orders.ArchiveFn = func(_ context.Context, _ time.Time, limit int) (int64, error) {
+		return int64(limit), nil
+	}
+	if archived, err := facade.ArchiveOrders(context.Background(), time.Now(), 3); err != nil || archived != 3 {
+		t.Fatalf("expected three archived orders, got %d err=%v", archived, err)
+	}
 }
 
 func TestLoyaltyFacadeBalance(t *testing.T) {
@@ -117,11 +166,12 @@ func TestLoyaltyFacadeBalance(t *testing.T) {
 	}
 
 	balances.WithdrawErr = domainErrors.ErrInsufficientBalance
-	if err := facade.Withdraw(context.Background(), 1, "79927398713", 5); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
+	req := model.WithdrawalRequest{UserID: 1, OrderNumber: "79927398713", Sum: 5}
+	if _, _, err := facade.Withdraw(context.Background(), req); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
 		t.Fatalf("expected insufficient balance error, got %v", err)
 	}
 	balances.WithdrawErr = nil
-	if err := facade.Withdraw(context.Background(), 1, "79927398713", 5); err != nil {
+	if _, created, err := facade.Withdraw(context.Background(), req); err != nil || !created {
 		t.Fatalf("expected successful withdraw, got %v", err)
 	}
 
@@ -129,6 +179,23 @@ func TestLoyaltyFacadeBalance(t *testing.T) {
 	if err != nil || len(list) != len(withdrawals.Items) {
 		t.Fatalf("unexpected withdrawals result: %v err=%v", list, err)
 	}
+
+	page, next, err := facade.WithdrawalsPage(context.Background(), 1, model.Page{Limit: 10})
+	if err != nil || len(page) != len(withdrawals.Items) || next != nil {
+		t.Fatalf("unexpected withdrawals page: %v next=%v err=%v", page, next, err)
+	}
+
+	balances.Entries = []model.LedgerEntry{{Kind: model.LedgerEntryWithdrawal, Amount: -5}}
+	entries, err := facade.BalanceHistory(context.Background(), 1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected history result: %v err=%v", entries, err)
+	}
+
+	balances.Drifts = []model.BalanceDrift{{UserID: 1, Expected: model.BalanceSummary{Current: 3}}}
+	report, err := facade.ReconcileBalances(context.Background(), true, "test")
+	if err != nil || len(report.Drifts) != 1 || len(report.Repairs) != 1 {
+		t.Fatalf("unexpected reconcile report: %+v err=%v", report, err)
+	}
 }
 
 func TestLoyaltyFacadeAccrual(t *testing.T) {
@@ -142,3 +209,57 @@ func TestLoyaltyFacadeAccrual(t *testing.T) {
 		t.Fatalf("unexpected accrual %v", result)
 	}
 }
+
+func TestLoyaltyFacadeAudit(t *testing.T) {
+	facade, _, _, _, _, _ := newFacade()
+	ctx := model.WithRequestMeta(context.Background(), model.RequestMeta{IP: "10.0.0.1"})
+	if _, err := facade.Register(ctx, "user", "pass"); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+	facade.TokenRejected(ctx, "invalid token")
+
+	events, next, err := facade.AuditEvents(context.Background(), model.AuditFilter{}, model.Page{Limit: 10})
+	if err != nil || next != nil || len(events) != 2 {
+		t.Fatalf("expected two audit events, got %+v err=%v", events, err)
+	}
+	if events[0].Action != model.AuditTokenRejected || events[1].Action != model.AuditUserRegistered || events[0].IP != "10.0.0.1" {
+		t.Fatalf("unexpected audit events %+v", events)
+	}
+
+	result, err := facade.VerifyAudit(context.Background())
+	if err != nil || !result.Valid || result.Checked != 2 {
+		t.Fatalf("expected intact chain, got %+v err=%v", result, err)
+	}
+}
+
+func TestLoyaltyFacadeAccount(t *testing.T) {
+	facade, users, _, _, withdrawals, _ := newFacade()
+	ctx := context.Background()
+	if _, err := facade.Register(ctx, "user", "pass"); err != nil {
+		t.Fatalf("register returned error: %v", err)
+	}
+
+	export, err := facade.ExportAccount(ctx, 1)
+	if err != nil || export.User.Login != "user" || export.User.PasswordHash != "" || len(export.Withdrawals) != 1 || export.Balance.Current != 10 {
+		t.Fatalf("unexpected export %+v err=%v", export, err)
+	}
+	if active, err := facade.AccountActive(ctx, 1); err != nil || !active {
+		t.Fatalf("expected open account, got %v err=%v", active, err)
+	}
+
+	if err := facade.DeleteAccount(ctx, 1); err != nil {
+		t.Fatalf("delete returned error: %v", err)
+	}
+	if active, err := facade.AccountActive(ctx, 1); err != nil || active {
+		t.Fatalf("expected closed account, got %v err=%v", active, err)
+	}
+	if _, err := users.GetByLogin(ctx, "user"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected login anonymized, got %v", err)
+	}
+	if len(withdrawals.Pseudonymized) != 1 {
+		t.Fatalf("expected withdrawals pseudonymized, got %v", withdrawals.Pseudonymized)
+	}
+	if _, err := facade.ExportAccount(ctx, 1); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected closed account export to fail, got %v", err)
+	}
+}
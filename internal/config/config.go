@@ -4,8 +4,10 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,14 +15,54 @@ import (
 type Config struct {
 	RunAddress           string
 	DatabaseURI          string
+	DatabaseReplicaURI   string
+	ReplicaMaxLag        time.Duration
 	AccrualSystemAddress string
+	AccrualRPS           int
+	BreakerFailures      int
+	BreakerSuccesses     int
+	BreakerCoolDown      time.Duration
 	JWTSecret            string
 	OrderPollInterval    time.Duration
 	WorkerPoolSize       int
+	WorkerPoolMin        int
+	WorkerPoolMax        int
+	WorkerScaleInterval  time.Duration
+	WorkerScaleLatency   time.Duration
 	ShutdownTimeout      time.Duration
 	MaxOrdersBatch       int
+	AutoMigrate          bool
+	InstanceID           string
+	OrderLeaseDuration   time.Duration
+	OrderRetryBaseDelay  time.Duration
+	OrderRetryMaxDelay   time.Duration
+	OrderMaxFailures     int
+	OrderMaxFailingAge   time.Duration
+	EventWebhookURLs     []string
+	OutboxPollInterval   time.Duration
+	OutboxRetention      time.Duration
+	OrderArchiveAfter    time.Duration
+	OrderArchiveInterval time.Duration
+	ReconcileInterval    time.Duration
+	ReconcileRepair      bool
+	OrderBatchLimit      int
+	AdminToken           string
+	WorkerCoordination   string
+	WorkerHeartbeat      time.Duration
+	WorkerInstanceTTL    time.Duration
+	TrustedProxies       []string
 }
 
+// Worker coordination modes between replicas sharing a database.
+const (
+	// CoordinationNone lets every replica poll all orders.
+	CoordinationNone = "none"
+	// CoordinationLeader lets only the elected replica poll.
+	CoordinationLeader = "leader"
+	// CoordinationSharded splits orders between the live replicas.
+	CoordinationSharded = "sharded"
+)
+
 const (
 	defaultRunAddress        = ":8080"
 	defaultJWTSecret         = "change-me-in-production"
@@ -28,6 +70,25 @@ const (
 	defaultWorkerPoolSize    = 4
 	defaultShutdownTimeout   = 10 * time.Second
 	defaultMaxOrdersBatch    = 32
+	defaultOrderLease        = time.Minute
+	defaultReplicaMaxLag     = 5 * time.Second
+	defaultOutboxPoll        = time.Second
+	defaultOutboxRetention   = 24 * time.Hour
+	defaultOrderArchiveAfter = 90 * 24 * time.Hour
+	defaultArchiveInterval   = time.Hour
+	defaultReconcileInterval = time.Hour
+	defaultOrderBatchLimit   = 1000
+	defaultOrderRetryBase    = 3 * time.Second
+	defaultOrderRetryMax     = 10 * time.Minute
+	defaultOrderMaxFailures  = 20
+	defaultOrderMaxFailing   = 24 * time.Hour
+	defaultBreakerFailures   = 5
+	defaultBreakerSuccesses  = 1
+	defaultBreakerCoolDown   = 30 * time.Second
+	defaultScaleInterval     = 10 * time.Second
+	defaultScaleLatency      = 2 * time.Second
+	defaultWorkerHeartbeat   = 5 * time.Second
+	defaultInstanceTTLBeats  = 3
 )
 
 // Load parses configuration from flags and environment variables.
@@ -41,12 +102,40 @@ func load(args []string, lookup envLookup) (*Config, error) {
 	cfg := &Config{
 		RunAddress:           getString(lookup, "RUN_ADDRESS", defaultRunAddress),
 		DatabaseURI:          getString(lookup, "DATABASE_URI", ""),
+		DatabaseReplicaURI:   getString(lookup, "DATABASE_REPLICA_URI", ""),
+		ReplicaMaxLag:        getDuration(lookup, "DATABASE_REPLICA_MAX_LAG", defaultReplicaMaxLag),
 		AccrualSystemAddress: getString(lookup, "ACCRUAL_SYSTEM_ADDRESS", ""),
+		AccrualRPS:           getInt(lookup, "ACCRUAL_RPS", 0),
+		BreakerFailures:      getInt(lookup, "ACCRUAL_BREAKER_FAILURES", defaultBreakerFailures),
+		BreakerSuccesses:     getInt(lookup, "ACCRUAL_BREAKER_SUCCESSES", defaultBreakerSuccesses),
+		BreakerCoolDown:      getDuration(lookup, "ACCRUAL_BREAKER_COOL_DOWN", defaultBreakerCoolDown),
 		JWTSecret:            getString(lookup, "JWT_SECRET", defaultJWTSecret),
 		OrderPollInterval:    getDuration(lookup, "ORDER_POLL_INTERVAL", defaultOrderPollInterval),
 		WorkerPoolSize:       getInt(lookup, "WORKER_POOL_SIZE", defaultWorkerPoolSize),
+		WorkerPoolMin:        getInt(lookup, "WORKER_POOL_MIN", 0),
+		WorkerPoolMax:        getInt(lookup, "WORKER_POOL_MAX", 0),
+		WorkerScaleInterval:  getDuration(lookup, "WORKER_SCALE_INTERVAL", defaultScaleInterval),
+		WorkerScaleLatency:   getDuration(lookup, "WORKER_SCALE_MAX_LATENCY", defaultScaleLatency),
 		ShutdownTimeout:      getDuration(lookup, "SHUTDOWN_TIMEOUT", defaultShutdownTimeout),
 		MaxOrdersBatch:       getInt(lookup, "POLL_BATCH_SIZE", defaultMaxOrdersBatch),
+		AutoMigrate:          getBool(lookup, "DATABASE_AUTO_MIGRATE", false),
+		InstanceID:           getString(lookup, "INSTANCE_ID", defaultInstanceID()),
+		OrderLeaseDuration:   getDuration(lookup, "ORDER_LEASE_DURATION", defaultOrderLease),
+		OrderRetryBaseDelay:  getDuration(lookup, "ORDER_RETRY_BASE_DELAY", defaultOrderRetryBase),
+		OrderRetryMaxDelay:   getDuration(lookup, "ORDER_RETRY_MAX_DELAY", defaultOrderRetryMax),
+		OrderMaxFailures:     getInt(lookup, "ORDER_MAX_FAILURES", defaultOrderMaxFailures),
+		OrderMaxFailingAge:   getDuration(lookup, "ORDER_MAX_FAILING_AGE", defaultOrderMaxFailing),
+		OutboxPollInterval:   getDuration(lookup, "OUTBOX_POLL_INTERVAL", defaultOutboxPoll),
+		OutboxRetention:      getDuration(lookup, "OUTBOX_RETENTION", defaultOutboxRetention),
+		OrderArchiveAfter:    getDuration(lookup, "ORDER_ARCHIVE_AFTER", defaultOrderArchiveAfter),
+		OrderArchiveInterval: getDuration(lookup, "ORDER_ARCHIVE_INTERVAL", defaultArchiveInterval),
+		ReconcileInterval:    getDuration(lookup, "RECONCILE_INTERVAL", defaultReconcileInterval),
+		ReconcileRepair:      getBool(lookup, "RECONCILE_REPAIR", false),
+		OrderBatchLimit:      getInt(lookup, "ORDER_BATCH_LIMIT", defaultOrderBatchLimit),
+		AdminToken:           getString(lookup, "ADMIN_TOKEN", ""),
+		WorkerCoordination:   getString(lookup, "WORKER_COORDINATION", CoordinationNone),
+		WorkerHeartbeat:      getDuration(lookup, "WORKER_HEARTBEAT_INTERVAL", defaultWorkerHeartbeat),
+		WorkerInstanceTTL:    getDuration(lookup, "WORKER_INSTANCE_TTL", defaultInstanceTTLBeats*defaultWorkerHeartbeat),
 	}
 
 	fs := flag.NewFlagSet("gophermart", flag.ContinueOnError)
@@ -55,16 +144,63 @@ func load(args []string, lookup envLookup) (*Config, error) {
 	var (
 		pollIntervalStr    = cfg.OrderPollInterval.String()
 		shutdownTimeoutStr = cfg.ShutdownTimeout.String()
+		orderLeaseStr      = cfg.OrderLeaseDuration.String()
+		retryBaseStr       = cfg.OrderRetryBaseDelay.String()
+		retryMaxStr        = cfg.OrderRetryMaxDelay.String()
+		maxFailingAgeStr   = cfg.OrderMaxFailingAge.String()
+		breakerCoolDownStr = cfg.BreakerCoolDown.String()
+		replicaMaxLagStr   = cfg.ReplicaMaxLag.String()
+		outboxPollStr      = cfg.OutboxPollInterval.String()
+		outboxRetentionStr = cfg.OutboxRetention.String()
+		archiveAfterStr    = cfg.OrderArchiveAfter.String()
+		archiveIntervalStr = cfg.OrderArchiveInterval.String()
+		reconcileStr       = cfg.ReconcileInterval.String()
+		heartbeatStr       = cfg.WorkerHeartbeat.String()
+		scaleIntervalStr   = cfg.WorkerScaleInterval.String()
+		scaleLatencyStr    = cfg.WorkerScaleLatency.String()
+		instanceTTLStr     = cfg.WorkerInstanceTTL.String()
+		eventWebhooks      = getString(lookup, "EVENT_WEBHOOK_URLS", "")
+		trustedProxies     = getString(lookup, "TRUSTED_PROXIES", "")
 	)
 
 	fs.StringVar(&cfg.RunAddress, "a", cfg.RunAddress, "HTTP server listen address")
-	fs.StringVar(&cfg.DatabaseURI, "d", cfg.DatabaseURI, "PostgreSQL DSN")
+	fs.StringVar(&cfg.DatabaseURI, "d", cfg.DatabaseURI, "PostgreSQL DSN or memory:// for in-memory storage")
+	fs.StringVar(&cfg.DatabaseReplicaURI, "replica-uri", cfg.DatabaseReplicaURI, "PostgreSQL DSN of a read replica for read-only queries")
+	fs.StringVar(&replicaMaxLagStr, "replica-max-lag", replicaMaxLagStr, "Replication lag past which reads fall back to the primary")
 	fs.StringVar(&cfg.AccrualSystemAddress, "r", cfg.AccrualSystemAddress, "Accrual system base URL")
+	fs.IntVar(&cfg.AccrualRPS, "accrual-rps", cfg.AccrualRPS, "Maximum accrual requests per second; 0 leaves them unpaced")
+	fs.IntVar(&cfg.BreakerFailures, "accrual-breaker-failures", cfg.BreakerFailures, "Consecutive accrual outages that open the circuit")
+	fs.IntVar(&cfg.BreakerSuccesses, "accrual-breaker-successes", cfg.BreakerSuccesses, "Successful probes that close the accrual circuit")
+	fs.StringVar(&breakerCoolDownStr, "accrual-breaker-cool-down", breakerCoolDownStr, "How long the accrual circuit stays open before probing")
 	fs.StringVar(&cfg.JWTSecret, "jwt-secret", cfg.JWTSecret, "Secret for signing auth tokens")
 	fs.IntVar(&cfg.WorkerPoolSize, "worker-pool", cfg.WorkerPoolSize, "Number of concurrent order workers")
+	fs.IntVar(&cfg.WorkerPoolMin, "worker-pool-min", cfg.WorkerPoolMin, "Fewest order workers the pool shrinks to; 0 uses the pool size")
+	fs.IntVar(&cfg.WorkerPoolMax, "worker-pool-max", cfg.WorkerPoolMax, "Most order workers the pool grows to; 0 uses the pool size")
+	fs.StringVar(&scaleIntervalStr, "worker-scale-interval", scaleIntervalStr, "Interval between order worker pool resizes")
+	fs.StringVar(&scaleLatencyStr, "worker-scale-max-latency", scaleLatencyStr, "Mean accrual call time above which the worker pool shrinks")
 	fs.StringVar(&pollIntervalStr, "poll-interval", pollIntervalStr, "Interval between accrual polls")
 	fs.StringVar(&shutdownTimeoutStr, "shutdown-timeout", shutdownTimeoutStr, "Graceful shutdown timeout")
 	fs.IntVar(&cfg.MaxOrdersBatch, "poll-batch", cfg.MaxOrdersBatch, "Maximum orders per polling batch")
+	fs.BoolVar(&cfg.AutoMigrate, "auto-migrate", cfg.AutoMigrate, "Apply pending database migrations on startup")
+	fs.StringVar(&cfg.InstanceID, "instance-id", cfg.InstanceID, "Identity recorded on orders claimed by this instance")
+	fs.StringVar(&orderLeaseStr, "order-lease", orderLeaseStr, "How long a claimed order stays reserved")
+	fs.StringVar(&retryBaseStr, "order-retry-base", retryBaseStr, "Delay after the first failed accrual attempt of an order")
+	fs.StringVar(&retryMaxStr, "order-retry-max", retryMaxStr, "Upper bound of the exponential retry delay")
+	fs.IntVar(&cfg.OrderMaxFailures, "order-max-failures", cfg.OrderMaxFailures, "Failed attempts before an order needs attention; 0 retries forever")
+	fs.StringVar(&maxFailingAgeStr, "order-max-failing-age", maxFailingAgeStr, "How long an order may keep failing before it needs attention; 0 retries forever")
+	fs.StringVar(&eventWebhooks, "event-webhooks", eventWebhooks, "Comma-separated URLs receiving domain events")
+	fs.StringVar(&outboxPollStr, "outbox-poll-interval", outboxPollStr, "Interval between outbox deliveries")
+	fs.StringVar(&outboxRetentionStr, "outbox-retention", outboxRetentionStr, "How long delivered events are kept")
+	fs.StringVar(&archiveAfterStr, "order-archive-after", archiveAfterStr, "How long final orders stay active before archival")
+	fs.StringVar(&archiveIntervalStr, "order-archive-interval", archiveIntervalStr, "Interval between order archival runs")
+	fs.StringVar(&reconcileStr, "reconcile-interval", reconcileStr, "Interval between balance reconciliation runs")
+	fs.BoolVar(&cfg.ReconcileRepair, "reconcile-repair", cfg.ReconcileRepair, "Repair balance drift found by reconciliation runs")
+	fs.IntVar(&cfg.OrderBatchLimit, "order-batch-limit", cfg.OrderBatchLimit, "Maximum order numbers accepted by one batch upload")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "Token guarding the admin API; empty disables it")
+	fs.StringVar(&cfg.WorkerCoordination, "worker-coordination", cfg.WorkerCoordination, "How replicas share order polling: none, leader or sharded")
+	fs.StringVar(&heartbeatStr, "worker-heartbeat", heartbeatStr, "Interval between worker coordination heartbeats")
+	fs.StringVar(&instanceTTLStr, "worker-instance-ttl", instanceTTLStr, "How long a silent replica keeps its order shard")
+	fs.StringVar(&trustedProxies, "trusted-proxies", trustedProxies, "Comma-separated proxy IPs or CIDRs trusted to forward the client address")
 
 	if err := fs.Parse(args); err != nil {
 		return nil, fmt.Errorf("parse flags: %w", err)
@@ -80,6 +216,84 @@ func load(args []string, lookup envLookup) (*Config, error) {
 		return nil, fmt.Errorf("invalid shutdown timeout: %w", err)
 	}
 
+	if cfg.OrderLeaseDuration, err = time.ParseDuration(orderLeaseStr); err != nil {
+		return nil, fmt.Errorf("invalid order lease: %w", err)
+	}
+
+	if cfg.OrderRetryBaseDelay, err = time.ParseDuration(retryBaseStr); err != nil {
+		return nil, fmt.Errorf("invalid order retry base delay: %w", err)
+	}
+
+	if cfg.OrderRetryMaxDelay, err = time.ParseDuration(retryMaxStr); err != nil {
+		return nil, fmt.Errorf("invalid order retry max delay: %w", err)
+	}
+
+	if cfg.OrderMaxFailingAge, err = time.ParseDuration(maxFailingAgeStr); err != nil {
+		return nil, fmt.Errorf("invalid order max failing age: %w", err)
+	}
+
+	if cfg.BreakerCoolDown, err = time.ParseDuration(breakerCoolDownStr); err != nil {
+		return nil, fmt.Errorf("invalid accrual breaker cool-down: %w", err)
+	}
+
+	if cfg.ReplicaMaxLag, err = time.ParseDuration(replicaMaxLagStr); err != nil {
+		return nil, fmt.Errorf("invalid replica max lag: %w", err)
+	}
+
+	if cfg.OutboxPollInterval, err = time.ParseDuration(outboxPollStr); err != nil {
+		return nil, fmt.Errorf("invalid outbox poll interval: %w", err)
+	}
+
+	if cfg.OutboxRetention, err = time.ParseDuration(outboxRetentionStr); err != nil {
+		return nil, fmt.Errorf("invalid outbox retention: %w", err)
+	}
+
+	if cfg.OrderArchiveAfter, err = time.ParseDuration(archiveAfterStr); err != nil {
+		return nil, fmt.Errorf("invalid order archive age: %w", err)
+	}
+
+	if cfg.OrderArchiveInterval, err = time.ParseDuration(archiveIntervalStr); err != nil {
+		return nil, fmt.Errorf("invalid order archive interval: %w", err)
+	}
+
+	if cfg.ReconcileInterval, err = time.ParseDuration(reconcileStr); err != nil {
+		return nil, fmt.Errorf("invalid reconcile interval: %w", err)
+	}
+
+	if cfg.WorkerHeartbeat, err = time.ParseDuration(heartbeatStr); err != nil {
+		return nil, fmt.Errorf("invalid worker heartbeat interval: %w", err)
+	}
+
+	if cfg.WorkerScaleInterval, err = time.ParseDuration(scaleIntervalStr); err != nil {
+		return nil, fmt.Errorf("invalid worker scale interval: %w", err)
+	}
+
+	if cfg.WorkerScaleLatency, err = time.ParseDuration(scaleLatencyStr); err != nil {
+		return nil, fmt.Errorf("invalid worker scale max latency: %w", err)
+	}
+
+	if cfg.WorkerInstanceTTL, err = time.ParseDuration(instanceTTLStr); err != nil {
+		return nil, fmt.Errorf("invalid worker instance ttl: %w", err)
+	}
+
+	for _, endpoint := range strings.Split(eventWebhooks, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			cfg.EventWebhookURLs = append(cfg.EventWebhookURLs, endpoint)
+		}
+	}
+
+	for _, proxy := range strings.Split(trustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+	}
+
 	if secretFile, ok := lookup("JWT_SECRET_FILE"); ok && secretFile != "" {
 		content, err := os.ReadFile(secretFile)
 		if err != nil {
@@ -92,6 +306,33 @@ func load(args []string, lookup envLookup) (*Config, error) {
 		cfg.WorkerPoolSize = defaultWorkerPoolSize
 	}
 
+	// Without bounds the pool keeps its size; a lone bound moves the other
+	// no further than the pool size.
+	if cfg.WorkerPoolMin <= 0 {
+		cfg.WorkerPoolMin = cfg.WorkerPoolSize
+		if cfg.WorkerPoolMax > 0 {
+			cfg.WorkerPoolMin = min(cfg.WorkerPoolMin, cfg.WorkerPoolMax)
+		}
+	}
+
+	if cfg.WorkerPoolMax <= 0 {
+		cfg.WorkerPoolMax = max(cfg.WorkerPoolSize, cfg.WorkerPoolMin)
+	}
+
+	if cfg.WorkerPoolMax < cfg.WorkerPoolMin {
+		cfg.WorkerPoolMax = cfg.WorkerPoolMin
+	}
+
+	cfg.WorkerPoolSize = min(max(cfg.WorkerPoolSize, cfg.WorkerPoolMin), cfg.WorkerPoolMax)
+
+	if cfg.WorkerScaleInterval <= 0 {
+		cfg.WorkerScaleInterval = defaultScaleInterval
+	}
+
+	if cfg.WorkerScaleLatency <= 0 {
+		cfg.WorkerScaleLatency = defaultScaleLatency
+	}
+
 	if cfg.MaxOrdersBatch <= 0 {
 		cfg.MaxOrdersBatch = defaultMaxOrdersBatch
 	}
@@ -104,6 +345,88 @@ func load(args []string, lookup envLookup) (*Config, error) {
 		cfg.ShutdownTimeout = defaultShutdownTimeout
 	}
 
+	if cfg.OrderLeaseDuration <= 0 {
+		cfg.OrderLeaseDuration = defaultOrderLease
+	}
+
+	if cfg.OrderRetryBaseDelay <= 0 {
+		cfg.OrderRetryBaseDelay = defaultOrderRetryBase
+	}
+
+	if cfg.OrderRetryMaxDelay < cfg.OrderRetryBaseDelay {
+		cfg.OrderRetryMaxDelay = max(defaultOrderRetryMax, cfg.OrderRetryBaseDelay)
+	}
+
+	if cfg.OrderMaxFailures < 0 {
+		cfg.OrderMaxFailures = 0
+	}
+
+	if cfg.OrderMaxFailingAge < 0 {
+		cfg.OrderMaxFailingAge = 0
+	}
+
+	if cfg.ReplicaMaxLag <= 0 {
+		cfg.ReplicaMaxLag = defaultReplicaMaxLag
+	}
+
+	if cfg.OutboxPollInterval <= 0 {
+		cfg.OutboxPollInterval = defaultOutboxPoll
+	}
+
+	if cfg.OutboxRetention <= 0 {
+		cfg.OutboxRetention = defaultOutboxRetention
+	}
+
+	if cfg.OrderArchiveAfter <= 0 {
+		cfg.OrderArchiveAfter = defaultOrderArchiveAfter
+	}
+
+	if cfg.OrderArchiveInterval <= 0 {
+		cfg.OrderArchiveInterval = defaultArchiveInterval
+	}
+
+	if cfg.ReconcileInterval <= 0 {
+		cfg.ReconcileInterval = defaultReconcileInterval
+	}
+
+	if cfg.OrderBatchLimit <= 0 {
+		cfg.OrderBatchLimit = defaultOrderBatchLimit
+	}
+
+	if cfg.AccrualRPS < 0 {
+		cfg.AccrualRPS = 0
+	}
+
+	if cfg.BreakerFailures <= 0 {
+		cfg.BreakerFailures = defaultBreakerFailures
+	}
+
+	if cfg.BreakerSuccesses <= 0 {
+		cfg.BreakerSuccesses = defaultBreakerSuccesses
+	}
+
+	if cfg.BreakerCoolDown <= 0 {
+		cfg.BreakerCoolDown = defaultBreakerCoolDown
+	}
+
+	if cfg.WorkerHeartbeat <= 0 {
+		cfg.WorkerHeartbeat = defaultWorkerHeartbeat
+	}
+
+	if cfg.WorkerInstanceTTL <= cfg.WorkerHeartbeat {
+		cfg.WorkerInstanceTTL = defaultInstanceTTLBeats * cfg.WorkerHeartbeat
+	}
+
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = defaultInstanceID()
+	}
+
+	switch cfg.WorkerCoordination {
+	case CoordinationNone, CoordinationLeader, CoordinationSharded:
+	default:
+		return nil, fmt.Errorf("invalid worker coordination %q", cfg.WorkerCoordination)
+	}
+
 	if cfg.DatabaseURI == "" {
 		return nil, fmt.Errorf("database URI must be provided")
 	}
@@ -115,6 +438,15 @@ func load(args []string, lookup envLookup) (*Config, error) {
 	return cfg, nil
 }
 
+// defaultInstanceID identifies the process by host name and PID.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "gophermart"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func getString(lookup envLookup, key, def string) string {
 	if v, ok := lookup(key); ok && v != "" {
 		return v
@@ -131,6 +463,15 @@ func getInt(lookup envLookup, key string, def int) int {
 	return def
 }
 
+func getBool(lookup envLookup, key string, def bool) bool {
+	if v, ok := lookup(key); ok && v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
 func getDuration(lookup envLookup, key string, def time.Duration) time.Duration {
 	if v, ok := lookup(key); ok && v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
@@ -4,11 +4,15 @@ import (
 	"github.com/polkiloo/gophermart/internal/adapter/accrual"
 	"github.com/polkiloo/gophermart/internal/app"
 	"github.com/polkiloo/gophermart/internal/config"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
 	"github.com/polkiloo/gophermart/internal/logger"
+	"github.com/polkiloo/gophermart/internal/outbox"
 	"github.com/polkiloo/gophermart/internal/pkg/auth"
+	"github.com/polkiloo/gophermart/internal/server/http/handlers"
 	"github.com/polkiloo/gophermart/internal/server/http/router"
-	"github.com/polkiloo/gophermart/internal/storage/postgres"
+	"github.com/polkiloo/gophermart/internal/storage"
 	"github.com/polkiloo/gophermart/internal/usecase"
+	"github.com/polkiloo/gophermart/internal/worker"
 	"go.uber.org/fx"
 )
 
@@ -17,12 +21,28 @@ func Module(opts ...fx.Option) fx.Option {
 		config.Module,
 		logger.Module,
 		auth.Module,
-		postgres.Module,
+		storage.Module,
 		accrual.Module,
 		usecase.Module,
 		fx.Provide(func(client accrual.Client) app.AccrualProvider { return client }),
+		fx.Provide(
+			fx.Annotate(
+				func(f repository.Factory) handlers.HealthChecker { return storage.DatabaseHealth{Factory: f} },
+				fx.ResultTags(`group:"health"`),
+			),
+			fx.Annotate(
+				func(b *accrual.Breaker) handlers.HealthChecker { return b },
+				fx.ResultTags(`group:"health"`),
+			),
+			fx.Annotate(
+				func(p *worker.OrderProcessor) handlers.HealthChecker { return p },
+				fx.ResultTags(`group:"health"`),
+			),
+		),
+		fx.Provide(func(p *worker.OrderProcessor) handlers.ProcessorControl { return p }),
 		router.Module,
 		app.Module,
+		outbox.Module,
 	}
 	modules = append(modules, opts...)
 	return fx.Options(modules...)
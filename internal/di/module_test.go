@@ -2,17 +2,22 @@ package di
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
+
 	"github.com/polkiloo/gophermart/internal/adapter/accrual"
 	"github.com/polkiloo/gophermart/internal/app"
 	"github.com/polkiloo/gophermart/internal/config"
 	"github.com/polkiloo/gophermart/internal/domain/model"
 	"github.com/polkiloo/gophermart/internal/domain/repository"
-	"github.com/polkiloo/gophermart/internal/storage/postgres"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
 	"github.com/polkiloo/gophermart/internal/test"
 	"go.uber.org/fx"
 )
@@ -38,11 +43,11 @@ func TestModuleComposesGraphWithReplacements(t *testing.T) {
 	var facade *app.LoyaltyFacade
 	fxApp := fx.New(
 		fx.NopLogger,
-		fx.Supply(context.Background()),
+		fx.Provide(func() context.Context { return context.Background() }),
 		Module(
 			fx.Replace(cfg),
 			fx.Replace(logger),
-			fx.Replace(&postgres.Storage{}),
+			fx.Replace(fx.Annotate(memory.New(), fx.As(new(repository.Factory)))),
 			fx.Replace(repository.UserRepository(userRepo)),
 			fx.Replace(repository.OrderRepository(orderRepo)),
 			fx.Replace(repository.BalanceRepository(balanceRepo)),
@@ -60,3 +65,56 @@ func TestModuleComposesGraphWithReplacements(t *testing.T) {
 		t.Fatal("expected loyalty facade instance")
 	}
 }
+
+func TestModuleRunsOnInMemoryStorage(t *testing.T) {
+	cfg := &config.Config{
+		RunAddress:           ":0",
+		DatabaseURI:          memory.Scheme,
+		AccrualSystemAddress: "http://localhost",
+		JWTSecret:            "secret",
+		OrderPollInterval:    time.Millisecond,
+		WorkerPoolSize:       1,
+		ShutdownTimeout:      time.Millisecond,
+		MaxOrdersBatch:       1,
+	}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	var (
+		facade  *app.LoyaltyFacade
+		factory repository.Factory
+		engine  *gin.Engine
+	)
+	fxApp := fx.New(
+		fx.NopLogger,
+		fx.Provide(func() context.Context { return context.Background() }),
+		Module(
+			fx.Replace(cfg),
+			fx.Replace(logger),
+		),
+		fx.Populate(&facade, &factory, &engine),
+	)
+
+	if err := fxApp.Err(); err != nil {
+		t.Fatalf("fx app returned error: %v", err)
+	}
+	if _, ok := factory.(*memory.Storage); !ok {
+		t.Fatalf("expected in-memory factory, got %T", factory)
+	}
+
+	token, err := facade.Register(context.Background(), "user", "password")
+	if err != nil || token == "" {
+		t.Fatalf("register failed: token=%q err=%v", token, err)
+	}
+	if _, err := facade.Register(context.Background(), "user", "password"); err == nil {
+		t.Fatal("expected duplicate login to be rejected")
+	}
+
+	resp := httptest.NewRecorder()
+	engine.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	var health struct {
+		Components []struct{ Name string } `json:"components"`
+	}
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &health) != nil || len(health.Components) != 3 {
+		t.Fatalf("expected database, accrual and order processor health, got %d %s", resp.Code, resp.Body.String())
+	}
+}
@@ -9,4 +9,11 @@ var (
 	ErrInsufficientBalance = errors.New("insufficient balance")
 	ErrInvalidOrderNumber  = errors.New("invalid order number")
 	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrIdempotencyConflict = errors.New("idempotency conflict")
+	ErrLeaseLost           = errors.New("lease lost")
+	// ErrConcurrentUpdate reports that a concurrent transaction committed a
+	// conflicting write first; retrying the whole unit of work resolves it.
+	ErrConcurrentUpdate = errors.New("concurrent update")
+
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
 )
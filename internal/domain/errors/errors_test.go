@@ -16,6 +16,10 @@ func TestSentinelErrors(t *testing.T) {
 		{"insufficient balance", ErrInsufficientBalance},
 		{"invalid order", ErrInvalidOrderNumber},
 		{"invalid amount", ErrInvalidAmount},
+		{"idempotency conflict", ErrIdempotencyConflict},
+		{"lease lost", ErrLeaseLost},
+		{"concurrent update", ErrConcurrentUpdate},
+		{"invalid status transition", ErrInvalidStatusTransition},
 	}
 
 	for _, tc := range cases {
@@ -14,5 +14,5 @@ const (
 type Accrual struct {
 	Order   string
 	Status  AccrualStatus
-	Accrual *float64
+	Accrual *Money
 }
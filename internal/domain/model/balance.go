@@ -2,6 +2,6 @@ package model
 
 // BalanceSummary aggregates current and withdrawn loyalty points.
 type BalanceSummary struct {
-	Current   float64
-	Withdrawn float64
+	Current   Money
+	Withdrawn Money
 }
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventType names a domain event published through the outbox.
+type EventType string
+
+const (
+	// EventOrderStatusChanged is emitted when an order moves to a new status.
+	EventOrderStatusChanged EventType = "order.status_changed"
+	// EventPointsAccrued is emitted when a processed order credits the balance.
+	EventPointsAccrued EventType = "points.accrued"
+	// EventPointsWithdrawn is emitted when points are spent on an order.
+	EventPointsWithdrawn EventType = "points.withdrawn"
+	// EventAccountDeleted is emitted when a user closes the account, so
+	// consumers can erase their copies of the user's personal data.
+	EventAccountDeleted EventType = "account.deleted"
+)
+
+// EventPayload is a typed domain event body.
+type EventPayload interface {
+	EventType() EventType
+}
+
+// OrderStatusChanged reports an applied order status transition.
+type OrderStatusChanged struct {
+	OrderID int64       `json:"order_id"`
+	Number  string      `json:"number"`
+	From    OrderStatus `json:"from"`
+	To      OrderStatus `json:"to"`
+	Accrual *Money      `json:"accrual,omitempty"`
+}
+
+// EventType implements EventPayload.
+func (OrderStatusChanged) EventType() EventType { return EventOrderStatusChanged }
+
+// PointsAccrued reports points credited for a processed order.
+type PointsAccrued struct {
+	OrderID      int64  `json:"order_id"`
+	OrderNumber  string `json:"order_number"`
+	Amount       Money  `json:"amount"`
+	BalanceAfter Money  `json:"balance_after"`
+}
+
+// EventType implements EventPayload.
+func (PointsAccrued) EventType() EventType { return EventPointsAccrued }
+
+// PointsWithdrawn reports points spent on an order.
+type PointsWithdrawn struct {
+	WithdrawalID int64  `json:"withdrawal_id"`
+	OrderNumber  string `json:"order_number"`
+	Sum          Money  `json:"sum"`
+	BalanceAfter Money  `json:"balance_after"`
+}
+
+// EventType implements EventPayload.
+func (PointsWithdrawn) EventType() EventType { return EventPointsWithdrawn }
+
+// AccountDeleted reports a closed and anonymized account.
+type AccountDeleted struct {
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// EventType implements EventPayload.
+func (AccountDeleted) EventType() EventType { return EventAccountDeleted }
+
+// Event is an outbox record: a serialized payload owned by a user. Events of
+// the same user are delivered in ID order.
+type Event struct {
+	ID        int64
+	UserID    int64
+	Type      EventType
+	Payload   json.RawMessage
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// NewEvent serializes payload into an outbox record for userID.
+func NewEvent(userID int64, payload EventPayload) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("encode %s event: %w", payload.EventType(), err)
+	}
+	return Event{UserID: userID, Type: payload.EventType(), Payload: data}, nil
+}
+
+// Decode restores the typed payload.
+func (e Event) Decode() (EventPayload, error) {
+	var payload EventPayload
+	switch e.Type {
+	case EventOrderStatusChanged:
+		payload = &OrderStatusChanged{}
+	case EventPointsAccrued:
+		payload = &PointsAccrued{}
+	case EventPointsWithdrawn:
+		payload = &PointsWithdrawn{}
+	case EventAccountDeleted:
+		payload = &AccountDeleted{}
+	default:
+		return nil, fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if err := json.Unmarshal(e.Payload, payload); err != nil {
+		return nil, fmt.Errorf("decode %s event: %w", e.Type, err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,20 @@
+package model
+
+// HealthStatus grades how well a component works.
+type HealthStatus string
+
+const (
+	HealthUp       HealthStatus = "up"
+	HealthDegraded HealthStatus = "degraded"
+	HealthDown     HealthStatus = "down"
+)
+
+// ComponentHealth describes the state of one dependency of the service.
+type ComponentHealth struct {
+	Name   string
+	Status HealthStatus
+	State  string
+	Detail string
+	// Metrics carries gauges worth charting, keyed by name.
+	Metrics map[string]int64
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// LedgerEntryKind describes the reason of a balance posting.
+type LedgerEntryKind string
+
+const (
+	// LedgerEntryAccrual credits points for a processed order.
+	LedgerEntryAccrual LedgerEntryKind = "ACCRUAL"
+	// LedgerEntryWithdrawal debits points spent on an order.
+	LedgerEntryWithdrawal LedgerEntryKind = "WITHDRAWAL"
+	// LedgerEntryAdjustment posts the difference applied by a balance repair.
+	LedgerEntryAdjustment LedgerEntryKind = "ADJUSTMENT"
+)
+
+// LedgerEntry is an append-only balance posting tied to its source.
+type LedgerEntry struct {
+	ID           int64
+	UserID       int64
+	Kind         LedgerEntryKind
+	Amount       Money
+	BalanceAfter Money
+	OrderNumber  string
+	OrderID      *int64
+	WithdrawalID *int64
+	AdjustmentID *int64
+	CreatedAt    time.Time
+}
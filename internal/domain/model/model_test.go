@@ -1,6 +1,13 @@
 package model
 
-import "testing"
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+)
 
 func TestOrderStatusValues(t *testing.T) {
 	cases := []struct {
@@ -23,6 +30,34 @@ func TestOrderStatusValues(t *testing.T) {
 	}
 }
 
+func TestOrderStatusTransition(t *testing.T) {
+	cases := []struct {
+		from, to OrderStatus
+		want     StatusUpdate
+		err      error
+	}{
+		{OrderStatusNew, OrderStatusProcessing, StatusUpdateApplied, nil},
+		{OrderStatusNew, OrderStatusProcessed, StatusUpdateApplied, nil},
+		{OrderStatusProcessing, OrderStatusInvalid, StatusUpdateApplied, nil},
+		{OrderStatusProcessing, OrderStatusProcessing, StatusUpdateNoop, nil},
+		{OrderStatusProcessed, OrderStatusProcessed, StatusUpdateAlreadyFinal, nil},
+		{OrderStatusInvalid, OrderStatusProcessed, StatusUpdateAlreadyFinal, nil},
+		{OrderStatusProcessing, OrderStatusNew, StatusUpdateUnknown, domainErrors.ErrInvalidStatusTransition},
+		{OrderStatusNew, OrderStatus("BOGUS"), StatusUpdateUnknown, domainErrors.ErrInvalidStatusTransition},
+	}
+
+	for _, tc := range cases {
+		got, err := tc.from.Transition(tc.to)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Fatalf("%s -> %s: got %v err=%v, want %v err=%v", tc.from, tc.to, got, err, tc.want, tc.err)
+		}
+	}
+
+	if StatusUpdateAlreadyFinal.String() != "already_final" || StatusUpdateUnknown.String() != "unknown" || StatusUpdate(42).String() != "unknown" {
+		t.Fatal("unexpected status update names")
+	}
+}
+
 func TestAccrualStatusValues(t *testing.T) {
 	cases := []struct {
 		status AccrualStatus
@@ -40,3 +75,286 @@ func TestAccrualStatusValues(t *testing.T) {
 		}
 	}
 }
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in    string
+		minor int64
+		ok    bool
+	}{
+		{"500", 50000, true},
+		{"500.5", 50050, true},
+		{"0.01", 1, true},
+		{"-1.25", -125, true},
+		{" 729.98 ", 72998, true},
+		{"1e2", 10000, true},
+		{"0.001", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := ParseMoney(tc.in)
+			if tc.ok != (err == nil) {
+				t.Fatalf("unexpected error state: %v", err)
+			}
+			if tc.ok && got.Minor() != tc.minor {
+				t.Fatalf("expected %d, got %d", tc.minor, got.Minor())
+			}
+		})
+	}
+}
+
+func TestRoundMoney(t *testing.T) {
+	cases := []struct {
+		in    string
+		minor int64
+	}{
+		{"12.34", 1234},
+		{"12.344", 1234},
+		{"12.346", 1235},
+		{"12.345", 1234},
+		{"12.355", 1236},
+		{"12.3450001", 1235},
+		{"-12.345", -1234},
+		{"-12.355", -1236},
+		{"-0.006", -1},
+		{"0.004", 0},
+	}
+	for _, tc := range cases {
+		got, err := RoundMoney(tc.in)
+		if err != nil || got.Minor() != tc.minor {
+			t.Fatalf("%s: expected %d, got %d err=%v", tc.in, tc.minor, got.Minor(), err)
+		}
+	}
+	for _, in := range []string{"", "abc", "1e30"} {
+		if _, err := RoundMoney(in); !errors.Is(err, ErrInvalidMoney) {
+			t.Fatalf("%q: expected invalid money error, got %v", in, err)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	cases := map[Money]string{
+		MoneyFromMinor(0):      "0",
+		MoneyFromMinor(50000):  "500",
+		MoneyFromMinor(50050):  "500.5",
+		MoneyFromMinor(72998):  "729.98",
+		MoneyFromMinor(-5):     "-0.05",
+		MoneyFromMinor(-12345): "-123.45",
+	}
+	for m, want := range cases {
+		if got := m.String(); got != want {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Sum Money `json:"sum"`
+	}{Sum: MustParseMoney("0.1")})
+	if err != nil || string(data) != `{"sum":0.1}` {
+		t.Fatalf("unexpected encoding %s err=%v", data, err)
+	}
+
+	var decoded struct {
+		Sum *Money `json:"sum"`
+	}
+	if err := json.Unmarshal([]byte(`{"sum":0.3}`), &decoded); err != nil || decoded.Sum == nil || *decoded.Sum != MoneyFromMinor(30) {
+		t.Fatalf("unexpected decoding %v err=%v", decoded.Sum, err)
+	}
+	if err := json.Unmarshal([]byte(`{"sum":"0.3"}`), &decoded); err == nil {
+		t.Fatal("expected error for quoted amount")
+	}
+	if err := json.Unmarshal([]byte(`{"sum":0.333}`), &decoded); !errors.Is(err, ErrInvalidMoney) {
+		t.Fatalf("expected invalid money error, got %v", err)
+	}
+}
+
+func TestMoneyScanAndValue(t *testing.T) {
+	var m Money
+	for src, want := range map[any]Money{
+		"12.34":            MoneyFromMinor(1234),
+		int64(7):           MoneyFromMinor(700),
+		float64(0.1 + 0.2): MoneyFromMinor(30),
+	} {
+		if err := m.Scan(src); err != nil || m != want {
+			t.Fatalf("scan %v: got %v err=%v", src, m, err)
+		}
+	}
+	if err := m.Scan([]byte("1.5")); err != nil || m != MoneyFromMinor(150) {
+		t.Fatalf("scan bytes: got %v err=%v", m, err)
+	}
+	if err := m.Scan(nil); err != nil || m != 0 {
+		t.Fatalf("scan nil: got %v err=%v", m, err)
+	}
+	if err := m.Scan(true); err == nil {
+		t.Fatal("expected error for unsupported source")
+	}
+
+	v, err := MoneyFromMinor(1050).Value()
+	if err != nil || v != "10.5" {
+		t.Fatalf("unexpected value %v err=%v", v, err)
+	}
+}
+
+func TestOrderFilterCursorFor(t *testing.T) {
+	accrual := MustParseMoney("7")
+	order := Order{ID: 5, Accrual: &accrual, UploadedAt: time.Unix(100, 0)}
+
+	byTime := OrderFilter{}.CursorFor(order)
+	if !byTime.Time.Equal(order.UploadedAt) || byTime.Amount != 0 || byTime.ID != 5 {
+		t.Fatalf("unexpected time cursor %+v", byTime)
+	}
+	byAmount := OrderFilter{SortBy: OrderSortAccrual}.CursorFor(order)
+	if !byAmount.Time.IsZero() || byAmount.Amount != accrual || byAmount.ID != 5 || byAmount.Ordering != "accrual.desc" {
+		t.Fatalf("unexpected accrual cursor %+v", byAmount)
+	}
+	if (OrderFilter{SortBy: OrderSortAccrual}).CursorFor(Order{ID: 1}).Amount != 0 {
+		t.Fatal("expected zero amount for order without accrual")
+	}
+
+	if err := (OrderFilter{}).CheckCursor(byTime); err != nil || byTime.Ordering != "" {
+		t.Fatalf("expected the default order to accept its own cursor, got %q err=%v", byTime.Ordering, err)
+	}
+	if err := (OrderFilter{Ascending: true}).CheckCursor(byTime); !errors.Is(err, ErrCursorMismatch) {
+		t.Fatalf("expected a direction change to be rejected, got %v", err)
+	}
+	if err := (OrderFilter{}).CheckCursor(byAmount); !errors.Is(err, ErrCursorMismatch) {
+		t.Fatalf("expected a sort field change to be rejected, got %v", err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := Cursor{Time: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC), ID: 42}
+	parsed, err := ParseCursor(cursor.String())
+	if err != nil || !parsed.Time.Equal(cursor.Time) || parsed.ID != cursor.ID {
+		t.Fatalf("unexpected round trip %+v err=%v", parsed, err)
+	}
+
+	if !cursor.Follows(cursor.Time, 41) || cursor.Follows(cursor.Time, 43) || !cursor.Follows(cursor.Time.Add(-time.Second), 100) {
+		t.Fatal("unexpected keyset ordering")
+	}
+
+	amount := Cursor{Amount: MustParseMoney("12.5"), ID: 3, Ordering: "accrual.asc"}
+	parsed, err = ParseCursor(amount.String())
+	if err != nil || !parsed.Time.IsZero() || parsed.Amount != amount.Amount || parsed.ID != 3 || parsed.Ordering != "accrual.asc" {
+		t.Fatalf("unexpected amount round trip %+v err=%v", parsed, err)
+	}
+
+	for _, token := range []string{"", "!!", "bm9jb2xvbg", "YWJjOjE", "MTphYmM", "MTow", "MTowOjA", "MDowOjE6", "MDowOjE6YTpi"} {
+		if _, err := ParseCursor(token); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected invalid cursor for %q, got %v", token, err)
+		}
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	accrual := MustParseMoney("12.5")
+	payloads := []EventPayload{
+		OrderStatusChanged{OrderID: 1, Number: "79927398713", From: OrderStatusProcessing, To: OrderStatusProcessed, Accrual: &accrual},
+		PointsAccrued{OrderID: 1, OrderNumber: "79927398713", Amount: accrual, BalanceAfter: accrual},
+		PointsWithdrawn{WithdrawalID: 2, OrderNumber: "2377225624", Sum: accrual, BalanceAfter: 0},
+		AccountDeleted{DeletedAt: time.Unix(100, 0).UTC()},
+	}
+	for _, payload := range payloads {
+		event, err := NewEvent(7, payload)
+		if err != nil || event.UserID != 7 || event.Type != payload.EventType() {
+			t.Fatalf("unexpected event %+v err=%v", event, err)
+		}
+		decoded, err := event.Decode()
+		if err != nil {
+			t.Fatalf("decode %s: %v", event.Type, err)
+		}
+		if decoded.EventType() != payload.EventType() {
+			t.Fatalf("expected %s, got %s", payload.EventType(), decoded.EventType())
+		}
+	}
+
+	event, _ := NewEvent(7, payloads[1])
+	if string(event.Payload) != `{"order_id":1,"order_number":"79927398713","amount":12.5,"balance_after":12.5}` {
+		t.Fatalf("unexpected payload %s", event.Payload)
+	}
+
+	if _, err := (Event{Type: "unknown", Payload: []byte("{}")}).Decode(); err == nil {
+		t.Fatal("expected unknown type error")
+	}
+	if _, err := (Event{Type: EventPointsAccrued, Payload: []byte("[")}).Decode(); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestAuditEventChain(t *testing.T) {
+	first := AuditEvent{ID: 1, Action: AuditUserRegistered, Actor: AuditUserActor(7), UserID: 7, Payload: json.RawMessage(`{}`), CreatedAt: time.Unix(10, 0)}
+	first.Link(AuditGenesisHash)
+	second := AuditEvent{ID: 2, Action: AuditLoginSucceeded, Actor: AuditUserActor(7), UserID: 7, Payload: json.RawMessage(`{}`), CreatedAt: time.Unix(20, 0)}
+	second.Link(first.Hash)
+
+	if first.Actor != "user:7" || len(first.Hash) != 64 {
+		t.Fatalf("unexpected sealed event %+v", first)
+	}
+	if !VerifyAuditLink(AuditGenesisHash, first) || !VerifyAuditLink(first.Hash, second) {
+		t.Fatal("expected intact links")
+	}
+	if VerifyAuditLink(AuditGenesisHash, second) {
+		t.Fatal("expected link to the wrong predecessor to fail")
+	}
+	tampered := second
+	tampered.UserID = 8
+	if VerifyAuditLink(first.Hash, tampered) {
+		t.Fatal("expected tampered event to fail verification")
+	}
+	local := second
+	local.CreatedAt = second.CreatedAt.In(time.FixedZone("UTC+3", 3*3600))
+	if local.ComputeHash() != second.Hash {
+		t.Fatal("expected hash independent of time zone")
+	}
+}
+
+func TestAuditFilterMatches(t *testing.T) {
+	event := AuditEvent{UserID: 1, Action: AuditOrderUploaded, CreatedAt: time.Unix(100, 0)}
+	cases := []struct {
+		filter AuditFilter
+		want   bool
+	}{
+		{AuditFilter{}, true},
+		{AuditFilter{UserID: 1, Action: AuditOrderUploaded}, true},
+		{AuditFilter{UserID: 2}, false},
+		{AuditFilter{Action: AuditLoginFailed}, false},
+		{AuditFilter{From: time.Unix(100, 0), To: time.Unix(101, 0)}, true},
+		{AuditFilter{From: time.Unix(101, 0)}, false},
+		{AuditFilter{To: time.Unix(100, 0)}, false},
+	}
+	for i, tt := range cases {
+		if got := tt.filter.Matches(event); got != tt.want {
+			t.Fatalf("case %d: expected %v, got %v", i, tt.want, got)
+		}
+	}
+}
+
+func TestShardOwnsEachOrderOnce(t *testing.T) {
+	const count = 3
+	owned := make([]int, count)
+	for id := int64(1); id <= 300; id++ {
+		owners := 0
+		for index := 0; index < count; index++ {
+			if (Shard{Index: index, Count: count}).Owns(id) {
+				owners++
+				owned[index]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("order %d owned by %d shards", id, owners)
+		}
+		if !(Shard{}).Owns(id) {
+			t.Fatalf("expected unsharded claim to own order %d", id)
+		}
+	}
+	for index, n := range owned {
+		if n < 80 {
+			t.Fatalf("shard %d owns only %d of 300 orders", index, n)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package model
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// moneyScale is the number of minor units in one loyalty point.
+const moneyScale = 100
+
+// ErrInvalidMoney reports amounts that can't be represented exactly.
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// Money is an exact amount of loyalty points kept in hundredths.
+type Money int64
+
+// MoneyFromMinor builds Money from hundredths of a point.
+func MoneyFromMinor(minor int64) Money {
+	return Money(minor)
+}
+
+// ParseMoney parses decimal notation with at most two fractional digits.
+func ParseMoney(s string) (Money, error) {
+	return parseMoney(s, false)
+}
+
+// RoundMoney parses decimal notation like ParseMoney, rounding finer amounts
+// half to even to hundredths. It is meant for amounts computed elsewhere,
+// such as accruals; amounts entered by users go through ParseMoney.
+func RoundMoney(s string) (Money, error) {
+	return parseMoney(s, true)
+}
+
+func parseMoney(s string, round bool) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidMoney
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	r.Mul(r, big.NewRat(moneyScale, 1))
+	minor := new(big.Int).Set(r.Num())
+	if !r.IsInt() {
+		if !round {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+		}
+		minor = roundHalfEven(r)
+	}
+	if !minor.IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	return Money(minor.Int64()), nil
+}
+
+// roundHalfEven rounds r to the nearest integer, ties to the even one.
+func roundHalfEven(r *big.Rat) *big.Int {
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// Twice the remainder against the denominator tells below, at or past half.
+	switch rem.Abs(rem).Lsh(rem, 1).Cmp(r.Denom()) {
+	case 1:
+	case 0:
+		if quo.Bit(0) == 0 {
+			return quo
+		}
+	default:
+		return quo
+	}
+	if r.Sign() < 0 {
+		return quo.Sub(quo, big.NewInt(1))
+	}
+	return quo.Add(quo, big.NewInt(1))
+}
+
+// MustParseMoney is ParseMoney that panics on malformed input.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Minor returns the amount in hundredths of a point.
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// String renders the amount without insignificant trailing zeros.
+func (m Money) String() string {
+	minor := int64(m)
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+	}
+	abs := uint64(minor)
+	if minor < 0 {
+		abs = uint64(-(minor + 1)) + 1
+	}
+	units, frac := abs/moneyScale, abs%moneyScale
+	if frac == 0 {
+		return sign + strconv.FormatUint(units, 10)
+	}
+	fraction := strings.TrimRight(fmt.Sprintf("%02d", frac), "0")
+	return sign + strconv.FormatUint(units, 10) + "." + fraction
+}
+
+// MarshalJSON encodes amount as a plain JSON number.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number without going through float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return fmt.Errorf("%w: expected number", ErrInvalidMoney)
+	}
+	parsed, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case []byte:
+		return m.Scan(string(v))
+	case int64:
+		*m = Money(v * moneyScale)
+		return nil
+	case float64:
+		*m = Money(math.Round(v * moneyScale))
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported source %T", ErrInvalidMoney, src)
+	}
+}
+
+// Value implements driver.Valuer using exact decimal text.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+)
 
 // OrderStatus describes processing lifecycle.
 type OrderStatus string
@@ -12,13 +16,98 @@ const (
 	OrderStatusProcessed  OrderStatus = "PROCESSED"
 )
 
+// IsFinal reports whether the order can no longer change status.
+func (s OrderStatus) IsFinal() bool {
+	return s == OrderStatusInvalid || s == OrderStatusProcessed
+}
+
+// StatusUpdate classifies the outcome of an order status update.
+type StatusUpdate int
+
+const (
+	// StatusUpdateUnknown accompanies an error: nothing is known to have changed.
+	StatusUpdateUnknown StatusUpdate = iota
+	// StatusUpdateApplied means the order moved to the new status.
+	StatusUpdateApplied
+	// StatusUpdateNoop means the order already had the requested status.
+	StatusUpdateNoop
+	// StatusUpdateAlreadyFinal means the order is final and was left alone.
+	StatusUpdateAlreadyFinal
+)
+
+func (u StatusUpdate) String() string {
+	switch u {
+	case StatusUpdateApplied:
+		return "applied"
+	case StatusUpdateNoop:
+		return "noop"
+	case StatusUpdateAlreadyFinal:
+		return "already_final"
+	default:
+		return "unknown"
+	}
+}
+
+// StatusChange reports the outcome of a status update together with the
+// owner and number of the order it concerned.
+type StatusChange struct {
+	Update StatusUpdate
+	UserID int64
+	Number string
+}
+
+// Transition validates moving an order from s to next. Final orders never
+// change again and repeating the current status is a no-op.
+func (s OrderStatus) Transition(next OrderStatus) (StatusUpdate, error) {
+	if s.IsFinal() {
+		return StatusUpdateAlreadyFinal, nil
+	}
+	if s == next {
+		return StatusUpdateNoop, nil
+	}
+	switch {
+	case s == OrderStatusNew && next == OrderStatusProcessing,
+		(s == OrderStatusNew || s == OrderStatusProcessing) && next.IsFinal():
+		return StatusUpdateApplied, nil
+	}
+	return StatusUpdateUnknown, domainErrors.ErrInvalidStatusTransition
+}
+
 // Order describes purchase order registered by user.
 type Order struct {
 	ID         int64
 	UserID     int64
 	Number     string
 	Status     OrderStatus
-	Accrual    *float64
+	Accrual    *Money
 	UploadedAt time.Time
 	UpdatedAt  time.Time
+
+	ClaimedBy     string
+	LeaseUntil    *time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+
+	// Failures counts failed accrual attempts since upload or the last
+	// requeue; FailingSince is when the first of them happened.
+	Failures     int
+	FailingSince *time.Time
+	// DeadLetteredAt is set once retries are exhausted. Such orders need
+	// attention and are not processed until requeued.
+	DeadLetteredAt *time.Time
+}
+
+// NeedsAttention reports whether processing gave up on the order.
+func (o Order) NeedsAttention() bool {
+	return o.DeadLetteredAt != nil
+}
+
+// OrderClaim describes a worker's request to lease due orders for processing.
+type OrderClaim struct {
+	Owner string
+	Limit int
+	Lease time.Duration
+	// Shard restricts the claim to the orders this instance owns.
+	Shard Shard
 }
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// OrderSortField selects the column orders are listed by.
+type OrderSortField string
+
+const (
+	OrderSortUploadedAt OrderSortField = "uploaded_at"
+	OrderSortAccrual    OrderSortField = "accrual"
+)
+
+// OrderFilter narrows and orders a user's order listing. The zero value lists
+// every active order newest first.
+type OrderFilter struct {
+	Statuses        []OrderStatus
+	From            *time.Time // inclusive lower bound on UploadedAt
+	To              *time.Time // exclusive upper bound on UploadedAt
+	NumberPrefix    string
+	SortBy          OrderSortField
+	Ascending       bool
+	IncludeArchived bool // also list orders moved to the archive
+}
+
+// SortField returns the effective sort field, defaulting to upload time.
+func (f OrderFilter) SortField() OrderSortField {
+	if f.SortBy == "" {
+		return OrderSortUploadedAt
+	}
+	return f.SortBy
+}
+
+// Ordering names the effective sort field and direction, as recorded in
+// cursors. The default newest-first order is the empty string.
+func (f OrderFilter) Ordering() string {
+	field := f.SortField()
+	if field == OrderSortUploadedAt && !f.Ascending {
+		return ""
+	}
+	if f.Ascending {
+		return string(field) + ".asc"
+	}
+	return string(field) + ".desc"
+}
+
+// CheckCursor rejects a cursor taken under a different ordering, which
+// would otherwise resume the listing at an unrelated position.
+func (f OrderFilter) CheckCursor(c Cursor) error {
+	if c.Ordering != f.Ordering() {
+		return ErrCursorMismatch
+	}
+	return nil
+}
+
+// CursorFor returns the keyset position of o under the filter's ordering.
+func (f OrderFilter) CursorFor(o Order) Cursor {
+	c := Cursor{ID: o.ID, Ordering: f.Ordering()}
+	if f.SortField() == OrderSortAccrual {
+		if o.Accrual != nil {
+			c.Amount = *o.Accrual
+		}
+		return c
+	}
+	c.Time = o.UploadedAt
+	return c
+}
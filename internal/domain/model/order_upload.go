@@ -0,0 +1,21 @@
+package model
+
+// OrderUploadResult is the outcome of uploading one order number.
+type OrderUploadResult string
+
+const (
+	// OrderUploadAccepted means the order was registered for processing.
+	OrderUploadAccepted OrderUploadResult = "accepted"
+	// OrderUploadAlreadyYours means the caller uploaded the number before.
+	OrderUploadAlreadyYours OrderUploadResult = "already_yours"
+	// OrderUploadOwnedByAnother means another user uploaded the number.
+	OrderUploadOwnedByAnother OrderUploadResult = "owned_by_another_user"
+	// OrderUploadInvalid means the number failed validation.
+	OrderUploadInvalid OrderUploadResult = "invalid"
+)
+
+// OrderUpload reports the outcome for one number of a batch upload.
+type OrderUpload struct {
+	Number string
+	Result OrderUploadResult
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCursor reports a malformed pagination cursor.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorMismatch reports a cursor taken under a different sort order.
+	ErrCursorMismatch = errors.New("cursor does not match the requested sort")
+)
+
+// Cursor is the keyset position of the last item on a page. Amount is set
+// instead of Time when the listing is sorted by an amount. Ordering names
+// the sort the position belongs to; it is empty for a listing's default sort.
+type Cursor struct {
+	Time     time.Time
+	Amount   Money
+	ID       int64
+	Ordering string
+}
+
+// Page requests up to Limit items following After; a nil After starts at the newest item.
+type Page struct {
+	Limit int
+	After *Cursor
+}
+
+// String encodes the cursor as an opaque URL-safe token.
+func (c Cursor) String() string {
+	var nanos int64
+	if !c.Time.IsZero() {
+		nanos = c.Time.UnixNano()
+	}
+	raw := fmt.Sprintf("%d:%d:%d", nanos, c.Amount.Minor(), c.ID)
+	if c.Ordering != "" {
+		raw += ":" + c.Ordering
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token produced by Cursor.String.
+func ParseCursor(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	var ordering string
+	switch len(parts) {
+	case 3:
+	case 4:
+		if ordering = parts[3]; ordering == "" {
+			return Cursor{}, ErrInvalidCursor
+		}
+		parts = parts[:3]
+	default:
+		return Cursor{}, ErrInvalidCursor
+	}
+	var values [3]int64
+	for i, part := range parts {
+		if values[i], err = strconv.ParseInt(part, 10, 64); err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+	}
+	if values[2] <= 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	c := Cursor{Amount: MoneyFromMinor(values[1]), ID: values[2], Ordering: ordering}
+	if values[0] != 0 {
+		c.Time = time.Unix(0, values[0]).UTC()
+	}
+	return c, nil
+}
+
+// Follows reports whether an item at (t, id) comes after the cursor in newest-first order.
+func (c Cursor) Follows(t time.Time, id int64) bool {
+	if !t.Equal(c.Time) {
+		return t.Before(c.Time)
+	}
+	return id < c.ID
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// ProcessorState is what the order processor is currently allowed to do.
+type ProcessorState string
+
+const (
+	// ProcessorRunning claims and processes orders.
+	ProcessorRunning ProcessorState = "running"
+	// ProcessorDraining finishes the orders it holds but claims no more.
+	ProcessorDraining ProcessorState = "draining"
+	// ProcessorPaused neither claims nor holds orders.
+	ProcessorPaused ProcessorState = "paused"
+	// ProcessorStopped has not been started or has been shut down.
+	ProcessorStopped ProcessorState = "stopped"
+)
+
+// ProcessorStatus is a snapshot of the order processor for operators.
+type ProcessorStatus struct {
+	State ProcessorState
+	// Workers is the current size of the worker pool.
+	Workers int
+	// QueueDepth counts claimed orders waiting for a worker.
+	QueueDepth int
+	// InFlight counts orders being worked on right now.
+	InFlight    int
+	LastPollAt  *time.Time
+	LastError   string
+	LastErrorAt *time.Time
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// BalanceDrift is a stored balance that disagrees with the processed order
+// accruals and withdrawals it is derived from, or with the sum of its ledger
+// postings.
+type BalanceDrift struct {
+	UserID   int64
+	Expected BalanceSummary
+	Actual   BalanceSummary
+	// Ledger is the sum of the user's ledger postings.
+	Ledger Money
+}
+
+// BalanceAdjustment records a reconciliation repair of a stored balance.
+type BalanceAdjustment struct {
+	ID        int64
+	UserID    int64
+	Before    BalanceSummary
+	After     BalanceSummary
+	Reason    string
+	CreatedAt time.Time
+}
+
+// ReconcileReport lists the drifts found by a reconciliation run and the
+// repairs it applied.
+type ReconcileReport struct {
+	Drifts  []BalanceDrift
+	Repairs []BalanceAdjustment
+}
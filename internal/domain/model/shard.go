@@ -0,0 +1,25 @@
+package model
+
+// shardModulus is the Lehmer generator modulus 2^31-1 used by ShardHash.
+const shardModulus = 2147483647
+
+// Shard selects the orders one of Count cooperating instances processes. A
+// Count of one or less selects every order.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// Owns reports whether the order with orderID falls into the shard.
+func (s Shard) Owns(orderID int64) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	return ShardHash(orderID)%int64(s.Count) == int64(s.Index)
+}
+
+// ShardHash scatters sequential order IDs evenly across shards. Storage
+// backends filtering in SQL must compute the same value.
+func ShardHash(orderID int64) int64 {
+	return (orderID % shardModulus) * 48271 % shardModulus
+}
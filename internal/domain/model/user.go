@@ -8,4 +8,21 @@ type User struct {
 	Login        string
 	PasswordHash string
 	CreatedAt    time.Time
+	// DeletedAt is set once the account is closed and its login anonymized.
+	DeletedAt *time.Time
+}
+
+// Deleted reports whether the account was closed.
+func (u User) Deleted() bool {
+	return u.DeletedAt != nil
+}
+
+// AccountExport is everything the service keeps about a user, as handed out
+// on a data subject access request.
+type AccountExport struct {
+	User        User
+	Balance     BalanceSummary
+	Orders      []Order
+	Withdrawals []Withdrawal
+	ExportedAt  time.Time
 }
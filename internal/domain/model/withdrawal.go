@@ -1,12 +1,33 @@
 package model
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
 
 // Withdrawal represents a loyalty points withdrawal transaction.
 type Withdrawal struct {
-	ID          int64
-	UserID      int64
-	OrderNumber string
-	Sum         float64
-	ProcessedAt time.Time
+	ID             int64
+	UserID         int64
+	OrderNumber    string
+	Sum            Money
+	IdempotencyKey string
+	Fingerprint    string
+	ProcessedAt    time.Time
+}
+
+// WithdrawalRequest describes a withdrawal attempt and its optional client key.
+type WithdrawalRequest struct {
+	UserID         int64
+	OrderNumber    string
+	Sum            Money
+	IdempotencyKey string
+}
+
+// Fingerprint identifies the request payload regardless of the idempotency key.
+func (r WithdrawalRequest) Fingerprint() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%d", r.UserID, r.OrderNumber, r.Sum.Minor())))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// AuditRepository stores the append-only, hash-chained audit log.
+type AuditRepository interface {
+	// Append links event after the current head of the chain and stores it.
+	// Called inside WithinTx the event commits or rolls back with the change
+	// it describes.
+	Append(ctx context.Context, event model.AuditEvent) (*model.AuditEvent, error)
+	// Find returns events matching filter, newest first.
+	Find(ctx context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, error)
+	// Chain returns up to limit events following afterID in chain order.
+	Chain(ctx context.Context, afterID int64, limit int) ([]model.AuditEvent, error)
+}
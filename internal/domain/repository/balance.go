@@ -9,6 +9,20 @@ import (
 // BalanceRepository manages user loyalty balance operations.
 type BalanceRepository interface {
 	GetSummary(ctx context.Context, userID int64) (*model.BalanceSummary, error)
-	AddAccrual(ctx context.Context, userID int64, sum float64) error
-	Withdraw(ctx context.Context, userID int64, order string, sum float64) error
+	AddAccrual(ctx context.Context, userID, orderID int64, sum model.Money) error
+	// Withdraw debits the balance unless a withdrawal for the same order
+	// number or idempotency key exists, which it returns instead. A keyed
+	// request rejected with ErrInsufficientBalance is remembered and retries
+	// get the same rejection; a caller running Withdraw in its own
+	// transaction must commit it for the rejection to stick.
+	Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error)
+	History(ctx context.Context, userID int64) ([]model.LedgerEntry, error)
+	// FindDrifts compares every stored balance with the sum of processed
+	// order accruals and withdrawals and with the sum of its ledger postings,
+	// and returns the ones that differ. It never reads from a replica.
+	FindDrifts(ctx context.Context) ([]model.BalanceDrift, error)
+	// Repair recomputes userID's balance under lock and, if it or the ledger
+	// still drifts, overwrites it, records the adjustment and posts the
+	// difference the ledger misses. It returns nil when both already match.
+	Repair(ctx context.Context, userID int64, reason string) (*model.BalanceAdjustment, error)
 }
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// LeaderLock elects a single order poller among the instances sharing a
+// backend. Each call to Factory.Leader returns an independent contender.
+type LeaderLock interface {
+	// TryAcquire takes the lock if it is free and reports whether the
+	// caller holds it. A holder that lost its session gets false.
+	TryAcquire(ctx context.Context) (bool, error)
+	// Release gives up the lock if held and frees its resources.
+	Release(ctx context.Context) error
+}
+
+// InstanceRegistry tracks the worker instances splitting orders between
+// themselves.
+type InstanceRegistry interface {
+	// Heartbeat registers instanceID or refreshes its registration.
+	Heartbeat(ctx context.Context, instanceID string) error
+	// LiveInstances returns the IDs that sent a heartbeat within ttl, sorted.
+	LiveInstances(ctx context.Context, ttl time.Duration) ([]string, error)
+	Deregister(ctx context.Context, instanceID string) error
+}
+
+// ProcessorStateStore keeps the state operators want the order processors
+// in, so a pause, resume or drain reaches every instance sharing a backend.
+type ProcessorStateStore interface {
+	// Desired returns the wanted state; ProcessorRunning until one is set.
+	Desired(ctx context.Context) (model.ProcessorState, error)
+	SetDesired(ctx context.Context, state model.ProcessorState) error
+}
@@ -1,9 +1,20 @@
 package repository
 
+import "context"
+
 // Factory describes access to different domain repositories.
 type Factory interface {
 	Users() UserRepository
 	Orders() OrderRepository
 	Balances() BalanceRepository
 	Withdrawals() WithdrawalRepository
+	Outbox() OutboxRepository
+	Audit() AuditRepository
+	Transactions() TxManager
+	Notifier() OrderNotifier
+	Leader() LeaderLock
+	Instances() InstanceRegistry
+	ProcessorState() ProcessorStateStore
+	// HealthCheck reports whether the backend answers.
+	HealthCheck(ctx context.Context) error
 }
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/polkiloo/gophermart/internal/domain/model"
 )
@@ -9,8 +10,46 @@ import (
 // OrderRepository describes persistence operations with orders.
 type OrderRepository interface {
 	Create(ctx context.Context, userID int64, number string) (*model.Order, bool, error)
+	// CreateBatch uploads distinct valid numbers for userID in one round trip
+	// and reports the outcome of each in input order.
+	CreateBatch(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error)
 	GetByNumber(ctx context.Context, number string) (*model.Order, error)
 	ListByUser(ctx context.Context, userID int64) ([]model.Order, error)
-	SelectBatchForProcessing(ctx context.Context, limit int) ([]model.Order, error)
-	UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *float64) error
+	FindByUser(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, error)
+	SelectBatchForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error)
+	// CountDue returns how many orders in shard are waiting to be claimed.
+	CountDue(ctx context.Context, shard model.Shard) (int64, error)
+	// Reschedule releases owner's lease and defers the next attempt by delay.
+	// Without lastErr the accrual system answered normally, which ends any
+	// failure streak the order was on.
+	Reschedule(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error
+	// Release hands an order owner claimed but never attempted back to the
+	// queue as it was: due at once and without the claim's attempt.
+	Release(ctx context.Context, orderID int64, owner string) error
+	// RecordFailure releases owner's lease, counts a failed attempt and
+	// defers the next one by delay.
+	RecordFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error
+	// DeadLetter releases owner's lease, counts a failed attempt and parks
+	// the order until it is requeued.
+	DeadLetter(ctx context.Context, orderID int64, owner string, lastErr string) error
+	// FindDeadLettered returns parked orders, most recently parked first.
+	FindDeadLettered(ctx context.Context, page model.Page) ([]model.Order, error)
+	// Requeue makes a parked order due again with a fresh retry budget. It
+	// returns ErrNotFound unless the order is parked.
+	Requeue(ctx context.Context, number string) (*model.Order, error)
+	// UpdateStatus applies a guarded transition and reports its outcome along
+	// with the order's owner and number.
+	UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusChange, error)
+	// Archive moves up to limit orders that reached a final status before
+	// the given time out of the active set and reports how many were moved.
+	// Archived orders keep their numbers reserved and are listed only on
+	// request.
+	Archive(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// OrderNotifier wakes order processing as soon as orders are uploaded.
+type OrderNotifier interface {
+	// NewOrders returns a channel signalled after orders are created until ctx
+	// ends. Signals coalesce, so one receive may stand for several orders.
+	NewOrders(ctx context.Context) <-chan struct{}
 }
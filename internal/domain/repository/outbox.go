@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// OutboxRepository hands domain events written alongside state changes to
+// the dispatcher.
+type OutboxRepository interface {
+	// Claim leases up to limit undelivered events in ID order for lease,
+	// skipping users whose earlier event is leased or waiting for a retry.
+	// Claims are serialized, so no two dispatchers hold events of one user.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.Event, error)
+	// Release hands leased events back for delivery right away.
+	Release(ctx context.Context, ids []int64) error
+	MarkDelivered(ctx context.Context, ids []int64) error
+	MarkFailed(ctx context.Context, id int64, retryAfter time.Duration, lastErr string) error
+	// DeadLetter counts the failed attempt and parks the event for an
+	// operator; the user's later events are delivered past it.
+	DeadLetter(ctx context.Context, id int64, lastErr string) error
+	DeleteDelivered(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type sessionKey struct{}
+
+// NewSession returns a context that remembers whether it was used to write,
+// so stores with read replicas can keep its later reads on the primary.
+func NewSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, new(atomic.Bool))
+}
+
+// MarkWritten records a write made with ctx. It is a no-op outside a session.
+func MarkWritten(ctx context.Context) {
+	if written, ok := ctx.Value(sessionKey{}).(*atomic.Bool); ok {
+		written.Store(true)
+	}
+}
+
+// HasWritten reports whether the session carried by ctx has written.
+func HasWritten(ctx context.Context) bool {
+	written, ok := ctx.Value(sessionKey{}).(*atomic.Bool)
+	return ok && written.Load()
+}
@@ -0,0 +1,25 @@
+package repository
+
+import "context"
+
+// IsolationLevel selects transaction isolation; empty means the backend default.
+type IsolationLevel string
+
+const (
+	IsolationDefault        IsolationLevel = ""
+	IsolationReadCommitted  IsolationLevel = "read committed"
+	IsolationRepeatableRead IsolationLevel = "repeatable read"
+	IsolationSerializable   IsolationLevel = "serializable"
+)
+
+// TxOptions tunes a unit of work.
+type TxOptions struct {
+	Isolation IsolationLevel
+	ReadOnly  bool
+}
+
+// TxManager runs fn as a single unit of work. Repository calls made with the
+// context passed to fn join the transaction; nested calls join the outer one.
+type TxManager interface {
+	WithinTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
+}
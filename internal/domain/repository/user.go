@@ -11,4 +11,8 @@ type UserRepository interface {
 	Create(ctx context.Context, login, passwordHash string) (*model.User, error)
 	GetByLogin(ctx context.Context, login string) (*model.User, error)
 	GetByID(ctx context.Context, id int64) (*model.User, error)
+	// Anonymize closes the account: it swaps the login for pseudonym, drops
+	// the password hash and announces the deletion through the outbox. It
+	// returns ErrNotFound for unknown or already closed accounts.
+	Anonymize(ctx context.Context, id int64, pseudonym string) (*model.User, error)
 }
@@ -9,4 +9,8 @@ import (
 // WithdrawalRepository provides access to withdrawals history.
 type WithdrawalRepository interface {
 	ListByUser(ctx context.Context, userID int64) ([]model.Withdrawal, error)
+	ListPageByUser(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, error)
+	// Pseudonymize strips client-supplied identifiers from the user's
+	// withdrawals; amounts and order numbers stay for accounting.
+	Pseudonymize(ctx context.Context, userID int64) error
 }
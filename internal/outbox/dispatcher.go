@@ -0,0 +1,263 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultRetention    = 24 * time.Hour
+	defaultRetryDelay   = time.Second
+	maxRetryDelay       = 5 * time.Minute
+	defaultLease        = 5 * time.Minute
+	defaultMaxAttempts  = 20
+	cleanupInterval     = time.Minute
+)
+
+// Option customizes Dispatcher.
+type Option func(*Dispatcher)
+
+// WithPollInterval sets how often the outbox is polled.
+func WithPollInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		if interval > 0 {
+			d.pollInterval = interval
+		}
+	}
+}
+
+// WithBatchSize sets how many events are read per poll.
+func WithBatchSize(size int) Option {
+	return func(d *Dispatcher) {
+		if size > 0 {
+			d.batchSize = size
+		}
+	}
+}
+
+// WithRetention sets how long delivered events are kept before cleanup.
+func WithRetention(retention time.Duration) Option {
+	return func(d *Dispatcher) {
+		if retention > 0 {
+			d.retention = retention
+		}
+	}
+}
+
+// WithRetryDelay sets the first retry delay; it doubles per failed attempt.
+func WithRetryDelay(delay time.Duration) Option {
+	return func(d *Dispatcher) {
+		if delay > 0 {
+			d.retryDelay = delay
+		}
+	}
+}
+
+// WithLease sets how long a claimed batch is held for delivery.
+func WithLease(lease time.Duration) Option {
+	return func(d *Dispatcher) {
+		if lease > 0 {
+			d.lease = lease
+		}
+	}
+}
+
+// WithMaxAttempts sets after how many failed deliveries an event is
+// dead-lettered.
+func WithMaxAttempts(attempts int) Option {
+	return func(d *Dispatcher) {
+		if attempts > 0 {
+			d.maxAttempts = attempts
+		}
+	}
+}
+
+// Dispatcher delivers outbox events to a sink at least once, in order per
+// user, and removes delivered events after the retention period.
+type Dispatcher struct {
+	outbox       repository.OutboxRepository
+	tx           repository.TxManager
+	sink         Sink
+	pollInterval time.Duration
+	batchSize    int
+	retention    time.Duration
+	retryDelay   time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	logger       *slog.Logger
+	now          func() time.Time
+
+	lastCleanup time.Time
+	wg          sync.WaitGroup
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+}
+
+// NewDispatcher constructs outbox dispatcher.
+func NewDispatcher(outbox repository.OutboxRepository, tx repository.TxManager, sink Sink, logger *slog.Logger, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		outbox:       outbox,
+		tx:           tx,
+		sink:         sink,
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+		retention:    defaultRetention,
+		retryDelay:   defaultRetryDelay,
+		lease:        defaultLease,
+		maxAttempts:  defaultMaxAttempts,
+		logger:       logger,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Start launches background delivery.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	d.cancel = cancel
+
+	d.wg.Add(1)
+	go d.run(runCtx)
+}
+
+// Stop waits for the current delivery round to finish.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.dispatch(ctx); err != nil && ctx.Err() == nil {
+				d.logger.Error("outbox dispatch failed", slog.String("error", err.Error()))
+			}
+			d.cleanup(ctx)
+		}
+	}
+}
+
+// deliveryFailure is an event the sink rejected.
+type deliveryFailure struct {
+	event model.Event
+	err   error
+}
+
+// dispatch delivers one batch. The batch is leased by a short claim, sent
+// outside any transaction and settled in a second short transaction, so a
+// slow sink never holds a database transaction open. A failed event holds
+// back the rest of its user's events until its retry. Delivery stops once
+// the lease runs out, as other dispatchers may then claim the remainder.
+func (d *Dispatcher) dispatch(ctx context.Context) error {
+	events, err := d.outbox.Claim(ctx, d.batchSize, d.lease)
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	deadline := d.now().Add(d.lease)
+
+	var (
+		delivered, unsent []int64
+		failures          []deliveryFailure
+	)
+	failed := make(map[int64]bool)
+	for _, event := range events {
+		if !d.now().Before(deadline) {
+			break
+		}
+		if failed[event.UserID] || ctx.Err() != nil {
+			unsent = append(unsent, event.ID)
+			continue
+		}
+		if err := d.sink.Deliver(ctx, event); err != nil {
+			if ctx.Err() != nil {
+				unsent = append(unsent, event.ID)
+				continue
+			}
+			failed[event.UserID] = true
+			failures = append(failures, deliveryFailure{event: event, err: err})
+			continue
+		}
+		delivered = append(delivered, event.ID)
+	}
+
+	// Settle even when stopping, so delivered events are not sent again.
+	return d.tx.WithinTx(context.WithoutCancel(ctx), repository.TxOptions{}, func(ctx context.Context) error {
+		for _, failure := range failures {
+			if err := d.fail(ctx, failure.event, failure.err); err != nil {
+				return err
+			}
+		}
+		if err := d.outbox.MarkDelivered(ctx, delivered); err != nil {
+			return err
+		}
+		return d.outbox.Release(ctx, unsent)
+	})
+}
+
+// fail schedules a retry of event, or dead-letters it once it has used up
+// maxAttempts.
+func (d *Dispatcher) fail(ctx context.Context, event model.Event, cause error) error {
+	attrs := []any{
+		slog.Int64("event_id", event.ID),
+		slog.String("type", string(event.Type)),
+		slog.Int("attempts", event.Attempts+1),
+		slog.String("error", cause.Error()),
+	}
+	if event.Attempts+1 >= d.maxAttempts {
+		d.logger.Error("outbox event dead-lettered", attrs...)
+		return d.outbox.DeadLetter(ctx, event.ID, cause.Error())
+	}
+	d.logger.Warn("outbox delivery failed", attrs...)
+	return d.outbox.MarkFailed(ctx, event.ID, d.backoff(event), cause.Error())
+}
+
+func (d *Dispatcher) backoff(event model.Event) time.Duration {
+	delay := d.retryDelay
+	for i := 0; i < event.Attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func (d *Dispatcher) cleanup(ctx context.Context) {
+	now := d.now()
+	if now.Sub(d.lastCleanup) < cleanupInterval {
+		return
+	}
+	d.lastCleanup = now
+
+	deleted, err := d.outbox.DeleteDelivered(ctx, now.Add(-d.retention))
+	if err != nil {
+		d.logger.Error("outbox cleanup failed", slog.String("error", err.Error()))
+		return
+	}
+	if deleted > 0 {
+		d.logger.Info("outbox cleaned up", slog.Int64("deleted", deleted))
+	}
+}
@@ -0,0 +1,263 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
+)
+
+type recordingSink struct {
+	mu        sync.Mutex
+	delivered []model.Event
+	fail      func(model.Event) error
+}
+
+func (s *recordingSink) Deliver(_ context.Context, event model.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		if err := s.fail(event); err != nil {
+			return err
+		}
+	}
+	s.delivered = append(s.delivered, event)
+	return nil
+}
+
+func (s *recordingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.delivered)
+}
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, nil))
+}
+
+// seedEvents produces status and accrual events for user 1 and a status event for user 2.
+func seedEvents(t *testing.T, storage *memory.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	orders := storage.Orders()
+	first, _, _ := orders.Create(ctx, 1, "12345678903")
+	second, _, _ := orders.Create(ctx, 2, "79927398713")
+	accrual := model.MustParseMoney("10")
+	if _, err := orders.UpdateStatus(ctx, first.ID, model.OrderStatusProcessed, &accrual); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, err := orders.UpdateStatus(ctx, second.ID, model.OrderStatusInvalid, nil); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+}
+
+func TestNewDispatcherOptions(t *testing.T) {
+	storage := memory.New()
+	d := NewDispatcher(storage.Outbox(), storage, LogSink{Logger: newTestLogger()}, newTestLogger(),
+		WithPollInterval(5*time.Millisecond), WithBatchSize(3), WithRetention(time.Hour), WithRetryDelay(time.Minute),
+		WithLease(time.Second), WithMaxAttempts(4))
+	if d.pollInterval != 5*time.Millisecond || d.batchSize != 3 || d.retention != time.Hour || d.retryDelay != time.Minute ||
+		d.lease != time.Second || d.maxAttempts != 4 {
+		t.Fatalf("unexpected options %+v", d)
+	}
+
+	d = NewDispatcher(storage.Outbox(), storage, LogSink{Logger: newTestLogger()}, newTestLogger(),
+		WithPollInterval(0), WithBatchSize(0), WithRetention(0), WithRetryDelay(0), WithLease(0), WithMaxAttempts(0))
+	if d.pollInterval != defaultPollInterval || d.batchSize != defaultBatchSize || d.retention != defaultRetention || d.retryDelay != defaultRetryDelay ||
+		d.lease != defaultLease || d.maxAttempts != defaultMaxAttempts {
+		t.Fatalf("expected defaults, got %+v", d)
+	}
+}
+
+func TestDispatcherDeliversInOrder(t *testing.T) {
+	storage := memory.New()
+	seedEvents(t, storage)
+	sink := &recordingSink{}
+	d := NewDispatcher(storage.Outbox(), storage, sink, newTestLogger())
+
+	if err := d.dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if sink.count() != 3 {
+		t.Fatalf("expected three events, got %+v", sink.delivered)
+	}
+	for i := 1; i < len(sink.delivered); i++ {
+		if sink.delivered[i-1].ID >= sink.delivered[i].ID {
+			t.Fatalf("events out of order: %+v", sink.delivered)
+		}
+	}
+
+	if err := d.dispatch(context.Background()); err != nil || sink.count() != 3 {
+		t.Fatalf("expected delivered events to stay delivered, got %d err=%v", sink.count(), err)
+	}
+}
+
+func TestDispatcherHoldsBackUserAfterFailure(t *testing.T) {
+	storage := memory.New()
+	seedEvents(t, storage)
+	failing := true
+	sink := &recordingSink{fail: func(event model.Event) error {
+		if failing && event.UserID == 1 {
+			return errors.New("crm down")
+		}
+		return nil
+	}}
+	d := NewDispatcher(storage.Outbox(), storage, sink, newTestLogger(), WithRetryDelay(time.Nanosecond))
+
+	if err := d.dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if sink.count() != 1 || sink.delivered[0].UserID != 2 {
+		t.Fatalf("expected only user 2 event, got %+v", sink.delivered)
+	}
+
+	failing = false
+	if err := d.dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if sink.count() != 3 || sink.delivered[1].Type != model.EventOrderStatusChanged || sink.delivered[2].Type != model.EventPointsAccrued {
+		t.Fatalf("expected user 1 events in order after retry, got %+v", sink.delivered)
+	}
+	if sink.delivered[1].Attempts != 1 {
+		t.Fatalf("expected retried event to record an attempt, got %d", sink.delivered[1].Attempts)
+	}
+}
+
+func TestDispatcherDeadLettersAfterMaxAttempts(t *testing.T) {
+	storage := memory.New()
+	seedEvents(t, storage)
+	sink := &recordingSink{fail: func(event model.Event) error {
+		if event.Type == model.EventOrderStatusChanged && event.UserID == 1 {
+			return errors.New("rejected")
+		}
+		return nil
+	}}
+	d := NewDispatcher(storage.Outbox(), storage, sink, newTestLogger(), WithRetryDelay(time.Nanosecond), WithMaxAttempts(2))
+
+	for range 3 {
+		if err := d.dispatch(context.Background()); err != nil {
+			t.Fatalf("dispatch failed: %v", err)
+		}
+	}
+	if sink.count() != 2 || sink.delivered[0].UserID != 2 || sink.delivered[1].Type != model.EventPointsAccrued {
+		t.Fatalf("expected user 1 accrual delivered past the dead letter, got %+v", sink.delivered)
+	}
+}
+
+func TestDispatcherSettlesBatchWhenStopped(t *testing.T) {
+	storage := memory.New()
+	seedEvents(t, storage)
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &recordingSink{fail: func(model.Event) error {
+		cancel()
+		return nil
+	}}
+	d := NewDispatcher(storage.Outbox(), storage, sink, newTestLogger())
+
+	if err := d.dispatch(ctx); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if sink.count() != 1 {
+		t.Fatalf("expected delivery to stop with the context, got %+v", sink.delivered)
+	}
+
+	// The delivered event is settled and the rest is released, not leased.
+	sink.fail = nil
+	if err := d.dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if sink.count() != 3 || sink.delivered[1].ID == sink.delivered[0].ID {
+		t.Fatalf("expected the remaining events delivered once, got %+v", sink.delivered)
+	}
+}
+
+func TestDispatcherStopsWhenLeaseRunsOut(t *testing.T) {
+	storage := memory.New()
+	seedEvents(t, storage)
+	sink := &recordingSink{}
+	d := NewDispatcher(storage.Outbox(), storage, sink, newTestLogger(), WithLease(time.Minute))
+	now := time.Now()
+	d.now = func() time.Time {
+		now = now.Add(40 * time.Second)
+		return now
+	}
+
+	if err := d.dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if sink.count() != 1 {
+		t.Fatalf("expected delivery to stop once the lease ran out, got %+v", sink.delivered)
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	d := NewDispatcher(nil, nil, nil, newTestLogger(), WithRetryDelay(time.Second))
+	for attempts, want := range map[int]time.Duration{0: time.Second, 1: 2 * time.Second, 3: 8 * time.Second, 20: maxRetryDelay} {
+		if got := d.backoff(model.Event{Attempts: attempts}); got != want {
+			t.Fatalf("attempts %d: expected %v, got %v", attempts, want, got)
+		}
+	}
+}
+
+type cleanupRecorder struct {
+	repository.OutboxRepository
+	before []time.Time
+}
+
+func (r *cleanupRecorder) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	r.before = append(r.before, before)
+	return r.OutboxRepository.DeleteDelivered(ctx, before)
+}
+
+func TestDispatcherCleanup(t *testing.T) {
+	storage := memory.New()
+	seedEvents(t, storage)
+	recorder := &cleanupRecorder{OutboxRepository: storage.Outbox()}
+	d := NewDispatcher(recorder, storage, &recordingSink{}, newTestLogger(), WithRetention(time.Hour))
+	if err := d.dispatch(context.Background()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	d.cleanup(context.Background())
+	d.cleanup(context.Background())
+	if len(recorder.before) != 1 || !recorder.before[0].Equal(now.Add(-time.Hour)) {
+		t.Fatalf("expected one cleanup keeping the retention window, got %v", recorder.before)
+	}
+
+	d.now = func() time.Time { return now.Add(2 * time.Hour) }
+	d.cleanup(context.Background())
+	if len(recorder.before) != 2 {
+		t.Fatalf("expected second cleanup after the interval, got %v", recorder.before)
+	}
+	if deleted, _ := storage.Outbox().DeleteDelivered(context.Background(), now.Add(2*time.Hour)); deleted != 0 {
+		t.Fatalf("expected cleanup to remove delivered events, %d left", deleted)
+	}
+}
+
+func TestDispatcherStartStop(t *testing.T) {
+	storage := memory.New()
+	seedEvents(t, storage)
+	sink := &recordingSink{}
+	d := NewDispatcher(storage.Outbox(), storage, sink, newTestLogger(), WithPollInterval(5*time.Millisecond))
+	d.Start(context.Background())
+
+	deadline := time.After(time.Second)
+	for sink.count() < 3 {
+		select {
+		case <-deadline:
+			d.Stop()
+			t.Fatal("timeout waiting for delivery")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	d.Stop()
+}
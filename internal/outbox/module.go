@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+
+	"go.uber.org/fx"
+
+	"github.com/polkiloo/gophermart/internal/config"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+// Module wires the outbox dispatcher and runs it for the application lifetime.
+var Module = fx.Options(
+	fx.Provide(newSink, newDispatcher),
+	fx.Invoke(registerLifecycle),
+)
+
+type sinkParams struct {
+	fx.In
+
+	Config *config.Config
+	Logger *slog.Logger
+}
+
+// newSink posts events to the configured webhooks, or logs them when none is set.
+func newSink(p sinkParams) (Sink, error) {
+	if len(p.Config.EventWebhookURLs) == 0 {
+		return LogSink{Logger: p.Logger}, nil
+	}
+	sinks := make(MultiSink, 0, len(p.Config.EventWebhookURLs))
+	for _, endpoint := range p.Config.EventWebhookURLs {
+		sink, err := NewWebhookSink(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+type dispatcherParams struct {
+	fx.In
+
+	Outbox repository.OutboxRepository
+	Tx     repository.TxManager
+	Sink   Sink
+	Config *config.Config
+	Logger *slog.Logger
+}
+
+func newDispatcher(p dispatcherParams) *Dispatcher {
+	return NewDispatcher(p.Outbox, p.Tx, p.Sink, p.Logger,
+		WithPollInterval(p.Config.OutboxPollInterval),
+		WithRetention(p.Config.OutboxRetention),
+	)
+}
+
+func registerLifecycle(lc fx.Lifecycle, d *Dispatcher) {
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			d.Start(context.Background())
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			d.Stop()
+			return nil
+		},
+	})
+}
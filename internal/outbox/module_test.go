@@ -0,0 +1,25 @@
+package outbox
+
+import (
+	"testing"
+
+	"github.com/polkiloo/gophermart/internal/config"
+)
+
+func TestNewSinkUsesConfig(t *testing.T) {
+	logger := newTestLogger()
+
+	sink, err := newSink(sinkParams{Config: &config.Config{}, Logger: logger})
+	if _, ok := sink.(LogSink); err != nil || !ok {
+		t.Fatalf("expected log sink by default, got %T err=%v", sink, err)
+	}
+
+	sink, err = newSink(sinkParams{Config: &config.Config{EventWebhookURLs: []string{"http://crm.local/events", "http://analytics.local/events"}}, Logger: logger})
+	if multi, ok := sink.(MultiSink); err != nil || !ok || len(multi) != 2 {
+		t.Fatalf("expected two webhook sinks, got %T err=%v", sink, err)
+	}
+
+	if _, err := newSink(sinkParams{Config: &config.Config{EventWebhookURLs: []string{"relative"}}, Logger: logger}); err == nil {
+		t.Fatal("expected invalid webhook error")
+	}
+}
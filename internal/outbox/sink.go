@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// Sink receives outbox events. Delivery is at least once, so sinks must
+// tolerate duplicates; the event ID identifies them.
+type Sink interface {
+	Deliver(ctx context.Context, event model.Event) error
+}
+
+// MultiSink fans an event out to every sink, failing on the first error. A
+// retried event is delivered again to sinks that already accepted it.
+type MultiSink []Sink
+
+// Deliver implements Sink.
+func (m MultiSink) Deliver(ctx context.Context, event model.Event) error {
+	for _, sink := range m {
+		if err := sink.Deliver(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogSink writes events to the application log.
+type LogSink struct {
+	Logger *slog.Logger
+}
+
+// Deliver implements Sink.
+func (s LogSink) Deliver(_ context.Context, event model.Event) error {
+	s.Logger.Info("domain event",
+		slog.Int64("event_id", event.ID),
+		slog.String("type", string(event.Type)),
+		slog.Int64("user_id", event.UserID),
+		slog.String("payload", string(event.Payload)),
+	)
+	return nil
+}
+
+// envelope is the JSON body posted to webhooks.
+type envelope struct {
+	ID        int64           `json:"id"`
+	Type      model.EventType `json:"type"`
+	UserID    int64           `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// WebhookSink posts events as JSON to an HTTP endpoint. The event ID is sent
+// as Idempotency-Key so receivers can drop redeliveries.
+type WebhookSink struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewWebhookSink validates endpoint and builds a sink with a default timeout.
+func NewWebhookSink(endpoint string) (*WebhookSink, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse webhook url: %w", err)
+	}
+	if !parsed.IsAbs() {
+		return nil, errors.New("webhook url must be absolute")
+	}
+	return &WebhookSink{
+		endpoint:   parsed.String(),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Deliver implements Sink.
+func (s *WebhookSink) Deliver(ctx context.Context, event model.Event) error {
+	body, err := json.Marshal(envelope{
+		ID:        event.ID,
+		Type:      event.Type,
+		UserID:    event.UserID,
+		CreatedAt: event.CreatedAt,
+		Payload:   event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.FormatInt(event.ID, 10))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded %d", s.endpoint, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var (
+		got envelope
+		key string
+	)
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	event := model.Event{ID: 42, UserID: 7, Type: model.EventPointsAccrued, Payload: json.RawMessage(`{"amount":5}`)}
+	if err := sink.Deliver(context.Background(), event); err != nil {
+		t.Fatalf("deliver failed: %v", err)
+	}
+	if key != "42" || got.ID != 42 || got.UserID != 7 || got.Type != model.EventPointsAccrued || string(got.Payload) != `{"amount":5}` {
+		t.Fatalf("unexpected request key=%q body=%+v", key, got)
+	}
+
+	status = http.StatusBadGateway
+	if err := sink.Deliver(context.Background(), event); err == nil {
+		t.Fatal("expected error for non-2xx response")
+	}
+
+	if _, err := NewWebhookSink("/relative"); err == nil {
+		t.Fatal("expected error for relative url")
+	}
+	if _, err := NewWebhookSink("://bad"); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
+
+type sinkFunc func(context.Context, model.Event) error
+
+func (f sinkFunc) Deliver(ctx context.Context, event model.Event) error { return f(ctx, event) }
+
+func TestMultiSinkStopsOnError(t *testing.T) {
+	var calls int
+	ok := sinkFunc(func(context.Context, model.Event) error { calls++; return nil })
+	failing := sinkFunc(func(context.Context, model.Event) error { calls++; return errors.New("down") })
+
+	if err := (MultiSink{ok, ok}).Deliver(context.Background(), model.Event{}); err != nil || calls != 2 {
+		t.Fatalf("expected both sinks called, got %d err=%v", calls, err)
+	}
+	calls = 0
+	if err := (MultiSink{failing, ok}).Deliver(context.Background(), model.Event{}); err == nil || calls != 1 {
+		t.Fatalf("expected first failure to stop fan-out, got %d err=%v", calls, err)
+	}
+	if err := (LogSink{Logger: newTestLogger()}).Deliver(context.Background(), model.Event{}); err != nil {
+		t.Fatalf("log sink failed: %v", err)
+	}
+}
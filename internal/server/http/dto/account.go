@@ -0,0 +1,19 @@
+package dto
+
+import "time"
+
+// ProfileResponse describes the account of the authenticated user.
+type ProfileResponse struct {
+	ID        int64     `json:"id"`
+	Login     string    `json:"login"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountExportResponse is the machine-readable archive of a user's data.
+type AccountExportResponse struct {
+	ExportedAt  time.Time            `json:"exported_at"`
+	Profile     ProfileResponse      `json:"profile"`
+	Balance     BalanceResponse      `json:"balance"`
+	Orders      []OrderResponse      `json:"orders"`
+	Withdrawals []WithdrawalResponse `json:"withdrawals"`
+}
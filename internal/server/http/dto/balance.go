@@ -1,7 +1,22 @@
 package dto
 
+import (
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
 // BalanceResponse represents summary of loyalty points.
 type BalanceResponse struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   model.Money `json:"current"`
+	Withdrawn model.Money `json:"withdrawn"`
+}
+
+// LedgerEntryResponse describes a single balance statement line.
+type LedgerEntryResponse struct {
+	Type         model.LedgerEntryKind `json:"type"`
+	Order        string                `json:"order,omitempty"`
+	Amount       model.Money           `json:"amount"`
+	BalanceAfter model.Money           `json:"balance_after"`
+	CreatedAt    time.Time             `json:"created_at"`
 }
@@ -0,0 +1,17 @@
+package dto
+
+// HealthResponse reports the overall state of the service and its dependencies.
+type HealthResponse struct {
+	Status     string                    `json:"status"`
+	Components []ComponentHealthResponse `json:"components"`
+}
+
+// ComponentHealthResponse reports the state of one dependency.
+type ComponentHealthResponse struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	State  string `json:"state,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Metrics carries gauges such as the order worker pool size.
+	Metrics map[string]int64 `json:"metrics,omitempty"`
+}
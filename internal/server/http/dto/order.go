@@ -1,11 +1,34 @@
 package dto
 
-import "time"
+import (
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
 
 // OrderResponse represents order state in API.
 type OrderResponse struct {
-	Number     string    `json:"number"`
-	Status     string    `json:"status"`
-	Accrual    *float64  `json:"accrual,omitempty"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	Number     string       `json:"number"`
+	Status     string       `json:"status"`
+	Accrual    *model.Money `json:"accrual,omitempty"`
+	UploadedAt time.Time    `json:"uploaded_at"`
+}
+
+// OrderUploadResponse reports the outcome for one number of a batch upload.
+type OrderUploadResponse struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
+}
+
+// DeadLetteredOrderResponse describes an order that processing gave up on.
+type DeadLetteredOrderResponse struct {
+	Number         string     `json:"number"`
+	UserID         int64      `json:"user_id"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	Failures       int        `json:"failures"`
+	LastError      string     `json:"last_error,omitempty"`
+	UploadedAt     time.Time  `json:"uploaded_at"`
+	FailingSince   *time.Time `json:"failing_since,omitempty"`
+	DeadLetteredAt *time.Time `json:"dead_lettered_at,omitempty"`
 }
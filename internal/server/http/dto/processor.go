@@ -0,0 +1,14 @@
+package dto
+
+import "time"
+
+// ProcessorStatusResponse is a snapshot of the order processor.
+type ProcessorStatusResponse struct {
+	State       string     `json:"state"`
+	Workers     int        `json:"workers"`
+	QueueDepth  int        `json:"queue_depth"`
+	InFlight    int        `json:"in_flight"`
+	LastPollAt  *time.Time `json:"last_poll_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
@@ -1,16 +1,20 @@
 package dto
 
-import "time"
+import (
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
 
 // WithdrawRequest describes withdrawal request payload.
 type WithdrawRequest struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order string      `json:"order"`
+	Sum   model.Money `json:"sum"`
 }
 
 // WithdrawalResponse describes withdrawal history entry.
 type WithdrawalResponse struct {
-	Order       string    `json:"order"`
-	Sum         float64   `json:"sum"`
-	ProcessedAt time.Time `json:"processed_at"`
+	Order       string      `json:"order"`
+	Sum         model.Money `json:"sum"`
+	ProcessedAt time.Time   `json:"processed_at"`
 }
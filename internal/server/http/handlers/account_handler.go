@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/server/http/dto"
+	"github.com/polkiloo/gophermart/internal/server/http/middleware"
+)
+
+// exportFileName is suggested to clients saving the data export.
+const exportFileName = "gophermart-export.json"
+
+// AccountHandler serves data subject requests of the authenticated user.
+type AccountHandler struct {
+	facade AccountFacade
+}
+
+// NewAccountHandler constructs AccountHandler.
+func NewAccountHandler(facade AccountFacade) *AccountHandler {
+	return &AccountHandler{facade: facade}
+}
+
+// Export handles GET /api/user/export.
+func (h *AccountHandler) Export(c *gin.Context) {
+	export, err := h.facade.ExportAccount(c.Request.Context(), CurrentUserID(c))
+	if err != nil {
+		if errors.Is(err, domainErrors.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	resp := dto.AccountExportResponse{
+		ExportedAt:  export.ExportedAt,
+		Profile:     dto.ProfileResponse{ID: export.User.ID, Login: export.User.Login, CreatedAt: export.User.CreatedAt},
+		Balance:     dto.BalanceResponse{Current: export.Balance.Current, Withdrawn: export.Balance.Withdrawn},
+		Orders:      make([]dto.OrderResponse, 0, len(export.Orders)),
+		Withdrawals: make([]dto.WithdrawalResponse, 0, len(export.Withdrawals)),
+	}
+	for _, order := range export.Orders {
+		resp.Orders = append(resp.Orders, toOrderResponse(order))
+	}
+	for _, w := range export.Withdrawals {
+		resp.Withdrawals = append(resp.Withdrawals, dto.WithdrawalResponse{Order: w.OrderNumber, Sum: w.Sum, ProcessedAt: w.ProcessedAt})
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+exportFileName+`"`)
+	c.JSON(http.StatusOK, resp)
+}
+
+// Delete handles DELETE /api/user. The account is anonymized and its auth
+// cookie cleared; financial records stay in pseudonymized form.
+func (h *AccountHandler) Delete(c *gin.Context) {
+	if err := h.facade.DeleteAccount(c.Request.Context(), CurrentUserID(c)); err != nil {
+		if errors.Is(err, domainErrors.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	middleware.ClearAuthCookie(c)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/server/http/dto"
+)
+
+// AuditHandler serves the audit log to support staff.
+type AuditHandler struct {
+	facade AuditFacade
+}
+
+// NewAuditHandler constructs AuditHandler.
+func NewAuditHandler(facade AuditFacade) *AuditHandler {
+	return &AuditHandler{facade: facade}
+}
+
+// List handles GET /api/admin/audit. It filters by ?user_id=, ?action=,
+// ?from= and ?to= and pages newest first with ?limit= and ?cursor=.
+func (h *AuditHandler) List(c *gin.Context) {
+	page, paged, err := parseNewestFirstPage(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !paged {
+		page.Limit = defaultPageLimit
+	}
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, next, err := h.facade.AuditEvents(c.Request.Context(), filter, page)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]dto.AuditEventResponse, 0, len(events))
+	for _, e := range events {
+		response = append(response, dto.AuditEventResponse{
+			ID:        e.ID,
+			Action:    string(e.Action),
+			Actor:     e.Actor,
+			UserID:    e.UserID,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			RequestID: e.RequestID,
+			Payload:   e.Payload,
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	setNextPage(c, page, next)
+	c.JSON(http.StatusOK, response)
+}
+
+// Verify handles GET /api/admin/audit/verify.
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.facade.VerifyAudit(c.Request.Context())
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, dto.AuditVerificationResponse{Checked: result.Checked, Valid: result.Valid, BrokenAt: result.BrokenAt})
+}
+
+func parseAuditFilter(c *gin.Context) (model.AuditFilter, error) {
+	var filter model.AuditFilter
+	if raw, ok := c.GetQuery("user_id"); ok {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			return model.AuditFilter{}, errors.New("user_id must be a positive integer")
+		}
+		filter.UserID = id
+	}
+	filter.Action = model.AuditAction(c.Query("action"))
+	if raw, ok := c.GetQuery("from"); ok {
+		from, err := parseFilterTime(raw)
+		if err != nil {
+			return model.AuditFilter{}, fmt.Errorf("from: %w", err)
+		}
+		filter.From = from
+	}
+	if raw, ok := c.GetQuery("to"); ok {
+		to, err := parseFilterEnd(raw)
+		if err != nil {
+			return model.AuditFilter{}, fmt.Errorf("to: %w", err)
+		}
+		filter.To = to
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return model.AuditFilter{}, errors.New("from must be before to")
+	}
+	return filter, nil
+}
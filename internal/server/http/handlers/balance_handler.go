@@ -7,9 +7,19 @@ import (
 	"github.com/gin-gonic/gin"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/domain/model"
 	"github.com/polkiloo/gophermart/internal/server/http/dto"
 )
 
+const (
+	// IdempotencyKeyHeader lets clients retry withdrawals safely.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replaying an earlier withdrawal.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
 // BalanceHandler manages balance-related endpoints.
 type BalanceHandler struct {
 	facade BalanceFacade
@@ -40,26 +50,57 @@ func (h *BalanceHandler) Withdraw(c *gin.Context) {
 		return
 	}
 
-	err := h.facade.Withdraw(c.Request.Context(), userID, req.Order, req.Sum)
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	_, created, err := h.facade.Withdraw(c.Request.Context(), model.WithdrawalRequest{
+		UserID:         userID,
+		OrderNumber:    req.Order,
+		Sum:            req.Sum,
+		IdempotencyKey: key,
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, domainErrors.ErrInvalidOrderNumber), errors.Is(err, domainErrors.ErrInvalidAmount):
 			c.Status(http.StatusUnprocessableEntity)
 		case errors.Is(err, domainErrors.ErrInsufficientBalance):
 			c.Status(http.StatusPaymentRequired)
+		case errors.Is(err, domainErrors.ErrIdempotencyConflict):
+			c.Status(http.StatusConflict)
 		default:
 			c.Status(http.StatusInternalServerError)
 		}
 		return
 	}
 
+	if !created {
+		c.Header(IdempotentReplayedHeader, "true")
+	}
 	c.Status(http.StatusOK)
 }
 
-// Withdrawals handles GET /api/user/withdrawals.
+// Withdrawals handles GET /api/user/withdrawals. Passing ?limit= or ?cursor=
+// switches to keyset pagination.
 func (h *BalanceHandler) Withdrawals(c *gin.Context) {
 	userID := CurrentUserID(c)
-	withdrawals, err := h.facade.Withdrawals(c.Request.Context(), userID)
+	page, paged, err := parseNewestFirstPage(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var (
+		withdrawals []model.Withdrawal
+		next        *model.Cursor
+	)
+	if paged {
+		withdrawals, next, err = h.facade.WithdrawalsPage(c.Request.Context(), userID, page)
+	} else {
+		withdrawals, err = h.facade.Withdrawals(c.Request.Context(), userID)
+	}
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
@@ -74,5 +115,33 @@ func (h *BalanceHandler) Withdrawals(c *gin.Context) {
 	for _, w := range withdrawals {
 		resp = append(resp, dto.WithdrawalResponse{Order: w.OrderNumber, Sum: w.Sum, ProcessedAt: w.ProcessedAt})
 	}
+	setNextPage(c, page, next)
+	c.JSON(http.StatusOK, resp)
+}
+
+// History handles GET /api/user/balance/history.
+func (h *BalanceHandler) History(c *gin.Context) {
+	userID := CurrentUserID(c)
+	entries, err := h.facade.BalanceHistory(c.Request.Context(), userID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]dto.LedgerEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, dto.LedgerEntryResponse{
+			Type:         e.Kind,
+			Order:        e.OrderNumber,
+			Amount:       e.Amount,
+			BalanceAfter: e.BalanceAfter,
+			CreatedAt:    e.CreatedAt,
+		})
+	}
 	c.JSON(http.StatusOK, resp)
 }
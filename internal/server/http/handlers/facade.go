@@ -11,19 +11,44 @@ type AuthFacade interface {
 	Register(ctx context.Context, login, password string) (string, error)
 	Authenticate(ctx context.Context, login, password string) (string, error)
 	ParseToken(token string) (int64, error)
+	TokenRejected(ctx context.Context, reason string)
+	AccountActive(ctx context.Context, userID int64) (bool, error)
 }
 
 // OrderFacade encapsulates order operations exposed via HTTP.
 type OrderFacade interface {
 	UploadOrder(ctx context.Context, userID int64, number string) (*model.Order, bool, error)
+	UploadOrders(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error)
 	Orders(ctx context.Context, userID int64) ([]model.Order, error)
+	FindOrders(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, *model.Cursor, error)
 }
 
 // BalanceFacade provides balance related operations.
 type BalanceFacade interface {
 	Balance(ctx context.Context, userID int64) (*model.BalanceSummary, error)
-	Withdraw(ctx context.Context, userID int64, order string, sum float64) error
+	Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error)
 	Withdrawals(ctx context.Context, userID int64) ([]model.Withdrawal, error)
+	WithdrawalsPage(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, *model.Cursor, error)
+	BalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error)
+}
+
+// AccountFacade answers data subject requests of the authenticated user.
+type AccountFacade interface {
+	ExportAccount(ctx context.Context, userID int64) (*model.AccountExport, error)
+	DeleteAccount(ctx context.Context, userID int64) error
+}
+
+// AuditFacade exposes the audit log to support staff.
+type AuditFacade interface {
+	AuditEvents(ctx context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, *model.Cursor, error)
+	VerifyAudit(ctx context.Context) (*model.AuditVerification, error)
+}
+
+// OrderAdminFacade lets operators inspect and requeue orders that processing
+// gave up on.
+type OrderAdminFacade interface {
+	DeadLetteredOrders(ctx context.Context, page model.Page) ([]model.Order, *model.Cursor, error)
+	RequeueOrder(ctx context.Context, number string) (*model.Order, error)
 }
 
 // LoyaltyFacade aggregates the full set of operations used across handlers.
@@ -31,4 +56,7 @@ type LoyaltyFacade interface {
 	AuthFacade
 	OrderFacade
 	BalanceFacade
+	AccountFacade
+	AuditFacade
+	OrderAdminFacade
 }
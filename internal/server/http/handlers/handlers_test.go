@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -219,6 +220,82 @@ func TestOrderHandlerUploadFailures(t *testing.T) {
 	}
 }
 
+func TestOrderHandlerUploadBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		headers map[string]string
+	}{
+		{name: "json", body: []byte(`["79927398713", 12345678903]`), headers: map[string]string{"Content-Type": "application/json"}},
+		{name: "lines", body: []byte("79927398713\n\n 12345678903 \r\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			facade := testhelpers.OrderFacadeStub{UploadBatchFn: func(_ context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+				if userID != 1 {
+					t.Fatalf("unexpected user %d", userID)
+				}
+				got = numbers
+				return []model.OrderUpload{
+					{Number: numbers[0], Result: model.OrderUploadAccepted},
+					{Number: numbers[1], Result: model.OrderUploadOwnedByAnother},
+				}, nil
+			}}
+			resp := performRequest(t, http.MethodPost, "/batch", NewOrderHandler(facade).UploadBatch, func(c *gin.Context) {
+				c.Set(middleware.UserIDContextKey, int64(1))
+			}, tt.body, tt.headers)
+			if resp.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", resp.Code)
+			}
+			if len(got) != 2 || got[0] != "79927398713" || got[1] != "12345678903" {
+				t.Fatalf("unexpected numbers passed to facade: %q", got)
+			}
+			var decoded []dto.OrderUploadResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(decoded) != 2 || decoded[0].Result != "accepted" || decoded[1].Result != "owned_by_another_user" {
+				t.Fatalf("unexpected response: %+v", decoded)
+			}
+		})
+	}
+}
+
+func TestOrderHandlerUploadBatchFailures(t *testing.T) {
+	jsonHeaders := map[string]string{"Content-Type": "application/json"}
+	tests := []struct {
+		name    string
+		facade  testhelpers.OrderFacadeStub
+		body    []byte
+		headers map[string]string
+		status  int
+	}{
+		{name: "empty", body: []byte(" \n "), status: http.StatusBadRequest},
+		{name: "empty array", body: []byte(`[]`), headers: jsonHeaders, status: http.StatusBadRequest},
+		{name: "malformed json", body: []byte(`["1"`), headers: jsonHeaders, status: http.StatusBadRequest},
+		{name: "object item", body: []byte(`[{"number":"1"}]`), headers: jsonHeaders, status: http.StatusBadRequest},
+		{name: "too many", body: []byte("1\n2\n3"), status: http.StatusRequestEntityTooLarge},
+		{name: "body too large", body: bytes.Repeat([]byte(" "), 2*batchBytesPerNumber+1), status: http.StatusRequestEntityTooLarge},
+		{name: "internal", body: []byte("79927398713"), facade: testhelpers.OrderFacadeStub{UploadBatchFn: func(context.Context, int64, []string) ([]model.OrderUpload, error) {
+			return nil, errors.New("boom")
+		}}, status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewOrderHandler(tt.facade, WithBatchLimit(2))
+			resp := performRequest(t, http.MethodPost, "/batch", handler.UploadBatch, func(c *gin.Context) {
+				c.Set(middleware.UserIDContextKey, int64(1))
+			}, tt.body, tt.headers)
+			if resp.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, resp.Code)
+			}
+		})
+	}
+}
+
 func TestOrderHandlerList(t *testing.T) {
 	orders := []model.Order{{Number: "1"}, {Number: "2"}}
 	facade := testhelpers.OrderFacadeStub{OrdersFn: func(context.Context, int64) ([]model.Order, error) {
@@ -257,6 +334,168 @@ func TestOrderHandlerListEmptySetsJSONContentType(t *testing.T) {
 	}
 }
 
+func performQuery(t *testing.T, path, query string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	router := gin.New()
+	router.GET(path, func(c *gin.Context) {
+		c.Set(middleware.UserIDContextKey, int64(1))
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?"+query, nil))
+	return w
+}
+
+func TestOrderHandlerListPaginated(t *testing.T) {
+	next := &model.Cursor{Time: time.Unix(100, 0), ID: 7}
+	var got model.Page
+	facade := testhelpers.OrderFacadeStub{
+		OrdersFn: func(context.Context, int64) ([]model.Order, error) {
+			t.Fatal("unpaginated listing should not be used")
+			return nil, nil
+		},
+		FindFn: func(_ context.Context, _ int64, _ model.OrderFilter, page model.Page) ([]model.Order, *model.Cursor, error) {
+			got = page
+			return []model.Order{{Number: "1"}, {Number: "2"}}, next, nil
+		},
+	}
+	handler := NewOrderHandler(facade)
+
+	after := model.Cursor{Time: time.Unix(200, 0), ID: 9}
+	resp := performQuery(t, "/orders", "limit=2&cursor="+after.String()+"&status=NEW", handler.List)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if got.Limit != 2 || got.After == nil || got.After.ID != 9 {
+		t.Fatalf("unexpected page request %+v", got)
+	}
+	if resp.Header().Get(NextCursorHeader) != next.String() {
+		t.Fatalf("expected next cursor header, got %q", resp.Header().Get(NextCursorHeader))
+	}
+	link := resp.Header().Get("Link")
+	if !strings.HasPrefix(link, "</orders?") || !strings.Contains(link, "cursor="+next.String()) || !strings.Contains(link, "status=NEW") || !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("unexpected link header %q", link)
+	}
+
+	resp = performQuery(t, "/orders", "cursor="+after.String(), handler.List)
+	if resp.Code != http.StatusOK || got.Limit != defaultPageLimit {
+		t.Fatalf("expected default limit, got status %d page %+v", resp.Code, got)
+	}
+}
+
+func TestOrderHandlerListPaginationFailures(t *testing.T) {
+	handler := NewOrderHandler(testhelpers.OrderFacadeStub{
+		FindFn: func(context.Context, int64, model.OrderFilter, model.Page) ([]model.Order, *model.Cursor, error) {
+			return nil, nil, errors.New("boom")
+		},
+	})
+
+	byAccrual := model.Cursor{ID: 3, Ordering: model.OrderFilter{SortBy: model.OrderSortAccrual}.Ordering()}
+	for _, query := range []string{
+		"limit=0", "limit=abc", "limit=100000", "cursor=garbage",
+		"cursor=" + byAccrual.String(),
+		"sort=accrual&order=asc&cursor=" + byAccrual.String(),
+	} {
+		if resp := performQuery(t, "/orders", query, handler.List); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, resp.Code)
+		}
+	}
+	if resp := performQuery(t, "/orders", "limit=5", handler.List); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.Code)
+	}
+}
+
+func TestOrderHandlerListFiltered(t *testing.T) {
+	var (
+		gotFilter model.OrderFilter
+		gotPage   model.Page
+	)
+	handler := NewOrderHandler(testhelpers.OrderFacadeStub{
+		OrdersFn: func(context.Context, int64) ([]model.Order, error) {
+			t.Fatal("unfiltered listing should not be used")
+			return nil, nil
+		},
+		FindFn: func(_ context.Context, _ int64, filter model.OrderFilter, page model.Page) ([]model.Order, *model.Cursor, error) {
+			gotFilter, gotPage = filter, page
+			return []model.Order{{Number: "12"}}, nil, nil
+		},
+	})
+
+	resp := performQuery(t, "/orders", "status=processed,INVALID&from=2024-01-01&to=2024-02-01T00:00:00Z&number=12&sort=accrual&order=asc&include_archived=true", handler.List)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if len(gotFilter.Statuses) != 2 || gotFilter.Statuses[0] != model.OrderStatusProcessed || gotFilter.Statuses[1] != model.OrderStatusInvalid {
+		t.Fatalf("unexpected statuses %+v", gotFilter.Statuses)
+	}
+	if gotFilter.From == nil || !gotFilter.From.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || gotFilter.To == nil || !gotFilter.To.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected range %v..%v", gotFilter.From, gotFilter.To)
+	}
+	if gotFilter.NumberPrefix != "12" || gotFilter.SortBy != model.OrderSortAccrual || !gotFilter.Ascending || !gotFilter.IncludeArchived {
+		t.Fatalf("unexpected filter %+v", gotFilter)
+	}
+	if gotPage.Limit != 0 {
+		t.Fatalf("expected unpaged request, got %+v", gotPage)
+	}
+
+	resp = performQuery(t, "/orders", "from=2024-01-05&to=2024-01-05", handler.List)
+	if resp.Code != http.StatusOK || !gotFilter.From.Equal(time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)) || !gotFilter.To.Equal(time.Date(2024, 1, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected a date-only bound to cover the whole day, got %d %v..%v", resp.Code, gotFilter.From, gotFilter.To)
+	}
+}
+
+func TestOrderHandlerListFilterValidation(t *testing.T) {
+	handler := NewOrderHandler(testhelpers.OrderFacadeStub{})
+
+	for query, message := range map[string]string{
+		"status=DONE":                   `unknown status "DONE"`,
+		"from=yesterday":                "from: expected RFC 3339 timestamp or 2006-01-02 date",
+		"to=2024-13-01":                 "to: expected RFC 3339 timestamp or 2006-01-02 date",
+		"from=2024-02-01&to=2024-01-01": "from must be before to",
+		"number=12a":                    "number must contain digits only",
+		"number=":                       "number must contain digits only",
+		"sort=number":                   "sort must be uploaded_at or accrual",
+		"order=up":                      "order must be asc or desc",
+		"include_archived=maybe":        "include_archived must be true or false",
+	} {
+		resp := performQuery(t, "/orders", query, handler.List)
+		if resp.Code != http.StatusBadRequest || resp.Body.String() != message {
+			t.Fatalf("expected 400 %q for %q, got %d %q", message, query, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestBalanceHandlerWithdrawalsPaginated(t *testing.T) {
+	facade := testhelpers.BalanceFacadeStub{
+		WithdrawalsPageFn: func(_ context.Context, _ int64, page model.Page) ([]model.Withdrawal, *model.Cursor, error) {
+			if page.Limit != 1 {
+				t.Fatalf("unexpected page %+v", page)
+			}
+			return []model.Withdrawal{{OrderNumber: "1", Sum: 1}}, nil, nil
+		},
+	}
+	handler := NewBalanceHandler(facade)
+
+	resp := performQuery(t, "/withdrawals", "limit=1", handler.Withdrawals)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if resp.Header().Get(NextCursorHeader) != "" || resp.Header().Get("Link") != "" {
+		t.Fatal("expected no next page headers on the last page")
+	}
+
+	byAccrual := model.Cursor{ID: 3, Ordering: model.OrderFilter{SortBy: model.OrderSortAccrual}.Ordering()}
+	for _, query := range []string{"limit=-1", "cursor=" + byAccrual.String()} {
+		if resp := performQuery(t, "/withdrawals", query, handler.Withdrawals); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, resp.Code)
+		}
+	}
+	newest := model.Cursor{Time: time.Unix(100, 0), ID: 3}
+	if resp := performQuery(t, "/withdrawals", "limit=1&cursor="+newest.String(), handler.Withdrawals); resp.Code != http.StatusOK {
+		t.Fatalf("expected a newest-first cursor to be accepted, got %d", resp.Code)
+	}
+}
+
 func TestBalanceHandlerSummary(t *testing.T) {
 	summary := &model.BalanceSummary{Current: 10, Withdrawn: 5}
 	facade := testhelpers.BalanceFacadeStub{BalanceFn: func(context.Context, int64) (*model.BalanceSummary, error) {
@@ -288,35 +527,68 @@ func TestBalanceHandlerWithdraw(t *testing.T) {
 	if resp.Code != http.StatusOK {
 		t.Fatalf("expected status 200, got %d", resp.Code)
 	}
+	if resp.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatal("fresh withdrawal must not be marked as replayed")
+	}
+}
+
+func TestBalanceHandlerWithdrawReplay(t *testing.T) {
+	var got model.WithdrawalRequest
+	facade := testhelpers.BalanceFacadeStub{WithdrawFn: func(_ context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+		got = req
+		return &model.Withdrawal{OrderNumber: req.OrderNumber, Sum: req.Sum}, false, nil
+	}}
+	body := []byte(`{"order":"79927398713","sum":10.5}`)
+	resp := performRequest(t, http.MethodPost, "/withdraw", NewBalanceHandler(facade).Withdraw, func(c *gin.Context) {
+		c.Set(middleware.UserIDContextKey, int64(3))
+	}, body, map[string]string{"Content-Type": "application/json", IdempotencyKeyHeader: "pos-1"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if resp.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatal("expected replay header")
+	}
+	if got.UserID != 3 || got.IdempotencyKey != "pos-1" || got.Sum != model.MustParseMoney("10.5") {
+		t.Fatalf("unexpected request %+v", got)
+	}
 }
 
 func TestBalanceHandlerWithdrawFailures(t *testing.T) {
 	tests := []struct {
-		name   string
-		facade testhelpers.BalanceFacadeStub
-		body   []byte
-		status int
+		name    string
+		facade  testhelpers.BalanceFacadeStub
+		body    []byte
+		headers map[string]string
+		status  int
 	}{
 		{name: "bad json", body: []byte("oops"), status: http.StatusBadRequest},
-		{name: "invalid order", body: []byte(`{"order":"1","sum":10}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, int64, string, float64) error {
-			return domainErrors.ErrInvalidOrderNumber
+		{name: "invalid order", body: []byte(`{"order":"1","sum":10}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+			return nil, false, domainErrors.ErrInvalidOrderNumber
 		}}, status: http.StatusUnprocessableEntity},
-		{name: "invalid amount", body: []byte(`{"order":"79927398713","sum":-1}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, int64, string, float64) error {
-			return domainErrors.ErrInvalidAmount
+		{name: "invalid amount", body: []byte(`{"order":"79927398713","sum":-1}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+			return nil, false, domainErrors.ErrInvalidAmount
 		}}, status: http.StatusUnprocessableEntity},
-		{name: "insufficient", body: []byte(`{"order":"79927398713","sum":10}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, int64, string, float64) error {
-			return domainErrors.ErrInsufficientBalance
+		{name: "insufficient", body: []byte(`{"order":"79927398713","sum":10}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+			return nil, false, domainErrors.ErrInsufficientBalance
 		}}, status: http.StatusPaymentRequired},
-		{name: "internal", body: []byte(`{"order":"79927398713","sum":10}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, int64, string, float64) error {
-			return errors.New("boom")
+		{name: "idempotency conflict", body: []byte(`{"order":"79927398713","sum":10}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+			return nil, false, domainErrors.ErrIdempotencyConflict
+		}}, status: http.StatusConflict},
+		{name: "key too long", body: []byte(`{"order":"79927398713","sum":10}`), headers: map[string]string{IdempotencyKeyHeader: strings.Repeat("k", 256)}, status: http.StatusBadRequest},
+		{name: "internal", body: []byte(`{"order":"79927398713","sum":10}`), facade: testhelpers.BalanceFacadeStub{WithdrawFn: func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+			return nil, false, errors.New("boom")
 		}}, status: http.StatusInternalServerError},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"Content-Type": "application/json"}
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
 			resp := performRequest(t, http.MethodPost, "/withdraw", NewBalanceHandler(tt.facade).Withdraw, func(c *gin.Context) {
 				c.Set(middleware.UserIDContextKey, int64(1))
-			}, tt.body, map[string]string{"Content-Type": "application/json"})
+			}, tt.body, headers)
 			if resp.Code != tt.status {
 				t.Fatalf("expected status %d, got %d", tt.status, resp.Code)
 			}
@@ -354,3 +626,299 @@ func TestBalanceHandlerWithdrawalsEmptySetsJSONContentType(t *testing.T) {
 		t.Fatalf("expected Content-Type application/json, got %q", got)
 	}
 }
+
+func TestBalanceHandlerHistory(t *testing.T) {
+	facade := testhelpers.BalanceFacadeStub{}
+	handler := NewBalanceHandler(facade)
+	resp := performRequest(t, http.MethodGet, "/balance/history", handler.History, func(c *gin.Context) {
+		c.Set(middleware.UserIDContextKey, int64(1))
+	}, nil, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var decoded []dto.LedgerEntryResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].Type != model.LedgerEntryAccrual {
+		t.Fatalf("unexpected body %s err=%v", resp.Body.String(), err)
+	}
+
+	facade.HistoryFn = func(context.Context, int64) ([]model.LedgerEntry, error) { return nil, nil }
+	resp = performRequest(t, http.MethodGet, "/balance/history", NewBalanceHandler(facade).History, nil, nil, nil)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", resp.Code)
+	}
+
+	facade.HistoryFn = func(context.Context, int64) ([]model.LedgerEntry, error) { return nil, errors.New("boom") }
+	resp = performRequest(t, http.MethodGet, "/balance/history", NewBalanceHandler(facade).History, nil, nil, nil)
+	if resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", resp.Code)
+	}
+}
+
+func TestAuditHandlerList(t *testing.T) {
+	next := &model.Cursor{Time: time.Unix(100, 0), ID: 4}
+	var (
+		gotFilter model.AuditFilter
+		gotPage   model.Page
+	)
+	handler := NewAuditHandler(testhelpers.AuditFacadeStub{
+		EventsFn: func(_ context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, *model.Cursor, error) {
+			gotFilter, gotPage = filter, page
+			return []model.AuditEvent{{ID: 5, Action: model.AuditLoginFailed, Actor: model.AuditActorAnonymous, UserID: 7, Payload: []byte(`{"reason":"wrong password"}`), Hash: "h"}}, next, nil
+		},
+	})
+
+	resp := performQuery(t, "/audit", "user_id=7&action=login.failed&from=2024-01-01&to=2024-02-01", handler.List)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	if gotFilter.UserID != 7 || gotFilter.Action != model.AuditLoginFailed || !gotFilter.From.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !gotFilter.To.Equal(time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected filter %+v", gotFilter)
+	}
+	if gotPage.Limit != defaultPageLimit || resp.Header().Get(NextCursorHeader) != next.String() {
+		t.Fatalf("expected default page with next cursor, got %+v header=%q", gotPage, resp.Header().Get(NextCursorHeader))
+	}
+	var decoded []dto.AuditEventResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].Action != "login.failed" || string(decoded[0].Payload) != `{"reason":"wrong password"}` {
+		t.Fatalf("unexpected body %s err=%v", resp.Body.String(), err)
+	}
+}
+
+func TestAuditHandlerListFailures(t *testing.T) {
+	handler := NewAuditHandler(testhelpers.AuditFacadeStub{
+		EventsFn: func(context.Context, model.AuditFilter, model.Page) ([]model.AuditEvent, *model.Cursor, error) {
+			return nil, nil, errors.New("boom")
+		},
+	})
+
+	byAccrual := model.Cursor{ID: 3, Ordering: model.OrderFilter{SortBy: model.OrderSortAccrual}.Ordering()}
+	for _, query := range []string{"user_id=abc", "user_id=0", "from=yesterday", "to=2024-13-01", "from=2024-02-01&to=2024-01-01", "limit=0", "cursor=" + byAccrual.String()} {
+		if resp := performQuery(t, "/audit", query, handler.List); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, resp.Code)
+		}
+	}
+	if resp := performQuery(t, "/audit", "", handler.List); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.Code)
+	}
+}
+
+func TestAuditHandlerVerify(t *testing.T) {
+	facade := testhelpers.AuditFacadeStub{
+		VerifyFn: func(context.Context) (*model.AuditVerification, error) {
+			return &model.AuditVerification{Checked: 2, BrokenAt: 3}, nil
+		},
+	}
+	resp := performQuery(t, "/audit/verify", "", NewAuditHandler(facade).Verify)
+	var decoded dto.AuditVerificationResponse
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &decoded) != nil || decoded.Valid || decoded.BrokenAt != 3 || decoded.Checked != 2 {
+		t.Fatalf("unexpected response %d %s", resp.Code, resp.Body.String())
+	}
+
+	facade.VerifyFn = func(context.Context) (*model.AuditVerification, error) { return nil, errors.New("boom") }
+	if resp := performQuery(t, "/audit/verify", "", NewAuditHandler(facade).Verify); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.Code)
+	}
+}
+
+func TestOrderAdminHandlerDeadLettered(t *testing.T) {
+	parkedAt := time.Unix(200, 0).UTC()
+	next := &model.Cursor{Time: parkedAt, ID: 3}
+	var got model.Page
+	facade := testhelpers.OrderAdminFacadeStub{
+		DeadLetteredFn: func(_ context.Context, page model.Page) ([]model.Order, *model.Cursor, error) {
+			got = page
+			return []model.Order{{ID: 3, UserID: 7, Number: "79927398713", Status: model.OrderStatusProcessing, Failures: 20, LastError: "order not registered", DeadLetteredAt: &parkedAt}}, next, nil
+		},
+	}
+	handler := NewOrderAdminHandler(facade)
+
+	resp := performQuery(t, "/orders/dead-letter", "", handler.DeadLettered)
+	if resp.Code != http.StatusOK || got.Limit != defaultPageLimit || resp.Header().Get(NextCursorHeader) != next.String() {
+		t.Fatalf("unexpected response %d page=%+v header=%q", resp.Code, got, resp.Header().Get(NextCursorHeader))
+	}
+	var decoded []dto.DeadLetteredOrderResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].Failures != 20 || decoded[0].DeadLetteredAt == nil || decoded[0].UserID != 7 {
+		t.Fatalf("unexpected body %s err=%v", resp.Body.String(), err)
+	}
+
+	byAccrual := model.Cursor{ID: 3, Ordering: model.OrderFilter{SortBy: model.OrderSortAccrual}.Ordering()}
+	for _, query := range []string{"limit=0", "cursor=" + byAccrual.String()} {
+		if resp := performQuery(t, "/orders/dead-letter", query, handler.DeadLettered); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, resp.Code)
+		}
+	}
+	facade.DeadLetteredFn = func(context.Context, model.Page) ([]model.Order, *model.Cursor, error) {
+		return nil, nil, errors.New("boom")
+	}
+	if resp := performQuery(t, "/orders/dead-letter", "", NewOrderAdminHandler(facade).DeadLettered); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.Code)
+	}
+}
+
+func TestOrderAdminHandlerRequeue(t *testing.T) {
+	var requeued string
+	facade := testhelpers.OrderAdminFacadeStub{
+		RequeueFn: func(_ context.Context, number string) (*model.Order, error) {
+			requeued = number
+			switch number {
+			case "1":
+				return &model.Order{Number: number, Status: model.OrderStatusNew}, nil
+			case "2":
+				return nil, domainErrors.ErrNotFound
+			}
+			return nil, errors.New("boom")
+		},
+	}
+	requeue := func(number string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/orders/:number/requeue", NewOrderAdminHandler(facade).Requeue)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders/"+number+"/requeue", nil))
+		return w
+	}
+
+	resp := requeue("1")
+	var decoded dto.DeadLetteredOrderResponse
+	if resp.Code != http.StatusOK || requeued != "1" || json.Unmarshal(resp.Body.Bytes(), &decoded) != nil || decoded.Number != "1" || decoded.DeadLetteredAt != nil {
+		t.Fatalf("unexpected response %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := requeue("2"); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.Code)
+	}
+	if resp := requeue("3"); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.Code)
+	}
+}
+
+func TestProcessorAdminHandler(t *testing.T) {
+	processor := &testhelpers.ProcessorControlStub{}
+	handler := NewProcessorAdminHandler(processor)
+
+	for _, tc := range []struct {
+		path    string
+		handler gin.HandlerFunc
+		state   string
+	}{
+		{"/processor/pause", handler.Pause, "paused"},
+		{"/processor/resume", handler.Resume, "running"},
+		{"/processor/drain", handler.Drain, "draining"},
+	} {
+		resp := performRequest(t, http.MethodPost, tc.path, tc.handler, nil, nil, nil)
+		var decoded dto.ProcessorStatusResponse
+		if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &decoded) != nil || decoded.State != tc.state {
+			t.Fatalf("unexpected response for %s: %d %s", tc.path, resp.Code, resp.Body.String())
+		}
+	}
+	if got := strings.Join(processor.Commands, ","); got != "pause,resume,drain" {
+		t.Fatalf("unexpected commands %q", got)
+	}
+
+	resp := performQuery(t, "/processor", "", handler.Status)
+	var decoded dto.ProcessorStatusResponse
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &decoded) != nil || decoded.State != "draining" {
+		t.Fatalf("unexpected status response %d %s", resp.Code, resp.Body.String())
+	}
+
+	processor.Err = errors.New("db down")
+	if resp := performRequest(t, http.MethodPost, "/processor/pause", handler.Pause, nil, nil, nil); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when the command cannot be recorded, got %d", resp.Code)
+	}
+	if processor.State != model.ProcessorDraining {
+		t.Fatalf("expected state kept on failure, got %s", processor.State)
+	}
+}
+
+type healthCheckStub model.ComponentHealth
+
+func (h healthCheckStub) Health(context.Context) model.ComponentHealth {
+	return model.ComponentHealth(h)
+}
+
+func TestHealthHandlerCheck(t *testing.T) {
+	database := healthCheckStub{Name: "database", Status: model.HealthUp}
+	tests := []struct {
+		name    string
+		accrual healthCheckStub
+		code    int
+		status  string
+	}{
+		{name: "up", accrual: healthCheckStub{Name: "accrual", Status: model.HealthUp, State: "closed"}, code: http.StatusOK, status: "up"},
+		{name: "degraded", accrual: healthCheckStub{Name: "accrual", Status: model.HealthDegraded, State: "open"}, code: http.StatusOK, status: "degraded"},
+		{name: "down", accrual: healthCheckStub{Name: "accrual", Status: model.HealthDown}, code: http.StatusServiceUnavailable, status: "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := performQuery(t, "/health", "", NewHealthHandler(database, tt.accrual).Check)
+			var decoded dto.HealthResponse
+			if resp.Code != tt.code || json.Unmarshal(resp.Body.Bytes(), &decoded) != nil || decoded.Status != tt.status || len(decoded.Components) != 2 {
+				t.Fatalf("unexpected response %d %s", resp.Code, resp.Body.String())
+			}
+			if decoded.Components[1].State != tt.accrual.State {
+				t.Fatalf("expected accrual state %q, got %+v", tt.accrual.State, decoded.Components[1])
+			}
+		})
+	}
+
+	processor := healthCheckStub{Name: "order_processor", Status: model.HealthUp, Metrics: map[string]int64{"pool_size": 6}}
+	resp := performQuery(t, "/health", "", NewHealthHandler(processor).Check)
+	var decoded dto.HealthResponse
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &decoded) != nil || decoded.Components[0].Metrics["pool_size"] != 6 {
+		t.Fatalf("expected component metrics in response, got %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestAccountHandlerExport(t *testing.T) {
+	accrual := model.MustParseMoney("5")
+	facade := testhelpers.AccountFacadeStub{
+		ExportFn: func(_ context.Context, userID int64) (*model.AccountExport, error) {
+			return &model.AccountExport{
+				User:        model.User{ID: userID, Login: "alice", PasswordHash: "secret"},
+				Balance:     model.BalanceSummary{Current: 5},
+				Orders:      []model.Order{{Number: "79927398713", Status: model.OrderStatusProcessed, Accrual: &accrual}},
+				Withdrawals: []model.Withdrawal{{OrderNumber: "2377225624", Sum: 3}},
+			}, nil
+		},
+	}
+	resp := performQuery(t, "/export", "", NewAccountHandler(facade).Export)
+	if resp.Code != http.StatusOK || !strings.HasPrefix(resp.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("expected downloadable export, got %d %v", resp.Code, resp.Header())
+	}
+	if strings.Contains(resp.Body.String(), "secret") {
+		t.Fatalf("export must not leak the password hash: %s", resp.Body.String())
+	}
+	var decoded dto.AccountExportResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &decoded); err != nil || decoded.Profile.ID != 1 || decoded.Profile.Login != "alice" || len(decoded.Orders) != 1 || len(decoded.Withdrawals) != 1 || decoded.Balance.Current != 5 {
+		t.Fatalf("unexpected body %s err=%v", resp.Body.String(), err)
+	}
+
+	facade.ExportFn = func(context.Context, int64) (*model.AccountExport, error) { return nil, domainErrors.ErrNotFound }
+	if resp := performQuery(t, "/export", "", NewAccountHandler(facade).Export); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.Code)
+	}
+	facade.ExportFn = func(context.Context, int64) (*model.AccountExport, error) { return nil, errors.New("boom") }
+	if resp := performQuery(t, "/export", "", NewAccountHandler(facade).Export); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.Code)
+	}
+}
+
+func TestAccountHandlerDelete(t *testing.T) {
+	var deleted int64
+	facade := testhelpers.AccountFacadeStub{DeleteFn: func(_ context.Context, userID int64) error {
+		deleted = userID
+		return nil
+	}}
+	resp := performRequest(t, http.MethodDelete, "/user", NewAccountHandler(facade).Delete, func(c *gin.Context) {
+		c.Set(middleware.UserIDContextKey, int64(4))
+	}, nil, nil)
+	if resp.Code != http.StatusNoContent || deleted != 4 || !strings.Contains(resp.Header().Get("Set-Cookie"), "Max-Age=0") {
+		t.Fatalf("expected account deleted and cookie cleared, got %d user=%d cookie=%q", resp.Code, deleted, resp.Header().Get("Set-Cookie"))
+	}
+
+	facade.DeleteFn = func(context.Context, int64) error { return domainErrors.ErrNotFound }
+	if resp := performRequest(t, http.MethodDelete, "/user", NewAccountHandler(facade).Delete, nil, nil, nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.Code)
+	}
+	facade.DeleteFn = func(context.Context, int64) error { return errors.New("boom") }
+	if resp := performRequest(t, http.MethodDelete, "/user", NewAccountHandler(facade).Delete, nil, nil, nil); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/server/http/dto"
+)
+
+// HealthChecker reports the state of one dependency.
+type HealthChecker interface {
+	Health(ctx context.Context) model.ComponentHealth
+}
+
+// HealthHandler serves the health of the service to probes and operators.
+type HealthHandler struct {
+	checks []HealthChecker
+}
+
+// NewHealthHandler constructs HealthHandler.
+func NewHealthHandler(checks ...HealthChecker) *HealthHandler {
+	return &HealthHandler{checks: checks}
+}
+
+// Check handles GET /api/health. A degraded dependency is reported but
+// keeps the status 200, since the API still serves; only a dependency that
+// is down turns it into 503.
+func (h *HealthHandler) Check(c *gin.Context) {
+	response := dto.HealthResponse{Status: string(model.HealthUp), Components: make([]dto.ComponentHealthResponse, 0, len(h.checks))}
+	code := http.StatusOK
+	for _, check := range h.checks {
+		health := check.Health(c.Request.Context())
+		switch health.Status {
+		case model.HealthDown:
+			response.Status = string(model.HealthDown)
+			code = http.StatusServiceUnavailable
+		case model.HealthDegraded:
+			if response.Status == string(model.HealthUp) {
+				response.Status = string(model.HealthDegraded)
+			}
+		}
+		response.Components = append(response.Components, dto.ComponentHealthResponse{
+			Name:    health.Name,
+			Status:  string(health.Status),
+			State:   health.State,
+			Detail:  health.Detail,
+			Metrics: health.Metrics,
+		})
+	}
+	c.JSON(code, response)
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -13,14 +15,38 @@ import (
 	"github.com/polkiloo/gophermart/internal/server/http/dto"
 )
 
+// DefaultBatchLimit caps the numbers accepted by one batch upload.
+const DefaultBatchLimit = 1000
+
+// batchBytesPerNumber is the body budget per batch entry, generous enough for
+// a quoted number with separators and whitespace.
+const batchBytesPerNumber = 32
+
+// OrderHandlerOption customizes OrderHandler.
+type OrderHandlerOption func(*OrderHandler)
+
+// WithBatchLimit sets how many numbers a batch upload may carry.
+func WithBatchLimit(limit int) OrderHandlerOption {
+	return func(h *OrderHandler) {
+		if limit > 0 {
+			h.batchLimit = limit
+		}
+	}
+}
+
 // OrderHandler manages order-related endpoints.
 type OrderHandler struct {
-	facade OrderFacade
+	facade     OrderFacade
+	batchLimit int
 }
 
 // NewOrderHandler constructs OrderHandler.
-func NewOrderHandler(facade OrderFacade) *OrderHandler {
-	return &OrderHandler{facade: facade}
+func NewOrderHandler(facade OrderFacade, opts ...OrderHandlerOption) *OrderHandler {
+	h := &OrderHandler{facade: facade, batchLimit: DefaultBatchLimit}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Upload handles POST /api/user/orders.
@@ -59,10 +85,76 @@ func (h *OrderHandler) Upload(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
-// List handles GET /api/user/orders.
+// UploadBatch handles POST /api/user/orders/batch. The body is either a JSON
+// array of numbers or plain text with one number per line.
+func (h *OrderHandler) UploadBatch(c *gin.Context) {
+	userID := CurrentUserID(c)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(h.batchLimit)*batchBytesPerNumber)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	numbers, err := parseOrderNumbers(c.ContentType(), body)
+	if err != nil || len(numbers) == 0 {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if len(numbers) > h.batchLimit {
+		c.Status(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	uploads, err := h.facade.UploadOrders(c.Request.Context(), userID, numbers)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]dto.OrderUploadResponse, 0, len(uploads))
+	for _, upload := range uploads {
+		response = append(response, dto.OrderUploadResponse{Number: upload.Number, Result: string(upload.Result)})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// List handles GET /api/user/orders. Passing ?limit= or ?cursor= switches
+// to keyset pagination; status, date, number and sort parameters narrow and
+// order the list, and ?include_archived=true adds archived orders.
 func (h *OrderHandler) List(c *gin.Context) {
 	userID := CurrentUserID(c)
-	orders, err := h.facade.Orders(c.Request.Context(), userID)
+	page, paged, err := parsePage(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, filtered, err := parseOrderFilter(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if page.After != nil {
+		if err := filter.CheckCursor(*page.After); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var (
+		orders []model.Order
+		next   *model.Cursor
+	)
+	if paged || filtered {
+		orders, next, err = h.facade.FindOrders(c.Request.Context(), userID, filter, page)
+	} else {
+		orders, err = h.facade.Orders(c.Request.Context(), userID)
+	}
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
@@ -78,6 +170,7 @@ func (h *OrderHandler) List(c *gin.Context) {
 		response = append(response, toOrderResponse(o))
 	}
 
+	setNextPage(c, page, next)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -89,3 +182,45 @@ func toOrderResponse(order model.Order) dto.OrderResponse {
 		UploadedAt: order.UploadedAt,
 	}
 }
+
+// parseOrderNumbers reads a batch body. JSON arrays may hold strings or bare
+// numbers; any other content type is split into lines, skipping blanks.
+func parseOrderNumbers(contentType string, body []byte) ([]string, error) {
+	if contentType == "application/json" {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, err
+		}
+		numbers := make([]string, 0, len(raw))
+		for _, item := range raw {
+			number, err := parseOrderNumber(item)
+			if err != nil {
+				return nil, err
+			}
+			numbers = append(numbers, number)
+		}
+		return numbers, nil
+	}
+
+	var numbers []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if number := strings.TrimSpace(line); number != "" {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers, nil
+}
+
+func parseOrderNumber(item json.RawMessage) (string, error) {
+	var number string
+	if err := json.Unmarshal(item, &number); err == nil {
+		return strings.TrimSpace(number), nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(item))
+	decoder.UseNumber()
+	var n json.Number
+	if err := decoder.Decode(&n); err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
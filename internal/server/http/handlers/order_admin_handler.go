@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/server/http/dto"
+)
+
+// OrderAdminHandler lets operators deal with orders that need attention.
+type OrderAdminHandler struct {
+	facade OrderAdminFacade
+}
+
+// NewOrderAdminHandler constructs OrderAdminHandler.
+func NewOrderAdminHandler(facade OrderAdminFacade) *OrderAdminHandler {
+	return &OrderAdminHandler{facade: facade}
+}
+
+// DeadLettered handles GET /api/admin/orders/dead-letter. It pages most
+// recently parked first with ?limit= and ?cursor=.
+func (h *OrderAdminHandler) DeadLettered(c *gin.Context) {
+	page, paged, err := parseNewestFirstPage(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !paged {
+		page.Limit = defaultPageLimit
+	}
+
+	orders, next, err := h.facade.DeadLetteredOrders(c.Request.Context(), page)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]dto.DeadLetteredOrderResponse, 0, len(orders))
+	for _, o := range orders {
+		response = append(response, deadLetteredOrderResponse(o))
+	}
+
+	setNextPage(c, page, next)
+	c.JSON(http.StatusOK, response)
+}
+
+// Requeue handles POST /api/admin/orders/:number/requeue.
+func (h *OrderAdminHandler) Requeue(c *gin.Context) {
+	order, err := h.facade.RequeueOrder(c.Request.Context(), c.Param("number"))
+	if err != nil {
+		if errors.Is(err, domainErrors.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, deadLetteredOrderResponse(*order))
+}
+
+func deadLetteredOrderResponse(o model.Order) dto.DeadLetteredOrderResponse {
+	return dto.DeadLetteredOrderResponse{
+		Number:         o.Number,
+		UserID:         o.UserID,
+		Status:         string(o.Status),
+		Attempts:       o.Attempts,
+		Failures:       o.Failures,
+		LastError:      o.LastError,
+		UploadedAt:     o.UploadedAt,
+		FailingSince:   o.FailingSince,
+		DeadLetteredAt: o.DeadLetteredAt,
+	}
+}
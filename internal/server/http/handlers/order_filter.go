@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+const dateLayout = "2006-01-02"
+
+// parseOrderFilter reads ?status=, ?from=, ?to=, ?number=, ?sort=, ?order=
+// and ?include_archived=. It reports false when none of them is present.
+func parseOrderFilter(c *gin.Context) (model.OrderFilter, bool, error) {
+	var (
+		filter model.OrderFilter
+		set    bool
+	)
+
+	if raw, ok := c.GetQuery("status"); ok {
+		set = true
+		for _, part := range strings.Split(raw, ",") {
+			status := model.OrderStatus(strings.ToUpper(strings.TrimSpace(part)))
+			switch status {
+			case model.OrderStatusNew, model.OrderStatusProcessing, model.OrderStatusInvalid, model.OrderStatusProcessed:
+				filter.Statuses = append(filter.Statuses, status)
+			default:
+				return model.OrderFilter{}, true, fmt.Errorf("unknown status %q", part)
+			}
+		}
+	}
+
+	if raw, ok := c.GetQuery("from"); ok {
+		set = true
+		from, err := parseFilterTime(raw)
+		if err != nil {
+			return model.OrderFilter{}, true, fmt.Errorf("from: %w", err)
+		}
+		filter.From = &from
+	}
+	if raw, ok := c.GetQuery("to"); ok {
+		set = true
+		to, err := parseFilterEnd(raw)
+		if err != nil {
+			return model.OrderFilter{}, true, fmt.Errorf("to: %w", err)
+		}
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return model.OrderFilter{}, true, errors.New("from must be before to")
+	}
+
+	if raw, ok := c.GetQuery("number"); ok {
+		set = true
+		if raw == "" || strings.Trim(raw, "0123456789") != "" {
+			return model.OrderFilter{}, true, errors.New("number must contain digits only")
+		}
+		filter.NumberPrefix = raw
+	}
+
+	if raw, ok := c.GetQuery("sort"); ok {
+		set = true
+		switch field := model.OrderSortField(raw); field {
+		case model.OrderSortUploadedAt, model.OrderSortAccrual:
+			filter.SortBy = field
+		default:
+			return model.OrderFilter{}, true, fmt.Errorf("sort must be %s or %s", model.OrderSortUploadedAt, model.OrderSortAccrual)
+		}
+	}
+	if raw, ok := c.GetQuery("order"); ok {
+		set = true
+		switch strings.ToLower(raw) {
+		case "asc":
+			filter.Ascending = true
+		case "desc":
+		default:
+			return model.OrderFilter{}, true, errors.New("order must be asc or desc")
+		}
+	}
+
+	if raw, ok := c.GetQuery("include_archived"); ok {
+		set = true
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			return model.OrderFilter{}, true, errors.New("include_archived must be true or false")
+		}
+		filter.IncludeArchived = include
+	}
+
+	return filter, set, nil
+}
+
+// parseFilterTime accepts RFC 3339 timestamps and plain dates.
+func parseFilterTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(dateLayout, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("expected RFC 3339 timestamp or %s date", dateLayout)
+}
+
+// parseFilterEnd parses the exclusive upper bound of a range. A plain date
+// covers that whole day, so to=2024-01-05 ends at the start of the 6th.
+func parseFilterEnd(raw string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, raw); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return parseFilterTime(raw)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+const (
+	// NextCursorHeader carries the cursor of the next page.
+	NextCursorHeader = "X-Next-Cursor"
+
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+)
+
+// parsePage reads ?limit= and ?cursor=. It reports false when neither is
+// present, so callers keep returning the full list.
+func parsePage(c *gin.Context) (model.Page, bool, error) {
+	limitParam, hasLimit := c.GetQuery("limit")
+	cursorParam, hasCursor := c.GetQuery("cursor")
+	if !hasLimit && !hasCursor {
+		return model.Page{}, false, nil
+	}
+
+	page := model.Page{Limit: defaultPageLimit}
+	if hasLimit {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			return model.Page{}, true, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		page.Limit = limit
+	}
+	if hasCursor {
+		cursor, err := model.ParseCursor(cursorParam)
+		if err != nil {
+			return model.Page{}, true, err
+		}
+		page.After = &cursor
+	}
+	return page, true, nil
+}
+
+// parseNewestFirstPage is parsePage for listings with a single newest-first
+// sort. A cursor recording another ordering came from a different listing.
+func parseNewestFirstPage(c *gin.Context) (model.Page, bool, error) {
+	page, paged, err := parsePage(c)
+	if err == nil && page.After != nil && page.After.Ordering != "" {
+		return model.Page{}, true, model.ErrCursorMismatch
+	}
+	return page, paged, err
+}
+
+// setNextPage advertises the next page through X-Next-Cursor and a Link header
+// that preserves the other query parameters.
+func setNextPage(c *gin.Context, page model.Page, next *model.Cursor) {
+	if next == nil {
+		return
+	}
+	token := next.String()
+
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("limit", strconv.Itoa(page.Limit))
+	query.Set("cursor", token)
+	u.RawQuery = query.Encode()
+
+	c.Header(NextCursorHeader, token)
+	c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", u.RequestURI()))
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/server/http/dto"
+)
+
+// ProcessorControl lets operators steer the order processors at runtime.
+// Commands are recorded for every replica; Status describes this one.
+type ProcessorControl interface {
+	Status() model.ProcessorStatus
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	Drain(ctx context.Context) error
+}
+
+// ProcessorAdminHandler exposes the order processor to operators.
+type ProcessorAdminHandler struct {
+	processor ProcessorControl
+}
+
+// NewProcessorAdminHandler constructs ProcessorAdminHandler.
+func NewProcessorAdminHandler(processor ProcessorControl) *ProcessorAdminHandler {
+	return &ProcessorAdminHandler{processor: processor}
+}
+
+// Status handles GET /api/admin/processor.
+func (h *ProcessorAdminHandler) Status(c *gin.Context) {
+	c.JSON(http.StatusOK, processorStatusResponse(h.processor.Status()))
+}
+
+// Pause handles POST /api/admin/processor/pause. Claimed orders no worker
+// on this replica has started are handed back to the queue before it
+// answers; the other replicas follow on their next poll.
+func (h *ProcessorAdminHandler) Pause(c *gin.Context) {
+	h.command(c, h.processor.Pause)
+}
+
+// Resume handles POST /api/admin/processor/resume.
+func (h *ProcessorAdminHandler) Resume(c *gin.Context) {
+	h.command(c, h.processor.Resume)
+}
+
+// Drain handles POST /api/admin/processor/drain. It answers at once; the
+// state turns from draining to paused when the claimed orders are done.
+func (h *ProcessorAdminHandler) Drain(c *gin.Context) {
+	h.command(c, h.processor.Drain)
+}
+
+func (h *ProcessorAdminHandler) command(c *gin.Context, run func(context.Context) error) {
+	if err := run(c.Request.Context()); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, processorStatusResponse(h.processor.Status()))
+}
+
+func processorStatusResponse(status model.ProcessorStatus) dto.ProcessorStatusResponse {
+	return dto.ProcessorStatusResponse{
+		State:       string(status.State),
+		Workers:     status.Workers,
+		QueueDepth:  status.QueueDepth,
+		InFlight:    status.InFlight,
+		LastPollAt:  status.LastPollAt,
+		LastError:   status.LastError,
+		LastErrorAt: status.LastErrorAt,
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenHeader carries the shared secret of support and operations staff.
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminRequired admits requests presenting the configured admin token. An
+// empty token disables admin routes altogether.
+func AdminRequired(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		presented := c.GetHeader(AdminTokenHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -19,8 +20,28 @@ type TokenParser interface {
 	ParseToken(token string) (int64, error)
 }
 
+// TokenAuditor is implemented by parsers that record rejected tokens.
+type TokenAuditor interface {
+	TokenRejected(ctx context.Context, reason string)
+}
+
+// AccountChecker is implemented by parsers that know closed accounts, whose
+// tokens must stop working before they expire.
+type AccountChecker interface {
+	AccountActive(ctx context.Context, userID int64) (bool, error)
+}
+
 // AuthRequired ensures user is authenticated before accessing handler.
 func AuthRequired(parser TokenParser) gin.HandlerFunc {
+	auditor, _ := parser.(TokenAuditor)
+	checker, _ := parser.(AccountChecker)
+	reject := func(c *gin.Context, reason string) {
+		if auditor != nil {
+			auditor.TokenRejected(c.Request.Context(), reason)
+		}
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+
 	return func(c *gin.Context) {
 		token := extractToken(c)
 		if token == "" {
@@ -31,12 +52,23 @@ func AuthRequired(parser TokenParser) gin.HandlerFunc {
 		userID, err := parser.ParseToken(token)
 		if err != nil {
 			if err == pkgAuth.ErrInvalidToken {
-				c.AbortWithStatus(http.StatusUnauthorized)
+				reject(c, "invalid token")
 				return
 			}
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
+		if checker != nil {
+			active, err := checker.AccountActive(c.Request.Context(), userID)
+			if err != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				reject(c, "closed account")
+				return
+			}
+		}
 
 		c.Set(UserIDContextKey, userID)
 		c.Next()
@@ -60,3 +92,8 @@ func SetAuthCookie(c *gin.Context, token string) {
 	c.SetCookie(authCookieName, token, 0, "/", "", false, true)
 	c.Header("Authorization", "Bearer "+token)
 }
+
+// ClearAuthCookie expires the auth token cookie.
+func ClearAuthCookie(c *gin.Context) {
+	c.SetCookie(authCookieName, "", -1, "/", "", false, true)
+}
@@ -8,10 +8,13 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
 	pkgAuth "github.com/polkiloo/gophermart/internal/pkg/auth"
 	testhelpers "github.com/polkiloo/gophermart/internal/test"
 )
@@ -160,3 +163,139 @@ func TestRequestLogger(t *testing.T) {
 		t.Fatalf("expected request to be logged")
 	}
 }
+
+func TestReadSession(t *testing.T) {
+	router := gin.New()
+	router.Use(ReadSession())
+	router.POST("/", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if repository.HasWritten(ctx) {
+			t.Error("fresh session must not report writes")
+		}
+		repository.MarkWritten(ctx)
+		if !repository.HasWritten(ctx) {
+			t.Error("expected session to remember the write")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	repository.MarkWritten(context.Background())
+	if repository.HasWritten(context.Background()) {
+		t.Fatal("contexts without a session never report writes")
+	}
+}
+
+func TestAuthRequiredAuditsRejectedTokens(t *testing.T) {
+	var reasons []string
+	parser := testhelpers.TokenParserStub{Err: pkgAuth.ErrInvalidToken, RejectFn: func(_ context.Context, reason string) {
+		reasons = append(reasons, reason)
+	}}
+	router := gin.New()
+	router.Use(AuthRequired(parser))
+	router.GET("/", func(c *gin.Context) {})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer forged")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(reasons) != 1 || reasons[0] != "invalid token" {
+		t.Fatalf("expected only the forged token audited, got %v", reasons)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	var meta model.RequestMeta
+	router := gin.New()
+	router.Use(RequestContext())
+	router.GET("/", func(c *gin.Context) {
+		meta, _ = model.RequestMetaFrom(c.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.Header.Set("User-Agent", "curl")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if meta.RequestID != "req-1" || meta.UserAgent != "curl" || meta.IP == "" || resp.Header().Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("expected client request id reused, got %+v header=%q", meta, resp.Header().Get(RequestIDHeader))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, string(bytes.Repeat([]byte("x"), maxRequestIDLength+1)))
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if len(meta.RequestID) != 32 || resp.Header().Get(RequestIDHeader) != meta.RequestID {
+		t.Fatalf("expected generated request id, got %q", meta.RequestID)
+	}
+}
+
+func TestAdminRequired(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		presented string
+		want      int
+	}{
+		{name: "disabled", token: "", presented: "", want: http.StatusUnauthorized},
+		{name: "missing", token: "secret", presented: "", want: http.StatusUnauthorized},
+		{name: "wrong", token: "secret", presented: "guess", want: http.StatusUnauthorized},
+		{name: "valid", token: "secret", presented: "secret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(AdminRequired(tt.token))
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.presented != "" {
+				req.Header.Set(AdminTokenHeader, tt.presented)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			if resp.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, resp.Code)
+			}
+		})
+	}
+}
+
+func TestAuthRequiredRejectsClosedAccounts(t *testing.T) {
+	var reasons []string
+	parser := testhelpers.TokenParserStub{
+		ID:       7,
+		RejectFn: func(_ context.Context, reason string) { reasons = append(reasons, reason) },
+		ActiveFn: func(_ context.Context, userID int64) (bool, error) { return userID != 7, nil },
+	}
+	serve := func(parser testhelpers.TokenParserStub) int {
+		router := gin.New()
+		router.Use(AuthRequired(parser))
+		router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := serve(parser); code != http.StatusUnauthorized || len(reasons) != 1 || reasons[0] != "closed account" {
+		t.Fatalf("expected closed account rejected, got %d reasons=%v", code, reasons)
+	}
+	parser.ActiveFn = func(context.Context, int64) (bool, error) { return false, context.DeadlineExceeded }
+	if code := serve(parser); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when account lookup fails, got %d", code)
+	}
+}
+
+func TestClearAuthCookie(t *testing.T) {
+	resp := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(resp)
+	ClearAuthCookie(c)
+	cookie := resp.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(cookie, authCookieName+"=;") || !strings.Contains(cookie, "Max-Age=0") {
+		t.Fatalf("expected expired cookie, got %q", cookie)
+	}
+}
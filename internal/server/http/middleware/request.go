@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+const (
+	// RequestIDHeader carries the request identifier recorded in the audit log.
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestContext tags the request with an ID, reusing a sane one sent by the
+// client, and exposes the client address and agent to the audit log.
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		meta := model.RequestMeta{IP: c.ClientIP(), UserAgent: c.Request.UserAgent(), RequestID: id}
+		c.Request = c.Request.WithContext(model.WithRequestMeta(c.Request.Context(), meta))
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+// ReadSession scopes read-your-writes routing to a single request: once the
+// request writes, its later reads skip the read replica.
+func ReadSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(repository.NewSession(c.Request.Context()))
+		c.Next()
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/gophermart/internal/app"
+	"github.com/polkiloo/gophermart/internal/config"
 	"github.com/polkiloo/gophermart/internal/server/http/handlers"
 	"go.uber.org/fx"
 )
@@ -24,10 +25,19 @@ func provideFacade(facade *app.LoyaltyFacade) handlers.LoyaltyFacade {
 type engineParams struct {
 	fx.In
 
-	Facade handlers.LoyaltyFacade
-	Logger *slog.Logger
+	Facade       handlers.LoyaltyFacade
+	Config       *config.Config
+	Logger       *slog.Logger
+	HealthChecks []handlers.HealthChecker  `group:"health"`
+	Processor    handlers.ProcessorControl `optional:"true"`
 }
 
 func newEngine(p engineParams) *gin.Engine {
-	return Setup(p.Facade, p.Logger)
+	return Setup(p.Facade, p.Logger, Options{
+		AdminToken:     p.Config.AdminToken,
+		OrderOptions:   []handlers.OrderHandlerOption{handlers.WithBatchLimit(p.Config.OrderBatchLimit)},
+		HealthChecks:   p.HealthChecks,
+		Processor:      p.Processor,
+		TrustedProxies: p.Config.TrustedProxies,
+	})
 }
@@ -10,21 +10,46 @@ import (
 	"github.com/polkiloo/gophermart/internal/server/http/middleware"
 )
 
+// Options tunes routes that depend on configuration.
+type Options struct {
+	// AdminToken guards /api/admin; empty leaves those routes unregistered.
+	AdminToken string
+	// OrderOptions customize the order handler.
+	OrderOptions []handlers.OrderHandlerOption
+	// HealthChecks are reported by /api/health.
+	HealthChecks []handlers.HealthChecker
+	// Processor is controlled through /api/admin/processor when set.
+	Processor handlers.ProcessorControl
+	// TrustedProxies may name the client in forwarding headers; with none
+	// the audit log records the peer address.
+	TrustedProxies []string
+}
+
 // Setup configures gin router with handlers and middleware.
-func Setup(facade handlers.LoyaltyFacade, logger *slog.Logger) *gin.Engine {
+func Setup(facade handlers.LoyaltyFacade, logger *slog.Logger, opts Options) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
+	if err := engine.SetTrustedProxies(opts.TrustedProxies); err != nil {
+		// A rejected list would leave gin trusting every peer.
+		logger.Error("ignoring trusted proxies", slog.String("error", err.Error()))
+		_ = engine.SetTrustedProxies(nil)
+	}
 
 	engine.Use(gin.Recovery())
+	engine.Use(middleware.RequestContext())
 	engine.Use(middleware.RequestLogger(logger))
+	engine.Use(middleware.ReadSession())
 	engine.Use(middleware.DecompressRequest())
 	engine.Use(gzip.Gzip(gzip.DefaultCompression))
 
 	authHandler := handlers.NewAuthHandler(facade)
-	orderHandler := handlers.NewOrderHandler(facade)
+	orderHandler := handlers.NewOrderHandler(facade, opts.OrderOptions...)
 	balanceHandler := handlers.NewBalanceHandler(facade)
+	accountHandler := handlers.NewAccountHandler(facade)
+	healthHandler := handlers.NewHealthHandler(opts.HealthChecks...)
 
 	api := engine.Group("/api")
+	api.GET("/health", healthHandler.Check)
 	user := api.Group("/user")
 	user.POST("/register", authHandler.Register)
 	user.POST("/login", authHandler.Login)
@@ -33,9 +58,32 @@ func Setup(facade handlers.LoyaltyFacade, logger *slog.Logger) *gin.Engine {
 	userAuth.Use(middleware.AuthRequired(facade))
 	userAuth.POST("/orders", orderHandler.Upload)
 	userAuth.GET("/orders", orderHandler.List)
+	userAuth.POST("/orders/batch", orderHandler.UploadBatch)
 	userAuth.GET("/balance", balanceHandler.Summary)
 	userAuth.POST("/balance/withdraw", balanceHandler.Withdraw)
+	userAuth.GET("/balance/history", balanceHandler.History)
 	userAuth.GET("/withdrawals", balanceHandler.Withdrawals)
+	userAuth.GET("/export", accountHandler.Export)
+	userAuth.DELETE("", accountHandler.Delete)
+
+	if opts.AdminToken != "" {
+		auditHandler := handlers.NewAuditHandler(facade)
+		orderAdminHandler := handlers.NewOrderAdminHandler(facade)
+		admin := api.Group("/admin")
+		admin.Use(middleware.AdminRequired(opts.AdminToken))
+		admin.GET("/audit", auditHandler.List)
+		admin.GET("/audit/verify", auditHandler.Verify)
+		admin.GET("/orders/dead-letter", orderAdminHandler.DeadLettered)
+		admin.POST("/orders/:number/requeue", orderAdminHandler.Requeue)
+
+		if opts.Processor != nil {
+			processorHandler := handlers.NewProcessorAdminHandler(opts.Processor)
+			admin.GET("/processor", processorHandler.Status)
+			admin.POST("/processor/pause", processorHandler.Pause)
+			admin.POST("/processor/resume", processorHandler.Resume)
+			admin.POST("/processor/drain", processorHandler.Drain)
+		}
+	}
 
 	return engine
 }
@@ -25,13 +25,13 @@ func TestSetupRoutes(t *testing.T) {
 		AuthFacadeStub: testhelpers.AuthFacadeStub{},
 		OrderFacadeStub: testhelpers.OrderFacadeStub{
 			OrdersFn: func(context.Context, int64) ([]model.Order, error) {
-				accrual := 5.0
+				accrual := model.MustParseMoney("5")
 				return []model.Order{{Number: "1", Status: model.OrderStatusProcessed, Accrual: &accrual, UploadedAt: time.Unix(0, 0)}}, nil
 			},
 		},
 		BalanceFacadeStub: testhelpers.BalanceFacadeStub{},
 	}
-	engine := Setup(facade, logger)
+	engine := Setup(facade, logger, Options{AdminToken: "admin", Processor: &testhelpers.ProcessorControlStub{}})
 
 	body, _ := json.Marshal(map[string]string{"login": "user", "password": "pass"})
 	req := httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(body))
@@ -49,6 +49,116 @@ func TestSetupRoutes(t *testing.T) {
 	if resp.Code != http.StatusOK {
 		t.Fatalf("expected status 200 for orders, got %d", resp.Code)
 	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", bytes.NewReader([]byte("79927398713\n")))
+	req.Header.Set("Authorization", "Bearer token")
+	resp = httptest.NewRecorder()
+	engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for batch upload, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/user/balance/history", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp = httptest.NewRecorder()
+	engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for balance history, got %d", resp.Code)
+	}
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/user/export", http.StatusOK},
+		{http.MethodDelete, "/api/user", http.StatusNoContent},
+	} {
+		req = httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		resp = httptest.NewRecorder()
+		engine.ServeHTTP(resp, req)
+		if resp.Code != tc.want {
+			t.Fatalf("expected status %d for %s %s, got %d", tc.want, tc.method, tc.path, resp.Code)
+		}
+	}
+	if resp.Header().Get("X-Request-ID") == "" {
+		t.Fatal("expected request id header")
+	}
+
+	resp = httptest.NewRecorder()
+	engine.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for health, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	engine.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/admin/audit", nil))
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 for audit without admin token, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/audit/verify", nil)
+	req.Header.Set("X-Admin-Token", "admin")
+	resp = httptest.NewRecorder()
+	engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for audit verify, got %d", resp.Code)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/admin/orders/dead-letter", http.StatusOK},
+		{http.MethodPost, "/api/admin/orders/79927398713/requeue", http.StatusOK},
+		{http.MethodGet, "/api/admin/processor", http.StatusOK},
+		{http.MethodPost, "/api/admin/processor/pause", http.StatusOK},
+		{http.MethodPost, "/api/admin/processor/resume", http.StatusOK},
+		{http.MethodPost, "/api/admin/processor/drain", http.StatusOK},
+	} {
+		adminReq := httptest.NewRequest(tc.method, tc.path, nil)
+		adminReq.Header.Set("X-Admin-Token", "admin")
+		resp = httptest.NewRecorder()
+		engine.ServeHTTP(resp, adminReq)
+		if resp.Code != tc.want {
+			t.Fatalf("expected status %d for %s %s, got %d", tc.want, tc.method, tc.path, resp.Code)
+		}
+	}
+
+	resp = httptest.NewRecorder()
+	Setup(facade, logger, Options{}).ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected admin routes disabled without token, got %d", resp.Code)
+	}
 }
 
 var _ handlers.LoyaltyFacade = (*testhelpers.LoyaltyFacadeStub)(nil)
+
+var _ handlers.ProcessorControl = (*testhelpers.ProcessorControlStub)(nil)
+
+func TestSetupTrustsOnlyConfiguredProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	clientIP := func(opts Options) string {
+		var meta model.RequestMeta
+		engine := Setup(testhelpers.LoyaltyFacadeStub{}, logger, opts)
+		engine.GET("/probe", func(c *gin.Context) {
+			meta, _ = model.RequestMetaFrom(c.Request.Context())
+		})
+		req := httptest.NewRequest(http.MethodGet, "/probe", nil)
+		req.RemoteAddr = "192.0.2.10:4321"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+		return meta.IP
+	}
+
+	if ip := clientIP(Options{}); ip != "192.0.2.10" {
+		t.Fatalf("expected a forged forwarding header to be ignored, got %q", ip)
+	}
+	if ip := clientIP(Options{TrustedProxies: []string{"192.0.2.0/24"}}); ip != "203.0.113.7" {
+		t.Fatalf("expected a trusted proxy to name the client, got %q", ip)
+	}
+	if ip := clientIP(Options{TrustedProxies: []string{"not-an-ip"}}); ip != "192.0.2.10" {
+		t.Fatalf("expected an invalid proxy list to trust no one, got %q", ip)
+	}
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// leaderLock elects one holder among the contenders sharing a Storage.
+type leaderLock struct {
+	storage *Storage
+}
+
+// TryAcquire takes the lock if no other contender holds it.
+func (l *leaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	s := l.storage
+	defer s.lock(ctx)()
+
+	if s.leader == nil {
+		s.leader = l
+	}
+	return s.leader == l, nil
+}
+
+// Release frees the lock if l holds it.
+func (l *leaderLock) Release(ctx context.Context) error {
+	s := l.storage
+	defer s.lock(ctx)()
+
+	if s.leader == l {
+		s.leader = nil
+	}
+	return nil
+}
+
+type instanceRegistry struct {
+	storage *Storage
+}
+
+// Heartbeat records that instanceID is alive.
+func (r *instanceRegistry) Heartbeat(ctx context.Context, instanceID string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	s.instances[instanceID] = s.now()
+	return nil
+}
+
+// LiveInstances returns the instances seen within ttl in ID order.
+func (r *instanceRegistry) LiveInstances(ctx context.Context, ttl time.Duration) ([]string, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	cutoff := s.now().Add(-ttl)
+	var ids []string
+	for id, seen := range s.instances {
+		if !seen.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// Deregister forgets instanceID.
+func (r *instanceRegistry) Deregister(ctx context.Context, instanceID string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	delete(s.instances, instanceID)
+	return nil
+}
+
+type processorStateStore struct {
+	storage *Storage
+}
+
+// Desired returns the state last set, running until then.
+func (r *processorStateStore) Desired(ctx context.Context) (model.ProcessorState, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	if s.processor == "" {
+		return model.ProcessorRunning, nil
+	}
+	return s.processor, nil
+}
+
+// SetDesired records state.
+func (r *processorStateStore) SetDesired(ctx context.Context, state model.ProcessorState) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	s.processor = state
+	return nil
+}
@@ -0,0 +1,1252 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+// Scheme is the DATABASE_URI scheme selecting the in-memory backend.
+const Scheme = "memory://"
+
+// IsDSN reports whether dsn points to the in-memory backend.
+func IsDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, Scheme)
+}
+
+// Storage keeps all repositories in process memory behind a single lock.
+type Storage struct {
+	mu sync.Mutex
+
+	users        map[int64]*model.User
+	loginIndex   map[string]int64
+	orders       map[int64]*model.Order
+	archive      map[int64]*model.Order
+	numberIndex  map[string]int64
+	balances     map[int64]*model.BalanceSummary
+	withdrawals  []model.Withdrawal
+	rejections   map[rejectionKey]string
+	ledger       []model.LedgerEntry
+	outbox       []outboxEntry
+	adjustments  []model.BalanceAdjustment
+	audit        []model.AuditEvent
+	nextUserID   int64
+	nextOrderID  int64
+	nextWithdraw int64
+	nextEntryID  int64
+	nextEventID  int64
+	leader       *leaderLock
+	instances    map[string]time.Time
+	processor    model.ProcessorState
+
+	now func() time.Time
+
+	listenersMu sync.Mutex
+	listeners   map[chan struct{}]struct{}
+}
+
+// rejectionKey identifies a rejected withdrawal by its idempotency key.
+type rejectionKey struct {
+	userID int64
+	key    string
+}
+
+// outboxEntry tracks delivery state of an event.
+type outboxEntry struct {
+	event          model.Event
+	availableAt    time.Time
+	deliveredAt    *time.Time
+	deadLetteredAt *time.Time
+	lastError      string
+}
+
+type userRepository struct {
+	storage *Storage
+}
+
+type orderRepository struct {
+	storage *Storage
+}
+
+type balanceRepository struct {
+	storage *Storage
+}
+
+type withdrawalRepository struct {
+	storage *Storage
+}
+
+type outboxRepository struct {
+	storage *Storage
+}
+
+type auditRepository struct {
+	storage *Storage
+}
+
+// New constructs empty in-memory storage.
+func New() *Storage {
+	return &Storage{
+		users:       make(map[int64]*model.User),
+		loginIndex:  make(map[string]int64),
+		orders:      make(map[int64]*model.Order),
+		archive:     make(map[int64]*model.Order),
+		numberIndex: make(map[string]int64),
+		balances:    make(map[int64]*model.BalanceSummary),
+		rejections:  make(map[rejectionKey]string),
+		instances:   make(map[string]time.Time),
+		now:         time.Now,
+		listeners:   make(map[chan struct{}]struct{}),
+	}
+}
+
+// Close is a no-op kept for parity with the PostgreSQL storage.
+func (s *Storage) Close() {}
+
+// HealthCheck always succeeds for the in-memory backend.
+func (s *Storage) HealthCheck(context.Context) error {
+	return nil
+}
+
+// Factory methods for domain repositories.
+func (s *Storage) Users() repository.UserRepository {
+	return &userRepository{storage: s}
+}
+
+func (s *Storage) Orders() repository.OrderRepository {
+	return &orderRepository{storage: s}
+}
+
+func (s *Storage) Balances() repository.BalanceRepository {
+	return &balanceRepository{storage: s}
+}
+
+func (s *Storage) Withdrawals() repository.WithdrawalRepository {
+	return &withdrawalRepository{storage: s}
+}
+
+func (s *Storage) Outbox() repository.OutboxRepository {
+	return &outboxRepository{storage: s}
+}
+
+func (s *Storage) Audit() repository.AuditRepository {
+	return &auditRepository{storage: s}
+}
+
+func (s *Storage) Transactions() repository.TxManager {
+	return s
+}
+
+func (s *Storage) Notifier() repository.OrderNotifier {
+	return s
+}
+
+func (s *Storage) Leader() repository.LeaderLock {
+	return &leaderLock{storage: s}
+}
+
+func (s *Storage) Instances() repository.InstanceRegistry {
+	return &instanceRegistry{storage: s}
+}
+
+func (s *Storage) ProcessorState() repository.ProcessorStateStore {
+	return &processorStateStore{storage: s}
+}
+
+// NewOrders signals on every created order until ctx ends.
+func (s *Storage) NewOrders(ctx context.Context) <-chan struct{} {
+	signals := make(chan struct{}, 1)
+	s.listenersMu.Lock()
+	s.listeners[signals] = struct{}{}
+	s.listenersMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.listenersMu.Lock()
+		delete(s.listeners, signals)
+		s.listenersMu.Unlock()
+	}()
+	return signals
+}
+
+func (s *Storage) notifyNewOrder() {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	for signals := range s.listeners {
+		select {
+		case signals <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type txKey struct{}
+
+func (s *Storage) inTx(ctx context.Context) bool {
+	owner, _ := ctx.Value(txKey{}).(*Storage)
+	return owner == s
+}
+
+// lock acquires the storage lock unless ctx already runs inside WithinTx,
+// which holds it for the whole unit of work.
+func (s *Storage) lock(ctx context.Context) func() {
+	if s.inTx(ctx) {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// WithinTx runs fn while holding the storage lock and restores the previous
+// state unless fn succeeds. Holding the lock makes every unit of work
+// serializable, so isolation options need no further handling.
+func (s *Storage) WithinTx(ctx context.Context, _ repository.TxOptions, fn func(ctx context.Context) error) error {
+	if s.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	s.mu.Lock()
+	snap := s.snapshotLocked()
+	committed := false
+	defer func() {
+		if !committed {
+			s.restoreLocked(snap)
+		}
+		s.mu.Unlock()
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, s)); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+type snapshot struct {
+	users        map[int64]*model.User
+	loginIndex   map[string]int64
+	orders       map[int64]*model.Order
+	archive      map[int64]*model.Order
+	numberIndex  map[string]int64
+	balances     map[int64]*model.BalanceSummary
+	withdrawals  []model.Withdrawal
+	rejections   map[rejectionKey]string
+	ledger       []model.LedgerEntry
+	outbox       []outboxEntry
+	adjustments  []model.BalanceAdjustment
+	audit        []model.AuditEvent
+	nextUserID   int64
+	nextOrderID  int64
+	nextWithdraw int64
+	nextEntryID  int64
+	nextEventID  int64
+}
+
+func (s *Storage) snapshotLocked() snapshot {
+	snap := snapshot{
+		users:        make(map[int64]*model.User, len(s.users)),
+		loginIndex:   make(map[string]int64, len(s.loginIndex)),
+		orders:       make(map[int64]*model.Order, len(s.orders)),
+		archive:      make(map[int64]*model.Order, len(s.archive)),
+		numberIndex:  make(map[string]int64, len(s.numberIndex)),
+		balances:     make(map[int64]*model.BalanceSummary, len(s.balances)),
+		withdrawals:  append([]model.Withdrawal(nil), s.withdrawals...),
+		rejections:   make(map[rejectionKey]string, len(s.rejections)),
+		ledger:       append([]model.LedgerEntry(nil), s.ledger...),
+		outbox:       append([]outboxEntry(nil), s.outbox...),
+		adjustments:  append([]model.BalanceAdjustment(nil), s.adjustments...),
+		audit:        append([]model.AuditEvent(nil), s.audit...),
+		nextUserID:   s.nextUserID,
+		nextOrderID:  s.nextOrderID,
+		nextWithdraw: s.nextWithdraw,
+		nextEntryID:  s.nextEntryID,
+		nextEventID:  s.nextEventID,
+	}
+	for id, u := range s.users {
+		user := *u
+		snap.users[id] = &user
+	}
+	for login, id := range s.loginIndex {
+		snap.loginIndex[login] = id
+	}
+	for id, o := range s.orders {
+		order := copyOrder(o)
+		snap.orders[id] = &order
+	}
+	for id, o := range s.archive {
+		order := copyOrder(o)
+		snap.archive[id] = &order
+	}
+	for number, id := range s.numberIndex {
+		snap.numberIndex[number] = id
+	}
+	for id, b := range s.balances {
+		balance := *b
+		snap.balances[id] = &balance
+	}
+	for key, fingerprint := range s.rejections {
+		snap.rejections[key] = fingerprint
+	}
+	return snap
+}
+
+func (s *Storage) restoreLocked(snap snapshot) {
+	s.users = snap.users
+	s.loginIndex = snap.loginIndex
+	s.orders = snap.orders
+	s.archive = snap.archive
+	s.numberIndex = snap.numberIndex
+	s.balances = snap.balances
+	s.withdrawals = snap.withdrawals
+	s.rejections = snap.rejections
+	s.ledger = snap.ledger
+	s.outbox = snap.outbox
+	s.adjustments = snap.adjustments
+	s.audit = snap.audit
+	s.nextUserID = snap.nextUserID
+	s.nextOrderID = snap.nextOrderID
+	s.nextWithdraw = snap.nextWithdraw
+	s.nextEntryID = snap.nextEntryID
+	s.nextEventID = snap.nextEventID
+}
+
+// --- UserRepository implementation ---
+
+func (r *userRepository) Create(ctx context.Context, login, passwordHash string) (*model.User, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	if _, exists := s.loginIndex[login]; exists {
+		return nil, domainErrors.ErrAlreadyExists
+	}
+	s.nextUserID++
+	u := &model.User{ID: s.nextUserID, Login: login, PasswordHash: passwordHash, CreatedAt: s.now()}
+	s.users[u.ID] = u
+	s.loginIndex[login] = u.ID
+	user := *u
+	return &user, nil
+}
+
+func (r *userRepository) GetByLogin(ctx context.Context, login string) (*model.User, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	id, ok := s.loginIndex[login]
+	if !ok {
+		return nil, domainErrors.ErrNotFound
+	}
+	user := *s.users[id]
+	return &user, nil
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, domainErrors.ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (r *userRepository) Anonymize(ctx context.Context, id int64, pseudonym string) (*model.User, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	u, ok := s.users[id]
+	if !ok || u.Deleted() {
+		return nil, domainErrors.ErrNotFound
+	}
+	if _, taken := s.loginIndex[pseudonym]; taken {
+		return nil, domainErrors.ErrAlreadyExists
+	}
+	deletedAt := s.now()
+	delete(s.loginIndex, u.Login)
+	s.loginIndex[pseudonym] = id
+	s.users[id] = &model.User{ID: id, Login: pseudonym, CreatedAt: u.CreatedAt, DeletedAt: &deletedAt}
+	s.publishLocked(id, model.AccountDeleted{DeletedAt: deletedAt})
+	user := *s.users[id]
+	return &user, nil
+}
+
+// --- OrderRepository implementation ---
+
+func (r *orderRepository) Create(ctx context.Context, userID int64, number string) (*model.Order, bool, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	if id, exists := s.numberIndex[number]; exists {
+		existing := copyOrder(s.orderLocked(id))
+		if existing.UserID != userID {
+			return &existing, false, domainErrors.ErrAlreadyExists
+		}
+		return &existing, false, nil
+	}
+
+	order := copyOrder(s.createOrderLocked(userID, number))
+	s.notifyNewOrder()
+	return &order, true, nil
+}
+
+func (s *Storage) createOrderLocked(userID int64, number string) *model.Order {
+	now := s.now()
+	s.nextOrderID++
+	o := &model.Order{ID: s.nextOrderID, UserID: userID, Number: number, Status: model.OrderStatusNew, UploadedAt: now, UpdatedAt: now, NextAttemptAt: now}
+	s.orders[o.ID] = o
+	s.numberIndex[number] = o.ID
+	return o
+}
+
+func (r *orderRepository) CreateBatch(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	results := make([]model.OrderUpload, 0, len(numbers))
+	created := false
+	for _, number := range numbers {
+		result := model.OrderUpload{Number: number, Result: model.OrderUploadAccepted}
+		if id, exists := s.numberIndex[number]; exists {
+			result.Result = model.OrderUploadAlreadyYours
+			if s.orderLocked(id).UserID != userID {
+				result.Result = model.OrderUploadOwnedByAnother
+			}
+			results = append(results, result)
+			continue
+		}
+		s.createOrderLocked(userID, number)
+		created = true
+		results = append(results, result)
+	}
+	if created {
+		s.notifyNewOrder()
+	}
+	return results, nil
+}
+
+func (r *orderRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	id, ok := s.numberIndex[number]
+	if !ok {
+		return nil, domainErrors.ErrNotFound
+	}
+	order := copyOrder(s.orderLocked(id))
+	return &order, nil
+}
+
+// orderLocked looks an order up among active and archived orders.
+func (s *Storage) orderLocked(id int64) *model.Order {
+	if o, ok := s.orders[id]; ok {
+		return o
+	}
+	return s.archive[id]
+}
+
+func (r *orderRepository) ListByUser(ctx context.Context, userID int64) ([]model.Order, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	var result []model.Order
+	for _, o := range s.orders {
+		if o.UserID == userID {
+			result = append(result, copyOrder(o))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].UploadedAt.Equal(result[j].UploadedAt) {
+			return result[i].UploadedAt.After(result[j].UploadedAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	return result, nil
+}
+
+// FindByUser returns the user's orders matching filter, one keyset page at a
+// time; a zero page.Limit returns every match.
+func (r *orderRepository) FindByUser(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	sources := []map[int64]*model.Order{s.orders}
+	if filter.IncludeArchived {
+		sources = append(sources, s.archive)
+	}
+	var result []model.Order
+	for _, orders := range sources {
+		for _, o := range orders {
+			if o.UserID != userID || !matchesFilter(o, filter) {
+				continue
+			}
+			if page.After != nil && !orderAfter(filter, filter.CursorFor(*o), *page.After) {
+				continue
+			}
+			result = append(result, copyOrder(o))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return orderAfter(filter, filter.CursorFor(result[j]), filter.CursorFor(result[i]))
+	})
+	if page.Limit > 0 && len(result) > page.Limit {
+		result = result[:page.Limit]
+	}
+	return result, nil
+}
+
+func matchesFilter(o *model.Order, filter model.OrderFilter) bool {
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, o.Status) {
+		return false
+	}
+	if filter.From != nil && o.UploadedAt.Before(*filter.From) {
+		return false
+	}
+	if filter.To != nil && !o.UploadedAt.Before(*filter.To) {
+		return false
+	}
+	return strings.HasPrefix(o.Number, filter.NumberPrefix)
+}
+
+// orderAfter reports whether position a is listed after position b.
+func orderAfter(filter model.OrderFilter, a, b model.Cursor) bool {
+	var diff int
+	if filter.SortField() == model.OrderSortAccrual {
+		diff = cmp.Compare(a.Amount, b.Amount)
+	} else {
+		diff = a.Time.Compare(b.Time)
+	}
+	if diff == 0 {
+		diff = cmp.Compare(a.ID, b.ID)
+	}
+	if filter.Ascending {
+		return diff > 0
+	}
+	return diff < 0
+}
+
+// CountDue counts the orders in shard that SelectBatchForProcessing would
+// claim now.
+func (r *orderRepository) CountDue(ctx context.Context, shard model.Shard) (int64, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+	return int64(len(s.dueLocked(s.now(), shard))), nil
+}
+
+// dueLocked returns the unleased orders in shard whose next attempt is due.
+func (s *Storage) dueLocked(now time.Time, shard model.Shard) []*model.Order {
+	var due []*model.Order
+	for _, o := range s.orders {
+		if o.Status != model.OrderStatusNew && o.Status != model.OrderStatusProcessing {
+			continue
+		}
+		if o.DeadLetteredAt != nil || !shard.Owns(o.ID) {
+			continue
+		}
+		if o.NextAttemptAt.After(now) || (o.LeaseUntil != nil && o.LeaseUntil.After(now)) {
+			continue
+		}
+		due = append(due, o)
+	}
+	return due
+}
+
+// SelectBatchForProcessing leases due orders to claim.Owner atomically, so
+// concurrent callers never receive the same order while its lease is live.
+func (r *orderRepository) SelectBatchForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	now := s.now()
+	due := s.dueLocked(now, claim.Shard)
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		if !due[i].UploadedAt.Equal(due[j].UploadedAt) {
+			return due[i].UploadedAt.Before(due[j].UploadedAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if claim.Limit >= 0 && len(due) > claim.Limit {
+		due = due[:claim.Limit]
+	}
+
+	leaseUntil := now.Add(claim.Lease)
+	orders := make([]model.Order, 0, len(due))
+	for _, o := range due {
+		until := leaseUntil
+		o.Status = model.OrderStatusProcessing
+		o.ClaimedBy = claim.Owner
+		o.LeaseUntil = &until
+		o.Attempts++
+		o.UpdatedAt = now
+		orders = append(orders, copyOrder(o))
+	}
+	return orders, nil
+}
+
+// Reschedule releases owner's lease and defers the next attempt by delay.
+func (r *orderRepository) Reschedule(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.ClaimedBy != owner {
+		return domainErrors.ErrLeaseLost
+	}
+	now := s.now()
+	o.ClaimedBy = ""
+	o.LeaseUntil = nil
+	o.NextAttemptAt = now.Add(delay)
+	o.LastError = lastErr
+	o.UpdatedAt = now
+	if lastErr == "" {
+		o.Failures = 0
+		o.FailingSince = nil
+	}
+	return nil
+}
+
+// Release drops owner's lease and takes back the attempt counted by the claim.
+func (r *orderRepository) Release(ctx context.Context, orderID int64, owner string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.ClaimedBy != owner {
+		return domainErrors.ErrLeaseLost
+	}
+	o.ClaimedBy = ""
+	o.LeaseUntil = nil
+	o.Attempts = max(o.Attempts-1, 0)
+	o.UpdatedAt = s.now()
+	return nil
+}
+
+// RecordFailure releases owner's lease, counts the failed attempt and
+// defers the next one by delay.
+func (r *orderRepository) RecordFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.ClaimedBy != owner {
+		return domainErrors.ErrLeaseLost
+	}
+	now := s.now()
+	s.failLocked(o, now, lastErr)
+	o.NextAttemptAt = now.Add(delay)
+	return nil
+}
+
+// DeadLetter releases owner's lease, counts the failed attempt and parks the
+// order until it is requeued.
+func (r *orderRepository) DeadLetter(ctx context.Context, orderID int64, owner string, lastErr string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	o, ok := s.orders[orderID]
+	if !ok || o.ClaimedBy != owner {
+		return domainErrors.ErrLeaseLost
+	}
+	now := s.now()
+	s.failLocked(o, now, lastErr)
+	o.DeadLetteredAt = &now
+	return nil
+}
+
+func (s *Storage) failLocked(o *model.Order, now time.Time, lastErr string) {
+	o.ClaimedBy = ""
+	o.LeaseUntil = nil
+	o.LastError = lastErr
+	o.Failures++
+	if o.FailingSince == nil {
+		since := now
+		o.FailingSince = &since
+	}
+	o.UpdatedAt = now
+}
+
+// FindDeadLettered returns parked orders, most recently parked first, one
+// keyset page at a time; a zero page.Limit returns every match.
+func (r *orderRepository) FindDeadLettered(ctx context.Context, page model.Page) ([]model.Order, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	var result []model.Order
+	for _, o := range s.orders {
+		if o.DeadLetteredAt == nil {
+			continue
+		}
+		if page.After != nil && !page.After.Follows(*o.DeadLetteredAt, o.ID) {
+			continue
+		}
+		result = append(result, copyOrder(o))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].DeadLetteredAt.Equal(*result[j].DeadLetteredAt) {
+			return result[i].DeadLetteredAt.After(*result[j].DeadLetteredAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	if page.Limit > 0 && len(result) > page.Limit {
+		result = result[:page.Limit]
+	}
+	return result, nil
+}
+
+// Requeue makes a parked order due now with a fresh retry budget.
+func (r *orderRepository) Requeue(ctx context.Context, number string) (*model.Order, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	id, ok := s.numberIndex[number]
+	if !ok {
+		return nil, domainErrors.ErrNotFound
+	}
+	o, ok := s.orders[id]
+	if !ok || o.DeadLetteredAt == nil {
+		return nil, domainErrors.ErrNotFound
+	}
+	now := s.now()
+	o.DeadLetteredAt = nil
+	o.Failures = 0
+	o.FailingSince = nil
+	o.NextAttemptAt = now
+	o.UpdatedAt = now
+	order := copyOrder(o)
+	return &order, nil
+}
+
+// UpdateStatus moves the order through the status state machine and credits
+// the accrual only on the transition into PROCESSED.
+func (r *orderRepository) UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusChange, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return model.StatusChange{}, domainErrors.ErrNotFound
+	}
+	update, err := o.Status.Transition(status)
+	if err != nil {
+		return model.StatusChange{}, err
+	}
+	result := model.StatusChange{Update: update, UserID: o.UserID, Number: o.Number}
+	if update != model.StatusUpdateApplied {
+		return result, nil
+	}
+
+	previous := o.Status
+	o.Status = status
+	o.Accrual = copyMoney(accrual)
+	o.ClaimedBy = ""
+	o.LeaseUntil = nil
+	o.LastError = ""
+	o.Failures = 0
+	o.FailingSince = nil
+	o.UpdatedAt = s.now()
+	s.publishLocked(o.UserID, model.OrderStatusChanged{OrderID: o.ID, Number: o.Number, From: previous, To: status, Accrual: copyMoney(accrual)})
+
+	if status == model.OrderStatusProcessed && accrual != nil && *accrual > 0 {
+		s.addAccrualLocked(o, *accrual)
+	}
+	return result, nil
+}
+
+// Archive moves final orders last updated before the given time, oldest
+// first, into the archive.
+func (r *orderRepository) Archive(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	var ids []int64
+	for id, o := range s.orders {
+		if o.Status.IsFinal() && o.UpdatedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	for _, id := range ids {
+		s.archive[id] = s.orders[id]
+		delete(s.orders, id)
+	}
+	return int64(len(ids)), nil
+}
+
+// --- BalanceRepository implementation ---
+
+func (s *Storage) addAccrualLocked(o *model.Order, sum model.Money) {
+	balance := s.balanceLocked(o.UserID)
+	balance.Current += sum
+
+	id := o.ID
+	s.appendEntryLocked(model.LedgerEntry{
+		UserID:       o.UserID,
+		Kind:         model.LedgerEntryAccrual,
+		Amount:       sum,
+		BalanceAfter: balance.Current,
+		OrderNumber:  o.Number,
+		OrderID:      &id,
+	})
+	s.publishLocked(o.UserID, model.PointsAccrued{OrderID: o.ID, OrderNumber: o.Number, Amount: sum, BalanceAfter: balance.Current})
+}
+
+func (s *Storage) balanceLocked(userID int64) *model.BalanceSummary {
+	balance, ok := s.balances[userID]
+	if !ok {
+		balance = &model.BalanceSummary{}
+		s.balances[userID] = balance
+	}
+	return balance
+}
+
+func (s *Storage) appendEntryLocked(entry model.LedgerEntry) {
+	s.nextEntryID++
+	entry.ID = s.nextEntryID
+	entry.CreatedAt = s.now()
+	s.ledger = append(s.ledger, entry)
+}
+
+func (r *balanceRepository) AddAccrual(ctx context.Context, userID, orderID int64, sum model.Money) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return domainErrors.ErrNotFound
+	}
+	credited := *o
+	credited.UserID = userID
+	s.addAccrualLocked(&credited, sum)
+	return nil
+}
+
+func (r *balanceRepository) GetSummary(ctx context.Context, userID int64) (*model.BalanceSummary, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	balance, ok := s.balances[userID]
+	if !ok {
+		return &model.BalanceSummary{}, nil
+	}
+	summary := *balance
+	return &summary, nil
+}
+
+func (r *balanceRepository) Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	existing, err := s.findWithdrawalLocked(req)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, false, nil
+	}
+	key := rejectionKey{userID: req.UserID, key: req.IdempotencyKey}
+	if fingerprint, ok := s.rejections[key]; ok {
+		if fingerprint != req.Fingerprint() {
+			return nil, false, domainErrors.ErrIdempotencyConflict
+		}
+		return nil, false, domainErrors.ErrInsufficientBalance
+	}
+
+	balance := s.balanceLocked(req.UserID)
+	if balance.Current < req.Sum {
+		if req.IdempotencyKey != "" {
+			s.rejections[key] = req.Fingerprint()
+		}
+		return nil, false, domainErrors.ErrInsufficientBalance
+	}
+	balance.Current -= req.Sum
+	balance.Withdrawn += req.Sum
+
+	s.nextWithdraw++
+	w := model.Withdrawal{
+		ID:             s.nextWithdraw,
+		UserID:         req.UserID,
+		OrderNumber:    req.OrderNumber,
+		Sum:            req.Sum,
+		IdempotencyKey: req.IdempotencyKey,
+		Fingerprint:    req.Fingerprint(),
+		ProcessedAt:    s.now(),
+	}
+	s.withdrawals = append(s.withdrawals, w)
+
+	id := w.ID
+	s.appendEntryLocked(model.LedgerEntry{
+		UserID:       req.UserID,
+		Kind:         model.LedgerEntryWithdrawal,
+		Amount:       -req.Sum,
+		BalanceAfter: balance.Current,
+		OrderNumber:  req.OrderNumber,
+		WithdrawalID: &id,
+	})
+	s.publishLocked(req.UserID, model.PointsWithdrawn{WithdrawalID: w.ID, OrderNumber: w.OrderNumber, Sum: w.Sum, BalanceAfter: balance.Current})
+	return &w, true, nil
+}
+
+func (s *Storage) findWithdrawalLocked(req model.WithdrawalRequest) (*model.Withdrawal, error) {
+	var found *model.Withdrawal
+	fingerprint := req.Fingerprint()
+	for i := range s.withdrawals {
+		w := s.withdrawals[i]
+		sameKey := req.IdempotencyKey != "" && w.UserID == req.UserID && w.IdempotencyKey == req.IdempotencyKey
+		if w.OrderNumber != req.OrderNumber && !sameKey {
+			continue
+		}
+		if w.Fingerprint != fingerprint {
+			return nil, domainErrors.ErrIdempotencyConflict
+		}
+		if found == nil {
+			found = &w
+		}
+	}
+	return found, nil
+}
+
+func (r *balanceRepository) History(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	var result []model.LedgerEntry
+	for i := len(s.ledger) - 1; i >= 0; i-- {
+		if s.ledger[i].UserID == userID {
+			result = append(result, s.ledger[i])
+		}
+	}
+	return result, nil
+}
+
+// expectedBalancesLocked derives balances from processed orders, active and
+// archived, and from every recorded withdrawal.
+func (s *Storage) expectedBalancesLocked() map[int64]model.BalanceSummary {
+	expected := make(map[int64]model.BalanceSummary)
+	for _, orders := range []map[int64]*model.Order{s.orders, s.archive} {
+		for _, o := range orders {
+			if o.Status == model.OrderStatusProcessed && o.Accrual != nil {
+				balance := expected[o.UserID]
+				balance.Current += *o.Accrual
+				expected[o.UserID] = balance
+			}
+		}
+	}
+	for _, w := range s.withdrawals {
+		balance := expected[w.UserID]
+		balance.Current -= w.Sum
+		balance.Withdrawn += w.Sum
+		expected[w.UserID] = balance
+	}
+	return expected
+}
+
+// postedLocked sums the user's ledger postings.
+func (s *Storage) postedLocked(userID int64) model.Money {
+	var total model.Money
+	for _, entry := range s.ledger {
+		if entry.UserID == userID {
+			total += entry.Amount
+		}
+	}
+	return total
+}
+
+func (r *balanceRepository) FindDrifts(ctx context.Context) ([]model.BalanceDrift, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	expected := s.expectedBalancesLocked()
+	users := make(map[int64]struct{}, len(expected)+len(s.balances))
+	for id := range expected {
+		users[id] = struct{}{}
+	}
+	for id := range s.balances {
+		users[id] = struct{}{}
+	}
+
+	var drifts []model.BalanceDrift
+	for id := range users {
+		var actual model.BalanceSummary
+		if balance, ok := s.balances[id]; ok {
+			actual = *balance
+		}
+		if ledger := s.postedLocked(id); actual != expected[id] || ledger != actual.Current {
+			drifts = append(drifts, model.BalanceDrift{UserID: id, Expected: expected[id], Actual: actual, Ledger: ledger})
+		}
+	}
+	slices.SortFunc(drifts, func(a, b model.BalanceDrift) int { return cmp.Compare(a.UserID, b.UserID) })
+	return drifts, nil
+}
+
+func (r *balanceRepository) Repair(ctx context.Context, userID int64, reason string) (*model.BalanceAdjustment, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	balance := s.balanceLocked(userID)
+	before, after := *balance, s.expectedBalancesLocked()[userID]
+	posted := s.postedLocked(userID)
+	if before == after && posted == after.Current {
+		return nil, nil
+	}
+	*balance = after
+	adjustment := model.BalanceAdjustment{
+		ID:        int64(len(s.adjustments)) + 1,
+		UserID:    userID,
+		Before:    before,
+		After:     after,
+		Reason:    reason,
+		CreatedAt: s.now(),
+	}
+	s.adjustments = append(s.adjustments, adjustment)
+	if posted != after.Current {
+		s.appendEntryLocked(model.LedgerEntry{
+			UserID:       userID,
+			Kind:         model.LedgerEntryAdjustment,
+			Amount:       after.Current - posted,
+			BalanceAfter: after.Current,
+			AdjustmentID: &adjustment.ID,
+		})
+	}
+	return &adjustment, nil
+}
+
+// --- WithdrawalRepository implementation ---
+
+func (r *withdrawalRepository) ListByUser(ctx context.Context, userID int64) ([]model.Withdrawal, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	var result []model.Withdrawal
+	for i := len(s.withdrawals) - 1; i >= 0; i-- {
+		if s.withdrawals[i].UserID == userID {
+			result = append(result, s.withdrawals[i])
+		}
+	}
+	return result, nil
+}
+
+// ListPageByUser returns one newest-first keyset page of the user's withdrawals.
+func (r *withdrawalRepository) ListPageByUser(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	var result []model.Withdrawal
+	for i := len(s.withdrawals) - 1; i >= 0 && len(result) < page.Limit; i-- {
+		w := s.withdrawals[i]
+		if w.UserID != userID || (page.After != nil && !page.After.Follows(w.ProcessedAt, w.ID)) {
+			continue
+		}
+		result = append(result, w)
+	}
+	return result, nil
+}
+
+func (r *withdrawalRepository) Pseudonymize(ctx context.Context, userID int64) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	for i := range s.withdrawals {
+		if s.withdrawals[i].UserID == userID {
+			s.withdrawals[i].IdempotencyKey = ""
+		}
+	}
+	return nil
+}
+
+func copyOrder(o *model.Order) model.Order {
+	order := *o
+	order.Accrual = copyMoney(o.Accrual)
+	if o.LeaseUntil != nil {
+		until := *o.LeaseUntil
+		order.LeaseUntil = &until
+	}
+	if o.FailingSince != nil {
+		since := *o.FailingSince
+		order.FailingSince = &since
+	}
+	if o.DeadLetteredAt != nil {
+		at := *o.DeadLetteredAt
+		order.DeadLetteredAt = &at
+	}
+	return order
+}
+
+func copyMoney(m *model.Money) *model.Money {
+	if m == nil {
+		return nil
+	}
+	v := *m
+	return &v
+}
+
+// --- OutboxRepository implementation ---
+
+// publishLocked records a domain event next to the change that caused it.
+// The payloads are plain structs, so encoding cannot fail.
+func (s *Storage) publishLocked(userID int64, payload model.EventPayload) {
+	event, err := model.NewEvent(userID, payload)
+	if err != nil {
+		panic(err)
+	}
+	s.nextEventID++
+	event.ID = s.nextEventID
+	event.CreatedAt = s.now()
+	s.outbox = append(s.outbox, outboxEntry{event: event, availableAt: event.CreatedAt})
+}
+
+func (r *outboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.Event, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	now := s.now()
+	waiting := make(map[int64]bool)
+	var result []model.Event
+	for i := range s.outbox {
+		if len(result) >= limit {
+			break
+		}
+		entry := &s.outbox[i]
+		if entry.deliveredAt != nil || entry.deadLetteredAt != nil || waiting[entry.event.UserID] {
+			continue
+		}
+		if entry.availableAt.After(now) {
+			waiting[entry.event.UserID] = true
+			continue
+		}
+		entry.availableAt = now.Add(lease)
+		result = append(result, entry.event)
+	}
+	return result, nil
+}
+
+func (r *outboxRepository) Release(ctx context.Context, ids []int64) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	now := s.now()
+	for i := range s.outbox {
+		if s.outbox[i].deliveredAt == nil && slices.Contains(ids, s.outbox[i].event.ID) {
+			s.outbox[i].availableAt = now
+		}
+	}
+	return nil
+}
+
+func (r *outboxRepository) MarkDelivered(ctx context.Context, ids []int64) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	now := s.now()
+	for i := range s.outbox {
+		if slices.Contains(ids, s.outbox[i].event.ID) {
+			s.outbox[i].deliveredAt = &now
+			s.outbox[i].lastError = ""
+		}
+	}
+	return nil
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id int64, retryAfter time.Duration, lastErr string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	for i := range s.outbox {
+		if s.outbox[i].event.ID == id {
+			entry := &s.outbox[i]
+			entry.event.Attempts++
+			entry.lastError = lastErr
+			entry.availableAt = s.now().Add(retryAfter)
+			return nil
+		}
+	}
+	return domainErrors.ErrNotFound
+}
+
+func (r *outboxRepository) DeadLetter(ctx context.Context, id int64, lastErr string) error {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	for i := range s.outbox {
+		if s.outbox[i].event.ID == id {
+			entry := &s.outbox[i]
+			now := s.now()
+			entry.event.Attempts++
+			entry.lastError = lastErr
+			entry.deadLetteredAt = &now
+			return nil
+		}
+	}
+	return domainErrors.ErrNotFound
+}
+
+func (r *outboxRepository) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	kept := s.outbox[:0]
+	var deleted int64
+	for _, entry := range s.outbox {
+		if entry.deliveredAt != nil && entry.deliveredAt.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	s.outbox = kept
+	return deleted, nil
+}
+
+// --- AuditRepository implementation ---
+
+func (r *auditRepository) Append(ctx context.Context, event model.AuditEvent) (*model.AuditEvent, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	prev := model.AuditGenesisHash
+	if n := len(s.audit); n > 0 {
+		prev = s.audit[n-1].Hash
+	}
+	event.ID = int64(len(s.audit)) + 1
+	event.CreatedAt = s.now().UTC()
+	event.Link(prev)
+	s.audit = append(s.audit, event)
+	return &event, nil
+}
+
+func (r *auditRepository) Find(ctx context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	var result []model.AuditEvent
+	for i := len(s.audit) - 1; i >= 0 && (page.Limit <= 0 || len(result) < page.Limit); i-- {
+		e := s.audit[i]
+		if !filter.Matches(e) || (page.After != nil && !page.After.Follows(e.CreatedAt, e.ID)) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+func (r *auditRepository) Chain(ctx context.Context, afterID int64, limit int) ([]model.AuditEvent, error) {
+	s := r.storage
+	defer s.lock(ctx)()
+
+	start := min(max(afterID, 0), int64(len(s.audit)))
+	end := min(start+int64(limit), int64(len(s.audit)))
+	return append([]model.AuditEvent(nil), s.audit[start:end]...), nil
+}
@@ -0,0 +1,1266 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+var _ repository.Factory = (*Storage)(nil)
+
+func newTestStorage() *Storage {
+	s := New()
+	base := time.Unix(1700000000, 0)
+	var tick int64
+	s.now = func() time.Time {
+		tick++
+		return base.Add(time.Duration(tick) * time.Second)
+	}
+	return s
+}
+
+func TestIsDSN(t *testing.T) {
+	if !IsDSN("memory://") || !IsDSN("memory://local") {
+		t.Fatal("expected memory scheme to match")
+	}
+	if IsDSN("postgres://localhost/db") {
+		t.Fatal("expected postgres DSN to be rejected")
+	}
+}
+
+func TestUserRepository(t *testing.T) {
+	ctx := context.Background()
+	users := newTestStorage().Users()
+
+	created, err := users.Create(ctx, "alice", "hash")
+	if err != nil || created.ID != 1 || created.CreatedAt.IsZero() {
+		t.Fatalf("unexpected user %+v err=%v", created, err)
+	}
+	if _, err := users.Create(ctx, "alice", "other"); !errors.Is(err, domainErrors.ErrAlreadyExists) {
+		t.Fatalf("expected already exists, got %v", err)
+	}
+
+	byLogin, err := users.GetByLogin(ctx, "alice")
+	if err != nil || byLogin.ID != created.ID {
+		t.Fatalf("unexpected user %+v err=%v", byLogin, err)
+	}
+	byLogin.Login = "mutated"
+	byID, err := users.GetByID(ctx, created.ID)
+	if err != nil || byID.Login != "alice" {
+		t.Fatalf("expected stored user to be isolated from callers, got %+v err=%v", byID, err)
+	}
+
+	if _, err := users.GetByLogin(ctx, "bob"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := users.GetByID(ctx, 42); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestUserRepositoryAnonymize(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	users := s.Users()
+	alice, _ := users.Create(ctx, "alice", "hash")
+	if _, err := users.Create(ctx, "taken", "hash"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	order, _, _ := s.Orders().Create(ctx, alice.ID, "12345678903")
+	if err := s.Balances().AddAccrual(ctx, alice.ID, order.ID, model.MustParseMoney("10")); err != nil {
+		t.Fatalf("add accrual failed: %v", err)
+	}
+	if _, _, err := s.Balances().Withdraw(ctx, model.WithdrawalRequest{UserID: alice.ID, OrderNumber: "2377225624", Sum: model.MustParseMoney("5"), IdempotencyKey: "pos-1"}); err != nil {
+		t.Fatalf("withdraw failed: %v", err)
+	}
+
+	if _, err := users.Anonymize(ctx, alice.ID, "taken"); !errors.Is(err, domainErrors.ErrAlreadyExists) {
+		t.Fatalf("expected taken pseudonym rejected, got %v", err)
+	}
+	err := s.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		if _, err := users.Anonymize(ctx, alice.ID, "deleted-1"); err != nil {
+			return err
+		}
+		return s.Withdrawals().Pseudonymize(ctx, alice.ID)
+	})
+	if err != nil {
+		t.Fatalf("anonymize failed: %v", err)
+	}
+
+	closed, err := users.GetByID(ctx, alice.ID)
+	if err != nil || closed.Login != "deleted-1" || closed.PasswordHash != "" || !closed.Deleted() || !closed.CreatedAt.Equal(alice.CreatedAt) {
+		t.Fatalf("unexpected anonymized user %+v err=%v", closed, err)
+	}
+	if _, err := users.GetByLogin(ctx, "alice"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected old login released, got %v", err)
+	}
+	if _, err := users.Create(ctx, "alice", "new"); err != nil {
+		t.Fatalf("expected old login free for reuse, got %v", err)
+	}
+	if _, err := users.Anonymize(ctx, alice.ID, "deleted-2"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected closed account not found, got %v", err)
+	}
+
+	withdrawals, _ := s.Withdrawals().ListByUser(ctx, alice.ID)
+	if len(withdrawals) != 1 || withdrawals[0].IdempotencyKey != "" || withdrawals[0].OrderNumber != "2377225624" {
+		t.Fatalf("expected withdrawal kept without its idempotency key, got %+v", withdrawals)
+	}
+	events, _ := s.Outbox().Claim(ctx, 10, time.Minute)
+	if last := events[len(events)-1]; last.Type != model.EventAccountDeleted || last.UserID != alice.ID {
+		t.Fatalf("expected account deletion published, got %+v", last)
+	}
+}
+
+func TestOrderRepositoryCreateOwnership(t *testing.T) {
+	ctx := context.Background()
+	orders := newTestStorage().Orders()
+
+	order, created, err := orders.Create(ctx, 1, "12345678903")
+	if err != nil || !created || order.Status != model.OrderStatusNew {
+		t.Fatalf("unexpected create result %+v created=%v err=%v", order, created, err)
+	}
+
+	again, created, err := orders.Create(ctx, 1, "12345678903")
+	if err != nil || created || again.ID != order.ID {
+		t.Fatalf("expected existing order for same user, got %+v created=%v err=%v", again, created, err)
+	}
+
+	foreign, created, err := orders.Create(ctx, 2, "12345678903")
+	if !errors.Is(err, domainErrors.ErrAlreadyExists) || created || foreign.UserID != 1 {
+		t.Fatalf("expected conflict for another user, got %+v created=%v err=%v", foreign, created, err)
+	}
+
+	if _, err := orders.GetByNumber(ctx, "79927398713"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestOrderRepositoryCreateBatch(t *testing.T) {
+	ctx := context.Background()
+	orders := newTestStorage().Orders()
+
+	if _, _, err := orders.Create(ctx, 2, "12345678903"); err != nil {
+		t.Fatalf("seed create: %v", err)
+	}
+	if _, _, err := orders.Create(ctx, 1, "4561261212345467"); err != nil {
+		t.Fatalf("seed create: %v", err)
+	}
+
+	uploads, err := orders.CreateBatch(ctx, 1, []string{"79927398713", "12345678903", "4561261212345467"})
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	want := []model.OrderUploadResult{model.OrderUploadAccepted, model.OrderUploadOwnedByAnother, model.OrderUploadAlreadyYours}
+	if len(uploads) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), uploads)
+	}
+	for i, result := range want {
+		if uploads[i].Result != result {
+			t.Fatalf("result %d: expected %s, got %+v", i, result, uploads[i])
+		}
+	}
+
+	created, err := orders.GetByNumber(ctx, "79927398713")
+	if err != nil || created.UserID != 1 || created.Status != model.OrderStatusNew {
+		t.Fatalf("expected accepted order to be stored, got %+v err=%v", created, err)
+	}
+}
+
+func TestOrderRepositoryListByUser(t *testing.T) {
+	ctx := context.Background()
+	orders := newTestStorage().Orders()
+
+	for _, number := range []string{"1", "2", "3"} {
+		if _, _, err := orders.Create(ctx, 1, number); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+	if _, _, err := orders.Create(ctx, 2, "4"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	list, err := orders.ListByUser(ctx, 1)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("unexpected list %+v err=%v", list, err)
+	}
+	if list[0].Number != "3" || list[2].Number != "1" {
+		t.Fatalf("expected newest first, got %+v", list)
+	}
+
+	empty, err := orders.ListByUser(ctx, 3)
+	if err != nil || len(empty) != 0 {
+		t.Fatalf("expected no orders, got %+v err=%v", empty, err)
+	}
+}
+
+func TestOrderRepositorySelectBatchForProcessing(t *testing.T) {
+	ctx := context.Background()
+	orders := newTestStorage().Orders()
+
+	for _, number := range []string{"1", "2", "3"} {
+		if _, _, err := orders.Create(ctx, 1, number); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+	final, _, _ := orders.Create(ctx, 1, "4")
+	if _, err := orders.UpdateStatus(ctx, final.ID, model.OrderStatusInvalid, nil); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	batch, err := orders.SelectBatchForProcessing(ctx, model.OrderClaim{Owner: "a", Limit: 2, Lease: time.Minute})
+	if err != nil || len(batch) != 2 {
+		t.Fatalf("unexpected batch %+v err=%v", batch, err)
+	}
+	if batch[0].Number != "1" || batch[1].Number != "2" || batch[0].Status != model.OrderStatusProcessing {
+		t.Fatalf("expected oldest orders claimed as processing, got %+v", batch)
+	}
+	if batch[0].ClaimedBy != "a" || batch[0].LeaseUntil == nil || batch[0].Attempts != 1 {
+		t.Fatalf("expected lease to be recorded, got %+v", batch[0])
+	}
+
+	stored, _ := orders.GetByNumber(ctx, "1")
+	if stored.Status != model.OrderStatusProcessing {
+		t.Fatalf("expected stored status to change, got %s", stored.Status)
+	}
+
+	rest, err := orders.SelectBatchForProcessing(ctx, model.OrderClaim{Owner: "b", Limit: 10, Lease: time.Minute})
+	if err != nil || len(rest) != 1 || rest[0].Number != "3" {
+		t.Fatalf("expected leased and terminal orders to be skipped, got %+v err=%v", rest, err)
+	}
+}
+
+func TestOrderRepositoryLeases(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	orders := s.Orders()
+
+	order, _, _ := orders.Create(ctx, 1, "1")
+	if _, err := orders.SelectBatchForProcessing(ctx, model.OrderClaim{Owner: "a", Limit: 1, Lease: time.Minute}); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+
+	if err := orders.Reschedule(ctx, order.ID, "b", time.Second, ""); !errors.Is(err, domainErrors.ErrLeaseLost) {
+		t.Fatalf("expected foreign reschedule to fail, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	reclaimed, err := orders.SelectBatchForProcessing(ctx, model.OrderClaim{Owner: "b", Limit: 1, Lease: time.Minute})
+	if err != nil || len(reclaimed) != 1 || reclaimed[0].ClaimedBy != "b" || reclaimed[0].Attempts != 2 {
+		t.Fatalf("expected expired lease to be reclaimed, got %+v err=%v", reclaimed, err)
+	}
+	if err := orders.Reschedule(ctx, order.ID, "a", time.Second, ""); !errors.Is(err, domainErrors.ErrLeaseLost) {
+		t.Fatalf("expected stale owner to lose lease, got %v", err)
+	}
+
+	if err := orders.Reschedule(ctx, order.ID, "b", 30*time.Second, "not registered"); err != nil {
+		t.Fatalf("reschedule failed: %v", err)
+	}
+	if batch, _ := orders.SelectBatchForProcessing(ctx, model.OrderClaim{Owner: "a", Limit: 1, Lease: time.Minute}); len(batch) != 0 {
+		t.Fatalf("expected order not to be due yet, got %+v", batch)
+	}
+
+	now = now.Add(30 * time.Second)
+	due, err := orders.SelectBatchForProcessing(ctx, model.OrderClaim{Owner: "a", Limit: 1, Lease: time.Minute})
+	if err != nil || len(due) != 1 || due[0].LastError != "not registered" || due[0].Attempts != 3 {
+		t.Fatalf("expected rescheduled order to be due, got %+v err=%v", due, err)
+	}
+
+	if _, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusInvalid, nil); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	stored, _ := orders.GetByNumber(ctx, "1")
+	if stored.ClaimedBy != "" || stored.LeaseUntil != nil || stored.LastError != "" {
+		t.Fatalf("expected final status to release lease, got %+v", stored)
+	}
+}
+
+func TestOrderRepositorySuccessEndsFailureStreak(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	orders := s.Orders()
+	claim := model.OrderClaim{Owner: "a", Limit: 1, Lease: time.Minute}
+
+	order, _, _ := orders.Create(ctx, 1, "1")
+	if _, err := orders.SelectBatchForProcessing(ctx, claim); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	if err := orders.RecordFailure(ctx, order.ID, "a", 0, "boom"); err != nil {
+		t.Fatalf("record failure: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := orders.SelectBatchForProcessing(ctx, claim); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	if err := orders.Reschedule(ctx, order.ID, "a", 0, ""); err != nil {
+		t.Fatalf("reschedule: %v", err)
+	}
+
+	now = now.Add(25 * time.Hour)
+	batch, err := orders.SelectBatchForProcessing(ctx, claim)
+	if err != nil || len(batch) != 1 || batch[0].Failures != 0 || batch[0].FailingSince != nil {
+		t.Fatalf("expected the successful poll to clear the streak, got %+v err=%v", batch, err)
+	}
+	if err := orders.RecordFailure(ctx, order.ID, "a", 0, "boom"); err != nil {
+		t.Fatalf("record failure: %v", err)
+	}
+	stored, _ := orders.GetByNumber(ctx, "1")
+	if stored.Failures != 1 || stored.FailingSince == nil || !stored.FailingSince.Equal(now) {
+		t.Fatalf("expected a fresh streak starting now, got %+v", stored)
+	}
+
+	if _, err := orders.SelectBatchForProcessing(ctx, claim); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	if err := orders.Reschedule(ctx, order.ID, "a", 0, "429 Too Many Requests"); err != nil {
+		t.Fatalf("reschedule: %v", err)
+	}
+	if stored, _ := orders.GetByNumber(ctx, "1"); stored.Failures != 1 {
+		t.Fatalf("expected a deferred error not to clear the streak, got %+v", stored)
+	}
+	if _, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessed, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if stored, _ := orders.GetByNumber(ctx, "1"); stored.Failures != 0 || stored.FailingSince != nil {
+		t.Fatalf("expected the final status to clear the streak, got %+v", stored)
+	}
+}
+
+func TestOrderRepositoryRelease(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	orders := s.Orders()
+	claim := model.OrderClaim{Owner: "a", Limit: 1, Lease: time.Minute}
+
+	order, _, _ := orders.Create(ctx, 1, "1")
+	if _, err := orders.SelectBatchForProcessing(ctx, claim); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	if err := orders.Release(ctx, order.ID, "b"); !errors.Is(err, domainErrors.ErrLeaseLost) {
+		t.Fatalf("expected foreign release to lose lease, got %v", err)
+	}
+	if err := orders.Release(ctx, order.ID, "a"); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+
+	batch, err := orders.SelectBatchForProcessing(ctx, claim)
+	if err != nil || len(batch) != 1 || batch[0].Attempts != 1 || batch[0].Failures != 0 {
+		t.Fatalf("expected released order due again without counting the attempt, got %+v err=%v", batch, err)
+	}
+}
+
+func TestOrderRepositoryDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	orders := s.Orders()
+	claim := model.OrderClaim{Owner: "a", Limit: 1, Lease: time.Minute}
+
+	order, _, _ := orders.Create(ctx, 1, "1")
+	if _, err := orders.SelectBatchForProcessing(ctx, claim); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	if err := orders.RecordFailure(ctx, order.ID, "b", time.Second, "boom"); !errors.Is(err, domainErrors.ErrLeaseLost) {
+		t.Fatalf("expected foreign failure to lose lease, got %v", err)
+	}
+	if err := orders.RecordFailure(ctx, order.ID, "a", 10*time.Second, "not registered"); err != nil {
+		t.Fatalf("record failure failed: %v", err)
+	}
+	if batch, _ := orders.SelectBatchForProcessing(ctx, claim); len(batch) != 0 {
+		t.Fatalf("expected failed order to back off, got %+v", batch)
+	}
+
+	failedAt := now
+	now = now.Add(10 * time.Second)
+	batch, err := orders.SelectBatchForProcessing(ctx, claim)
+	if err != nil || len(batch) != 1 || batch[0].Failures != 1 || batch[0].FailingSince == nil || !batch[0].FailingSince.Equal(failedAt) {
+		t.Fatalf("expected order due with one failure, got %+v err=%v", batch, err)
+	}
+
+	if err := orders.DeadLetter(ctx, order.ID, "b", "boom"); !errors.Is(err, domainErrors.ErrLeaseLost) {
+		t.Fatalf("expected foreign dead-letter to lose lease, got %v", err)
+	}
+	if err := orders.DeadLetter(ctx, order.ID, "a", "boom"); err != nil {
+		t.Fatalf("dead-letter failed: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if batch, _ := orders.SelectBatchForProcessing(ctx, claim); len(batch) != 0 {
+		t.Fatalf("expected dead-lettered order to stay parked, got %+v", batch)
+	}
+
+	other, _, _ := orders.Create(ctx, 1, "2")
+	if _, err := orders.SelectBatchForProcessing(ctx, claim); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := orders.DeadLetter(ctx, other.ID, "a", "boom"); err != nil {
+		t.Fatalf("dead-letter failed: %v", err)
+	}
+
+	parked, err := orders.FindDeadLettered(ctx, model.Page{Limit: 1})
+	if err != nil || len(parked) != 1 || parked[0].Number != "2" || !parked[0].NeedsAttention() {
+		t.Fatalf("expected most recently parked order first, got %+v err=%v", parked, err)
+	}
+	after := model.Cursor{Time: *parked[0].DeadLetteredAt, ID: parked[0].ID}
+	rest, err := orders.FindDeadLettered(ctx, model.Page{After: &after})
+	if err != nil || len(rest) != 1 || rest[0].Number != "1" || rest[0].Failures != 2 || rest[0].LastError != "boom" {
+		t.Fatalf("expected second parked order on next page, got %+v err=%v", rest, err)
+	}
+
+	if _, err := orders.Requeue(ctx, "3"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected unknown order not to requeue, got %v", err)
+	}
+	requeued, err := orders.Requeue(ctx, "1")
+	if err != nil || requeued.NeedsAttention() || requeued.Failures != 0 || requeued.FailingSince != nil {
+		t.Fatalf("expected fresh retry budget, got %+v err=%v", requeued, err)
+	}
+	if _, err := orders.Requeue(ctx, "1"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected active order not to requeue, got %v", err)
+	}
+	batch, err = orders.SelectBatchForProcessing(ctx, claim)
+	if err != nil || len(batch) != 1 || batch[0].Number != "1" {
+		t.Fatalf("expected requeued order to be due, got %+v err=%v", batch, err)
+	}
+}
+
+func TestOrderRepositoryUpdateStatusCreditsBalance(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders, balances := s.Orders(), s.Balances()
+
+	order, _, _ := orders.Create(ctx, 7, "12345678903")
+	accrual := model.MustParseMoney("729.98")
+	if _, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessed, &accrual); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	accrual = 0
+
+	stored, _ := orders.GetByNumber(ctx, "12345678903")
+	if stored.Status != model.OrderStatusProcessed || stored.Accrual == nil || *stored.Accrual != model.MustParseMoney("729.98") {
+		t.Fatalf("unexpected stored order %+v", stored)
+	}
+
+	summary, _ := balances.GetSummary(ctx, 7)
+	if summary.Current != model.MustParseMoney("729.98") {
+		t.Fatalf("unexpected balance %+v", summary)
+	}
+
+	history, _ := balances.History(ctx, 7)
+	if len(history) != 1 || history[0].Kind != model.LedgerEntryAccrual || history[0].OrderID == nil || *history[0].OrderID != order.ID {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	if _, err := orders.UpdateStatus(ctx, 999, model.OrderStatusInvalid, nil); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestOrderRepositoryUpdateStatusCreditsOnce(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders, balances := s.Orders(), s.Balances()
+
+	order, _, _ := orders.Create(ctx, 7, "12345678903")
+	if result, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessing, nil); err != nil || result.Update != model.StatusUpdateApplied || result.UserID != 7 || result.Number != "12345678903" {
+		t.Fatalf("expected processing to apply, got %v err=%v", result, err)
+	}
+	if result, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessing, nil); err != nil || result.Update != model.StatusUpdateNoop {
+		t.Fatalf("expected repeated processing to be a no-op, got %v err=%v", result, err)
+	}
+	if _, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusNew, nil); !errors.Is(err, domainErrors.ErrInvalidStatusTransition) {
+		t.Fatalf("expected invalid transition, got %v", err)
+	}
+
+	accrual := model.MustParseMoney("100")
+	var wg sync.WaitGroup
+	results := make(chan model.StatusUpdate, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessed, &accrual)
+			if err != nil {
+				t.Errorf("update failed: %v", err)
+			}
+			results <- result.Update
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	applied := 0
+	for result := range results {
+		if result == model.StatusUpdateApplied {
+			applied++
+		} else if result != model.StatusUpdateAlreadyFinal {
+			t.Fatalf("unexpected result %v", result)
+		}
+	}
+	if applied != 1 {
+		t.Fatalf("expected exactly one applied update, got %d", applied)
+	}
+
+	summary, _ := balances.GetSummary(ctx, 7)
+	history, _ := balances.History(ctx, 7)
+	if summary.Current != accrual || len(history) != 1 {
+		t.Fatalf("expected single credit, got balance %+v history %+v", summary, history)
+	}
+
+	if result, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusInvalid, nil); err != nil || result.Update != model.StatusUpdateAlreadyFinal {
+		t.Fatalf("expected final order to stay put, got %v err=%v", result, err)
+	}
+}
+
+func TestBalanceRepositoryWithdraw(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders, balances, withdrawals := s.Orders(), s.Balances(), s.Withdrawals()
+
+	if _, _, err := balances.Withdraw(ctx, model.WithdrawalRequest{UserID: 1, OrderNumber: "2377225624", Sum: model.MustParseMoney("1")}); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
+		t.Fatalf("expected insufficient balance, got %v", err)
+	}
+
+	order, _, _ := orders.Create(ctx, 1, "12345678903")
+	if err := balances.AddAccrual(ctx, 1, order.ID, model.MustParseMoney("100")); err != nil {
+		t.Fatalf("add accrual failed: %v", err)
+	}
+	if err := balances.AddAccrual(ctx, 1, 999, model.MustParseMoney("1")); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found for unknown order, got %v", err)
+	}
+
+	if _, created, err := balances.Withdraw(ctx, model.WithdrawalRequest{UserID: 1, OrderNumber: "2377225624", Sum: model.MustParseMoney("40.5")}); err != nil || !created {
+		t.Fatalf("withdraw failed: %v", err)
+	}
+	if _, _, err := balances.Withdraw(ctx, model.WithdrawalRequest{UserID: 1, OrderNumber: "2377225625", Sum: model.MustParseMoney("60")}); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
+		t.Fatalf("expected insufficient balance, got %v", err)
+	}
+
+	summary, _ := balances.GetSummary(ctx, 1)
+	if summary.Current != model.MustParseMoney("59.5") || summary.Withdrawn != model.MustParseMoney("40.5") {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	list, err := withdrawals.ListByUser(ctx, 1)
+	if err != nil || len(list) != 1 || list[0].OrderNumber != "2377225624" {
+		t.Fatalf("unexpected withdrawals %+v err=%v", list, err)
+	}
+
+	history, _ := balances.History(ctx, 1)
+	if len(history) != 2 || history[0].Kind != model.LedgerEntryWithdrawal || history[0].Amount != model.MustParseMoney("-40.5") || history[0].BalanceAfter != summary.Current {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	empty, _ := balances.GetSummary(ctx, 2)
+	if empty.Current != 0 || empty.Withdrawn != 0 {
+		t.Fatalf("expected empty summary, got %+v", empty)
+	}
+}
+
+func TestBalanceRepositoryConcurrentWithdrawals(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	order, _, _ := s.Orders().Create(ctx, 1, "12345678903")
+	if err := s.Balances().AddAccrual(ctx, 1, order.ID, model.MustParseMoney("10")); err != nil {
+		t.Fatalf("add accrual failed: %v", err)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := model.WithdrawalRequest{UserID: 1, OrderNumber: strconv.Itoa(i), Sum: model.MustParseMoney("1")}
+			if _, _, err := s.Balances().Withdraw(ctx, req); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	summary, _ := s.Balances().GetSummary(ctx, 1)
+	if succeeded != 10 || summary.Current != 0 || summary.Withdrawn != model.MustParseMoney("10") {
+		t.Fatalf("expected exactly 10 withdrawals, got %d with summary %+v", succeeded, summary)
+	}
+}
+
+func TestBalanceRepositoryWithdrawIdempotency(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	order, _, _ := s.Orders().Create(ctx, 1, "12345678903")
+	if err := s.Balances().AddAccrual(ctx, 1, order.ID, model.MustParseMoney("100")); err != nil {
+		t.Fatalf("add accrual failed: %v", err)
+	}
+
+	req := model.WithdrawalRequest{UserID: 1, OrderNumber: "2377225624", Sum: model.MustParseMoney("10"), IdempotencyKey: "pos-1"}
+	first, created, err := s.Balances().Withdraw(ctx, req)
+	if err != nil || !created {
+		t.Fatalf("first withdraw failed: created=%v err=%v", created, err)
+	}
+
+	replayed, created, err := s.Balances().Withdraw(ctx, req)
+	if err != nil || created || replayed.ID != first.ID {
+		t.Fatalf("expected replay, got %+v created=%v err=%v", replayed, created, err)
+	}
+
+	sameOrder := req
+	sameOrder.IdempotencyKey = ""
+	if _, created, err := s.Balances().Withdraw(ctx, sameOrder); err != nil || created {
+		t.Fatalf("expected replay by order number, created=%v err=%v", created, err)
+	}
+
+	reusedKey := req
+	reusedKey.OrderNumber = "2377225625"
+	if _, _, err := s.Balances().Withdraw(ctx, reusedKey); !errors.Is(err, domainErrors.ErrIdempotencyConflict) {
+		t.Fatalf("expected conflict for reused key, got %v", err)
+	}
+
+	foreign := model.WithdrawalRequest{UserID: 2, OrderNumber: req.OrderNumber, Sum: req.Sum}
+	if _, _, err := s.Balances().Withdraw(ctx, foreign); !errors.Is(err, domainErrors.ErrIdempotencyConflict) {
+		t.Fatalf("expected conflict for order used by another user, got %v", err)
+	}
+
+	summary, _ := s.Balances().GetSummary(ctx, 1)
+	if summary.Current != model.MustParseMoney("90") || summary.Withdrawn != model.MustParseMoney("10") {
+		t.Fatalf("expected single debit, got %+v", summary)
+	}
+}
+
+func TestBalanceRepositoryWithdrawReplaysRejection(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	req := model.WithdrawalRequest{UserID: 1, OrderNumber: "2377225624", Sum: model.MustParseMoney("10"), IdempotencyKey: "pos-1"}
+	if _, _, err := s.Balances().Withdraw(ctx, req); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
+		t.Fatalf("expected insufficient balance, got %v", err)
+	}
+
+	order, _, _ := s.Orders().Create(ctx, 1, "12345678903")
+	if err := s.Balances().AddAccrual(ctx, 1, order.ID, model.MustParseMoney("100")); err != nil {
+		t.Fatalf("add accrual failed: %v", err)
+	}
+	if _, _, err := s.Balances().Withdraw(ctx, req); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
+		t.Fatalf("expected retry to replay the rejection after top-up, got %v", err)
+	}
+	changed := req
+	changed.Sum = model.MustParseMoney("5")
+	if _, _, err := s.Balances().Withdraw(ctx, changed); !errors.Is(err, domainErrors.ErrIdempotencyConflict) {
+		t.Fatalf("expected conflict for a different payload, got %v", err)
+	}
+
+	unkeyed := req
+	unkeyed.IdempotencyKey = ""
+	if _, created, err := s.Balances().Withdraw(ctx, unkeyed); err != nil || !created {
+		t.Fatalf("expected request without key to run again, created=%v err=%v", created, err)
+	}
+}
+
+func TestWithinTxCommitsAndRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	tx := s.Transactions()
+
+	err := tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		user, err := s.Users().Create(ctx, "alice", "hash")
+		if err != nil {
+			return err
+		}
+		_, _, err = s.Orders().Create(ctx, user.ID, "12345678903")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.Orders().GetByNumber(ctx, "12345678903"); err != nil {
+		t.Fatalf("expected committed order, got %v", err)
+	}
+
+	boom := errors.New("boom")
+	err = tx.WithinTx(ctx, repository.TxOptions{Isolation: repository.IsolationSerializable}, func(ctx context.Context) error {
+		order, _ := s.Orders().GetByNumber(ctx, "12345678903")
+		accrual := model.MustParseMoney("10")
+		if _, err := s.Orders().UpdateStatus(ctx, order.ID, model.OrderStatusProcessed, &accrual); err != nil {
+			return err
+		}
+		return tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+			if _, err := s.Users().Create(ctx, "bob", "hash"); err != nil {
+				return err
+			}
+			return boom
+		})
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected boom, got %v", err)
+	}
+
+	order, _ := s.Orders().GetByNumber(ctx, "12345678903")
+	summary, _ := s.Balances().GetSummary(ctx, order.UserID)
+	history, _ := s.Balances().History(ctx, order.UserID)
+	if order.Status != model.OrderStatusNew || summary.Current != 0 || len(history) != 0 {
+		t.Fatalf("expected rollback, got order %+v balance %+v history %+v", order, summary, history)
+	}
+	if _, err := s.Users().GetByLogin(ctx, "bob"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected nested write to roll back, got %v", err)
+	}
+	if user, _ := s.Users().Create(ctx, "carol", "hash"); user.ID != 2 {
+		t.Fatalf("expected id sequence to roll back, got %d", user.ID)
+	}
+}
+
+func TestWithinTxRollsBackOnPanic(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+
+	func() {
+		defer func() { _ = recover() }()
+		_ = s.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+			_, _ = s.Users().Create(ctx, "alice", "hash")
+			panic("boom")
+		})
+	}()
+
+	if _, err := s.Users().GetByLogin(ctx, "alice"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected rollback after panic, got %v", err)
+	}
+}
+
+func TestListPageByUser(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders := s.Orders()
+
+	for i := 1; i <= 5; i++ {
+		if _, _, err := orders.Create(ctx, 1, strconv.Itoa(i)); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+	_, _, _ = orders.Create(ctx, 2, "99")
+
+	var numbers []string
+	page := model.Page{Limit: 2}
+	for {
+		batch, err := orders.FindByUser(ctx, 1, model.OrderFilter{}, page)
+		if err != nil {
+			t.Fatalf("list page failed: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, o := range batch {
+			numbers = append(numbers, o.Number)
+		}
+		last := batch[len(batch)-1]
+		page.After = &model.Cursor{Time: last.UploadedAt, ID: last.ID}
+	}
+	if strings.Join(numbers, ",") != "5,4,3,2,1" {
+		t.Fatalf("unexpected paging order %v", numbers)
+	}
+
+	balances := s.Balances()
+	credit, _, _ := orders.Create(ctx, 1, "12345678903")
+	accrual := model.MustParseMoney("100")
+	_, _ = orders.UpdateStatus(ctx, credit.ID, model.OrderStatusProcessed, &accrual)
+	for _, number := range []string{"2377225624", "79927398713", "4561261212345467"} {
+		if _, _, err := balances.Withdraw(ctx, model.WithdrawalRequest{UserID: 1, OrderNumber: number, Sum: model.MustParseMoney("1")}); err != nil {
+			t.Fatalf("withdraw failed: %v", err)
+		}
+	}
+
+	first, err := s.Withdrawals().ListPageByUser(ctx, 1, model.Page{Limit: 2})
+	if err != nil || len(first) != 2 || first[0].OrderNumber != "4561261212345467" {
+		t.Fatalf("unexpected first withdrawals page %+v err=%v", first, err)
+	}
+	last := first[len(first)-1]
+	rest, err := s.Withdrawals().ListPageByUser(ctx, 1, model.Page{Limit: 2, After: &model.Cursor{Time: last.ProcessedAt, ID: last.ID}})
+	if err != nil || len(rest) != 1 || rest[0].OrderNumber != "2377225624" {
+		t.Fatalf("unexpected second withdrawals page %+v err=%v", rest, err)
+	}
+}
+
+func TestFindByUserFilters(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders := s.Orders()
+
+	for i, number := range []string{"120", "121", "130", "122"} {
+		order, _, err := orders.Create(ctx, 1, number)
+		if err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+		if i < 3 {
+			accrual := model.MoneyFromMinor(int64(300 - i*100))
+			if _, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessed, &accrual); err != nil {
+				t.Fatalf("update failed: %v", err)
+			}
+		}
+	}
+
+	numbers := func(list []model.Order) string {
+		out := make([]string, 0, len(list))
+		for _, o := range list {
+			out = append(out, o.Number)
+		}
+		return strings.Join(out, ",")
+	}
+
+	filter := model.OrderFilter{Statuses: []model.OrderStatus{model.OrderStatusProcessed}, NumberPrefix: "12", SortBy: model.OrderSortAccrual, Ascending: true}
+	found, err := orders.FindByUser(ctx, 1, filter, model.Page{})
+	if err != nil || numbers(found) != "121,120" {
+		t.Fatalf("unexpected filtered orders %v err=%v", numbers(found), err)
+	}
+
+	first, err := orders.FindByUser(ctx, 1, model.OrderFilter{SortBy: model.OrderSortAccrual}, model.Page{Limit: 2})
+	if err != nil || numbers(first) != "120,121" {
+		t.Fatalf("unexpected first accrual page %v err=%v", numbers(first), err)
+	}
+	after := model.OrderFilter{SortBy: model.OrderSortAccrual}.CursorFor(first[1])
+	rest, err := orders.FindByUser(ctx, 1, model.OrderFilter{SortBy: model.OrderSortAccrual}, model.Page{Limit: 2, After: &after})
+	if err != nil || numbers(rest) != "130,122" {
+		t.Fatalf("unexpected second accrual page %v err=%v", numbers(rest), err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	found, err = orders.FindByUser(ctx, 1, model.OrderFilter{From: &future}, model.Page{})
+	if err != nil || len(found) != 0 {
+		t.Fatalf("expected no orders after %v, got %v err=%v", future, numbers(found), err)
+	}
+}
+
+func TestOrderRepositoryArchive(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders := s.Orders()
+
+	var ids []int64
+	for _, number := range []string{"1", "2", "3"} {
+		order, _, err := orders.Create(ctx, 1, number)
+		if err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+		ids = append(ids, order.ID)
+	}
+	accrual := model.MustParseMoney("10")
+	if _, err := orders.UpdateStatus(ctx, ids[0], model.OrderStatusProcessed, &accrual); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, err := orders.UpdateStatus(ctx, ids[1], model.OrderStatusInvalid, nil); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	if moved, err := orders.Archive(ctx, time.Unix(1700000000, 0), 10); err != nil || moved != 0 {
+		t.Fatalf("expected nothing finished before the cutoff, got %d err=%v", moved, err)
+	}
+	cutoff := time.Unix(1800000000, 0)
+	for _, want := range []int64{1, 1, 0} {
+		if moved, err := orders.Archive(ctx, cutoff, 1); err != nil || moved != want {
+			t.Fatalf("expected %d archived, got %d err=%v", want, moved, err)
+		}
+	}
+
+	active, err := orders.ListByUser(ctx, 1)
+	if err != nil || len(active) != 1 || active[0].Number != "3" {
+		t.Fatalf("expected only the pending order to stay active, got %+v err=%v", active, err)
+	}
+	all, err := orders.FindByUser(ctx, 1, model.OrderFilter{IncludeArchived: true, Ascending: true}, model.Page{})
+	if err != nil || len(all) != 3 || all[0].Number != "1" || all[0].Accrual == nil || *all[0].Accrual != accrual {
+		t.Fatalf("expected archived orders on request, got %+v err=%v", all, err)
+	}
+
+	if order, err := orders.GetByNumber(ctx, "2"); err != nil || order.Status != model.OrderStatusInvalid {
+		t.Fatalf("expected archived order by number, got %+v err=%v", order, err)
+	}
+	if _, created, err := orders.Create(ctx, 1, "1"); err != nil || created {
+		t.Fatalf("expected archived number to be reported as uploaded, created=%v err=%v", created, err)
+	}
+	if _, _, err := orders.Create(ctx, 2, "1"); !errors.Is(err, domainErrors.ErrAlreadyExists) {
+		t.Fatalf("expected archived number to stay reserved, got %v", err)
+	}
+}
+
+func TestBalanceRepositoryReconcile(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders, balances := s.Orders(), s.Balances()
+
+	order, _, _ := orders.Create(ctx, 1, "1")
+	accrual := model.MustParseMoney("10")
+	if _, err := orders.UpdateStatus(ctx, order.ID, model.OrderStatusProcessed, &accrual); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, _, err := balances.Withdraw(ctx, model.WithdrawalRequest{UserID: 1, OrderNumber: "2377225624", Sum: model.MustParseMoney("3")}); err != nil {
+		t.Fatalf("withdraw failed: %v", err)
+	}
+	if _, err := orders.Archive(ctx, time.Unix(1800000000, 0), 0); err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	if drifts, err := balances.FindDrifts(ctx); err != nil || len(drifts) != 0 {
+		t.Fatalf("expected consistent balances, got %+v err=%v", drifts, err)
+	}
+
+	s.balances[1].Current = model.MustParseMoney("100")
+	s.balances[2] = &model.BalanceSummary{Withdrawn: model.MustParseMoney("1")}
+	drifts, err := balances.FindDrifts(ctx)
+	if err != nil || len(drifts) != 2 || drifts[0].UserID != 1 || drifts[1].UserID != 2 {
+		t.Fatalf("expected drift for both users, got %+v err=%v", drifts, err)
+	}
+	if drifts[0].Expected.Current != model.MustParseMoney("7") || drifts[0].Actual.Current != model.MustParseMoney("100") {
+		t.Fatalf("unexpected drift %+v", drifts[0])
+	}
+
+	adjustment, err := balances.Repair(ctx, 1, "test")
+	if err != nil || adjustment == nil || adjustment.Before.Current != model.MustParseMoney("100") ||
+		adjustment.After != (model.BalanceSummary{Current: model.MustParseMoney("7"), Withdrawn: model.MustParseMoney("3")}) || adjustment.Reason != "test" {
+		t.Fatalf("unexpected adjustment %+v err=%v", adjustment, err)
+	}
+	if adjustment, err := balances.Repair(ctx, 1, "test"); err != nil || adjustment != nil {
+		t.Fatalf("expected repaired balance to be left alone, got %+v err=%v", adjustment, err)
+	}
+	if _, err := balances.Repair(ctx, 2, "test"); err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	if drifts, err := balances.FindDrifts(ctx); err != nil || len(drifts) != 0 {
+		t.Fatalf("expected no drift after repair, got %+v err=%v", drifts, err)
+	}
+	if len(s.adjustments) != 2 {
+		t.Fatalf("expected two recorded adjustments, got %d", len(s.adjustments))
+	}
+	// An accrual that reached neither the balance nor the ledger.
+	missed, _, _ := orders.Create(ctx, 3, "3")
+	s.orders[missed.ID].Status, s.orders[missed.ID].Accrual = model.OrderStatusProcessed, &accrual
+	// A ledger posting without a balance change.
+	s.ledger = append(s.ledger, model.LedgerEntry{UserID: 1, Kind: model.LedgerEntryAccrual, Amount: model.MustParseMoney("2")})
+	drifts, err = balances.FindDrifts(ctx)
+	if err != nil || len(drifts) != 2 || drifts[0].UserID != 1 || drifts[1].UserID != 3 {
+		t.Fatalf("expected ledger and balance drift, got %+v err=%v", drifts, err)
+	}
+	if drifts[0].Expected != drifts[0].Actual || drifts[0].Ledger != model.MustParseMoney("9") {
+		t.Fatalf("expected a ledger-only drift, got %+v", drifts[0])
+	}
+	if drifts[1].Expected.Current != accrual || drifts[1].Actual.Current != 0 || drifts[1].Ledger != 0 {
+		t.Fatalf("unexpected drift %+v", drifts[1])
+	}
+	for _, userID := range []int64{1, 3} {
+		if _, err := balances.Repair(ctx, userID, "test"); err != nil {
+			t.Fatalf("repair failed: %v", err)
+		}
+		history, err := balances.History(ctx, userID)
+		if err != nil || len(history) == 0 || history[0].Kind != model.LedgerEntryAdjustment || history[0].AdjustmentID == nil {
+			t.Fatalf("expected a compensating posting for user %d, got %+v err=%v", userID, history, err)
+		}
+	}
+	if history, _ := balances.History(ctx, 1); history[0].Amount != model.MustParseMoney("-2") || history[0].BalanceAfter != model.MustParseMoney("7") {
+		t.Fatalf("unexpected posting %+v", history[0])
+	}
+	if history, _ := balances.History(ctx, 3); history[0].Amount != accrual || history[0].BalanceAfter != accrual {
+		t.Fatalf("unexpected posting %+v", history[0])
+	}
+	if drifts, err := balances.FindDrifts(ctx); err != nil || len(drifts) != 0 {
+		t.Fatalf("expected no drift after repair, got %+v err=%v", drifts, err)
+	}
+}
+
+func TestAuditRepository(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	audit := s.Audit()
+
+	for _, e := range []model.AuditEvent{
+		{Action: model.AuditUserRegistered, Actor: "user:1", UserID: 1, Payload: []byte(`{}`)},
+		{Action: model.AuditLoginFailed, Actor: model.AuditActorAnonymous, Payload: []byte(`{}`)},
+		{Action: model.AuditLoginSucceeded, Actor: "user:1", UserID: 1, Payload: []byte(`{}`)},
+	} {
+		if _, err := audit.Append(ctx, e); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	boom := errors.New("boom")
+	err := s.Transactions().WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		if _, err := audit.Append(ctx, model.AuditEvent{Action: model.AuditPointsWithdrawn, UserID: 1}); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+
+	chain, err := audit.Chain(ctx, 0, 10)
+	if err != nil || len(chain) != 3 {
+		t.Fatalf("expected rolled back event to be gone, got %+v err=%v", chain, err)
+	}
+	prev := model.AuditGenesisHash
+	for _, e := range chain {
+		if !model.VerifyAuditLink(prev, e) {
+			t.Fatalf("event %d does not link to its predecessor", e.ID)
+		}
+		prev = e.Hash
+	}
+	if tail, _ := audit.Chain(ctx, 2, 10); len(tail) != 1 || tail[0].ID != 3 {
+		t.Fatalf("expected chain to resume after id 2, got %+v", tail)
+	}
+
+	found, err := audit.Find(ctx, model.AuditFilter{UserID: 1}, model.Page{Limit: 1})
+	if err != nil || len(found) != 1 || found[0].Action != model.AuditLoginSucceeded {
+		t.Fatalf("expected newest event of user 1, got %+v err=%v", found, err)
+	}
+	cursor := model.Cursor{Time: found[0].CreatedAt, ID: found[0].ID}
+	found, err = audit.Find(ctx, model.AuditFilter{UserID: 1}, model.Page{Limit: 5, After: &cursor})
+	if err != nil || len(found) != 1 || found[0].Action != model.AuditUserRegistered {
+		t.Fatalf("expected next page with registration, got %+v err=%v", found, err)
+	}
+	if found, _ := audit.Find(ctx, model.AuditFilter{Action: model.AuditLoginFailed}, model.Page{}); len(found) != 1 {
+		t.Fatalf("expected one failed login, got %+v", found)
+	}
+}
+
+func TestOutboxRepository(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	orders := s.Orders()
+	outbox := s.Outbox()
+
+	first, _, _ := orders.Create(ctx, 1, "12345678903")
+	second, _, _ := orders.Create(ctx, 2, "79927398713")
+	accrual := model.MustParseMoney("100")
+	if _, err := orders.UpdateStatus(ctx, first.ID, model.OrderStatusProcessed, &accrual); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, err := orders.UpdateStatus(ctx, second.ID, model.OrderStatusInvalid, nil); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, _, err := s.Balances().Withdraw(ctx, model.WithdrawalRequest{UserID: 1, OrderNumber: "2377225624", Sum: model.MustParseMoney("40")}); err != nil {
+		t.Fatalf("withdraw failed: %v", err)
+	}
+
+	// A failed unit of work leaves no events behind.
+	_ = s.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		_, _, _ = s.Balances().Withdraw(ctx, model.WithdrawalRequest{UserID: 1, OrderNumber: "4561261212345467", Sum: model.MustParseMoney("1")})
+		return errors.New("abort")
+	})
+
+	events, err := outbox.Claim(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	var types []string
+	for _, e := range events {
+		types = append(types, fmt.Sprintf("%d:%s", e.UserID, e.Type))
+	}
+	if strings.Join(types, ",") != "1:order.status_changed,1:points.accrued,2:order.status_changed,1:points.withdrawn" {
+		t.Fatalf("unexpected events %v", types)
+	}
+	payload, err := events[3].Decode()
+	if withdrawn, ok := payload.(*model.PointsWithdrawn); err != nil || !ok || withdrawn.BalanceAfter != model.MustParseMoney("60") {
+		t.Fatalf("unexpected withdrawal payload %+v err=%v", payload, err)
+	}
+
+	if claimed, _ := outbox.Claim(ctx, 10, time.Minute); len(claimed) != 0 {
+		t.Fatalf("expected leased events not to be claimed again, got %+v", claimed)
+	}
+	if err := outbox.Release(ctx, []int64{events[0].ID, events[1].ID, events[2].ID, events[3].ID}); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+
+	// A failed event holds back later events of the same user only.
+	if err := outbox.MarkFailed(ctx, events[0].ID, time.Hour, "boom"); err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+	if err := outbox.MarkFailed(ctx, 404, time.Hour, "boom"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	claimed, _ := outbox.Claim(ctx, 10, time.Minute)
+	if len(claimed) != 1 || claimed[0].ID != events[2].ID {
+		t.Fatalf("expected only user 2 event, got %+v", claimed)
+	}
+
+	if err := outbox.MarkDelivered(ctx, []int64{events[2].ID}); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	if claimed, _ := outbox.Claim(ctx, 10, time.Minute); len(claimed) != 0 {
+		t.Fatalf("expected nothing claimable, got %+v", claimed)
+	}
+
+	// A dead-lettered event stops holding back the user's later events.
+	if err := outbox.DeadLetter(ctx, events[0].ID, "gone"); err != nil {
+		t.Fatalf("dead letter failed: %v", err)
+	}
+	if err := outbox.DeadLetter(ctx, 404, "gone"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	claimed, _ = outbox.Claim(ctx, 10, time.Minute)
+	if len(claimed) != 2 || claimed[0].ID != events[1].ID || claimed[1].ID != events[3].ID {
+		t.Fatalf("expected user 1 events past the dead letter, got %+v", claimed)
+	}
+	if s.outbox[0].event.Attempts != 2 || s.outbox[0].deadLetteredAt == nil {
+		t.Fatalf("expected dead letter to count an attempt, got %+v", s.outbox[0])
+	}
+	deleted, err := outbox.DeleteDelivered(ctx, s.now().Add(time.Second))
+	if err != nil || deleted != 1 || len(s.outbox) != 3 {
+		t.Fatalf("expected one deleted event, got %d err=%v left=%d", deleted, err, len(s.outbox))
+	}
+}
+
+func TestOrderRepositorySelectBatchForShard(t *testing.T) {
+	ctx := context.Background()
+	orders := newTestStorage().Orders()
+
+	for _, number := range []string{"1", "2", "3", "4", "5", "6"} {
+		if _, _, err := orders.Create(ctx, 1, number); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+	shard := model.Shard{Index: 1, Count: 2}
+	batch, err := orders.SelectBatchForProcessing(ctx, model.OrderClaim{Owner: "a", Limit: 10, Lease: time.Minute, Shard: shard})
+	if err != nil || len(batch) == 0 || len(batch) == 6 {
+		t.Fatalf("expected a strict subset of orders, got %+v err=%v", batch, err)
+	}
+	for _, o := range batch {
+		if !shard.Owns(o.ID) {
+			t.Fatalf("claimed order %d outside the shard", o.ID)
+		}
+	}
+
+	if due, err := orders.CountDue(ctx, shard); err != nil || due != 0 {
+		t.Fatalf("expected claimed shard to have no backlog, got %d err=%v", due, err)
+	}
+	if due, err := orders.CountDue(ctx, model.Shard{}); err != nil || due != int64(6-len(batch)) {
+		t.Fatalf("expected unclaimed orders as backlog, got %d err=%v", due, err)
+	}
+}
+
+func TestLeaderLock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	first, second := s.Leader(), s.Leader()
+
+	if held, err := first.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("expected first contender to win, got %v err=%v", held, err)
+	}
+	if held, _ := first.TryAcquire(ctx); !held {
+		t.Fatal("expected holder to keep the lock")
+	}
+	if held, _ := second.TryAcquire(ctx); held {
+		t.Fatal("expected second contender to lose")
+	}
+	if err := second.Release(ctx); err != nil {
+		t.Fatalf("release by non-holder failed: %v", err)
+	}
+	if held, _ := second.TryAcquire(ctx); held {
+		t.Fatal("expected release by non-holder to keep the lock")
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if held, _ := second.TryAcquire(ctx); !held {
+		t.Fatal("expected second contender to take over")
+	}
+}
+
+func TestInstanceRegistry(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage()
+	registry := s.Instances()
+
+	for _, id := range []string{"node-b", "node-a", "node-c"} {
+		if err := registry.Heartbeat(ctx, id); err != nil {
+			t.Fatalf("heartbeat failed: %v", err)
+		}
+	}
+	live, err := registry.LiveInstances(ctx, time.Hour)
+	if err != nil || strings.Join(live, ",") != "node-a,node-b,node-c" {
+		t.Fatalf("unexpected live instances %v err=%v", live, err)
+	}
+
+	// The test clock advances a second per call, so only the latest
+	// heartbeat falls within two seconds.
+	if err := registry.Heartbeat(ctx, "node-b"); err != nil {
+		t.Fatalf("heartbeat failed: %v", err)
+	}
+	if live, _ := registry.LiveInstances(ctx, 2*time.Second); strings.Join(live, ",") != "node-b" {
+		t.Fatalf("expected silent instances to expire, got %v", live)
+	}
+
+	if err := registry.Deregister(ctx, "node-b"); err != nil {
+		t.Fatalf("deregister failed: %v", err)
+	}
+	if live, _ := registry.LiveInstances(ctx, time.Hour); strings.Join(live, ",") != "node-a,node-c" {
+		t.Fatalf("expected deregistered instance to leave, got %v", live)
+	}
+}
+
+func TestProcessorStateStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStorage().ProcessorState()
+
+	if state, err := store.Desired(ctx); err != nil || state != model.ProcessorRunning {
+		t.Fatalf("expected running by default, got %s err=%v", state, err)
+	}
+	if err := store.SetDesired(ctx, model.ProcessorPaused); err != nil {
+		t.Fatalf("set desired failed: %v", err)
+	}
+	if state, _ := store.Desired(ctx); state != model.ProcessorPaused {
+		t.Fatalf("expected paused, got %s", state)
+	}
+}
+
+func TestNewOrdersNotifier(t *testing.T) {
+	s := newTestStorage()
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := s.Notifier().NewOrders(ctx)
+
+	if _, _, err := s.Orders().Create(context.Background(), 1, "1"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	_, _, _ = s.Orders().Create(context.Background(), 1, "2")
+	select {
+	case <-signals:
+	default:
+		t.Fatal("expected a signal for new orders")
+	}
+	select {
+	case <-signals:
+		t.Fatal("expected signals to coalesce")
+	default:
+	}
+
+	_, _, _ = s.Orders().Create(context.Background(), 1, "1")
+	select {
+	case <-signals:
+		t.Fatal("duplicate upload must not signal")
+	default:
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.listenersMu.Lock()
+		left := len(s.listeners)
+		s.listenersMu.Unlock()
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected listener to be removed after cancel")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
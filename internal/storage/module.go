@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+
+	"go.uber.org/fx"
+
+	"github.com/polkiloo/gophermart/internal/config"
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
+	"github.com/polkiloo/gophermart/internal/storage/postgres"
+)
+
+// Module selects the storage backend by DATABASE_URI and exposes its repositories.
+var Module = fx.Options(
+	fx.Provide(newFactory),
+	fx.Provide(
+		func(f repository.Factory) repository.UserRepository { return f.Users() },
+		func(f repository.Factory) repository.OrderRepository { return f.Orders() },
+		func(f repository.Factory) repository.BalanceRepository { return f.Balances() },
+		func(f repository.Factory) repository.WithdrawalRepository { return f.Withdrawals() },
+		func(f repository.Factory) repository.OutboxRepository { return f.Outbox() },
+		func(f repository.Factory) repository.AuditRepository { return f.Audit() },
+		func(f repository.Factory) repository.TxManager { return f.Transactions() },
+		func(f repository.Factory) repository.OrderNotifier { return f.Notifier() },
+	),
+)
+
+// DatabaseHealth reports the storage backend as the database component.
+type DatabaseHealth struct {
+	Factory repository.Factory
+}
+
+// Health pings the backend.
+func (h DatabaseHealth) Health(ctx context.Context) model.ComponentHealth {
+	if err := h.Factory.HealthCheck(ctx); err != nil {
+		return model.ComponentHealth{Name: "database", Status: model.HealthDown, Detail: err.Error()}
+	}
+	return model.ComponentHealth{Name: "database", Status: model.HealthUp}
+}
+
+type factoryParams struct {
+	fx.In
+
+	Ctx       context.Context
+	Lifecycle fx.Lifecycle
+	Config    *config.Config
+	Logger    *slog.Logger
+}
+
+func newFactory(p factoryParams) (repository.Factory, error) {
+	if memory.IsDSN(p.Config.DatabaseURI) {
+		p.Logger.Warn("using in-memory storage, data will not survive restarts")
+		return memory.New(), nil
+	}
+
+	storage, err := postgres.Open(p.Ctx, p.Lifecycle, p.Config, p.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
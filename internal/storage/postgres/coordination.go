@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// pollerLockKey is the advisory lock held by the elected order poller.
+const pollerLockKey int64 = 0x706f6c6c6572
+
+// staleInstanceFactor scales the instance ttl into the age after which
+// registrations of vanished instances are pruned.
+const staleInstanceFactor = 10
+
+var errNoConnConfig = errors.New("leader lock needs a connection config")
+
+type lockConn interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Close(ctx context.Context) error
+}
+
+var connectLocker = func(ctx context.Context, cfg *pgx.ConnConfig) (lockConn, error) {
+	return pgx.ConnectConfig(ctx, cfg)
+}
+
+// leaderLock holds a session-level advisory lock on a dedicated connection
+// outside the pool, so the lock lives exactly as long as that session. When
+// the holder dies or its connection drops, the server frees the lock and
+// another contender takes over on its next attempt.
+type leaderLock struct {
+	storage *Storage
+
+	mu   sync.Mutex
+	conn lockConn
+	held bool
+}
+
+// TryAcquire takes the lock if it is free. A holder checks that its session
+// is still alive; a dead session means the lock is gone.
+func (l *leaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		if l.storage.connConfig == nil {
+			return false, errNoConnConfig
+		}
+		conn, err := connectLocker(ctx, l.storage.connConfig.Copy())
+		if err != nil {
+			return false, err
+		}
+		l.conn = conn
+	}
+
+	if l.held {
+		var alive int
+		if err := l.conn.QueryRow(ctx, `SELECT 1`).Scan(&alive); err != nil {
+			l.drop(ctx)
+			return false, err
+		}
+		return true, nil
+	}
+
+	if err := l.conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, pollerLockKey).Scan(&l.held); err != nil {
+		l.drop(ctx)
+		return false, err
+	}
+	return l.held, nil
+}
+
+// Release unlocks and closes the dedicated connection.
+func (l *leaderLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	var err error
+	if l.held {
+		var unlocked bool
+		err = l.conn.QueryRow(ctx, `SELECT pg_advisory_unlock($1)`, pollerLockKey).Scan(&unlocked)
+	}
+	l.drop(ctx)
+	return err
+}
+
+func (l *leaderLock) drop(ctx context.Context) {
+	_ = l.conn.Close(context.WithoutCancel(ctx))
+	l.conn = nil
+	l.held = false
+}
+
+type instanceRegistry struct {
+	storage *Storage
+}
+
+// Heartbeat upserts the registration of instanceID.
+func (r *instanceRegistry) Heartbeat(ctx context.Context, instanceID string) error {
+	const query = `INSERT INTO worker_instances (id) VALUES ($1)
+                   ON CONFLICT (id) DO UPDATE SET heartbeat_at=NOW()`
+	_, err := r.storage.writer(ctx).Exec(ctx, query, instanceID)
+	return err
+}
+
+// LiveInstances returns the instances seen within ttl and prunes those gone
+// for much longer, so crashed instances do not pile up.
+func (r *instanceRegistry) LiveInstances(ctx context.Context, ttl time.Duration) ([]string, error) {
+	const prune = `DELETE FROM worker_instances WHERE heartbeat_at < NOW() - make_interval(secs => $1)`
+	if _, err := r.storage.writer(ctx).Exec(ctx, prune, (staleInstanceFactor * ttl).Seconds()); err != nil {
+		return nil, err
+	}
+
+	const query = `SELECT id FROM worker_instances
+                   WHERE heartbeat_at >= NOW() - make_interval(secs => $1)
+                   ORDER BY id`
+	rows, err := r.storage.writer(ctx).Query(ctx, query, ttl.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Deregister removes instanceID so the others take over its shard at once.
+func (r *instanceRegistry) Deregister(ctx context.Context, instanceID string) error {
+	_, err := r.storage.writer(ctx).Exec(ctx, `DELETE FROM worker_instances WHERE id=$1`, instanceID)
+	return err
+}
+
+type processorStateStore struct {
+	storage *Storage
+}
+
+// Desired reads from the primary, so a replica cannot undo a fresh command.
+func (r *processorStateStore) Desired(ctx context.Context) (model.ProcessorState, error) {
+	var state model.ProcessorState
+	err := r.storage.conn(ctx).QueryRow(ctx, `SELECT state FROM processor_state`).Scan(&state)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ProcessorRunning, nil
+	}
+	return state, err
+}
+
+// SetDesired records state for every processor to pick up.
+func (r *processorStateStore) SetDesired(ctx context.Context, state model.ProcessorState) error {
+	const query = `INSERT INTO processor_state (state) VALUES ($1)
+                   ON CONFLICT (singleton) DO UPDATE SET state=EXCLUDED.state, updated_at=NOW()`
+	_, err := r.storage.writer(ctx).Exec(ctx, query, state)
+	return err
+}
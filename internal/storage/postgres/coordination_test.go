@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	pgxmockv3 "github.com/pashagolub/pgxmock/v3"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+func stubLockConn(t *testing.T) pgxmockv3.PgxConnIface {
+	t.Helper()
+	mock, err := pgxmockv3.NewConn()
+	if err != nil {
+		t.Fatalf("failed to create mock conn: %v", err)
+	}
+	previous := connectLocker
+	connectLocker = func(context.Context, *pgx.ConnConfig) (lockConn, error) { return mock, nil }
+	t.Cleanup(func() { connectLocker = previous })
+	return mock
+}
+
+func TestLeaderLockAcquireAndRelease(t *testing.T) {
+	conn := stubLockConn(t)
+	lock := &leaderLock{storage: &Storage{connConfig: &pgx.ConnConfig{}}}
+	ctx := context.Background()
+
+	conn.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(pollerLockKey).WillReturnRows(pgxmockv3.NewRows([]string{"held"}).AddRow(false))
+	if held, err := lock.TryAcquire(ctx); err != nil || held {
+		t.Fatalf("expected lock held elsewhere, got %v err=%v", held, err)
+	}
+
+	conn.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(pollerLockKey).WillReturnRows(pgxmockv3.NewRows([]string{"held"}).AddRow(true))
+	if held, err := lock.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("expected lock acquired, got %v err=%v", held, err)
+	}
+
+	conn.ExpectQuery("SELECT 1").WillReturnRows(pgxmockv3.NewRows([]string{"alive"}).AddRow(1))
+	if held, err := lock.TryAcquire(ctx); err != nil || !held {
+		t.Fatalf("expected lock kept, got %v err=%v", held, err)
+	}
+
+	conn.ExpectQuery("SELECT pg_advisory_unlock").WithArgs(pollerLockKey).WillReturnRows(pgxmockv3.NewRows([]string{"unlocked"}).AddRow(true))
+	conn.ExpectClose()
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("second release failed: %v", err)
+	}
+
+	if err := conn.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestLeaderLockLostSession(t *testing.T) {
+	conn := stubLockConn(t)
+	lock := &leaderLock{storage: &Storage{connConfig: &pgx.ConnConfig{}}}
+	ctx := context.Background()
+
+	conn.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(pollerLockKey).WillReturnRows(pgxmockv3.NewRows([]string{"held"}).AddRow(true))
+	if held, _ := lock.TryAcquire(ctx); !held {
+		t.Fatal("expected lock acquired")
+	}
+
+	conn.ExpectQuery("SELECT 1").WillReturnError(errors.New("connection reset"))
+	conn.ExpectClose()
+	if held, err := lock.TryAcquire(ctx); err == nil || held {
+		t.Fatalf("expected lost session to drop the lock, got %v err=%v", held, err)
+	}
+	if lock.conn != nil || lock.held {
+		t.Fatal("expected the dead connection to be discarded")
+	}
+
+	if err := conn.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestLeaderLockConnectErrors(t *testing.T) {
+	lock := &leaderLock{storage: &Storage{}}
+	if _, err := lock.TryAcquire(context.Background()); !errors.Is(err, errNoConnConfig) {
+		t.Fatalf("expected missing config error, got %v", err)
+	}
+
+	previous := connectLocker
+	connectLocker = func(context.Context, *pgx.ConnConfig) (lockConn, error) { return nil, errors.New("refused") }
+	t.Cleanup(func() { connectLocker = previous })
+
+	lock.storage.connConfig = &pgx.ConnConfig{}
+	if held, err := lock.TryAcquire(context.Background()); err == nil || held {
+		t.Fatalf("expected connect error, got %v err=%v", held, err)
+	}
+}
+
+func TestInstanceRegistry(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	defer mock.Close()
+	registry := &instanceRegistry{storage: storage}
+	ctx := context.Background()
+
+	mock.ExpectExec("INSERT INTO worker_instances").WithArgs("node-a").WillReturnResult(pgxmockv3.NewResult("INSERT", 1))
+	if err := registry.Heartbeat(ctx, "node-a"); err != nil {
+		t.Fatalf("heartbeat failed: %v", err)
+	}
+
+	mock.ExpectExec("DELETE FROM worker_instances WHERE heartbeat_at").WithArgs(float64(150)).WillReturnResult(pgxmockv3.NewResult("DELETE", 2))
+	mock.ExpectQuery("SELECT id FROM worker_instances").WithArgs(float64(15)).WillReturnRows(
+		pgxmockv3.NewRows([]string{"id"}).AddRow("node-a").AddRow("node-b"),
+	)
+	live, err := registry.LiveInstances(ctx, 15*time.Second)
+	if err != nil || len(live) != 2 || live[0] != "node-a" || live[1] != "node-b" {
+		t.Fatalf("unexpected live instances %v err=%v", live, err)
+	}
+
+	mock.ExpectExec("DELETE FROM worker_instances WHERE heartbeat_at").WithArgs(float64(150)).WillReturnError(errors.New("prune"))
+	if _, err := registry.LiveInstances(ctx, 15*time.Second); err == nil {
+		t.Fatal("expected prune error")
+	}
+
+	mock.ExpectExec("DELETE FROM worker_instances WHERE heartbeat_at").WithArgs(float64(150)).WillReturnResult(pgxmockv3.NewResult("DELETE", 0))
+	mock.ExpectQuery("SELECT id FROM worker_instances").WithArgs(float64(15)).WillReturnError(errors.New("query"))
+	if _, err := registry.LiveInstances(ctx, 15*time.Second); err == nil {
+		t.Fatal("expected query error")
+	}
+
+	mock.ExpectExec("DELETE FROM worker_instances WHERE id").WithArgs("node-a").WillReturnResult(pgxmockv3.NewResult("DELETE", 1))
+	if err := registry.Deregister(ctx, "node-a"); err != nil {
+		t.Fatalf("deregister failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestProcessorStateStore(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	defer mock.Close()
+	store := storage.ProcessorState()
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT state FROM processor_state").WillReturnError(pgx.ErrNoRows)
+	if state, err := store.Desired(ctx); err != nil || state != model.ProcessorRunning {
+		t.Fatalf("expected running before any command, got %s err=%v", state, err)
+	}
+	mock.ExpectQuery("SELECT state FROM processor_state").WillReturnRows(pgxmockv3.NewRows([]string{"state"}).AddRow(model.ProcessorPaused))
+	if state, err := store.Desired(ctx); err != nil || state != model.ProcessorPaused {
+		t.Fatalf("expected paused, got %s err=%v", state, err)
+	}
+	mock.ExpectQuery("SELECT state FROM processor_state").WillReturnError(errors.New("query"))
+	if _, err := store.Desired(ctx); err == nil {
+		t.Fatal("expected query error")
+	}
+
+	mock.ExpectExec("INSERT INTO processor_state \\(state\\) VALUES \\(\\$1\\) ON CONFLICT \\(singleton\\) DO UPDATE").
+		WithArgs(model.ProcessorDraining).WillReturnResult(pgxmockv3.NewResult("INSERT", 1))
+	if err := store.SetDesired(ctx, model.ProcessorDraining); err != nil {
+		t.Fatalf("set desired failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaOutdated indicates the database has pending migrations.
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// migrationLockKey is the advisory lock guarding schema changes.
+const migrationLockKey int64 = 0x676f706865726d61
+
+// Migration describes a single versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies embedded migrations serialized by an advisory lock.
+type Migrator struct {
+	storage    *Storage
+	migrations []Migration
+}
+
+// Migrator returns migrator bound to the storage connection pool.
+func (s *Storage) Migrator() (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{storage: s, migrations: migrations}, nil
+}
+
+// Up applies all pending migrations and returns the applied ones.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(tx pgx.Tx) error {
+		done, err := appliedMigrations(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if _, err := tx.Exec(ctx, mig.Up); err != nil {
+				return fmt.Errorf("apply migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			const insertQuery = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+			if _, err := tx.Exec(ctx, insertQuery, mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("record migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, mig := range applied {
+		m.logger().Info("migration applied", slog.Int64("version", mig.Version), slog.String("name", mig.Name))
+	}
+	return applied, nil
+}
+
+// Down reverts up to steps most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, nil
+	}
+	var reverted []Migration
+	err := m.withLock(ctx, func(tx pgx.Tx) error {
+		done, err := appliedMigrations(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("migration %04d_%s is irreversible", mig.Version, mig.Name)
+			}
+			if _, err := tx.Exec(ctx, mig.Down); err != nil {
+				return fmt.Errorf("revert migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			const deleteQuery = `DELETE FROM schema_migrations WHERE version=$1`
+			if _, err := tx.Exec(ctx, deleteQuery, mig.Version); err != nil {
+				return fmt.Errorf("unrecord migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, mig := range reverted {
+		m.logger().Info("migration reverted", slog.Int64("version", mig.Version), slog.String("name", mig.Name))
+	}
+	return reverted, nil
+}
+
+// Status lists known migrations along with their application time. It only
+// reads, so it neither waits behind a running migration nor creates the
+// history table; without one every migration is pending.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var table *string
+	if err := m.storage.pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations')::text`).Scan(&table); err != nil {
+		return nil, err
+	}
+	done := map[int64]time.Time{}
+	if table != nil {
+		var err error
+		if done, err = appliedMigrations(ctx, m.storage.pool); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := MigrationStatus{Migration: mig}
+		if at, ok := done[mig.Version]; ok {
+			appliedAt := at
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Pending returns migrations which have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, st := range statuses {
+		if st.AppliedAt == nil {
+			pending = append(pending, st.Migration)
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(pgx.Tx) error) error {
+	return m.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+            version BIGINT PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )`
+		if _, err := tx.Exec(ctx, createTable); err != nil {
+			return fmt.Errorf("create schema_migrations: %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+func (m *Migrator) logger() *slog.Logger {
+	if m.storage.logger != nil {
+		return m.storage.logger
+	}
+	return slog.Default()
+}
+
+func appliedMigrations(ctx context.Context, db querier) (map[int64]time.Time, error) {
+	rows, err := db.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// loadMigrations reads NNNN_name.up.sql / NNNN_name.down.sql pairs from dir.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileName := entry.Name()
+		base, direction, ok := splitMigrationName(fileName)
+		if !ok {
+			return nil, fmt.Errorf("unexpected migration file %q", fileName)
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("unexpected migration file %q", fileName)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", fileName)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %q: %w", fileName, err)
+		}
+
+		mig, exists := byVersion[version]
+		if !exists {
+			mig = &Migration{Version: version, Name: name}
+			byVersion[version] = mig
+		} else if mig.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, name)
+		}
+		if direction == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if strings.TrimSpace(mig.Up) == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func splitMigrationName(fileName string) (string, string, bool) {
+	switch {
+	case strings.HasSuffix(fileName, ".up.sql"):
+		return strings.TrimSuffix(fileName, ".up.sql"), "up", true
+	case strings.HasSuffix(fileName, ".down.sql"):
+		return strings.TrimSuffix(fileName, ".down.sql"), "down", true
+	default:
+		return "", "", false
+	}
+}
@@ -0,0 +1,228 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	pgxmockv3 "github.com/pashagolub/pgxmock/v3"
+)
+
+func newTestMigrator(t *testing.T) (*Migrator, pgxmockv3.PgxPoolIface) {
+	t.Helper()
+	storage, mock := newMockStorage(t)
+	return &Migrator{storage: storage, migrations: []Migration{
+		{Version: 1, Name: "init", Up: "CREATE TABLE one", Down: "DROP TABLE one"},
+		{Version: 2, Name: "second", Up: "CREATE TABLE two", Down: "DROP TABLE two"},
+	}}, mock
+}
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i, mig := range migrations {
+		if mig.Version != int64(i+1) {
+			t.Fatalf("expected sequential versions, got %d at position %d", mig.Version, i)
+		}
+		if mig.Up == "" || mig.Down == "" {
+			t.Fatalf("migration %d must have up and down scripts", mig.Version)
+		}
+	}
+}
+
+func TestLoadMigrationsValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "unknown suffix", fsys: fstest.MapFS{"m/0001_init.sql": {Data: []byte("x")}}},
+		{name: "no name", fsys: fstest.MapFS{"m/0001.up.sql": {Data: []byte("x")}}},
+		{name: "bad version", fsys: fstest.MapFS{"m/abc_init.up.sql": {Data: []byte("x")}}},
+		{name: "missing up", fsys: fstest.MapFS{"m/0001_init.down.sql": {Data: []byte("x")}}},
+		{name: "conflicting names", fsys: fstest.MapFS{
+			"m/0001_init.up.sql":    {Data: []byte("x")},
+			"m/0001_other.down.sql": {Data: []byte("x")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadMigrations(tt.fsys, "m"); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	migrations, err := loadMigrations(fstest.MapFS{
+		"m/0002_b.up.sql":   {Data: []byte("b")},
+		"m/0001_a.up.sql":   {Data: []byte("a")},
+		"m/0001_a.down.sql": {Data: []byte("-a")},
+	}, "m")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "a" || migrations[1].Name != "b" || migrations[0].Down != "-a" {
+		t.Fatalf("unexpected migrations: %+v", migrations)
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	defer mock.Close()
+
+	expectMigrationLock(mock)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(
+		pgxmockv3.NewRows([]string{"version", "applied_at"}).AddRow(int64(1), time.Now()))
+	mock.ExpectExec("CREATE TABLE two").WillReturnResult(pgxmockv3.NewResult("CREATE", 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(int64(2), "second").WillReturnResult(pgxmockv3.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("unexpected applied migrations: %+v", applied)
+	}
+
+	expectMigrationLock(mock)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(
+		pgxmockv3.NewRows([]string{"version", "applied_at"}))
+	mock.ExpectExec("CREATE TABLE one").WillReturnError(errors.New("ddl"))
+	mock.ExpectRollback()
+	if _, err := migrator.Up(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(migrationLockKey).WillReturnError(errors.New("lock"))
+	mock.ExpectRollback()
+	if _, err := migrator.Up(context.Background()); err == nil {
+		t.Fatal("expected lock error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestMigratorDown(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	defer mock.Close()
+
+	expectMigrationLock(mock)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(
+		pgxmockv3.NewRows([]string{"version", "applied_at"}).AddRow(int64(1), time.Now()).AddRow(int64(2), time.Now()))
+	mock.ExpectExec("DROP TABLE two").WillReturnResult(pgxmockv3.NewResult("DROP", 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(int64(2)).WillReturnResult(pgxmockv3.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+
+	reverted, err := migrator.Down(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("unexpected reverted migrations: %+v", reverted)
+	}
+
+	if reverted, err := migrator.Down(context.Background(), 0); err != nil || len(reverted) != 0 {
+		t.Fatalf("expected no-op for zero steps, got %v err=%v", reverted, err)
+	}
+
+	migrator.migrations[0].Down = ""
+	expectMigrationLock(mock)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(
+		pgxmockv3.NewRows([]string{"version", "applied_at"}).AddRow(int64(1), time.Now()))
+	mock.ExpectRollback()
+	if _, err := migrator.Down(context.Background(), 1); err == nil {
+		t.Fatal("expected irreversible migration error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestMigratorStatusAndPending(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	defer mock.Close()
+
+	appliedAt := time.Now()
+	expectMigrationHistory(mock, true)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(
+		pgxmockv3.NewRows([]string{"version", "applied_at"}).AddRow(int64(1), appliedAt))
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+
+	expectMigrationHistory(mock, true)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(
+		pgxmockv3.NewRows([]string{"version", "applied_at"}).AddRow(int64(1), appliedAt))
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Fatalf("unexpected pending migrations: %+v", pending)
+	}
+
+	expectMigrationHistory(mock, false)
+	if pending, err := migrator.Pending(context.Background()); err != nil || len(pending) != 2 {
+		t.Fatalf("expected every migration pending without history, got %+v err=%v", pending, err)
+	}
+
+	expectMigrationHistory(mock, true)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnError(errors.New("query"))
+	if _, err := migrator.Pending(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+
+	mock.ExpectQuery("SELECT to_regclass").WillReturnError(errors.New("regclass"))
+	if _, err := migrator.Status(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestEnsureSchemaAutoMigrate(t *testing.T) {
+	storage, mock := newMockStorage(t)
+	defer mock.Close()
+
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+
+	expectMigrationLock(mock)
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(
+		pgxmockv3.NewRows([]string{"version", "applied_at"}))
+	for _, mig := range migrations {
+		mock.ExpectExec(regexp.QuoteMeta(mig.Up)).WillReturnResult(pgxmockv3.NewResult("CREATE", 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(mig.Version, mig.Name).WillReturnResult(pgxmockv3.NewResult("INSERT", 1))
+	}
+	mock.ExpectCommit()
+
+	if err := storage.ensureSchema(context.Background(), true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
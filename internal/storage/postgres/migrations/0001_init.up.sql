@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    login TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    number TEXT UNIQUE NOT NULL,
+    status TEXT NOT NULL,
+    accrual DOUBLE PRECISION,
+    uploaded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS balances (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id),
+    current DOUBLE PRECISION NOT NULL DEFAULT 0,
+    withdrawn DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS withdrawals (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    order_number TEXT NOT NULL,
+    sum DOUBLE PRECISION NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user ON orders(user_id, uploaded_at DESC);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_user ON withdrawals(user_id, processed_at DESC);
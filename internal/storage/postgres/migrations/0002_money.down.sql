@@ -0,0 +1,7 @@
+ALTER TABLE withdrawals ALTER COLUMN sum TYPE DOUBLE PRECISION USING sum::double precision;
+
+ALTER TABLE balances
+    ALTER COLUMN current TYPE DOUBLE PRECISION USING current::double precision,
+    ALTER COLUMN withdrawn TYPE DOUBLE PRECISION USING withdrawn::double precision;
+
+ALTER TABLE orders ALTER COLUMN accrual TYPE DOUBLE PRECISION USING accrual::double precision;
@@ -0,0 +1,36 @@
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    kind TEXT NOT NULL,
+    amount NUMERIC(18, 2) NOT NULL,
+    balance_after NUMERIC(18, 2) NOT NULL,
+    order_number TEXT NOT NULL,
+    order_id BIGINT REFERENCES orders(id),
+    withdrawal_id BIGINT REFERENCES withdrawals(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT ledger_entries_source CHECK (
+        (kind = 'ACCRUAL' AND order_id IS NOT NULL AND withdrawal_id IS NULL AND amount > 0) OR
+        (kind = 'WITHDRAWAL' AND withdrawal_id IS NOT NULL AND order_id IS NULL AND amount < 0)
+    )
+);
+
+CREATE UNIQUE INDEX ledger_entries_order_accrual ON ledger_entries(order_id) WHERE kind = 'ACCRUAL';
+CREATE UNIQUE INDEX ledger_entries_withdrawal ON ledger_entries(withdrawal_id) WHERE withdrawal_id IS NOT NULL;
+CREATE INDEX idx_ledger_entries_user ON ledger_entries(user_id, id DESC);
+
+INSERT INTO ledger_entries (user_id, kind, amount, balance_after, order_number, order_id, withdrawal_id, created_at)
+SELECT user_id, kind, amount,
+       SUM(amount) OVER (PARTITION BY user_id ORDER BY created_at, kind, source_id ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW),
+       order_number, order_id, withdrawal_id, created_at
+FROM (
+    SELECT user_id, 'ACCRUAL' AS kind, accrual AS amount, number AS order_number,
+           id::bigint AS order_id, NULL::bigint AS withdrawal_id, updated_at AS created_at, id::bigint AS source_id
+    FROM orders
+    WHERE status = 'PROCESSED' AND accrual > 0
+    UNION ALL
+    SELECT user_id, 'WITHDRAWAL', -sum, order_number,
+           NULL, id::bigint, processed_at, id::bigint
+    FROM withdrawals
+    WHERE sum > 0
+) AS history
+ORDER BY created_at, kind, source_id;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS withdrawals_idempotency_key;
+DROP INDEX IF EXISTS withdrawals_order_number;
+
+ALTER TABLE withdrawals
+    DROP COLUMN IF EXISTS duplicate_of,
+    DROP COLUMN IF EXISTS fingerprint,
+    DROP COLUMN IF EXISTS idempotency_key;
@@ -0,0 +1,23 @@
+ALTER TABLE withdrawals
+    ADD COLUMN idempotency_key TEXT,
+    ADD COLUMN fingerprint TEXT,
+    ADD COLUMN duplicate_of BIGINT REFERENCES withdrawals(id);
+
+UPDATE withdrawals
+SET fingerprint = encode(sha256(convert_to(user_id || ':' || order_number || ':' || (sum * 100)::bigint, 'UTF8')), 'hex');
+
+ALTER TABLE withdrawals ALTER COLUMN fingerprint SET NOT NULL;
+
+-- Historical double debits stay on record but are excluded from the uniqueness guarantee.
+UPDATE withdrawals w
+SET duplicate_of = first.id
+FROM (
+    SELECT order_number, MIN(id) AS id
+    FROM withdrawals
+    GROUP BY order_number
+    HAVING COUNT(*) > 1
+) AS first
+WHERE w.order_number = first.order_number AND w.id <> first.id;
+
+CREATE UNIQUE INDEX withdrawals_order_number ON withdrawals(order_number) WHERE duplicate_of IS NULL;
+CREATE UNIQUE INDEX withdrawals_idempotency_key ON withdrawals(user_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
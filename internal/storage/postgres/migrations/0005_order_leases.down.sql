@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_orders_due;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS lease_until,
+    DROP COLUMN IF EXISTS claimed_by;
@@ -0,0 +1,8 @@
+ALTER TABLE orders
+    ADD COLUMN claimed_by TEXT,
+    ADD COLUMN lease_until TIMESTAMPTZ,
+    ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN last_error TEXT;
+
+CREATE INDEX idx_orders_due ON orders(next_attempt_at) WHERE status IN ('NEW', 'PROCESSING');
@@ -0,0 +1,15 @@
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events(id) WHERE delivered_at IS NULL;
+CREATE INDEX idx_outbox_events_user_pending ON outbox_events(user_id, id) WHERE delivered_at IS NULL;
+CREATE INDEX idx_outbox_events_delivered ON outbox_events(delivered_at) WHERE delivered_at IS NOT NULL;
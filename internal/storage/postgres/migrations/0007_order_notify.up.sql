@@ -0,0 +1,10 @@
+CREATE FUNCTION notify_order_inserted() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('orders_new', NEW.id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_notify_insert
+    AFTER INSERT ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_inserted();
@@ -0,0 +1,7 @@
+INSERT INTO orders (id, user_id, number, status, accrual, uploaded_at, updated_at)
+SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM orders_archive;
+
+DROP TABLE IF EXISTS orders_archive;
+
+ALTER TABLE ledger_entries
+    ADD CONSTRAINT ledger_entries_order_id_fkey FOREIGN KEY (order_id) REFERENCES orders(id);
@@ -0,0 +1,22 @@
+-- Archived orders leave the orders table, so ledger entries keep the order id
+-- without a foreign key.
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_order_id_fkey;
+
+CREATE TABLE orders_archive (
+    id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    number TEXT NOT NULL,
+    status TEXT NOT NULL,
+    accrual NUMERIC(18, 2),
+    uploaded_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id, uploaded_at)
+) PARTITION BY RANGE (uploaded_at);
+
+-- Monthly partitions are created by the archiver before it moves rows; the
+-- default partition only catches rows inserted by hand.
+CREATE TABLE orders_archive_default PARTITION OF orders_archive DEFAULT;
+
+CREATE INDEX idx_orders_archive_number ON orders_archive(number);
+CREATE INDEX idx_orders_archive_user ON orders_archive(user_id, uploaded_at DESC);
@@ -0,0 +1,12 @@
+CREATE TABLE balance_adjustments (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    current_before NUMERIC(18, 2) NOT NULL,
+    withdrawn_before NUMERIC(18, 2) NOT NULL,
+    current_after NUMERIC(18, 2) NOT NULL,
+    withdrawn_after NUMERIC(18, 2) NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_balance_adjustments_user ON balance_adjustments(user_id, id DESC);
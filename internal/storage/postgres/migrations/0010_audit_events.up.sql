@@ -0,0 +1,17 @@
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    user_id BIGINT,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    payload JSON NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_audit_events_user ON audit_events(user_id, created_at DESC, id DESC);
+CREATE INDEX idx_audit_events_action ON audit_events(action, created_at DESC, id DESC);
+CREATE INDEX idx_audit_events_created ON audit_events(created_at DESC, id DESC);
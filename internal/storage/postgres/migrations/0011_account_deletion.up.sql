@@ -0,0 +1,3 @@
+-- Closed accounts keep their row, so financial records stay linked to a
+-- pseudonymous user.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
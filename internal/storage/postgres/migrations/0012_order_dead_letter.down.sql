@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_orders_dead_lettered;
+
+DROP INDEX IF EXISTS idx_orders_due;
+CREATE INDEX idx_orders_due ON orders(next_attempt_at) WHERE status IN ('NEW', 'PROCESSING');
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS dead_lettered_at,
+    DROP COLUMN IF EXISTS failing_since,
+    DROP COLUMN IF EXISTS failures;
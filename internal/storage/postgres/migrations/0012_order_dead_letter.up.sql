@@ -0,0 +1,12 @@
+ALTER TABLE orders
+    ADD COLUMN failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN failing_since TIMESTAMPTZ,
+    ADD COLUMN dead_lettered_at TIMESTAMPTZ;
+
+-- Dead-lettered orders wait for an operator and are never due.
+DROP INDEX IF EXISTS idx_orders_due;
+CREATE INDEX idx_orders_due ON orders(next_attempt_at)
+    WHERE status IN ('NEW', 'PROCESSING') AND dead_lettered_at IS NULL;
+
+CREATE INDEX idx_orders_dead_lettered ON orders(dead_lettered_at DESC, id DESC)
+    WHERE dead_lettered_at IS NOT NULL;
@@ -0,0 +1,9 @@
+-- Rejected withdrawals keep their outcome so a retry with the same
+-- Idempotency-Key replays the rejection instead of running again.
+CREATE TABLE withdrawal_rejections (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    rejected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, idempotency_key)
+);
@@ -0,0 +1,9 @@
+-- The chain head lives in one row. Appends lock it as their last statement,
+-- so money movements queue on each other only for the time it takes to commit.
+CREATE TABLE audit_head (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    hash TEXT NOT NULL
+);
+
+INSERT INTO audit_head (hash)
+SELECT COALESCE((SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1), '');
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_outbox_events_dead_lettered;
+
+DROP INDEX IF EXISTS idx_outbox_events_pending;
+DROP INDEX IF EXISTS idx_outbox_events_user_pending;
+CREATE INDEX idx_outbox_events_pending ON outbox_events(id) WHERE delivered_at IS NULL;
+CREATE INDEX idx_outbox_events_user_pending ON outbox_events(user_id, id) WHERE delivered_at IS NULL;
+
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS dead_lettered_at;
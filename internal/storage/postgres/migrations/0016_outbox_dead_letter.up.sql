@@ -0,0 +1,12 @@
+ALTER TABLE outbox_events ADD COLUMN dead_lettered_at TIMESTAMPTZ;
+
+-- Dead-lettered events wait for an operator and are never pending.
+DROP INDEX IF EXISTS idx_outbox_events_pending;
+DROP INDEX IF EXISTS idx_outbox_events_user_pending;
+CREATE INDEX idx_outbox_events_pending ON outbox_events(id)
+    WHERE delivered_at IS NULL AND dead_lettered_at IS NULL;
+CREATE INDEX idx_outbox_events_user_pending ON outbox_events(user_id, id)
+    WHERE delivered_at IS NULL AND dead_lettered_at IS NULL;
+
+CREATE INDEX idx_outbox_events_dead_lettered ON outbox_events(dead_lettered_at)
+    WHERE dead_lettered_at IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Every order number ever uploaded. Create claims the number here before it
+-- inserts the order, and archiving never deletes from it, so an order moving
+-- to orders_archive cannot free its number for a concurrent upload.
+CREATE TABLE order_numbers (
+    number TEXT PRIMARY KEY
+);
+
+INSERT INTO order_numbers (number)
+SELECT number FROM orders
+UNION
+SELECT number FROM orders_archive;
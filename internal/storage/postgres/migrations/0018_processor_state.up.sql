@@ -0,0 +1,7 @@
+-- The state operators want every order processor in. A single row, absent
+-- until the first pause, resume or drain.
+CREATE TABLE processor_state (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    state TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
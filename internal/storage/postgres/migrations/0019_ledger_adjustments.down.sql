@@ -0,0 +1,11 @@
+DELETE FROM ledger_entries WHERE kind = 'ADJUSTMENT';
+
+DROP INDEX IF EXISTS ledger_entries_adjustment;
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_source;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_source CHECK (
+    (kind = 'ACCRUAL' AND order_id IS NOT NULL AND withdrawal_id IS NULL AND amount > 0) OR
+    (kind = 'WITHDRAWAL' AND withdrawal_id IS NOT NULL AND order_id IS NULL AND amount < 0)
+);
+
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS adjustment_id;
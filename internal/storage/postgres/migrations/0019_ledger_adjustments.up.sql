@@ -0,0 +1,13 @@
+-- Reconciliation repairs post the difference they apply to the ledger, so
+-- the sum of a user's postings always matches the stored balance. Repairs
+-- are not tied to an order; their order_number is empty.
+ALTER TABLE ledger_entries ADD COLUMN adjustment_id BIGINT REFERENCES balance_adjustments(id);
+
+ALTER TABLE ledger_entries DROP CONSTRAINT ledger_entries_source;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_source CHECK (
+    (kind = 'ACCRUAL' AND order_id IS NOT NULL AND withdrawal_id IS NULL AND adjustment_id IS NULL AND amount > 0) OR
+    (kind = 'WITHDRAWAL' AND withdrawal_id IS NOT NULL AND order_id IS NULL AND adjustment_id IS NULL AND amount < 0) OR
+    (kind = 'ADJUSTMENT' AND adjustment_id IS NOT NULL AND order_id IS NULL AND withdrawal_id IS NULL AND amount <> 0)
+);
+
+CREATE UNIQUE INDEX ledger_entries_adjustment ON ledger_entries(adjustment_id) WHERE adjustment_id IS NOT NULL;
@@ -7,20 +7,17 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/polkiloo/gophermart/internal/config"
-	"github.com/polkiloo/gophermart/internal/domain/repository"
 )
 
-// Module wires PostgreSQL storage and repository adapters.
-var Module = fx.Options(
-	fx.Provide(newStorage),
-	fx.Provide(
-		func(s *Storage) repository.UserRepository { return s.Users() },
-		func(s *Storage) repository.OrderRepository { return s.Orders() },
-		func(s *Storage) repository.BalanceRepository { return s.Balances() },
-		func(s *Storage) repository.WithdrawalRepository { return s.Withdrawals() },
-	),
-	fx.Invoke(registerLifecycle),
-)
+// Open connects storage from application config and closes it on shutdown.
+func Open(ctx context.Context, lc fx.Lifecycle, cfg *config.Config, logger *slog.Logger) (*Storage, error) {
+	storage, err := newStorage(storageParams{Ctx: ctx, Config: cfg, Logger: logger})
+	if err != nil {
+		return nil, err
+	}
+	registerLifecycle(lc, storage)
+	return storage, nil
+}
 
 type storageParams struct {
 	fx.In
@@ -31,7 +28,11 @@ type storageParams struct {
 }
 
 func newStorage(p storageParams) (*Storage, error) {
-	return New(p.Ctx, p.Config.DatabaseURI, p.Logger)
+	return New(p.Ctx, p.Config.DatabaseURI, Options{
+		AutoMigrate:   p.Config.AutoMigrate,
+		ReplicaDSN:    p.Config.DatabaseReplicaURI,
+		MaxReplicaLag: p.Config.ReplicaMaxLag,
+	}, p.Logger)
 }
 
 func registerLifecycle(lc fx.Lifecycle, storage *Storage) {
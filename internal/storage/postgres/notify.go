@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// orderChannel is notified by the orders insert trigger.
+const orderChannel = "orders_new"
+
+type listenConn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+var connectListener = func(ctx context.Context, cfg *pgx.ConnConfig) (listenConn, error) {
+	return pgx.ConnectConfig(ctx, cfg)
+}
+
+var (
+	listenRetryMin = 100 * time.Millisecond
+	listenRetryMax = 30 * time.Second
+)
+
+// NewOrders holds a dedicated LISTEN connection outside the pool and signals
+// on every order insert until ctx ends. A dropped connection is re-established
+// with backoff; each reconnect also signals once so that inserts missed while
+// disconnected are picked up.
+func (s *Storage) NewOrders(ctx context.Context) <-chan struct{} {
+	signals := make(chan struct{}, 1)
+	if s.connConfig != nil {
+		go s.listen(ctx, signals)
+	}
+	return signals
+}
+
+func (s *Storage) listen(ctx context.Context, signals chan<- struct{}) {
+	delay := listenRetryMin
+	for {
+		err := s.listenOnce(ctx, signals, func() { delay = listenRetryMin })
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.Warn("order listener disconnected", slog.String("error", err.Error()), slog.Duration("retry_in", delay))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, listenRetryMax)
+	}
+}
+
+func (s *Storage) listenOnce(ctx context.Context, signals chan<- struct{}, connected func()) error {
+	conn, err := connectListener(ctx, s.connConfig.Copy())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+orderChannel); err != nil {
+		return err
+	}
+	connected()
+
+	for {
+		wake(signals)
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func wake(signals chan<- struct{}) {
+	select {
+	case signals <- struct{}{}:
+	default:
+	}
+}
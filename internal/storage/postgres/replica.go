@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+const (
+	// DefaultMaxReplicaLag is the replay delay past which reads fall back to the primary.
+	DefaultMaxReplicaLag = 5 * time.Second
+
+	replicaCheckInterval = time.Second
+	replicaCheckTimeout  = time.Second
+)
+
+// replicaLagQuery reports whether the server is a standby that is streaming
+// WAL right now, and its lag. Lag is zero while a streaming replica has
+// replayed everything it received, so an idle primary does not look like lag;
+// otherwise it is the age of the last replayed transaction, NULL if unknown.
+// A disconnected receiver never looks caught up, however old its data.
+const replicaLagQuery = `SELECT pg_is_in_recovery(),
+                                EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming'),
+                                pg_last_wal_receive_lsn() IS NOT NULL,
+                                CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+                                     ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END::float8`
+
+// replica is a read-only pool that serves reads only while it keeps up.
+type replica struct {
+	pool    pgxPool
+	maxLag  time.Duration
+	logger  *slog.Logger
+	healthy atomic.Bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// attachReplica connects the read replica and starts watching its lag. Reads
+// stay on the primary until the first check succeeds.
+func (s *Storage) attachReplica(ctx context.Context, dsn string, maxLag time.Duration) error {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return fmt.Errorf("parse replica dsn: %w", err)
+	}
+	pool, err := newPgxPool(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("connect replica: %w", err)
+	}
+	if maxLag <= 0 {
+		maxLag = DefaultMaxReplicaLag
+	}
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	r := &replica{pool: pool, maxLag: maxLag, logger: s.logger, cancel: cancel, done: make(chan struct{})}
+	s.replica = r
+	go r.run(runCtx)
+	return nil
+}
+
+func (r *replica) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		r.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check measures replication lag and flips routing when it crosses maxLag.
+func (r *replica) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	var (
+		standby, streaming, received bool
+		lagSeconds                   *float64
+	)
+	err := r.pool.QueryRow(ctx, replicaLagQuery).Scan(&standby, &streaming, &received, &lagSeconds)
+	var unavailable string
+	switch {
+	case err != nil:
+		unavailable = err.Error()
+	case !standby:
+		unavailable = "server is not a standby"
+	case !received:
+		unavailable = "no WAL received"
+	case !streaming:
+		unavailable = "WAL receiver is not streaming"
+	case lagSeconds == nil:
+		unavailable = "replay lag unknown"
+	}
+	var lag time.Duration
+	if lagSeconds != nil {
+		lag = time.Duration(*lagSeconds * float64(time.Second))
+	}
+	healthy := unavailable == "" && lag <= r.maxLag
+
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	switch {
+	case healthy:
+		r.logger.Info("read replica available", slog.Duration("lag", lag))
+	case unavailable != "":
+		r.logger.Warn("read replica unavailable, reading from primary", slog.String("error", unavailable))
+	default:
+		r.logger.Warn("read replica lagging, reading from primary", slog.Duration("lag", lag), slog.Duration("max_lag", r.maxLag))
+	}
+}
+
+func (r *replica) close() {
+	r.cancel()
+	<-r.done
+	r.pool.Close()
+}
+
+// reader returns the connection for a read-only query: the ambient
+// transaction, the replica when it is healthy and the caller's session has
+// not written yet, or the primary.
+func (s *Storage) reader(ctx context.Context) querier {
+	if tx := s.txFromContext(ctx); tx != nil {
+		return tx
+	}
+	if s.replica == nil || !s.replica.healthy.Load() || repository.HasWritten(ctx) {
+		return s.pool
+	}
+	return s.replica.pool
+}
+
+// writer returns the primary connection and remembers the write in the
+// caller's session.
+func (s *Storage) writer(ctx context.Context) querier {
+	repository.MarkWritten(ctx)
+	return s.conn(ctx)
+}
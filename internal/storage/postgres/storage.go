@@ -2,9 +2,14 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -31,8 +36,10 @@ var newPgxPool = func(ctx context.Context, cfg *pgxpool.Config) (pgxPool, error)
 
 // Storage acts as repository facade backed by PostgreSQL.
 type Storage struct {
-	pool   pgxPool
-	logger *slog.Logger
+	pool       pgxPool
+	replica    *replica
+	connConfig *pgx.ConnConfig
+	logger     *slog.Logger
 }
 
 type userRepository struct {
@@ -51,8 +58,48 @@ type withdrawalRepository struct {
 	storage *Storage
 }
 
-// New creates storage with schema initialization.
-func New(ctx context.Context, dsn string, logger *slog.Logger) (*Storage, error) {
+type outboxRepository struct {
+	storage *Storage
+}
+
+type auditRepository struct {
+	storage *Storage
+}
+
+// Options tunes storage behaviour on startup.
+type Options struct {
+	// AutoMigrate applies pending migrations instead of refusing to start.
+	AutoMigrate bool
+	// ReplicaDSN enables routing of read-only queries to a replica.
+	ReplicaDSN string
+	// MaxReplicaLag is the replay delay past which reads go back to the primary.
+	MaxReplicaLag time.Duration
+}
+
+// New connects to the database and makes sure the schema is up to date.
+func New(ctx context.Context, dsn string, opts Options, logger *slog.Logger) (*Storage, error) {
+	storage, err := Connect(ctx, dsn, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.ensureSchema(ctx, opts.AutoMigrate); err != nil {
+		storage.Close()
+		return nil, err
+	}
+
+	if opts.ReplicaDSN != "" {
+		if err := storage.attachReplica(ctx, opts.ReplicaDSN, opts.MaxReplicaLag); err != nil {
+			storage.Close()
+			return nil, err
+		}
+	}
+
+	return storage, nil
+}
+
+// Connect opens the connection pool without touching the schema.
+func Connect(ctx context.Context, dsn string, logger *slog.Logger) (*Storage, error) {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parse dsn: %w", err)
@@ -63,17 +110,15 @@ func New(ctx context.Context, dsn string, logger *slog.Logger) (*Storage, error)
 		return nil, fmt.Errorf("connect db: %w", err)
 	}
 
-	storage := &Storage{pool: pool, logger: logger}
-	if err := storage.initSchema(ctx); err != nil {
-		pool.Close()
-		return nil, err
-	}
-
-	return storage, nil
+	return &Storage{pool: pool, connConfig: cfg.ConnConfig, logger: logger}, nil
 }
 
 // Close releases database resources.
 func (s *Storage) Close() {
+	if s.replica != nil {
+		s.replica.close()
+		s.replica = nil
+	}
 	if s.pool != nil {
 		s.pool.Close()
 	}
@@ -96,45 +141,54 @@ func (s *Storage) Withdrawals() repository.WithdrawalRepository {
 	return &withdrawalRepository{storage: s}
 }
 
-func (s *Storage) initSchema(ctx context.Context) error {
-	statements := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-            id SERIAL PRIMARY KEY,
-            login TEXT UNIQUE NOT NULL,
-            password_hash TEXT NOT NULL,
-            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-        )`,
-		`CREATE TABLE IF NOT EXISTS orders (
-            id SERIAL PRIMARY KEY,
-            user_id BIGINT NOT NULL REFERENCES users(id),
-            number TEXT UNIQUE NOT NULL,
-            status TEXT NOT NULL,
-            accrual DOUBLE PRECISION,
-            uploaded_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-            updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-        )`,
-		`CREATE TABLE IF NOT EXISTS balances (
-            user_id BIGINT PRIMARY KEY REFERENCES users(id),
-            current DOUBLE PRECISION NOT NULL DEFAULT 0,
-            withdrawn DOUBLE PRECISION NOT NULL DEFAULT 0
-        )`,
-		`CREATE TABLE IF NOT EXISTS withdrawals (
-            id SERIAL PRIMARY KEY,
-            user_id BIGINT NOT NULL REFERENCES users(id),
-            order_number TEXT NOT NULL,
-            sum DOUBLE PRECISION NOT NULL,
-            processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-        )`,
-		`CREATE INDEX IF NOT EXISTS idx_orders_user ON orders(user_id, uploaded_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_withdrawals_user ON withdrawals(user_id, processed_at DESC)`,
-	}
-
-	for _, stmt := range statements {
-		if _, err := s.pool.Exec(ctx, stmt); err != nil {
-			return fmt.Errorf("init schema: %w", err)
+func (s *Storage) Outbox() repository.OutboxRepository {
+	return &outboxRepository{storage: s}
+}
+
+func (s *Storage) Audit() repository.AuditRepository {
+	return &auditRepository{storage: s}
+}
+
+func (s *Storage) Transactions() repository.TxManager {
+	return s
+}
+
+func (s *Storage) Notifier() repository.OrderNotifier {
+	return s
+}
+
+func (s *Storage) Leader() repository.LeaderLock {
+	return &leaderLock{storage: s}
+}
+
+func (s *Storage) Instances() repository.InstanceRegistry {
+	return &instanceRegistry{storage: s}
+}
+
+func (s *Storage) ProcessorState() repository.ProcessorStateStore {
+	return &processorStateStore{storage: s}
+}
+
+func (s *Storage) ensureSchema(ctx context.Context, autoMigrate bool) error {
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+
+	if autoMigrate {
+		if _, err := migrator.Up(ctx); err != nil {
+			return fmt.Errorf("migrate schema: %w", err)
 		}
+		return nil
 	}
 
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return fmt.Errorf("check schema: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations, run `gophermart migrate up` or enable auto-migrate", ErrSchemaOutdated, len(pending))
+	}
 	return nil
 }
 
@@ -143,7 +197,7 @@ func (s *Storage) initSchema(ctx context.Context) error {
 func (r *userRepository) Create(ctx context.Context, login, passwordHash string) (*model.User, error) {
 	const query = `INSERT INTO users (login, password_hash) VALUES ($1, $2) RETURNING id, created_at`
 	var u model.User
-	err := r.storage.pool.QueryRow(ctx, query, login, passwordHash).Scan(&u.ID, &u.CreatedAt)
+	err := r.storage.writer(ctx).QueryRow(ctx, query, login, passwordHash).Scan(&u.ID, &u.CreatedAt)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
@@ -157,10 +211,18 @@ func (r *userRepository) Create(ctx context.Context, login, passwordHash string)
 }
 
 func (r *userRepository) GetByLogin(ctx context.Context, login string) (*model.User, error) {
-	const query = `SELECT id, login, password_hash, created_at FROM users WHERE login=$1`
+	const query = `SELECT id, login, password_hash, created_at, deleted_at FROM users WHERE login=$1`
+	return scanUser(r.storage.conn(ctx).QueryRow(ctx, query, login))
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	const query = `SELECT id, login, password_hash, created_at, deleted_at FROM users WHERE id=$1`
+	return scanUser(r.storage.conn(ctx).QueryRow(ctx, query, id))
+}
+
+func scanUser(row pgx.Row) (*model.User, error) {
 	var u model.User
-	err := r.storage.pool.QueryRow(ctx, query, login).Scan(&u.ID, &u.Login, &u.PasswordHash, &u.CreatedAt)
-	if err != nil {
+	if err := row.Scan(&u.ID, &u.Login, &u.PasswordHash, &u.CreatedAt, &u.DeletedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, domainErrors.ErrNotFound
 		}
@@ -169,30 +231,53 @@ func (r *userRepository) GetByLogin(ctx context.Context, login string) (*model.U
 	return &u, nil
 }
 
-func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
-	const query = `SELECT id, login, password_hash, created_at FROM users WHERE id=$1`
-	var u model.User
-	err := r.storage.pool.QueryRow(ctx, query, id).Scan(&u.ID, &u.Login, &u.PasswordHash, &u.CreatedAt)
+// Anonymize closes the account and publishes the deletion in one transaction.
+func (r *userRepository) Anonymize(ctx context.Context, id int64, pseudonym string) (*model.User, error) {
+	var user *model.User
+	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		const query = `UPDATE users SET login=$2, password_hash='', deleted_at=NOW()
+                       WHERE id=$1 AND deleted_at IS NULL
+                       RETURNING id, login, password_hash, created_at, deleted_at`
+		u, err := scanUser(tx.QueryRow(ctx, query, id, pseudonym))
+		if err != nil {
+			return err
+		}
+		if err := publishTx(ctx, tx, id, model.AccountDeleted{DeletedAt: *u.DeletedAt}); err != nil {
+			return err
+		}
+		user = u
+		return nil
+	})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, domainErrors.ErrNotFound
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, domainErrors.ErrAlreadyExists
 		}
 		return nil, err
 	}
-	return &u, nil
+	return user, nil
 }
 
 // --- OrderRepository implementation ---
 
+// Create uploads a new order unless its number is taken, by an active or an
+// archived order. The number is claimed in order_numbers first, which the
+// archiver never touches, so an order being archived still holds it.
 func (r *orderRepository) Create(ctx context.Context, userID int64, number string) (*model.Order, bool, error) {
-	const query = `INSERT INTO orders (user_id, number, status) VALUES ($1, $2, $3)
+	const query = `WITH registered AS (
+                       INSERT INTO order_numbers (number) VALUES ($2::text)
+                       ON CONFLICT (number) DO NOTHING
+                       RETURNING number
+                   )
+                   INSERT INTO orders (user_id, number, status)
+                   SELECT $1::bigint, registered.number, $3::text FROM registered
                    ON CONFLICT (number) DO NOTHING
                    RETURNING id, status, uploaded_at, updated_at`
 	var order model.Order
-	err := r.storage.pool.QueryRow(ctx, query, userID, number, model.OrderStatusNew).Scan(&order.ID, &order.Status, &order.UploadedAt, &order.UpdatedAt)
+	err := r.storage.writer(ctx).QueryRow(ctx, query, userID, number, model.OrderStatusNew).Scan(&order.ID, &order.Status, &order.UploadedAt, &order.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			existing, err := r.GetByNumber(ctx, number)
+			existing, err := r.getByNumber(ctx, r.storage.conn(ctx), number)
 			if err != nil {
 				return nil, false, err
 			}
@@ -208,10 +293,106 @@ func (r *orderRepository) Create(ctx context.Context, userID int64, number strin
 	return &order, true, nil
 }
 
+// CreateBatch inserts all numbers with a single multi-row INSERT and then
+// looks up the owners of the numbers that were already taken.
+func (r *orderRepository) CreateBatch(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+	const insertQuery = `WITH registered AS (
+                             INSERT INTO order_numbers (number)
+                             SELECT input.number FROM unnest($2::text[]) AS input(number)
+                             ON CONFLICT (number) DO NOTHING
+                             RETURNING number
+                         )
+                         INSERT INTO orders (user_id, number, status)
+                         SELECT $1::bigint, registered.number, $3::text FROM registered
+                         ON CONFLICT (number) DO NOTHING
+                         RETURNING number`
+	rows, err := r.storage.writer(ctx).Query(ctx, insertQuery, userID, numbers, model.OrderStatusNew)
+	if err != nil {
+		return nil, err
+	}
+	created, err := scanNumbers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var taken []string
+	for _, number := range numbers {
+		if !created[number] {
+			taken = append(taken, number)
+		}
+	}
+	owners := make(map[string]int64, len(taken))
+	if len(taken) > 0 {
+		const ownersQuery = `SELECT number, user_id FROM orders WHERE number = ANY($1::text[])
+                             UNION ALL
+                             SELECT number, user_id FROM orders_archive WHERE number = ANY($1::text[])`
+		rows, err := r.storage.conn(ctx).Query(ctx, ownersQuery, taken)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				number string
+				owner  int64
+			)
+			if err := rows.Scan(&number, &owner); err != nil {
+				return nil, err
+			}
+			owners[number] = owner
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]model.OrderUpload, 0, len(numbers))
+	for _, number := range numbers {
+		result := model.OrderUpload{Number: number, Result: model.OrderUploadAccepted}
+		if !created[number] {
+			owner, ok := owners[number]
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("order %s was neither created nor found", number)
+			case owner == userID:
+				result.Result = model.OrderUploadAlreadyYours
+			default:
+				result.Result = model.OrderUploadOwnedByAnother
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func scanNumbers(rows pgx.Rows) (map[string]bool, error) {
+	defer rows.Close()
+
+	numbers := make(map[string]bool)
+	for rows.Next() {
+		var number string
+		if err := rows.Scan(&number); err != nil {
+			return nil, err
+		}
+		numbers[number] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return numbers, nil
+}
+
 func (r *orderRepository) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
-	const query = `SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM orders WHERE number=$1`
+	return r.getByNumber(ctx, r.storage.reader(ctx), number)
+}
+
+func (r *orderRepository) getByNumber(ctx context.Context, q querier, number string) (*model.Order, error) {
+	const query = `SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM orders WHERE number=$1
+                   UNION ALL
+                   SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM orders_archive WHERE number=$1
+                   LIMIT 1`
 	var order model.Order
-	err := r.storage.pool.QueryRow(ctx, query, number).Scan(&order.ID, &order.UserID, &order.Number, &order.Status, &order.Accrual, &order.UploadedAt, &order.UpdatedAt)
+	err := q.QueryRow(ctx, query, number).Scan(&order.ID, &order.UserID, &order.Number, &order.Status, &order.Accrual, &order.UploadedAt, &order.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, domainErrors.ErrNotFound
@@ -224,10 +405,90 @@ func (r *orderRepository) GetByNumber(ctx context.Context, number string) (*mode
 func (r *orderRepository) ListByUser(ctx context.Context, userID int64) ([]model.Order, error) {
 	const query = `SELECT id, user_id, number, status, accrual, uploaded_at, updated_at
                    FROM orders WHERE user_id=$1 ORDER BY uploaded_at DESC`
-	rows, err := r.storage.pool.Query(ctx, query, userID)
+	rows, err := r.storage.reader(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanOrders(rows)
+}
+
+// FindByUser returns the user's orders matching filter, one keyset page at a
+// time; a zero page.Limit returns every match.
+func (r *orderRepository) FindByUser(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, error) {
+	query, args := buildFindOrdersQuery(userID, filter, page)
+	rows, err := r.storage.reader(ctx).Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	return scanOrders(rows)
+}
+
+func buildFindOrdersQuery(userID int64, filter model.OrderFilter, page model.Page) (string, []any) {
+	var (
+		where = []string{"user_id=$1"}
+		args  = []any{userID}
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, 0, len(filter.Statuses))
+		for _, st := range filter.Statuses {
+			statuses = append(statuses, string(st))
+		}
+		where = append(where, "status = ANY("+arg(statuses)+"::text[])")
+	}
+	if filter.From != nil {
+		where = append(where, "uploaded_at >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		where = append(where, "uploaded_at < "+arg(*filter.To))
+	}
+	if filter.NumberPrefix != "" {
+		where = append(where, "number LIKE "+arg(escapeLike(filter.NumberPrefix)+"%"))
+	}
+
+	key, cmp, dir := "uploaded_at", "<", "DESC"
+	if filter.SortField() == model.OrderSortAccrual {
+		key = "COALESCE(accrual, 0)"
+	}
+	if filter.Ascending {
+		cmp, dir = ">", "ASC"
+	}
+	if page.After != nil {
+		var position any = page.After.Time
+		if filter.SortField() == model.OrderSortAccrual {
+			position = page.After.Amount
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", key, cmp, arg(position), arg(page.After.ID)))
+	}
+
+	source := "orders"
+	if filter.IncludeArchived {
+		source = allOrdersSource
+	}
+	query := `SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM ` + source + ` WHERE ` +
+		strings.Join(where, " AND ") +
+		fmt.Sprintf(" ORDER BY %s %s, id %s", key, dir, dir)
+	if page.Limit > 0 {
+		query += " LIMIT " + arg(page.Limit)
+	}
+	return query, args
+}
+
+// allOrdersSource lists active and archived orders together; the planner
+// pushes outer filters down into both branches.
+const allOrdersSource = `(SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM orders
+                          UNION ALL
+                          SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM orders_archive) AS orders`
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func scanOrders(rows pgx.Rows) ([]model.Order, error) {
 	defer rows.Close()
 
 	var result []model.Order
@@ -244,150 +505,710 @@ func (r *orderRepository) ListByUser(ctx context.Context, userID int64) ([]model
 	return result, nil
 }
 
-func (r *orderRepository) SelectBatchForProcessing(ctx context.Context, limit int) ([]model.Order, error) {
-	const selectQuery = `SELECT id, user_id, number, status, accrual, uploaded_at, updated_at
-                         FROM orders
-                         WHERE status IN ('NEW', 'PROCESSING')
-                         ORDER BY uploaded_at
-                         LIMIT $1
-                         FOR UPDATE SKIP LOCKED`
+// processingColumns lists the order columns that describe its processing state.
+const processingColumns = `o.id, o.user_id, o.number, o.status, o.accrual, o.uploaded_at, o.updated_at,
+                           o.claimed_by, o.lease_until, o.attempts, o.next_attempt_at, COALESCE(o.last_error, ''),
+                           o.failures, o.failing_since, o.dead_lettered_at`
+
+func scanProcessingOrder(row pgx.Row) (model.Order, error) {
+	var o model.Order
+	err := row.Scan(&o.ID, &o.UserID, &o.Number, &o.Status, &o.Accrual, &o.UploadedAt, &o.UpdatedAt,
+		&o.ClaimedBy, &o.LeaseUntil, &o.Attempts, &o.NextAttemptAt, &o.LastError,
+		&o.Failures, &o.FailingSince, &o.DeadLetteredAt)
+	return o, err
+}
+
+func scanProcessingOrders(rows pgx.Rows) ([]model.Order, error) {
+	defer rows.Close()
 
 	var orders []model.Order
-	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
-		rows, err := tx.Query(ctx, selectQuery, limit)
+	for rows.Next() {
+		o, err := scanProcessingOrder(rows)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		defer rows.Close()
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
 
-		var ids []int64
-		for rows.Next() {
-			var o model.Order
-			if err := rows.Scan(&o.ID, &o.UserID, &o.Number, &o.Status, &o.Accrual, &o.UploadedAt, &o.UpdatedAt); err != nil {
-				return err
-			}
-			ids = append(ids, o.ID)
+// shardHashSQL mirrors model.ShardHash. orders.id is an int4, in which the
+// product overflows once an id passes 44488, so it is widened first.
+const shardHashSQL = `(id::bigint % 2147483647) * 48271 % 2147483647`
 
-			orders = append(orders, o)
-		}
-		if err := rows.Err(); err != nil {
-			return err
-		}
-		if len(ids) == 0 {
-			return nil
-		}
+// shardFilter restricts orders to the shard whose count and index are bound
+// to the given placeholders, like model.Shard.Owns.
+func shardFilter(count, index string) string {
+	return `(` + count + ` <= 1 OR ` + shardHashSQL + ` % ` + count + ` = ` + index + `)`
+}
 
-		const updateQuery = `UPDATE orders SET status='PROCESSING', updated_at=NOW() WHERE id = ANY($1::bigint[])`
-		if _, err := tx.Exec(ctx, updateQuery, ids); err != nil {
-			return err
-		}
-		for i := range orders {
-			orders[i].Status = model.OrderStatusProcessing
-		}
-		return nil
-	})
+// SelectBatchForProcessing leases due orders in claim.Shard to claim.Owner.
+// Orders whose lease has expired are reclaimed, so a crashed instance never
+// strands its batch.
+func (r *orderRepository) SelectBatchForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
+	query := `UPDATE orders o
+                   SET status='PROCESSING', claimed_by=$2, lease_until=NOW() + make_interval(secs => $3),
+                       attempts=o.attempts + 1, updated_at=NOW()
+                   FROM (
+                       SELECT id FROM orders
+                       WHERE status IN ('NEW', 'PROCESSING')
+                         AND dead_lettered_at IS NULL
+                         AND next_attempt_at <= NOW()
+                         AND (lease_until IS NULL OR lease_until <= NOW())
+                         AND ` + shardFilter("$4", "$5") + `
+                       ORDER BY next_attempt_at, uploaded_at
+                       LIMIT $1
+                       FOR UPDATE SKIP LOCKED
+                   ) due
+                   WHERE o.id = due.id
+                   RETURNING ` + processingColumns
+	rows, err := r.storage.writer(ctx).Query(ctx, query, claim.Limit, claim.Owner, claim.Lease.Seconds(), claim.Shard.Count, claim.Shard.Index)
 	if err != nil {
 		return nil, err
 	}
+	orders, err := scanProcessingOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].NextAttemptAt.Equal(orders[j].NextAttemptAt) {
+			return orders[i].NextAttemptAt.Before(orders[j].NextAttemptAt)
+		}
+		return orders[i].UploadedAt.Before(orders[j].UploadedAt)
+	})
 	return orders, nil
 }
 
-func (r *orderRepository) UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *float64) error {
-	return r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
-		const updateQuery = `UPDATE orders SET status=$1, accrual=$2, updated_at=NOW() WHERE id=$3`
-		if _, err := tx.Exec(ctx, updateQuery, status, accrual, orderID); err != nil {
-			return err
-		}
+// CountDue counts the orders in shard that SelectBatchForProcessing would
+// claim now.
+func (r *orderRepository) CountDue(ctx context.Context, shard model.Shard) (int64, error) {
+	query := `SELECT COUNT(*) FROM orders
+                   WHERE status IN ('NEW', 'PROCESSING')
+                     AND dead_lettered_at IS NULL
+                     AND next_attempt_at <= NOW()
+                     AND (lease_until IS NULL OR lease_until <= NOW())
+                     AND ` + shardFilter("$1", "$2")
+	var count int64
+	if err := r.storage.reader(ctx).QueryRow(ctx, query, shard.Count, shard.Index).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
 
-		if status == model.OrderStatusProcessed && accrual != nil && *accrual > 0 {
-			const selectUser = `SELECT user_id FROM orders WHERE id=$1`
-			var userID int64
-			if err := tx.QueryRow(ctx, selectUser, orderID).Scan(&userID); err != nil {
-				return err
-			}
-			if err := r.storage.addAccrualTx(ctx, tx, userID, *accrual); err != nil {
-				return err
-			}
-		}
+// Reschedule releases owner's lease and defers the next attempt by delay.
+func (r *orderRepository) Reschedule(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	const query = `UPDATE orders
+                   SET claimed_by=NULL, lease_until=NULL, next_attempt_at=NOW() + make_interval(secs => $3),
+                       last_error=$4, updated_at=NOW(),
+                       failures=CASE WHEN $4::text IS NULL THEN 0 ELSE failures END,
+                       failing_since=CASE WHEN $4::text IS NULL THEN NULL ELSE failing_since END
+                   WHERE id=$1 AND claimed_by=$2`
+	tag, err := r.storage.writer(ctx).Exec(ctx, query, orderID, owner, delay.Seconds(), nullableString(lastErr))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domainErrors.ErrLeaseLost
+	}
+	return nil
+}
 
-		return nil
-	})
+// Release drops owner's lease and takes back the attempt counted by the claim.
+func (r *orderRepository) Release(ctx context.Context, orderID int64, owner string) error {
+	const query = `UPDATE orders
+                   SET claimed_by=NULL, lease_until=NULL, attempts=GREATEST(attempts - 1, 0), updated_at=NOW()
+                   WHERE id=$1 AND claimed_by=$2`
+	tag, err := r.storage.writer(ctx).Exec(ctx, query, orderID, owner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domainErrors.ErrLeaseLost
+	}
+	return nil
 }
 
-// --- BalanceRepository implementation ---
+// RecordFailure releases owner's lease, counts the failed attempt and
+// defers the next one by delay.
+func (r *orderRepository) RecordFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	const query = `UPDATE orders
+                   SET claimed_by=NULL, lease_until=NULL, next_attempt_at=NOW() + make_interval(secs => $3),
+                       last_error=$4, failures=failures + 1, failing_since=COALESCE(failing_since, NOW()), updated_at=NOW()
+                   WHERE id=$1 AND claimed_by=$2`
+	tag, err := r.storage.writer(ctx).Exec(ctx, query, orderID, owner, delay.Seconds(), nullableString(lastErr))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domainErrors.ErrLeaseLost
+	}
+	return nil
+}
 
-func (s *Storage) addAccrualTx(ctx context.Context, tx pgx.Tx, userID int64, sum float64) error {
-	const updateBalance = `INSERT INTO balances (user_id, current, withdrawn)
-                           VALUES ($1, $2, 0)
-                           ON CONFLICT (user_id) DO UPDATE SET current = balances.current + EXCLUDED.current`
-	if _, err := tx.Exec(ctx, updateBalance, userID, sum); err != nil {
+// DeadLetter releases owner's lease, counts the failed attempt and parks the
+// order until it is requeued.
+func (r *orderRepository) DeadLetter(ctx context.Context, orderID int64, owner string, lastErr string) error {
+	const query = `UPDATE orders
+                   SET claimed_by=NULL, lease_until=NULL, last_error=$3, failures=failures + 1,
+                       failing_since=COALESCE(failing_since, NOW()), dead_lettered_at=NOW(), updated_at=NOW()
+                   WHERE id=$1 AND claimed_by=$2`
+	tag, err := r.storage.writer(ctx).Exec(ctx, query, orderID, owner, nullableString(lastErr))
+	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return domainErrors.ErrLeaseLost
+	}
 	return nil
 }
 
-func (r *balanceRepository) AddAccrual(ctx context.Context, userID int64, sum float64) error {
-	return r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
-		return r.storage.addAccrualTx(ctx, tx, userID, sum)
-	})
+// FindDeadLettered returns parked orders, most recently parked first, one
+// keyset page at a time; a zero page.Limit returns every match.
+func (r *orderRepository) FindDeadLettered(ctx context.Context, page model.Page) ([]model.Order, error) {
+	query := `SELECT ` + processingColumns + ` FROM orders o WHERE o.dead_lettered_at IS NOT NULL`
+	var args []any
+	if page.After != nil {
+		args = append(args, page.After.Time, page.After.ID)
+		query += ` AND (o.dead_lettered_at, o.id) < ($1, $2)`
+	}
+	query += ` ORDER BY o.dead_lettered_at DESC, o.id DESC`
+	if page.Limit > 0 {
+		args = append(args, page.Limit)
+		query += ` LIMIT $` + strconv.Itoa(len(args))
+	}
+	rows, err := r.storage.reader(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanProcessingOrders(rows)
 }
 
-func (r *balanceRepository) GetSummary(ctx context.Context, userID int64) (*model.BalanceSummary, error) {
-	const query = `SELECT current, withdrawn FROM balances WHERE user_id=$1`
-	var summary model.BalanceSummary
-	err := r.storage.pool.QueryRow(ctx, query, userID).Scan(&summary.Current, &summary.Withdrawn)
+// Requeue makes a parked order due now with a fresh retry budget.
+func (r *orderRepository) Requeue(ctx context.Context, number string) (*model.Order, error) {
+	const query = `UPDATE orders o
+                   SET dead_lettered_at=NULL, failures=0, failing_since=NULL, next_attempt_at=NOW(), updated_at=NOW()
+                   WHERE o.number=$1 AND o.dead_lettered_at IS NOT NULL
+                   RETURNING ` + processingColumns
+	order, err := scanProcessingOrder(r.storage.writer(ctx).QueryRow(ctx, query, number))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return &model.BalanceSummary{}, nil
+			return nil, domainErrors.ErrNotFound
 		}
 		return nil, err
 	}
-	return &summary, nil
+	return &order, nil
 }
 
-func (r *balanceRepository) Withdraw(ctx context.Context, userID int64, order string, sum float64) error {
-	return r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
-		const balanceQuery = `SELECT current FROM balances WHERE user_id=$1 FOR UPDATE`
-		var current float64
-		err := tx.QueryRow(ctx, balanceQuery, userID).Scan(&current)
-		if err != nil {
+// UpdateStatus moves the order through the status state machine. The row is
+// locked first, so the accrual is credited only by the transition into PROCESSED.
+func (r *orderRepository) UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusChange, error) {
+	var result model.StatusChange
+	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		const selectQuery = `SELECT user_id, number, status FROM orders WHERE id=$1 FOR UPDATE`
+		var current model.OrderStatus
+		if err := tx.QueryRow(ctx, selectQuery, orderID).Scan(&result.UserID, &result.Number, &current); err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
-				current = 0
-			} else {
-				return err
+				return domainErrors.ErrNotFound
 			}
-		}
-		if current < sum {
-			return domainErrors.ErrInsufficientBalance
+			return err
 		}
 
-		const updateBalance = `INSERT INTO balances (user_id, current, withdrawn)
-                               VALUES ($1, $2, $3)
-                               ON CONFLICT (user_id) DO UPDATE
-                               SET current = balances.current - $2,
-                                   withdrawn = balances.withdrawn + $3`
-		if _, err := tx.Exec(ctx, updateBalance, userID, sum, sum); err != nil {
+		var err error
+		if result.Update, err = current.Transition(status); err != nil || result.Update != model.StatusUpdateApplied {
 			return err
 		}
+		userID, number := result.UserID, result.Number
 
-		const insertWithdrawal = `INSERT INTO withdrawals (user_id, order_number, sum) VALUES ($1, $2, $3)`
-		if _, err := tx.Exec(ctx, insertWithdrawal, userID, order, sum); err != nil {
+		const updateQuery = `UPDATE orders SET status=$1, accrual=$2, claimed_by=NULL, lease_until=NULL, last_error=NULL,
+                                                 failures=0, failing_since=NULL, updated_at=NOW()
+                              WHERE id=$3`
+		if _, err := tx.Exec(ctx, updateQuery, status, accrual, orderID); err != nil {
+			return err
+		}
+		changed := model.OrderStatusChanged{OrderID: orderID, Number: number, From: current, To: status, Accrual: accrual}
+		if err := publishTx(ctx, tx, userID, changed); err != nil {
 			return err
 		}
-		return nil
-	})
-}
 
-// --- WithdrawalRepository implementation ---
+		if status == model.OrderStatusProcessed && accrual != nil && *accrual > 0 {
+			if err := r.storage.addAccrualTx(ctx, tx, userID, orderID, *accrual); err != nil {
+				return err
+			}
+		}
 
-func (r *withdrawalRepository) ListByUser(ctx context.Context, userID int64) ([]model.Withdrawal, error) {
-	const query = `SELECT id, user_id, order_number, sum, processed_at
-                   FROM withdrawals WHERE user_id=$1 ORDER BY processed_at DESC`
-	rows, err := r.storage.pool.Query(ctx, query, userID)
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return model.StatusChange{}, err
 	}
-	defer rows.Close()
+	return result, nil
+}
+
+// archiveLockKey serializes archivers, which may create partitions.
+const archiveLockKey int64 = 0x61726368697665
+
+// Archive moves final orders into the monthly partitions of orders_archive,
+// creating the partitions they need first.
+func (r *orderRepository) Archive(ctx context.Context, before time.Time, limit int) (int64, error) {
+	var moved int64
+	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, archiveLockKey); err != nil {
+			return err
+		}
+
+		const selectQuery = `SELECT id, date_trunc('month', uploaded_at AT TIME ZONE 'UTC') FROM orders
+                             WHERE status IN ('PROCESSED', 'INVALID') AND updated_at < $1
+                             ORDER BY id LIMIT $2 FOR UPDATE`
+		rows, err := tx.Query(ctx, selectQuery, before, limit)
+		if err != nil {
+			return err
+		}
+		var (
+			ids    []int64
+			months []time.Time
+		)
+		for rows.Next() {
+			var (
+				id    int64
+				month time.Time
+			)
+			if err := rows.Scan(&id, &month); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+			if !slices.ContainsFunc(months, month.Equal) {
+				months = append(months, month)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, month := range months {
+			if _, err := tx.Exec(ctx, archivePartitionDDL(month)); err != nil {
+				return fmt.Errorf("create archive partition: %w", err)
+			}
+		}
+
+		const moveQuery = `WITH moved AS (
+                               DELETE FROM orders WHERE id = ANY($1)
+                               RETURNING id, user_id, number, status, accrual, uploaded_at, updated_at
+                           )
+                           INSERT INTO orders_archive (id, user_id, number, status, accrual, uploaded_at, updated_at)
+                           SELECT id, user_id, number, status, accrual, uploaded_at, updated_at FROM moved`
+		tag, err := tx.Exec(ctx, moveQuery, ids)
+		if err != nil {
+			return err
+		}
+		moved = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// archivePartitionDDL creates the archive partition for the UTC month
+// starting at month.
+func archivePartitionDDL(month time.Time) string {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS orders_archive_%s PARTITION OF orders_archive FOR VALUES FROM ('%s') TO ('%s')`,
+		from.Format("2006_01"), from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// --- BalanceRepository implementation ---
+
+func (s *Storage) addAccrualTx(ctx context.Context, tx pgx.Tx, userID, orderID int64, sum model.Money) error {
+	const updateBalance = `INSERT INTO balances (user_id, current, withdrawn)
+                           VALUES ($1, $2, 0)
+                           ON CONFLICT (user_id) DO UPDATE SET current = balances.current + EXCLUDED.current
+                           RETURNING current`
+	var balanceAfter model.Money
+	if err := tx.QueryRow(ctx, updateBalance, userID, sum).Scan(&balanceAfter); err != nil {
+		return err
+	}
+
+	const insertEntry = `INSERT INTO ledger_entries (user_id, kind, amount, balance_after, order_number, order_id)
+                         SELECT $1, $2, $3, $4, number, id FROM orders WHERE id=$5
+                         RETURNING order_number`
+	var number string
+	if err := tx.QueryRow(ctx, insertEntry, userID, model.LedgerEntryAccrual, sum, balanceAfter, orderID).Scan(&number); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domainErrors.ErrNotFound
+		}
+		return err
+	}
+	return publishTx(ctx, tx, userID, model.PointsAccrued{OrderID: orderID, OrderNumber: number, Amount: sum, BalanceAfter: balanceAfter})
+}
+
+func (r *balanceRepository) AddAccrual(ctx context.Context, userID, orderID int64, sum model.Money) error {
+	return r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		return r.storage.addAccrualTx(ctx, tx, userID, orderID, sum)
+	})
+}
+
+func (r *balanceRepository) GetSummary(ctx context.Context, userID int64) (*model.BalanceSummary, error) {
+	const query = `SELECT current, withdrawn FROM balances WHERE user_id=$1`
+	var summary model.BalanceSummary
+	err := r.storage.reader(ctx).QueryRow(ctx, query, userID).Scan(&summary.Current, &summary.Withdrawn)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &model.BalanceSummary{}, nil
+		}
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func (r *balanceRepository) Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+	var (
+		withdrawal *model.Withdrawal
+		created    bool
+		rejected   bool
+	)
+	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		existing, err := findWithdrawal(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			withdrawal = existing
+			return nil
+		}
+		if rejected, err = findRejection(ctx, tx, req); err != nil || rejected {
+			return err
+		}
+
+		const balanceQuery = `SELECT current FROM balances WHERE user_id=$1 FOR UPDATE`
+		var current model.Money
+		err = tx.QueryRow(ctx, balanceQuery, req.UserID).Scan(&current)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				current = 0
+			} else {
+				return err
+			}
+		}
+		if current < req.Sum {
+			if req.IdempotencyKey == "" {
+				return domainErrors.ErrInsufficientBalance
+			}
+			rejected = true
+			const insertRejection = `INSERT INTO withdrawal_rejections (user_id, idempotency_key, fingerprint)
+                                     VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+			_, err := tx.Exec(ctx, insertRejection, req.UserID, req.IdempotencyKey, req.Fingerprint())
+			return err
+		}
+
+		const updateBalance = `INSERT INTO balances (user_id, current, withdrawn)
+                               VALUES ($1, $2, $3)
+                               ON CONFLICT (user_id) DO UPDATE
+                               SET current = balances.current - $2,
+                                   withdrawn = balances.withdrawn + $3
+                               RETURNING current`
+		var balanceAfter model.Money
+		if err := tx.QueryRow(ctx, updateBalance, req.UserID, req.Sum, req.Sum).Scan(&balanceAfter); err != nil {
+			return err
+		}
+
+		const insertWithdrawal = `INSERT INTO withdrawals (user_id, order_number, sum, idempotency_key, fingerprint)
+                                  VALUES ($1, $2, $3, $4, $5) RETURNING id, processed_at`
+		w := model.Withdrawal{
+			UserID:         req.UserID,
+			OrderNumber:    req.OrderNumber,
+			Sum:            req.Sum,
+			IdempotencyKey: req.IdempotencyKey,
+			Fingerprint:    req.Fingerprint(),
+		}
+		if err := tx.QueryRow(ctx, insertWithdrawal, w.UserID, w.OrderNumber, w.Sum, nullableString(w.IdempotencyKey), w.Fingerprint).Scan(&w.ID, &w.ProcessedAt); err != nil {
+			return err
+		}
+
+		const insertEntry = `INSERT INTO ledger_entries (user_id, kind, amount, balance_after, order_number, withdrawal_id)
+                             VALUES ($1, $2, $3, $4, $5, $6)`
+		if _, err := tx.Exec(ctx, insertEntry, w.UserID, model.LedgerEntryWithdrawal, -w.Sum, balanceAfter, w.OrderNumber, w.ID); err != nil {
+			return err
+		}
+		withdrawn := model.PointsWithdrawn{WithdrawalID: w.ID, OrderNumber: w.OrderNumber, Sum: w.Sum, BalanceAfter: balanceAfter}
+		if err := publishTx(ctx, tx, w.UserID, withdrawn); err != nil {
+			return err
+		}
+		withdrawal, created = &w, true
+		return nil
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+			return nil, false, err
+		}
+		// The ambient transaction is aborted; let its owner retry the unit of work.
+		if r.storage.txFromContext(ctx) != nil {
+			return nil, false, fmt.Errorf("%w: %w", domainErrors.ErrConcurrentUpdate, err)
+		}
+		// A concurrent retry committed first; report its outcome instead.
+		existing, findErr := findWithdrawal(ctx, r.storage.pool, req)
+		if findErr != nil {
+			return nil, false, findErr
+		}
+		if existing == nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+	if rejected {
+		return nil, false, domainErrors.ErrInsufficientBalance
+	}
+	return withdrawal, created, nil
+}
+
+type rowsQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// findWithdrawal looks up a previous withdrawal sharing the order number or
+// idempotency key and rejects it when the payload differs.
+func findWithdrawal(ctx context.Context, q rowsQuerier, req model.WithdrawalRequest) (*model.Withdrawal, error) {
+	const query = `SELECT id, user_id, order_number, sum, COALESCE(idempotency_key, ''), fingerprint, processed_at
+                   FROM withdrawals
+                   WHERE duplicate_of IS NULL
+                     AND (order_number=$1 OR (user_id=$2 AND idempotency_key=$3))
+                   ORDER BY id`
+	rows, err := q.Query(ctx, query, req.OrderNumber, req.UserID, nullableString(req.IdempotencyKey))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var found *model.Withdrawal
+	fingerprint := req.Fingerprint()
+	for rows.Next() {
+		var w model.Withdrawal
+		if err := rows.Scan(&w.ID, &w.UserID, &w.OrderNumber, &w.Sum, &w.IdempotencyKey, &w.Fingerprint, &w.ProcessedAt); err != nil {
+			return nil, err
+		}
+		if w.Fingerprint != fingerprint {
+			return nil, domainErrors.ErrIdempotencyConflict
+		}
+		if found == nil {
+			found = &w
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// findRejection reports whether a withdrawal with the same idempotency key
+// was rejected before and rejects a differing payload.
+func findRejection(ctx context.Context, q querier, req model.WithdrawalRequest) (bool, error) {
+	if req.IdempotencyKey == "" {
+		return false, nil
+	}
+	const query = `SELECT fingerprint FROM withdrawal_rejections WHERE user_id=$1 AND idempotency_key=$2`
+	var fingerprint string
+	if err := q.QueryRow(ctx, query, req.UserID, req.IdempotencyKey).Scan(&fingerprint); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	if fingerprint != req.Fingerprint() {
+		return false, domainErrors.ErrIdempotencyConflict
+	}
+	return true, nil
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func (r *balanceRepository) History(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	const query = `SELECT id, user_id, kind, amount, balance_after, order_number, order_id, withdrawal_id, adjustment_id, created_at
+                   FROM ledger_entries WHERE user_id=$1 ORDER BY id DESC`
+	rows, err := r.storage.reader(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []model.LedgerEntry
+	for rows.Next() {
+		var e model.LedgerEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Kind, &e.Amount, &e.BalanceAfter, &e.OrderNumber, &e.OrderID, &e.WithdrawalID, &e.AdjustmentID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// driftsQuery recomputes balances from processed orders, active and
+// archived, and from every recorded withdrawal, sums the ledger postings,
+// and returns the stored balances that differ from either.
+const driftsQuery = `WITH accrued AS (
+                         SELECT user_id, SUM(accrual) AS total
+                         FROM (SELECT user_id, accrual FROM orders WHERE status = 'PROCESSED'
+                               UNION ALL
+                               SELECT user_id, accrual FROM orders_archive WHERE status = 'PROCESSED') AS processed
+                         GROUP BY user_id
+                     ), spent AS (
+                         SELECT user_id, SUM(sum) AS total FROM withdrawals GROUP BY user_id
+                     ), expected AS (
+                         SELECT COALESCE(a.user_id, s.user_id) AS user_id,
+                                COALESCE(a.total, 0) - COALESCE(s.total, 0) AS current,
+                                COALESCE(s.total, 0) AS withdrawn
+                         FROM accrued a FULL JOIN spent s ON s.user_id = a.user_id
+                     ), posted AS (
+                         SELECT user_id, SUM(amount) AS total FROM ledger_entries GROUP BY user_id
+                     )
+                     SELECT COALESCE(e.user_id, b.user_id, p.user_id), COALESCE(e.current, 0), COALESCE(e.withdrawn, 0),
+                            COALESCE(b.current, 0), COALESCE(b.withdrawn, 0), COALESCE(p.total, 0)
+                     FROM expected e
+                     FULL JOIN balances b ON b.user_id = e.user_id
+                     FULL JOIN posted p ON p.user_id = COALESCE(e.user_id, b.user_id)
+                     WHERE COALESCE(e.current, 0) <> COALESCE(b.current, 0)
+                        OR COALESCE(e.withdrawn, 0) <> COALESCE(b.withdrawn, 0)
+                        OR COALESCE(p.total, 0) <> COALESCE(b.current, 0)
+                     ORDER BY 1`
+
+// FindDrifts reads from the primary: a lagging replica would report
+// balances that are merely behind as drifted and have them repaired.
+func (r *balanceRepository) FindDrifts(ctx context.Context) ([]model.BalanceDrift, error) {
+	rows, err := r.storage.conn(ctx).Query(ctx, driftsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drifts []model.BalanceDrift
+	for rows.Next() {
+		var d model.BalanceDrift
+		if err := rows.Scan(&d.UserID, &d.Expected.Current, &d.Expected.Withdrawn, &d.Actual.Current, &d.Actual.Withdrawn, &d.Ledger); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+// Repair locks the balance row before recomputing it, so accruals and
+// withdrawals committed concurrently are either fully counted or applied on
+// top of the repaired value. Whatever the ledger postings miss of the repaired
+// current balance is posted in the same transaction.
+func (r *balanceRepository) Repair(ctx context.Context, userID int64, reason string) (*model.BalanceAdjustment, error) {
+	var adjustment *model.BalanceAdjustment
+	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `INSERT INTO balances (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING`, userID); err != nil {
+			return err
+		}
+		var before model.BalanceSummary
+		if err := tx.QueryRow(ctx, `SELECT current, withdrawn FROM balances WHERE user_id=$1 FOR UPDATE`, userID).
+			Scan(&before.Current, &before.Withdrawn); err != nil {
+			return err
+		}
+
+		const expectedQuery = `SELECT (SELECT COALESCE(SUM(accrual), 0) FROM orders WHERE user_id=$1 AND status = 'PROCESSED')
+                                    + (SELECT COALESCE(SUM(accrual), 0) FROM orders_archive WHERE user_id=$1 AND status = 'PROCESSED'),
+                                      (SELECT COALESCE(SUM(sum), 0) FROM withdrawals WHERE user_id=$1),
+                                      (SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE user_id=$1)`
+		var accrued, withdrawn, posted model.Money
+		if err := tx.QueryRow(ctx, expectedQuery, userID).Scan(&accrued, &withdrawn, &posted); err != nil {
+			return err
+		}
+		after := model.BalanceSummary{Current: accrued - withdrawn, Withdrawn: withdrawn}
+		if after == before && posted == after.Current {
+			return nil
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE balances SET current=$2, withdrawn=$3 WHERE user_id=$1`, userID, after.Current, after.Withdrawn); err != nil {
+			return err
+		}
+		const auditQuery = `INSERT INTO balance_adjustments (user_id, current_before, withdrawn_before, current_after, withdrawn_after, reason)
+                            VALUES ($1, $2, $3, $4, $5, $6)
+                            RETURNING id, created_at`
+		adjustment = &model.BalanceAdjustment{UserID: userID, Before: before, After: after, Reason: reason}
+		if err := tx.QueryRow(ctx, auditQuery, userID, before.Current, before.Withdrawn, after.Current, after.Withdrawn, reason).
+			Scan(&adjustment.ID, &adjustment.CreatedAt); err != nil {
+			return err
+		}
+		if posted == after.Current {
+			return nil
+		}
+
+		const insertEntry = `INSERT INTO ledger_entries (user_id, kind, amount, balance_after, order_number, adjustment_id)
+                             VALUES ($1, $2, $3, $4, '', $5)`
+		_, err := tx.Exec(ctx, insertEntry, userID, model.LedgerEntryAdjustment, after.Current-posted, after.Current, adjustment.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return adjustment, nil
+}
+
+// --- WithdrawalRepository implementation ---
+
+func (r *withdrawalRepository) ListByUser(ctx context.Context, userID int64) ([]model.Withdrawal, error) {
+	const query = `SELECT id, user_id, order_number, sum, processed_at
+                   FROM withdrawals WHERE user_id=$1 ORDER BY processed_at DESC`
+	rows, err := r.storage.reader(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanWithdrawals(rows)
+}
+
+// ListPageByUser returns one newest-first keyset page of the user's withdrawals.
+func (r *withdrawalRepository) ListPageByUser(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, error) {
+	const firstPage = `SELECT id, user_id, order_number, sum, processed_at
+                       FROM withdrawals WHERE user_id=$1
+                       ORDER BY processed_at DESC, id DESC LIMIT $2`
+	const nextPage = `SELECT id, user_id, order_number, sum, processed_at
+                      FROM withdrawals WHERE user_id=$1 AND (processed_at, id) < ($2, $3)
+                      ORDER BY processed_at DESC, id DESC LIMIT $4`
+	var (
+		rows pgx.Rows
+		err  error
+	)
+	if page.After == nil {
+		rows, err = r.storage.reader(ctx).Query(ctx, firstPage, userID, page.Limit)
+	} else {
+		rows, err = r.storage.reader(ctx).Query(ctx, nextPage, userID, page.After.Time, page.After.ID, page.Limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanWithdrawals(rows)
+}
+
+func (r *withdrawalRepository) Pseudonymize(ctx context.Context, userID int64) error {
+	const query = `UPDATE withdrawals SET idempotency_key=NULL WHERE user_id=$1 AND idempotency_key IS NOT NULL`
+	_, err := r.storage.writer(ctx).Exec(ctx, query, userID)
+	return err
+}
+
+func scanWithdrawals(rows pgx.Rows) ([]model.Withdrawal, error) {
+	defer rows.Close()
 
 	var result []model.Withdrawal
 	for rows.Next() {
@@ -403,9 +1224,287 @@ func (r *withdrawalRepository) ListByUser(ctx context.Context, userID int64) ([]
 	return result, nil
 }
 
-// WithinTransaction executes function inside transaction boundary.
-func (s *Storage) WithinTransaction(ctx context.Context, fn func(pgx.Tx) error) (err error) {
-	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+// --- OutboxRepository implementation ---
+
+// outboxLockKey is the advisory lock that serializes outbox claims.
+const outboxLockKey int64 = 0x6f7574626f78
+
+// publishTx records a domain event in the transaction that caused it.
+func publishTx(ctx context.Context, tx pgx.Tx, userID int64, payload model.EventPayload) error {
+	event, err := model.NewEvent(userID, payload)
+	if err != nil {
+		return err
+	}
+	const query = `INSERT INTO outbox_events (user_id, type, payload) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(ctx, query, event.UserID, event.Type, []byte(event.Payload))
+	return err
+}
+
+// Claim leases events by pushing available_at past the lease, so a leased
+// event holds back its user's later events exactly like one waiting for a
+// retry. The advisory lock makes a claim see every lease committed before it.
+func (r *outboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.Event, error) {
+	const query = `UPDATE outbox_events o
+                   SET available_at=NOW() + make_interval(secs => $2)
+                   FROM (
+                       SELECT id FROM outbox_events e
+                       WHERE delivered_at IS NULL AND dead_lettered_at IS NULL AND available_at <= NOW()
+                         AND NOT EXISTS (
+                             SELECT 1 FROM outbox_events p
+                             WHERE p.user_id = e.user_id AND p.id < e.id
+                               AND p.delivered_at IS NULL AND p.dead_lettered_at IS NULL
+                               AND p.available_at > NOW())
+                       ORDER BY id LIMIT $1
+                   ) due
+                   WHERE o.id = due.id
+                   RETURNING o.id, o.user_id, o.type, o.payload, o.attempts, o.created_at`
+
+	var result []model.Event
+	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, outboxLockKey); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, query, limit, lease.Seconds())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				e       model.Event
+				payload []byte
+			)
+			if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &payload, &e.Attempts, &e.CreatedAt); err != nil {
+				return err
+			}
+			e.Payload = payload
+			result = append(result, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (r *outboxRepository) Release(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	const query = `UPDATE outbox_events SET available_at=NOW() WHERE id = ANY($1) AND delivered_at IS NULL`
+	_, err := r.storage.writer(ctx).Exec(ctx, query, ids)
+	return err
+}
+
+func (r *outboxRepository) MarkDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	const query = `UPDATE outbox_events SET delivered_at=NOW(), last_error=NULL WHERE id = ANY($1)`
+	_, err := r.storage.writer(ctx).Exec(ctx, query, ids)
+	return err
+}
+
+func (r *outboxRepository) MarkFailed(ctx context.Context, id int64, retryAfter time.Duration, lastErr string) error {
+	const query = `UPDATE outbox_events
+                   SET attempts=attempts+1, last_error=$3, available_at=NOW() + make_interval(secs => $2)
+                   WHERE id=$1`
+	tag, err := r.storage.writer(ctx).Exec(ctx, query, id, retryAfter.Seconds(), lastErr)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domainErrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *outboxRepository) DeadLetter(ctx context.Context, id int64, lastErr string) error {
+	const query = `UPDATE outbox_events
+                   SET attempts=attempts+1, last_error=$2, dead_lettered_at=NOW()
+                   WHERE id=$1`
+	tag, err := r.storage.writer(ctx).Exec(ctx, query, id, lastErr)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domainErrors.ErrNotFound
+	}
+	return nil
+}
+
+func (r *outboxRepository) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	const query = `DELETE FROM outbox_events WHERE delivered_at < $1`
+	tag, err := r.storage.writer(ctx).Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// --- AuditRepository implementation ---
+
+const auditColumns = `id, action, actor, COALESCE(user_id, 0), ip, user_agent, request_id, payload, prev_hash, hash, created_at`
+
+// Append links event to the chain head. The head row stays locked until the
+// transaction ends, so callers append last, right before they commit.
+func (r *auditRepository) Append(ctx context.Context, event model.AuditEvent) (*model.AuditEvent, error) {
+	err := r.storage.WithinTransaction(ctx, func(tx pgx.Tx) error {
+		var prev string
+		if err := tx.QueryRow(ctx, `SELECT hash FROM audit_head FOR UPDATE`).Scan(&prev); err != nil {
+			return err
+		}
+
+		// Postgres keeps microseconds; hash exactly what will be read back.
+		event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		event.Link(prev)
+		const query = `INSERT INTO audit_events (action, actor, user_id, ip, user_agent, request_id, payload, prev_hash, hash, created_at)
+                       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+		if err := tx.QueryRow(ctx, query, event.Action, event.Actor, nullableID(event.UserID), event.IP, event.UserAgent,
+			event.RequestID, string(event.Payload), event.PrevHash, event.Hash, event.CreatedAt).Scan(&event.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `UPDATE audit_head SET hash=$1`, event.Hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *auditRepository) Find(ctx context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, error) {
+	var (
+		where = []string{"TRUE"}
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if filter.UserID != 0 {
+		where = append(where, "user_id="+arg(filter.UserID))
+	}
+	if filter.Action != "" {
+		where = append(where, "action="+arg(string(filter.Action)))
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "created_at < "+arg(filter.To))
+	}
+	if page.After != nil {
+		where = append(where, fmt.Sprintf("(created_at, id) < (%s, %s)", arg(page.After.Time), arg(page.After.ID)))
+	}
+	query := `SELECT ` + auditColumns + ` FROM audit_events WHERE ` + strings.Join(where, " AND ") +
+		` ORDER BY created_at DESC, id DESC`
+	if page.Limit > 0 {
+		query += " LIMIT " + arg(page.Limit)
+	}
+
+	rows, err := r.storage.reader(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEvents(rows)
+}
+
+func (r *auditRepository) Chain(ctx context.Context, afterID int64, limit int) ([]model.AuditEvent, error) {
+	const query = `SELECT ` + auditColumns + ` FROM audit_events WHERE id > $1 ORDER BY id LIMIT $2`
+	rows, err := r.storage.conn(ctx).Query(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEvents(rows)
+}
+
+func scanAuditEvents(rows pgx.Rows) ([]model.AuditEvent, error) {
+	defer rows.Close()
+
+	var result []model.AuditEvent
+	for rows.Next() {
+		var (
+			e       model.AuditEvent
+			payload string
+		)
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &e.UserID, &e.IP, &e.UserAgent, &e.RequestID,
+			&payload, &e.PrevHash, &e.Hash, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		result = append(result, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func nullableID(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txKey struct{}
+
+type ambientTx struct {
+	storage *Storage
+	tx      pgx.Tx
+}
+
+// txFromContext returns the transaction opened by this storage's WithinTx, if any.
+func (s *Storage) txFromContext(ctx context.Context) pgx.Tx {
+	if amb, ok := ctx.Value(txKey{}).(*ambientTx); ok && amb.storage == s {
+		return amb.tx
+	}
+	return nil
+}
+
+// conn returns the ambient transaction or the pool.
+func (s *Storage) conn(ctx context.Context) querier {
+	if tx := s.txFromContext(ctx); tx != nil {
+		return tx
+	}
+	return s.pool
+}
+
+// WithinTx runs fn in a transaction carried by the context, joining an
+// already open one instead of nesting.
+func (s *Storage) WithinTx(ctx context.Context, opts repository.TxOptions, fn func(ctx context.Context) error) error {
+	if s.txFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	return s.begin(ctx, txOptions(opts), func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, &ambientTx{storage: s, tx: tx}))
+	})
+}
+
+// WithinTransaction executes function inside transaction boundary, reusing
+// the ambient transaction when the context carries one.
+func (s *Storage) WithinTransaction(ctx context.Context, fn func(pgx.Tx) error) error {
+	if tx := s.txFromContext(ctx); tx != nil {
+		return fn(tx)
+	}
+	return s.begin(ctx, pgx.TxOptions{}, fn)
+}
+
+func (s *Storage) begin(ctx context.Context, opts pgx.TxOptions, fn func(pgx.Tx) error) (err error) {
+	if opts.AccessMode != pgx.ReadOnly {
+		repository.MarkWritten(ctx)
+	}
+	tx, err := s.pool.BeginTx(ctx, opts)
 	if err != nil {
 		return err
 	}
@@ -421,6 +1520,22 @@ func (s *Storage) WithinTransaction(ctx context.Context, fn func(pgx.Tx) error)
 	return err
 }
 
+func txOptions(opts repository.TxOptions) pgx.TxOptions {
+	var pgOpts pgx.TxOptions
+	switch opts.Isolation {
+	case repository.IsolationReadCommitted:
+		pgOpts.IsoLevel = pgx.ReadCommitted
+	case repository.IsolationRepeatableRead:
+		pgOpts.IsoLevel = pgx.RepeatableRead
+	case repository.IsolationSerializable:
+		pgOpts.IsoLevel = pgx.Serializable
+	}
+	if opts.ReadOnly {
+		pgOpts.AccessMode = pgx.ReadOnly
+	}
+	return pgOpts
+}
+
 // HealthCheck verifies database connectivity.
 func (s *Storage) HealthCheck(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
@@ -65,9 +65,11 @@ func (s StrategyStub) Name() string {
 
 // TokenParserStub implements middleware token parsing contract.
 type TokenParserStub struct {
-	ID      int64
-	Err     error
-	ParseFn func(string) (int64, error)
+	ID       int64
+	Err      error
+	ParseFn  func(string) (int64, error)
+	RejectFn func(context.Context, string)
+	ActiveFn func(context.Context, int64) (bool, error)
 }
 
 // ParseToken either delegates to override or returns predefined result.
@@ -81,11 +83,28 @@ func (s TokenParserStub) ParseToken(token string) (int64, error) {
 	return s.ID, nil
 }
 
+// TokenRejected forwards rejections to RejectFn when provided.
+func (s TokenParserStub) TokenRejected(ctx context.Context, reason string) {
+	if s.RejectFn != nil {
+		s.RejectFn(ctx, reason)
+	}
+}
+
+// AccountActive delegates to ActiveFn or reports every account open.
+func (s TokenParserStub) AccountActive(ctx context.Context, userID int64) (bool, error) {
+	if s.ActiveFn != nil {
+		return s.ActiveFn(ctx, userID)
+	}
+	return true, nil
+}
+
 // AuthFacadeStub simulates authentication facade interactions.
 type AuthFacadeStub struct {
 	RegisterFn     func(context.Context, string, string) (string, error)
 	AuthenticateFn func(context.Context, string, string) (string, error)
 	ParseFn        func(string) (int64, error)
+	RejectFn       func(context.Context, string)
+	ActiveFn       func(context.Context, int64) (bool, error)
 }
 
 // Register returns token for successful registration scenarios.
@@ -112,11 +131,29 @@ func (s AuthFacadeStub) ParseToken(token string) (int64, error) {
 	return 1, nil
 }
 
+// TokenRejected forwards rejections to RejectFn when provided.
+func (s AuthFacadeStub) TokenRejected(ctx context.Context, reason string) {
+	if s.RejectFn != nil {
+		s.RejectFn(ctx, reason)
+	}
+}
+
+// AccountActive delegates to ActiveFn or reports every account open.
+func (s AuthFacadeStub) AccountActive(ctx context.Context, userID int64) (bool, error) {
+	if s.ActiveFn != nil {
+		return s.ActiveFn(ctx, userID)
+	}
+	return true, nil
+}
+
 // LoyaltyFacadeStub aggregates facade dependencies for HTTP layer tests.
 type LoyaltyFacadeStub struct {
 	AuthFacadeStub
 	OrderFacadeStub
 	BalanceFacadeStub
+	AccountFacadeStub
+	AuditFacadeStub
+	OrderAdminFacadeStub
 }
 
 var _ pkgAuth.PasswordHasher = HasherStub{}
@@ -11,8 +11,10 @@ import (
 
 // OrderFacadeStub provides controllable behaviour for order endpoints.
 type OrderFacadeStub struct {
-	UploadFn func(context.Context, int64, string) (*model.Order, bool, error)
-	OrdersFn func(context.Context, int64) ([]model.Order, error)
+	UploadFn      func(context.Context, int64, string) (*model.Order, bool, error)
+	UploadBatchFn func(context.Context, int64, []string) ([]model.OrderUpload, error)
+	OrdersFn      func(context.Context, int64) ([]model.Order, error)
+	FindFn        func(context.Context, int64, model.OrderFilter, model.Page) ([]model.Order, *model.Cursor, error)
 }
 
 // UploadOrder delegates to provided function or returns default order.
@@ -23,6 +25,18 @@ func (s OrderFacadeStub) UploadOrder(ctx context.Context, userID int64, number s
 	return &model.Order{Number: number, UserID: userID}, true, nil
 }
 
+// UploadOrders delegates to provided function or accepts every number.
+func (s OrderFacadeStub) UploadOrders(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+	if s.UploadBatchFn != nil {
+		return s.UploadBatchFn(ctx, userID, numbers)
+	}
+	uploads := make([]model.OrderUpload, 0, len(numbers))
+	for _, number := range numbers {
+		uploads = append(uploads, model.OrderUpload{Number: number, Result: model.OrderUploadAccepted})
+	}
+	return uploads, nil
+}
+
 // Orders returns predefined orders for given user.
 func (s OrderFacadeStub) Orders(ctx context.Context, userID int64) ([]model.Order, error) {
 	if s.OrdersFn != nil {
@@ -31,11 +45,21 @@ func (s OrderFacadeStub) Orders(ctx context.Context, userID int64) ([]model.Orde
 	return []model.Order{{Number: "1"}}, nil
 }
 
+// FindOrders returns the configured result or a single order without a next cursor.
+func (s OrderFacadeStub) FindOrders(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, *model.Cursor, error) {
+	if s.FindFn != nil {
+		return s.FindFn(ctx, userID, filter, page)
+	}
+	return []model.Order{{Number: "1"}}, nil, nil
+}
+
 // BalanceFacadeStub simulates balance operations.
 type BalanceFacadeStub struct {
-	BalanceFn     func(context.Context, int64) (*model.BalanceSummary, error)
-	WithdrawFn    func(context.Context, int64, string, float64) error
-	WithdrawalsFn func(context.Context, int64) ([]model.Withdrawal, error)
+	BalanceFn         func(context.Context, int64) (*model.BalanceSummary, error)
+	WithdrawFn        func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error)
+	WithdrawalsFn     func(context.Context, int64) ([]model.Withdrawal, error)
+	WithdrawalsPageFn func(context.Context, int64, model.Page) ([]model.Withdrawal, *model.Cursor, error)
+	HistoryFn         func(context.Context, int64) ([]model.LedgerEntry, error)
 }
 
 // Balance returns stored summary or default data.
@@ -47,11 +71,11 @@ func (s BalanceFacadeStub) Balance(ctx context.Context, userID int64) (*model.Ba
 }
 
 // Withdraw executes configured withdrawal handler.
-func (s BalanceFacadeStub) Withdraw(ctx context.Context, userID int64, order string, sum float64) error {
+func (s BalanceFacadeStub) Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
 	if s.WithdrawFn != nil {
-		return s.WithdrawFn(ctx, userID, order, sum)
+		return s.WithdrawFn(ctx, req)
 	}
-	return nil
+	return &model.Withdrawal{UserID: req.UserID, OrderNumber: req.OrderNumber, Sum: req.Sum}, true, nil
 }
 
 // Withdrawals returns preconfigured history.
@@ -62,20 +86,158 @@ func (s BalanceFacadeStub) Withdrawals(ctx context.Context, userID int64) ([]mod
 	return []model.Withdrawal{{OrderNumber: "1", Sum: 1, ProcessedAt: time.Unix(0, 0)}}, nil
 }
 
+// WithdrawalsPage returns the configured page or a single withdrawal without a next cursor.
+func (s BalanceFacadeStub) WithdrawalsPage(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, *model.Cursor, error) {
+	if s.WithdrawalsPageFn != nil {
+		return s.WithdrawalsPageFn(ctx, userID, page)
+	}
+	return []model.Withdrawal{{OrderNumber: "1", Sum: 1, ProcessedAt: time.Unix(0, 0)}}, nil, nil
+}
+
+// BalanceHistory returns preconfigured ledger entries.
+func (s BalanceFacadeStub) BalanceHistory(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	if s.HistoryFn != nil {
+		return s.HistoryFn(ctx, userID)
+	}
+	return []model.LedgerEntry{{Kind: model.LedgerEntryAccrual, OrderNumber: "1", Amount: 1, BalanceAfter: 1, CreatedAt: time.Unix(0, 0)}}, nil
+}
+
+// AccountFacadeStub serves data subject requests for HTTP layer tests.
+type AccountFacadeStub struct {
+	ExportFn func(context.Context, int64) (*model.AccountExport, error)
+	DeleteFn func(context.Context, int64) error
+}
+
+// ExportAccount delegates to provided function or returns an empty export.
+func (s AccountFacadeStub) ExportAccount(ctx context.Context, userID int64) (*model.AccountExport, error) {
+	if s.ExportFn != nil {
+		return s.ExportFn(ctx, userID)
+	}
+	return &model.AccountExport{User: model.User{ID: userID}}, nil
+}
+
+// DeleteAccount delegates to provided function or succeeds.
+func (s AccountFacadeStub) DeleteAccount(ctx context.Context, userID int64) error {
+	if s.DeleteFn != nil {
+		return s.DeleteFn(ctx, userID)
+	}
+	return nil
+}
+
+// AuditFacadeStub serves audit queries for HTTP layer tests.
+type AuditFacadeStub struct {
+	EventsFn func(context.Context, model.AuditFilter, model.Page) ([]model.AuditEvent, *model.Cursor, error)
+	VerifyFn func(context.Context) (*model.AuditVerification, error)
+}
+
+// AuditEvents delegates to provided function or returns no events.
+func (s AuditFacadeStub) AuditEvents(ctx context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, *model.Cursor, error) {
+	if s.EventsFn != nil {
+		return s.EventsFn(ctx, filter, page)
+	}
+	return nil, nil, nil
+}
+
+// VerifyAudit delegates to provided function or reports an intact chain.
+func (s AuditFacadeStub) VerifyAudit(ctx context.Context) (*model.AuditVerification, error) {
+	if s.VerifyFn != nil {
+		return s.VerifyFn(ctx)
+	}
+	return &model.AuditVerification{Valid: true}, nil
+}
+
+// OrderAdminFacadeStub serves dead-letter operations for HTTP layer tests.
+type OrderAdminFacadeStub struct {
+	DeadLetteredFn func(context.Context, model.Page) ([]model.Order, *model.Cursor, error)
+	RequeueFn      func(context.Context, string) (*model.Order, error)
+}
+
+// DeadLetteredOrders delegates to provided function or returns no orders.
+func (s OrderAdminFacadeStub) DeadLetteredOrders(ctx context.Context, page model.Page) ([]model.Order, *model.Cursor, error) {
+	if s.DeadLetteredFn != nil {
+		return s.DeadLetteredFn(ctx, page)
+	}
+	return nil, nil, nil
+}
+
+// RequeueOrder delegates to provided function or requeues a fresh order.
+func (s OrderAdminFacadeStub) RequeueOrder(ctx context.Context, number string) (*model.Order, error) {
+	if s.RequeueFn != nil {
+		return s.RequeueFn(ctx, number)
+	}
+	return &model.Order{Number: number, Status: model.OrderStatusNew}, nil
+}
+
+// ProcessorControlStub records operator commands for HTTP layer tests.
+type ProcessorControlStub struct {
+	State    model.ProcessorState
+	Commands []string
+	Err      error
+}
+
+// Status returns the state set by the last command.
+func (s *ProcessorControlStub) Status() model.ProcessorStatus {
+	if s.State == "" {
+		return model.ProcessorStatus{State: model.ProcessorRunning}
+	}
+	return model.ProcessorStatus{State: s.State}
+}
+
+// Pause records the command and pauses unless Err is set.
+func (s *ProcessorControlStub) Pause(context.Context) error {
+	return s.command("pause", model.ProcessorPaused)
+}
+
+// Resume records the command and resumes unless Err is set.
+func (s *ProcessorControlStub) Resume(context.Context) error {
+	return s.command("resume", model.ProcessorRunning)
+}
+
+// Drain records the command and starts draining unless Err is set.
+func (s *ProcessorControlStub) Drain(context.Context) error {
+	return s.command("drain", model.ProcessorDraining)
+}
+
+func (s *ProcessorControlStub) command(name string, state model.ProcessorState) error {
+	s.Commands = append(s.Commands, name)
+	if s.Err != nil {
+		return s.Err
+	}
+	s.State = state
+	return nil
+}
+
 // OrderUpdateCall stores information about UpdateOrderStatus invocations.
 type OrderUpdateCall struct {
 	OrderID int64
 	Status  model.OrderStatus
-	Accrual *float64
+	Accrual *model.Money
+}
+
+// OrderRescheduleCall stores information about RescheduleOrder invocations.
+type OrderRescheduleCall struct {
+	OrderID   int64
+	Owner     string
+	Delay     time.Duration
+	LastError string
 }
 
 // WorkerFacadeStub mimics worker interactions with loyalty facade.
 type WorkerFacadeStub struct {
 	Orders          [][]model.Order
-	OrdersFn        func(context.Context, int) ([]model.Order, error)
+	OrdersFn        func(context.Context, model.OrderClaim) ([]model.Order, error)
 	CheckFn         func(context.Context, string) (*model.Accrual, error)
-	UpdateFn        func(context.Context, int64, model.OrderStatus, *float64) error
+	UpdateFn        func(context.Context, int64, model.OrderStatus, *model.Money) (model.StatusUpdate, error)
+	RescheduleFn    func(context.Context, int64, string, time.Duration, string) error
+	ReleaseFn       func(context.Context, int64, string) error
+	FailureFn       func(context.Context, int64, string, time.Duration, string) error
+	DeadLetterFn    func(context.Context, int64, string, string) error
+	BacklogFn       func(context.Context, model.Shard) (int64, error)
 	Updates         []OrderUpdateCall
+	Reschedules     []OrderRescheduleCall
+	Releases        []OrderRescheduleCall
+	Failures        []OrderRescheduleCall
+	DeadLetters     []OrderRescheduleCall
 	mu              sync.Mutex
 	ordersCallCount int32
 }
@@ -87,9 +249,9 @@ func (s *WorkerFacadeStub) Lock() { s.mu.Lock() }
 func (s *WorkerFacadeStub) Unlock() { s.mu.Unlock() }
 
 // OrdersForProcessing returns batches from configured queue.
-func (s *WorkerFacadeStub) OrdersForProcessing(ctx context.Context, limit int) ([]model.Order, error) {
+func (s *WorkerFacadeStub) OrdersForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
 	if s.OrdersFn != nil {
-		return s.OrdersFn(ctx, limit)
+		return s.OrdersFn(ctx, claim)
 	}
 	call := atomic.AddInt32(&s.ordersCallCount, 1)
 	if int(call) <= len(s.Orders) {
@@ -104,21 +266,73 @@ func (s *WorkerFacadeStub) CheckAccrual(ctx context.Context, number string) (*mo
 	if s.CheckFn != nil {
 		return s.CheckFn(ctx, number)
 	}
-	accrual := 5.0
+	accrual := model.MustParseMoney("5")
 	return &model.Accrual{Status: model.AccrualStatusProcessed, Accrual: &accrual}, nil
 }
 
 // UpdateOrderStatus records update requests.
-func (s *WorkerFacadeStub) UpdateOrderStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *float64) error {
+func (s *WorkerFacadeStub) UpdateOrderStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusUpdate, error) {
 	if s.UpdateFn != nil {
 		return s.UpdateFn(ctx, orderID, status, accrual)
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Updates = append(s.Updates, OrderUpdateCall{OrderID: orderID, Status: status, Accrual: accrual})
+	return model.StatusUpdateApplied, nil
+}
+
+// RescheduleOrder records reschedule requests.
+func (s *WorkerFacadeStub) RescheduleOrder(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	if s.RescheduleFn != nil {
+		return s.RescheduleFn(ctx, orderID, owner, delay, lastErr)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Reschedules = append(s.Reschedules, OrderRescheduleCall{OrderID: orderID, Owner: owner, Delay: delay, LastError: lastErr})
 	return nil
 }
 
+// ReleaseOrder records orders handed back unattempted.
+func (s *WorkerFacadeStub) ReleaseOrder(ctx context.Context, orderID int64, owner string) error {
+	if s.ReleaseFn != nil {
+		return s.ReleaseFn(ctx, orderID, owner)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Releases = append(s.Releases, OrderRescheduleCall{OrderID: orderID, Owner: owner})
+	return nil
+}
+
+// RecordOrderFailure records failed attempts.
+func (s *WorkerFacadeStub) RecordOrderFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	if s.FailureFn != nil {
+		return s.FailureFn(ctx, orderID, owner, delay, lastErr)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Failures = append(s.Failures, OrderRescheduleCall{OrderID: orderID, Owner: owner, Delay: delay, LastError: lastErr})
+	return nil
+}
+
+// DeadLetterOrder records orders given up on.
+func (s *WorkerFacadeStub) DeadLetterOrder(ctx context.Context, orderID int64, owner string, lastErr string) error {
+	if s.DeadLetterFn != nil {
+		return s.DeadLetterFn(ctx, orderID, owner, lastErr)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.DeadLetters = append(s.DeadLetters, OrderRescheduleCall{OrderID: orderID, Owner: owner, LastError: lastErr})
+	return nil
+}
+
+// OrderBacklog reports an empty backlog unless BacklogFn is set.
+func (s *WorkerFacadeStub) OrderBacklog(ctx context.Context, shard model.Shard) (int64, error) {
+	if s.BacklogFn != nil {
+		return s.BacklogFn(ctx, shard)
+	}
+	return 0, nil
+}
+
 // AccrualProviderStub fetches accrual information for tests.
 type AccrualProviderStub struct {
 	FetchFn func(context.Context, string) (*model.Accrual, error)
@@ -2,9 +2,12 @@ package test
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
 )
 
 // UserRepositoryStub stores users in-memory for tests.
@@ -70,21 +73,52 @@ func (s *UserRepositoryStub) GetByID(ctx context.Context, id int64) (*model.User
 	return nil, domainErrors.ErrNotFound
 }
 
+// Anonymize swaps the login of an open account for pseudonym.
+func (s *UserRepositoryStub) Anonymize(ctx context.Context, id int64, pseudonym string) (*model.User, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	user, ok := s.ByID[id]
+	if !ok || user.Deleted() {
+		return nil, domainErrors.ErrNotFound
+	}
+	deletedAt := time.Now()
+	delete(s.Users, user.Login)
+	user.Login, user.PasswordHash, user.DeletedAt = pseudonym, "", &deletedAt
+	s.Users[pseudonym] = user
+	return user, nil
+}
+
 // OrderRepositoryStub allows tests to customize behaviour.
 type OrderRepositoryStub struct {
 	CreateFn                   func(context.Context, int64, string) (*model.Order, bool, error)
+	CreateBatchFn              func(context.Context, int64, []string) ([]model.OrderUpload, error)
 	GetByNumberFn              func(context.Context, string) (*model.Order, error)
 	ListByUserFn               func(context.Context, int64) ([]model.Order, error)
-	SelectBatchForProcessingFn func(context.Context, int) ([]model.Order, error)
-	UpdateStatusFn             func(context.Context, int64, model.OrderStatus, *float64) error
+	FindByUserFn               func(context.Context, int64, model.OrderFilter, model.Page) ([]model.Order, error)
+	SelectBatchForProcessingFn func(context.Context, model.OrderClaim) ([]model.Order, error)
+	CountDueFn                 func(context.Context, model.Shard) (int64, error)
+	RescheduleFn               func(context.Context, int64, string, time.Duration, string) error
+	ReleaseFn                  func(context.Context, int64, string) error
+	RecordFailureFn            func(context.Context, int64, string, time.Duration, string) error
+	DeadLetterFn               func(context.Context, int64, string, string) error
+	FindDeadLetteredFn         func(context.Context, model.Page) ([]model.Order, error)
+	RequeueFn                  func(context.Context, string) (*model.Order, error)
+	UpdateStatusFn             func(context.Context, int64, model.OrderStatus, *model.Money) (model.StatusChange, error)
+	ArchiveFn                  func(context.Context, time.Time, int) (int64, error)
 
 	Created []struct {
 		UserID int64
 		Number string
 	}
-	Orders      []model.Order
-	Processing  []model.Order
-	UpdateCalls []OrderUpdateCall
+	Orders          []model.Order
+	Processing      []model.Order
+	UpdateCalls     []OrderUpdateCall
+	RescheduleCalls []OrderRescheduleCall
+	ReleaseCalls    []OrderRescheduleCall
+	FailureCalls    []OrderRescheduleCall
+	DeadLetterCalls []OrderRescheduleCall
+	DeadLettered    []model.Order
 }
 
 // Create tracks invocations and returns configured responses.
@@ -100,6 +134,18 @@ func (s *OrderRepositoryStub) Create(ctx context.Context, userID int64, number s
 	return order, true, nil
 }
 
+// CreateBatch delegates to CreateBatchFn or accepts every number.
+func (s *OrderRepositoryStub) CreateBatch(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+	if s.CreateBatchFn != nil {
+		return s.CreateBatchFn(ctx, userID, numbers)
+	}
+	uploads := make([]model.OrderUpload, 0, len(numbers))
+	for _, number := range numbers {
+		uploads = append(uploads, model.OrderUpload{Number: number, Result: model.OrderUploadAccepted})
+	}
+	return uploads, nil
+}
+
 // GetByNumber returns matched order either via override or stored slice.
 func (s *OrderRepositoryStub) GetByNumber(ctx context.Context, number string) (*model.Order, error) {
 	if s.GetByNumberFn != nil {
@@ -122,29 +168,123 @@ func (s *OrderRepositoryStub) ListByUser(ctx context.Context, userID int64) ([]m
 	return s.Orders, nil
 }
 
+// FindByUser returns at most page.Limit orders from configured slice.
+func (s *OrderRepositoryStub) FindByUser(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, error) {
+	if s.FindByUserFn != nil {
+		return s.FindByUserFn(ctx, userID, filter, page)
+	}
+	if page.Limit > 0 && len(s.Orders) > page.Limit {
+		return s.Orders[:page.Limit], nil
+	}
+	return s.Orders, nil
+}
+
 // SelectBatchForProcessing returns queued orders for processing.
-func (s *OrderRepositoryStub) SelectBatchForProcessing(ctx context.Context, limit int) ([]model.Order, error) {
+func (s *OrderRepositoryStub) SelectBatchForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
 	if s.SelectBatchForProcessingFn != nil {
-		return s.SelectBatchForProcessingFn(ctx, limit)
+		return s.SelectBatchForProcessingFn(ctx, claim)
 	}
 	return s.Processing, nil
 }
 
+// CountDue returns the number of Processing orders unless CountDueFn is set.
+func (s *OrderRepositoryStub) CountDue(ctx context.Context, shard model.Shard) (int64, error) {
+	if s.CountDueFn != nil {
+		return s.CountDueFn(ctx, shard)
+	}
+	return int64(len(s.Processing)), nil
+}
+
+// Reschedule records reschedule invocations.
+func (s *OrderRepositoryStub) Reschedule(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	if s.RescheduleFn != nil {
+		return s.RescheduleFn(ctx, orderID, owner, delay, lastErr)
+	}
+	s.RescheduleCalls = append(s.RescheduleCalls, OrderRescheduleCall{OrderID: orderID, Owner: owner, Delay: delay, LastError: lastErr})
+	return nil
+}
+
+// Release records release invocations.
+func (s *OrderRepositoryStub) Release(ctx context.Context, orderID int64, owner string) error {
+	if s.ReleaseFn != nil {
+		return s.ReleaseFn(ctx, orderID, owner)
+	}
+	s.ReleaseCalls = append(s.ReleaseCalls, OrderRescheduleCall{OrderID: orderID, Owner: owner})
+	return nil
+}
+
+// RecordFailure records failed attempt invocations.
+func (s *OrderRepositoryStub) RecordFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	if s.RecordFailureFn != nil {
+		return s.RecordFailureFn(ctx, orderID, owner, delay, lastErr)
+	}
+	s.FailureCalls = append(s.FailureCalls, OrderRescheduleCall{OrderID: orderID, Owner: owner, Delay: delay, LastError: lastErr})
+	return nil
+}
+
+// DeadLetter records dead-letter invocations.
+func (s *OrderRepositoryStub) DeadLetter(ctx context.Context, orderID int64, owner string, lastErr string) error {
+	if s.DeadLetterFn != nil {
+		return s.DeadLetterFn(ctx, orderID, owner, lastErr)
+	}
+	s.DeadLetterCalls = append(s.DeadLetterCalls, OrderRescheduleCall{OrderID: orderID, Owner: owner, LastError: lastErr})
+	return nil
+}
+
+// FindDeadLettered returns at most page.Limit orders from configured slice.
+func (s *OrderRepositoryStub) FindDeadLettered(ctx context.Context, page model.Page) ([]model.Order, error) {
+	if s.FindDeadLetteredFn != nil {
+		return s.FindDeadLetteredFn(ctx, page)
+	}
+	if page.Limit > 0 && len(s.DeadLettered) > page.Limit {
+		return s.DeadLettered[:page.Limit], nil
+	}
+	return s.DeadLettered, nil
+}
+
+// Requeue returns the matching parked order from configured slice.
+func (s *OrderRepositoryStub) Requeue(ctx context.Context, number string) (*model.Order, error) {
+	if s.RequeueFn != nil {
+		return s.RequeueFn(ctx, number)
+	}
+	for _, o := range s.DeadLettered {
+		if o.Number == number {
+			order := o
+			order.DeadLetteredAt = nil
+			return &order, nil
+		}
+	}
+	return nil, domainErrors.ErrNotFound
+}
+
 // UpdateStatus records update invocations.
-func (s *OrderRepositoryStub) UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *float64) error {
+func (s *OrderRepositoryStub) UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusChange, error) {
 	if s.UpdateStatusFn != nil {
 		return s.UpdateStatusFn(ctx, orderID, status, accrual)
 	}
 	s.UpdateCalls = append(s.UpdateCalls, OrderUpdateCall{OrderID: orderID, Status: status, Accrual: accrual})
-	return nil
+	return model.StatusChange{Update: model.StatusUpdateApplied}, nil
+}
+
+// Archive delegates to ArchiveFn and archives nothing by default.
+func (s *OrderRepositoryStub) Archive(ctx context.Context, before time.Time, limit int) (int64, error) {
+	if s.ArchiveFn != nil {
+		return s.ArchiveFn(ctx, before, limit)
+	}
+	return 0, nil
 }
 
 // BalanceRepositoryStub lets tests control balance data.
 type BalanceRepositoryStub struct {
 	GetSummaryFn func(context.Context, int64) (*model.BalanceSummary, error)
-	AddAccrualFn func(context.Context, int64, float64) error
-	WithdrawFn   func(context.Context, int64, string, float64) error
+	AddAccrualFn func(context.Context, int64, int64, model.Money) error
+	WithdrawFn   func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error)
+	HistoryFn    func(context.Context, int64) ([]model.LedgerEntry, error)
+	RepairFn     func(context.Context, int64, string) (*model.BalanceAdjustment, error)
 	Summary      *model.BalanceSummary
+	Entries      []model.LedgerEntry
+	Drifts       []model.BalanceDrift
+	DriftsErr    error
 	WithdrawErr  error
 }
 
@@ -160,25 +300,58 @@ func (s *BalanceRepositoryStub) GetSummary(ctx context.Context, userID int64) (*
 }
 
 // AddAccrual applies override when provided.
-func (s *BalanceRepositoryStub) AddAccrual(ctx context.Context, userID int64, sum float64) error {
+func (s *BalanceRepositoryStub) AddAccrual(ctx context.Context, userID, orderID int64, sum model.Money) error {
 	if s.AddAccrualFn != nil {
-		return s.AddAccrualFn(ctx, userID, sum)
+		return s.AddAccrualFn(ctx, userID, orderID, sum)
 	}
 	return nil
 }
 
 // Withdraw returns configured error or executes override.
-func (s *BalanceRepositoryStub) Withdraw(ctx context.Context, userID int64, order string, sum float64) error {
+func (s *BalanceRepositoryStub) Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
 	if s.WithdrawFn != nil {
-		return s.WithdrawFn(ctx, userID, order, sum)
+		return s.WithdrawFn(ctx, req)
+	}
+	if s.WithdrawErr != nil {
+		return nil, false, s.WithdrawErr
+	}
+	return &model.Withdrawal{UserID: req.UserID, OrderNumber: req.OrderNumber, Sum: req.Sum, IdempotencyKey: req.IdempotencyKey}, true, nil
+}
+
+// History returns configured ledger entries.
+func (s *BalanceRepositoryStub) History(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	if s.HistoryFn != nil {
+		return s.HistoryFn(ctx, userID)
+	}
+	return s.Entries, nil
+}
+
+// FindDrifts returns configured drifts or error.
+func (s *BalanceRepositoryStub) FindDrifts(context.Context) ([]model.BalanceDrift, error) {
+	return s.Drifts, s.DriftsErr
+}
+
+// Repair applies override or reports the configured drift as repaired.
+func (s *BalanceRepositoryStub) Repair(ctx context.Context, userID int64, reason string) (*model.BalanceAdjustment, error) {
+	if s.RepairFn != nil {
+		return s.RepairFn(ctx, userID, reason)
+	}
+	for _, d := range s.Drifts {
+		if d.UserID == userID {
+			return &model.BalanceAdjustment{UserID: userID, Before: d.Actual, After: d.Expected, Reason: reason}, nil
+		}
 	}
-	return s.WithdrawErr
+	return nil, nil
 }
 
 // WithdrawalRepositoryStub stores withdrawals history for tests.
 type WithdrawalRepositoryStub struct {
-	ListFn func(context.Context, int64) ([]model.Withdrawal, error)
-	Items  []model.Withdrawal
+	ListFn     func(context.Context, int64) ([]model.Withdrawal, error)
+	ListPageFn func(context.Context, int64, model.Page) ([]model.Withdrawal, error)
+	Items      []model.Withdrawal
+
+	PseudonymizeErr error
+	Pseudonymized   []int64
 }
 
 // ListByUser returns configured withdrawals.
@@ -188,3 +361,176 @@ func (s *WithdrawalRepositoryStub) ListByUser(ctx context.Context, userID int64)
 	}
 	return s.Items, nil
 }
+
+// ListPageByUser returns at most page.Limit configured withdrawals.
+func (s *WithdrawalRepositoryStub) ListPageByUser(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, error) {
+	if s.ListPageFn != nil {
+		return s.ListPageFn(ctx, userID, page)
+	}
+	if len(s.Items) > page.Limit {
+		return s.Items[:page.Limit], nil
+	}
+	return s.Items, nil
+}
+
+// Pseudonymize records the user unless PseudonymizeErr is configured.
+func (s *WithdrawalRepositoryStub) Pseudonymize(ctx context.Context, userID int64) error {
+	if s.PseudonymizeErr != nil {
+		return s.PseudonymizeErr
+	}
+	s.Pseudonymized = append(s.Pseudonymized, userID)
+	return nil
+}
+
+// TxManagerStub runs units of work inline and records requested options.
+type TxManagerStub struct {
+	Err   error
+	Calls []repository.TxOptions
+}
+
+// WithinTx records opts and invokes fn unless Err is configured.
+func (s *TxManagerStub) WithinTx(ctx context.Context, opts repository.TxOptions, fn func(ctx context.Context) error) error {
+	s.Calls = append(s.Calls, opts)
+	if s.Err != nil {
+		return s.Err
+	}
+	return fn(ctx)
+}
+
+// AuditRepositoryStub keeps appended audit events in a chained slice.
+type AuditRepositoryStub struct {
+	mu        sync.Mutex
+	Events    []model.AuditEvent
+	AppendErr error
+	FindErr   error
+}
+
+// Append links event to the last recorded one unless AppendErr is configured.
+func (s *AuditRepositoryStub) Append(_ context.Context, event model.AuditEvent) (*model.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.AppendErr != nil {
+		return nil, s.AppendErr
+	}
+	prev := model.AuditGenesisHash
+	if n := len(s.Events); n > 0 {
+		prev = s.Events[n-1].Hash
+	}
+	event.ID = int64(len(s.Events)) + 1
+	event.CreatedAt = time.Unix(event.ID, 0).UTC()
+	event.Link(prev)
+	s.Events = append(s.Events, event)
+	return &event, nil
+}
+
+// Find returns recorded events matching filter, newest first.
+func (s *AuditRepositoryStub) Find(_ context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.FindErr != nil {
+		return nil, s.FindErr
+	}
+	var result []model.AuditEvent
+	for i := len(s.Events) - 1; i >= 0 && (page.Limit <= 0 || len(result) < page.Limit); i-- {
+		if filter.Matches(s.Events[i]) {
+			result = append(result, s.Events[i])
+		}
+	}
+	return result, nil
+}
+
+// Chain returns up to limit recorded events following afterID.
+func (s *AuditRepositoryStub) Chain(_ context.Context, afterID int64, limit int) ([]model.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.FindErr != nil {
+		return nil, s.FindErr
+	}
+	var result []model.AuditEvent
+	for _, e := range s.Events {
+		if e.ID > afterID && len(result) < limit {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// Actions lists the actions of recorded events in order.
+func (s *AuditRepositoryStub) Actions() []model.AuditAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	actions := make([]model.AuditAction, 0, len(s.Events))
+	for _, e := range s.Events {
+		actions = append(actions, e.Action)
+	}
+	return actions
+}
+
+// LeaderLockStub reports Held, or Err when configured, and counts releases.
+type LeaderLockStub struct {
+	mu       sync.Mutex
+	Held     bool
+	Err      error
+	Releases int
+}
+
+// TryAcquire reports the configured outcome.
+func (s *LeaderLockStub) TryAcquire(context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return false, s.Err
+	}
+	return s.Held, nil
+}
+
+// Release records the call.
+func (s *LeaderLockStub) Release(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Releases++
+	return nil
+}
+
+// InstanceRegistryStub reports Live as the live instances and records
+// heartbeats and deregistrations; HeartbeatErr fails heartbeats.
+type InstanceRegistryStub struct {
+	mu           sync.Mutex
+	Live         []string
+	HeartbeatErr error
+	Heartbeats   []string
+	Deregistered []string
+}
+
+// Heartbeat records instanceID unless HeartbeatErr is configured.
+func (s *InstanceRegistryStub) Heartbeat(_ context.Context, instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.HeartbeatErr != nil {
+		return s.HeartbeatErr
+	}
+	s.Heartbeats = append(s.Heartbeats, instanceID)
+	return nil
+}
+
+// LiveInstances returns a copy of Live.
+func (s *InstanceRegistryStub) LiveInstances(context.Context, time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.Live...), nil
+}
+
+// Deregister records instanceID.
+func (s *InstanceRegistryStub) Deregister(_ context.Context, instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Deregistered = append(s.Deregistered, instanceID)
+	return nil
+}
+
+// SetLive replaces the live instances.
+func (s *InstanceRegistryStub) SetLive(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Live = ids
+}
@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+// deletedLoginPrefix marks the pseudonymous login of a closed account.
+const deletedLoginPrefix = "deleted-"
+
+// AccountUseCase answers data subject requests: it exports everything kept
+// about a user and closes accounts.
+type AccountUseCase struct {
+	users       repository.UserRepository
+	orders      repository.OrderRepository
+	balances    repository.BalanceRepository
+	withdrawals repository.WithdrawalRepository
+	tx          repository.TxManager
+	audit       *AuditUseCase
+}
+
+// NewAccountUseCase constructs AccountUseCase.
+func NewAccountUseCase(users repository.UserRepository, orders repository.OrderRepository, balances repository.BalanceRepository, withdrawals repository.WithdrawalRepository, tx repository.TxManager, audit *AuditUseCase) *AccountUseCase {
+	return &AccountUseCase{users: users, orders: orders, balances: balances, withdrawals: withdrawals, tx: tx, audit: audit}
+}
+
+// Export collects the user's profile, balance, orders including archived
+// ones and withdrawals from one consistent snapshot. The password hash is
+// never exported.
+func (u *AccountUseCase) Export(ctx context.Context, userID int64) (*model.AccountExport, error) {
+	export := &model.AccountExport{}
+	opts := repository.TxOptions{Isolation: repository.IsolationRepeatableRead, ReadOnly: true}
+	err := u.tx.WithinTx(ctx, opts, func(ctx context.Context) error {
+		user, err := u.users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user.Deleted() {
+			return domainErrors.ErrNotFound
+		}
+		balance, err := u.balances.GetSummary(ctx, userID)
+		if err != nil {
+			return err
+		}
+		orders, err := u.orders.FindByUser(ctx, userID, model.OrderFilter{IncludeArchived: true}, model.Page{})
+		if err != nil {
+			return err
+		}
+		withdrawals, err := u.withdrawals.ListByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		profile := *user
+		profile.PasswordHash = ""
+		export.User, export.Balance, export.Orders, export.Withdrawals = profile, *balance, orders, withdrawals
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	export.ExportedAt = time.Now().UTC()
+	u.audit.Notice(ctx, AuditEntry{Action: model.AuditAccountExported, UserID: userID})
+	return export, nil
+}
+
+// Delete closes the account. The login is replaced by a random pseudonym,
+// which also revokes every issued token, while orders, withdrawals and the
+// ledger stay under the now pseudonymous user ID for accounting.
+func (u *AccountUseCase) Delete(ctx context.Context, userID int64) error {
+	return u.audit.Track(ctx, func(ctx context.Context) (*AuditEntry, error) {
+		if _, err := u.users.Anonymize(ctx, userID, newDeletedLogin()); err != nil {
+			return nil, err
+		}
+		if err := u.withdrawals.Pseudonymize(ctx, userID); err != nil {
+			return nil, err
+		}
+		return &AuditEntry{Action: model.AuditAccountDeleted, UserID: userID}, nil
+	})
+}
+
+func newDeletedLogin() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	return deletedLoginPrefix + hex.EncodeToString(buf[:])
+}
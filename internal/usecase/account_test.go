@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+	testhelpers "github.com/polkiloo/gophermart/internal/test"
+)
+
+type accountFixture struct {
+	uc          *AccountUseCase
+	users       *testhelpers.UserRepositoryStub
+	orders      *testhelpers.OrderRepositoryStub
+	balances    *testhelpers.BalanceRepositoryStub
+	withdrawals *testhelpers.WithdrawalRepositoryStub
+	tx          *testhelpers.TxManagerStub
+	events      *testhelpers.AuditRepositoryStub
+}
+
+func newAccountFixture(t *testing.T) accountFixture {
+	t.Helper()
+	f := accountFixture{
+		users:       testhelpers.NewUserRepositoryStub(),
+		orders:      &testhelpers.OrderRepositoryStub{Orders: []model.Order{{Number: "79927398713", Status: model.OrderStatusProcessed}}},
+		balances:    &testhelpers.BalanceRepositoryStub{Summary: &model.BalanceSummary{Current: 5, Withdrawn: 3}},
+		withdrawals: &testhelpers.WithdrawalRepositoryStub{Items: []model.Withdrawal{{OrderNumber: "2377225624", Sum: 3, IdempotencyKey: "key"}}},
+		tx:          &testhelpers.TxManagerStub{},
+	}
+	if _, err := f.users.Create(context.Background(), "dave", "hash"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	var audit *AuditUseCase
+	audit, f.events = newRecordingAudit()
+	f.uc = NewAccountUseCase(f.users, f.orders, f.balances, f.withdrawals, f.tx, audit)
+	return f
+}
+
+func TestAccountUseCaseExport(t *testing.T) {
+	f := newAccountFixture(t)
+	var filter model.OrderFilter
+	f.orders.FindByUserFn = func(_ context.Context, _ int64, got model.OrderFilter, page model.Page) ([]model.Order, error) {
+		filter = got
+		if page.Limit != 0 {
+			t.Fatalf("expected unpaged listing, got %+v", page)
+		}
+		return f.orders.Orders, nil
+	}
+
+	export, err := f.uc.Export(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if export.User.Login != "dave" || export.User.PasswordHash != "" || export.Balance.Current != 5 || len(export.Orders) != 1 || len(export.Withdrawals) != 1 || export.ExportedAt.IsZero() {
+		t.Fatalf("unexpected export %+v", export)
+	}
+	if !filter.IncludeArchived {
+		t.Fatal("expected archived orders to be exported")
+	}
+	if stored, _ := f.users.GetByID(context.Background(), 1); stored.PasswordHash != "hash" {
+		t.Fatal("export must not alter the stored user")
+	}
+	want := repository.TxOptions{Isolation: repository.IsolationRepeatableRead, ReadOnly: true}
+	if len(f.tx.Calls) != 1 || f.tx.Calls[0] != want {
+		t.Fatalf("expected one consistent read-only snapshot, got %+v", f.tx.Calls)
+	}
+	if got := f.events.Actions(); !slices.Equal(got, []model.AuditAction{model.AuditAccountExported}) {
+		t.Fatalf("expected export audited, got %v", got)
+	}
+}
+
+func TestAccountUseCaseExportFailures(t *testing.T) {
+	f := newAccountFixture(t)
+	if _, err := f.uc.Export(context.Background(), 2); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	boom := errors.New("boom")
+	f.withdrawals.ListFn = func(context.Context, int64) ([]model.Withdrawal, error) { return nil, boom }
+	if _, err := f.uc.Export(context.Background(), 1); !errors.Is(err, boom) {
+		t.Fatalf("expected withdrawals error, got %v", err)
+	}
+	if len(f.events.Events) != 0 {
+		t.Fatalf("expected failed exports unaudited, got %v", f.events.Actions())
+	}
+}
+
+func TestAccountUseCaseDelete(t *testing.T) {
+	f := newAccountFixture(t)
+	if err := f.uc.Delete(context.Background(), 1); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	user, _ := f.users.GetByID(context.Background(), 1)
+	if !user.Deleted() || !strings.HasPrefix(user.Login, deletedLoginPrefix) || user.PasswordHash != "" {
+		t.Fatalf("expected anonymized user, got %+v", user)
+	}
+	if !slices.Equal(f.withdrawals.Pseudonymized, []int64{1}) {
+		t.Fatalf("expected withdrawals pseudonymized, got %v", f.withdrawals.Pseudonymized)
+	}
+	if deleted := f.events.Events; len(deleted) != 1 || deleted[0].Action != model.AuditAccountDeleted || deleted[0].UserID != 1 {
+		t.Fatalf("expected deletion audited, got %+v", deleted)
+	}
+
+	if err := f.uc.Delete(context.Background(), 1); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected closed account to be gone, got %v", err)
+	}
+	if _, err := f.uc.Export(context.Background(), 1); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected closed account export to fail, got %v", err)
+	}
+}
+
+func TestAccountUseCaseDeleteFailure(t *testing.T) {
+	f := newAccountFixture(t)
+	f.withdrawals.PseudonymizeErr = errors.New("boom")
+	if err := f.uc.Delete(context.Background(), 1); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(f.events.Events) != 0 {
+		t.Fatalf("expected failed deletion unaudited, got %v", f.events.Actions())
+	}
+}
@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/domain/repository"
+)
+
+// auditVerifyBatch is how many events Verify reads per round trip.
+const auditVerifyBatch = 500
+
+// AuditEntry describes an audit event before it is chained. Actor defaults
+// to the user behind the request, or to the system outside requests.
+type AuditEntry struct {
+	Action  model.AuditAction
+	UserID  int64
+	Actor   string
+	Payload any
+}
+
+// AuditUseCase writes and queries the tamper-evident audit log.
+type AuditUseCase struct {
+	events repository.AuditRepository
+	tx     repository.TxManager
+	logger *slog.Logger
+}
+
+// NewAuditUseCase constructs AuditUseCase.
+func NewAuditUseCase(events repository.AuditRepository, tx repository.TxManager, logger *slog.Logger) *AuditUseCase {
+	return &AuditUseCase{events: events, tx: tx, logger: logger}
+}
+
+// Record appends entry to the audit log. Inside a transaction the event
+// commits or rolls back with it.
+func (u *AuditUseCase) Record(ctx context.Context, entry AuditEntry) error {
+	payload := entry.Payload
+	if payload == nil {
+		payload = struct{}{}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s audit payload: %w", entry.Action, err)
+	}
+
+	event := model.AuditEvent{Action: entry.Action, Actor: entry.Actor, UserID: entry.UserID, Payload: data}
+	meta, fromRequest := model.RequestMetaFrom(ctx)
+	event.IP, event.UserAgent, event.RequestID = meta.IP, meta.UserAgent, meta.RequestID
+	if event.Actor == "" {
+		switch {
+		case meta.Actor != "":
+			event.Actor = meta.Actor
+		case !fromRequest:
+			event.Actor = model.AuditActorSystem
+		case entry.UserID != 0:
+			event.Actor = model.AuditUserActor(entry.UserID)
+		default:
+			event.Actor = model.AuditActorAnonymous
+		}
+	}
+
+	_, err = u.events.Append(ctx, event)
+	return err
+}
+
+// Notice records entry and only logs a failure, so an audit outage does not
+// lock users out of the service.
+func (u *AuditUseCase) Notice(ctx context.Context, entry AuditEntry) {
+	if err := u.Record(ctx, entry); err != nil {
+		u.logger.Error("audit record failed", slog.String("action", string(entry.Action)), slog.Any("error", err))
+	}
+}
+
+// Track runs fn in a transaction and records the entry it returns, if any,
+// in the same transaction, so a money movement never commits unaudited.
+func (u *AuditUseCase) Track(ctx context.Context, fn func(ctx context.Context) (*AuditEntry, error)) error {
+	return u.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		entry, err := fn(ctx)
+		if err != nil || entry == nil {
+			return err
+		}
+		return u.Record(ctx, *entry)
+	})
+}
+
+// Find returns audit events matching filter, newest first. With a page limit
+// it also returns the cursor of the next page when more events remain.
+func (u *AuditUseCase) Find(ctx context.Context, filter model.AuditFilter, page model.Page) ([]model.AuditEvent, *model.Cursor, error) {
+	events, err := u.events.Find(ctx, filter, model.Page{Limit: page.Limit + 1, After: page.After})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(events) <= page.Limit {
+		return events, nil, nil
+	}
+	events = events[:page.Limit]
+	last := events[len(events)-1]
+	return events, &model.Cursor{Time: last.CreatedAt, ID: last.ID}, nil
+}
+
+// Verify walks the whole chain and reports the first event that was altered,
+// removed or inserted out of order.
+func (u *AuditUseCase) Verify(ctx context.Context) (*model.AuditVerification, error) {
+	result := &model.AuditVerification{Valid: true}
+	prev, afterID := model.AuditGenesisHash, int64(0)
+	for {
+		events, err := u.events.Chain(ctx, afterID, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if !model.VerifyAuditLink(prev, e) {
+				result.Valid, result.BrokenAt = false, e.ID
+				return result, nil
+			}
+			result.Checked++
+			prev, afterID = e.Hash, e.ID
+		}
+		if len(events) < auditVerifyBatch {
+			return result, nil
+		}
+	}
+}
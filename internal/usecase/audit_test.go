@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	testhelpers "github.com/polkiloo/gophermart/internal/test"
+)
+
+func newTestAudit() *AuditUseCase {
+	uc, _ := newRecordingAudit()
+	return uc
+}
+
+func newRecordingAudit() (*AuditUseCase, *testhelpers.AuditRepositoryStub) {
+	events := &testhelpers.AuditRepositoryStub{}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	return NewAuditUseCase(events, &testhelpers.TxManagerStub{}, logger), events
+}
+
+func TestAuditUseCaseRecordResolvesActor(t *testing.T) {
+	uc, events := newRecordingAudit()
+	request := model.WithRequestMeta(context.Background(), model.RequestMeta{IP: "10.0.0.1", UserAgent: "curl", RequestID: "req-1"})
+
+	entries := []struct {
+		ctx   context.Context
+		entry AuditEntry
+		actor string
+	}{
+		{ctx: context.Background(), entry: AuditEntry{Action: model.AuditAccrualCredited, UserID: 3}, actor: model.AuditActorSystem},
+		{ctx: request, entry: AuditEntry{Action: model.AuditOrderUploaded, UserID: 3}, actor: "user:3"},
+		{ctx: request, entry: AuditEntry{Action: model.AuditTokenRejected}, actor: model.AuditActorAnonymous},
+		{ctx: request, entry: AuditEntry{Action: model.AuditLoginFailed, UserID: 3, Actor: model.AuditActorAnonymous}, actor: model.AuditActorAnonymous},
+		{ctx: model.WithRequestMeta(context.Background(), model.RequestMeta{Actor: "operator:ann"}), entry: AuditEntry{Action: model.AuditBalanceAdjusted, UserID: 3}, actor: "operator:ann"},
+	}
+	for _, tt := range entries {
+		if err := uc.Record(tt.ctx, tt.entry); err != nil {
+			t.Fatalf("record %s: %v", tt.entry.Action, err)
+		}
+	}
+
+	for i, tt := range entries {
+		if got := events.Events[i].Actor; got != tt.actor {
+			t.Fatalf("event %d: expected actor %q, got %q", i, tt.actor, got)
+		}
+	}
+	second := events.Events[1]
+	if second.IP != "10.0.0.1" || second.UserAgent != "curl" || second.RequestID != "req-1" || string(second.Payload) != "{}" {
+		t.Fatalf("expected request metadata and empty payload, got %+v", second)
+	}
+}
+
+func TestAuditUseCaseRecordRejectsUnencodablePayload(t *testing.T) {
+	uc, events := newRecordingAudit()
+	if err := uc.Record(context.Background(), AuditEntry{Action: model.AuditOrderUploaded, Payload: func() {}}); err == nil {
+		t.Fatal("expected payload encoding error")
+	}
+	if len(events.Events) != 0 {
+		t.Fatalf("expected nothing recorded, got %d events", len(events.Events))
+	}
+}
+
+func TestAuditUseCaseNoticeSwallowsFailures(t *testing.T) {
+	uc, events := newRecordingAudit()
+	events.AppendErr = errors.New("down")
+	uc.Notice(context.Background(), AuditEntry{Action: model.AuditLoginSucceeded, UserID: 1})
+}
+
+func TestAuditUseCaseTrack(t *testing.T) {
+	uc, events := newRecordingAudit()
+
+	if err := uc.Track(context.Background(), func(context.Context) (*AuditEntry, error) {
+		return &AuditEntry{Action: model.AuditPointsWithdrawn, UserID: 1}, nil
+	}); err != nil {
+		t.Fatalf("track: %v", err)
+	}
+	if err := uc.Track(context.Background(), func(context.Context) (*AuditEntry, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("track without entry: %v", err)
+	}
+	boom := errors.New("boom")
+	if err := uc.Track(context.Background(), func(context.Context) (*AuditEntry, error) {
+		return &AuditEntry{Action: model.AuditPointsWithdrawn}, boom
+	}); !errors.Is(err, boom) {
+		t.Fatalf("expected fn error, got %v", err)
+	}
+	if len(events.Events) != 1 {
+		t.Fatalf("expected a single recorded event, got %d", len(events.Events))
+	}
+
+	events.AppendErr = errors.New("down")
+	if err := uc.Track(context.Background(), func(context.Context) (*AuditEntry, error) {
+		return &AuditEntry{Action: model.AuditPointsWithdrawn}, nil
+	}); err == nil {
+		t.Fatal("expected audit failure to fail the unit of work")
+	}
+}
+
+func TestAuditUseCaseFindPages(t *testing.T) {
+	uc, _ := newRecordingAudit()
+	for i := 0; i < 3; i++ {
+		if err := uc.Record(context.Background(), AuditEntry{Action: model.AuditOrderUploaded, UserID: 1}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	events, next, err := uc.Find(context.Background(), model.AuditFilter{UserID: 1}, model.Page{Limit: 2})
+	if err != nil || len(events) != 2 || next == nil || next.ID != 2 {
+		t.Fatalf("expected two newest events and a cursor, got %+v next=%+v err=%v", events, next, err)
+	}
+	if events, next, err = uc.Find(context.Background(), model.AuditFilter{UserID: 2}, model.Page{Limit: 2}); err != nil || len(events) != 0 || next != nil {
+		t.Fatalf("expected no events for another user, got %+v next=%+v err=%v", events, next, err)
+	}
+}
+
+func TestAuditUseCaseVerify(t *testing.T) {
+	uc, events := newRecordingAudit()
+	for _, action := range []model.AuditAction{model.AuditUserRegistered, model.AuditLoginSucceeded, model.AuditOrderUploaded} {
+		if err := uc.Record(context.Background(), AuditEntry{Action: action, UserID: 1}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	result, err := uc.Verify(context.Background())
+	if err != nil || !result.Valid || result.Checked != 3 {
+		t.Fatalf("expected intact chain of three, got %+v err=%v", result, err)
+	}
+
+	events.Events[1].Payload = []byte(`{"login":"mallory"}`)
+	result, err = uc.Verify(context.Background())
+	if err != nil || result.Valid || result.BrokenAt != 2 || result.Checked != 1 {
+		t.Fatalf("expected chain broken at event 2, got %+v err=%v", result, err)
+	}
+
+	events.Events = append(events.Events[:1], events.Events[2:]...)
+	if result, err = uc.Verify(context.Background()); err != nil || result.Valid || result.BrokenAt != 3 {
+		t.Fatalf("expected removed event to break the chain at 3, got %+v err=%v", result, err)
+	}
+
+	events.FindErr = errors.New("down")
+	if _, err := uc.Verify(context.Background()); err == nil {
+		t.Fatal("expected repository error")
+	}
+}
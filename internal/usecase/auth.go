@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
+	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
@@ -11,16 +13,32 @@ import (
 	pkgAuth "github.com/polkiloo/gophermart/internal/pkg/auth"
 )
 
+// Bad tokens cost an attacker nothing, so at most tokenRejectedBudget of them
+// are audited per tokenRejectedWindow; the rest are counted and reported with
+// the next one recorded.
+const (
+	tokenRejectedBudget = 20
+	tokenRejectedWindow = time.Minute
+)
+
 // AuthUseCase handles user lifecycle and token management.
 type AuthUseCase struct {
-	users  repository.UserRepository
-	hasher pkgAuth.PasswordHasher
-	tokens pkgAuth.Strategy
+	users      repository.UserRepository
+	hasher     pkgAuth.PasswordHasher
+	tokens     pkgAuth.Strategy
+	audit      *AuditUseCase
+	rejections *rejectionSampler
 }
 
 // NewAuthUseCase constructs AuthUseCase.
-func NewAuthUseCase(users repository.UserRepository, hasher pkgAuth.PasswordHasher, strategy pkgAuth.Strategy) *AuthUseCase {
-	return &AuthUseCase{users: users, hasher: hasher, tokens: strategy}
+func NewAuthUseCase(users repository.UserRepository, hasher pkgAuth.PasswordHasher, strategy pkgAuth.Strategy, audit *AuditUseCase) *AuthUseCase {
+	return &AuthUseCase{
+		users:      users,
+		hasher:     hasher,
+		tokens:     strategy,
+		audit:      audit,
+		rejections: &rejectionSampler{budget: tokenRejectedBudget, window: tokenRejectedWindow, now: time.Now},
+	}
 }
 
 // Register creates a new user with login/password and returns auth token.
@@ -48,9 +66,18 @@ func (u *AuthUseCase) Register(ctx context.Context, login, password string) (*mo
 		return nil, "", err
 	}
 
+	u.audit.Notice(ctx, AuditEntry{Action: model.AuditUserRegistered, UserID: usr.ID})
 	return usr, token, nil
 }
 
+// loginPayload names the login only when no account matches it: the audit
+// log cannot be rewritten, so logins of existing accounts are referenced by
+// user ID and disappear from it once the account is anonymized.
+type loginPayload struct {
+	Login  string `json:"login,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
 // Authenticate validates credentials and returns auth token.
 func (u *AuthUseCase) Authenticate(ctx context.Context, login, password string) (*model.User, string, error) {
 	login = strings.TrimSpace(login)
@@ -61,12 +88,16 @@ func (u *AuthUseCase) Authenticate(ctx context.Context, login, password string)
 	usr, err := u.users.GetByLogin(ctx, login)
 	if err != nil {
 		if errors.Is(err, domainErrors.ErrNotFound) {
+			u.audit.Notice(ctx, AuditEntry{Action: model.AuditLoginFailed, Actor: model.AuditActorAnonymous,
+				Payload: loginPayload{Login: login, Reason: "unknown login"}})
 			return nil, "", domainErrors.ErrInvalidCredentials
 		}
 		return nil, "", err
 	}
 
 	if err := u.hasher.Compare(usr.PasswordHash, password); err != nil {
+		u.audit.Notice(ctx, AuditEntry{Action: model.AuditLoginFailed, UserID: usr.ID, Actor: model.AuditActorAnonymous,
+			Payload: loginPayload{Reason: "wrong password"}})
 		return nil, "", domainErrors.ErrInvalidCredentials
 	}
 
@@ -75,6 +106,7 @@ func (u *AuthUseCase) Authenticate(ctx context.Context, login, password string)
 		return nil, "", err
 	}
 
+	u.audit.Notice(ctx, AuditEntry{Action: model.AuditLoginSucceeded, UserID: usr.ID})
 	return usr, token, nil
 }
 
@@ -86,6 +118,65 @@ func (u *AuthUseCase) ParseToken(token string) (int64, error) {
 	return u.tokens.ParseToken(token)
 }
 
+type tokenRejectedPayload struct {
+	Reason     string `json:"reason"`
+	Suppressed int    `json:"suppressed,omitempty"`
+}
+
+// TokenRejected records a request turned away for presenting a bad token.
+// Floods are sampled: rejections over budget are only counted.
+func (u *AuthUseCase) TokenRejected(ctx context.Context, reason string) {
+	suppressed, ok := u.rejections.admit()
+	if !ok {
+		return
+	}
+	u.audit.Notice(ctx, AuditEntry{Action: model.AuditTokenRejected, Payload: tokenRejectedPayload{Reason: reason, Suppressed: suppressed}})
+}
+
+// rejectionSampler admits up to budget events per fixed window.
+type rejectionSampler struct {
+	budget int
+	window time.Duration
+	now    func() time.Time
+
+	mu         sync.Mutex
+	start      time.Time
+	admitted   int
+	suppressed int
+}
+
+// admit reports whether an event may be recorded and, if so, how many were
+// dropped since the last one admitted.
+func (s *rejectionSampler) admit() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := s.now(); now.Sub(s.start) >= s.window {
+		s.start, s.admitted = now, 0
+	}
+	if s.admitted >= s.budget {
+		s.suppressed++
+		return 0, false
+	}
+	s.admitted++
+	suppressed := s.suppressed
+	s.suppressed = 0
+	return suppressed, true
+}
+
+// Active reports whether userID still has an open account, so tokens issued
+// before the account was closed stop working ahead of their expiry.
+func (u *AuthUseCase) Active(ctx context.Context, userID int64) (bool, error) {
+	usr, err := u.users.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domainErrors.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !usr.Deleted(), nil
+}
+
 // GetByID fetches user by identifier.
 func (u *AuthUseCase) GetByID(ctx context.Context, id int64) (*model.User, error) {
 	return u.users.GetByID(ctx, id)
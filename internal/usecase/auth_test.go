@@ -3,9 +3,12 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
+	"github.com/polkiloo/gophermart/internal/domain/model"
 	pkgAuth "github.com/polkiloo/gophermart/internal/pkg/auth"
 	testhelpers "github.com/polkiloo/gophermart/internal/test"
 )
@@ -26,7 +29,7 @@ func newStrategyStub() testhelpers.StrategyStub {
 }
 func TestAuthUseCaseRegisterSuccess(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 
 	ctx := context.Background()
 	user, token, err := uc.Register(ctx, "alice", "password")
@@ -50,7 +53,7 @@ func TestAuthUseCaseRegisterSuccess(t *testing.T) {
 
 func TestAuthUseCaseRegisterDuplicate(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 
 	ctx := context.Background()
 	if _, _, err := uc.Register(ctx, "bob", "secret"); err != nil {
@@ -63,7 +66,7 @@ func TestAuthUseCaseRegisterDuplicate(t *testing.T) {
 
 func TestAuthUseCaseAuthenticate(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 
 	ctx := context.Background()
 	if _, _, err := uc.Register(ctx, "carol", "123456"); err != nil {
@@ -84,7 +87,7 @@ func TestAuthUseCaseAuthenticate(t *testing.T) {
 }
 
 func TestAuthUseCaseParseToken(t *testing.T) {
-	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 
 	id, err := uc.ParseToken("token-42")
 	if err != nil {
@@ -104,7 +107,7 @@ func TestAuthUseCaseParseToken(t *testing.T) {
 }
 
 func TestAuthUseCaseRegisterValidation(t *testing.T) {
-	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "", "password"); err != domainErrors.ErrInvalidCredentials {
 		t.Fatalf("expected invalid credentials error, got %v", err)
 	}
@@ -117,7 +120,7 @@ func TestAuthUseCaseRegisterHasherError(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
 	uc := NewAuthUseCase(repo, testhelpers.HasherStub{HashFn: func(string) (string, error) {
 		return "", fmt.Errorf("hash error")
-	}}, newStrategyStub())
+	}}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "user", "pass"); err == nil {
 		t.Fatal("expected hashing error")
 	}
@@ -126,7 +129,7 @@ func TestAuthUseCaseRegisterHasherError(t *testing.T) {
 func TestAuthUseCaseRegisterRepositoryError(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
 	repo.Err = fmt.Errorf("db down")
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "user", "pass"); err == nil {
 		t.Fatal("expected repository error")
 	}
@@ -137,7 +140,7 @@ func TestAuthUseCaseRegisterIssueTokenError(t *testing.T) {
 	strategy := testhelpers.StrategyStub{IssueFn: func(int64) (string, error) {
 		return "", fmt.Errorf("cannot issue token")
 	}}
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, strategy)
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, strategy, newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "user", "pass"); err == nil {
 		t.Fatal("expected token issuing error")
 	}
@@ -145,7 +148,7 @@ func TestAuthUseCaseRegisterIssueTokenError(t *testing.T) {
 
 func TestAuthUseCaseAuthenticateNotFound(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Authenticate(context.Background(), "absent", "pass"); err != domainErrors.ErrInvalidCredentials {
 		t.Fatalf("expected invalid credentials error, got %v", err)
 	}
@@ -155,7 +158,7 @@ func TestAuthUseCaseAuthenticateHasherMismatch(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
 	uc := NewAuthUseCase(repo, testhelpers.HasherStub{CompareFn: func(hash, password string) error {
 		return fmt.Errorf("mismatch")
-	}}, newStrategyStub())
+	}}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "user", "pass"); err != nil {
 		t.Fatalf("register returned error: %v", err)
 	}
@@ -176,7 +179,7 @@ func TestAuthUseCaseAuthenticateIssueTokenError(t *testing.T) {
 			return "token", nil
 		},
 	}
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, strategy)
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, strategy, newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "user", "pass"); err != nil {
 		t.Fatalf("register returned error: %v", err)
 	}
@@ -187,7 +190,7 @@ func TestAuthUseCaseAuthenticateIssueTokenError(t *testing.T) {
 
 func TestAuthUseCaseAuthenticateRepositoryError(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "user", "pass"); err != nil {
 		t.Fatalf("register returned error: %v", err)
 	}
@@ -198,7 +201,7 @@ func TestAuthUseCaseAuthenticateRepositoryError(t *testing.T) {
 }
 
 func TestAuthUseCaseAuthenticateValidation(t *testing.T) {
-	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Authenticate(context.Background(), "", "pass"); err != domainErrors.ErrInvalidCredentials {
 		t.Fatalf("expected invalid credentials error, got %v", err)
 	}
@@ -210,7 +213,7 @@ func TestAuthUseCaseAuthenticateValidation(t *testing.T) {
 func TestAuthUseCaseParseTokenStrategyError(t *testing.T) {
 	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, testhelpers.StrategyStub{
 		ParseFn: func(string) (int64, error) { return 0, fmt.Errorf("parse error") },
-	})
+	}, newTestAudit())
 	if _, err := uc.ParseToken("token"); err == nil {
 		t.Fatal("expected parse error")
 	}
@@ -218,7 +221,7 @@ func TestAuthUseCaseParseTokenStrategyError(t *testing.T) {
 
 func TestAuthUseCaseGetByID(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	user, _, err := uc.Register(context.Background(), "dave", "pwd")
 	if err != nil {
 		t.Fatalf("register returned error: %v", err)
@@ -235,7 +238,7 @@ func TestAuthUseCaseGetByID(t *testing.T) {
 func TestAuthUseCaseGetByIDErrorPropagation(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
 	repo.Err = fmt.Errorf("read error")
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	if _, err := uc.GetByID(context.Background(), 1); err == nil {
 		t.Fatal("expected repository error")
 	}
@@ -243,7 +246,7 @@ func TestAuthUseCaseGetByIDErrorPropagation(t *testing.T) {
 
 func TestAuthUseCaseTrimsLogin(t *testing.T) {
 	repo := testhelpers.NewUserRepositoryStub()
-	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub())
+	uc := NewAuthUseCase(repo, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
 	if _, _, err := uc.Register(context.Background(), "  user  ", "pass"); err != nil {
 		t.Fatalf("register returned error: %v", err)
 	}
@@ -261,3 +264,85 @@ func TestUserRepositoryStubDuplicate(t *testing.T) {
 		t.Fatalf("expected duplicate error, got %v", err)
 	}
 }
+
+func TestAuthUseCaseAudit(t *testing.T) {
+	audit, events := newRecordingAudit()
+	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub(), audit)
+	ctx := context.Background()
+
+	if _, _, err := uc.Register(ctx, "carol", "secret"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, _, err := uc.Authenticate(ctx, "carol", "secret"); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if _, _, err := uc.Authenticate(ctx, "carol", "wrong"); err != domainErrors.ErrInvalidCredentials {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	if _, _, err := uc.Authenticate(ctx, "nobody", "secret"); err != domainErrors.ErrInvalidCredentials {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	uc.TokenRejected(ctx, "invalid token")
+
+	want := []model.AuditAction{model.AuditUserRegistered, model.AuditLoginSucceeded, model.AuditLoginFailed, model.AuditLoginFailed, model.AuditTokenRejected}
+	if got := events.Actions(); !slices.Equal(got, want) {
+		t.Fatalf("expected actions %v, got %v", want, got)
+	}
+	if failed := events.Events[2]; failed.UserID != 1 || failed.Actor != model.AuditActorAnonymous || string(failed.Payload) != `{"reason":"wrong password"}` {
+		t.Fatalf("unexpected failed login event %+v payload=%s", failed, failed.Payload)
+	}
+	if registered := events.Events[0]; registered.UserID != 1 || string(registered.Payload) != "{}" {
+		t.Fatalf("expected registration without login, got %+v payload=%s", registered, registered.Payload)
+	}
+	if unknown := events.Events[3]; unknown.UserID != 0 || string(unknown.Payload) != `{"login":"nobody","reason":"unknown login"}` {
+		t.Fatalf("unexpected unknown login event %+v payload=%s", unknown, unknown.Payload)
+	}
+}
+
+func TestAuthUseCaseTokenRejectedIsSampled(t *testing.T) {
+	audit, events := newRecordingAudit()
+	uc := NewAuthUseCase(testhelpers.NewUserRepositoryStub(), testhelpers.HasherStub{}, newStrategyStub(), audit)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	uc.rejections.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < tokenRejectedBudget+5; i++ {
+		uc.TokenRejected(ctx, "invalid token")
+	}
+	if len(events.Events) != tokenRejectedBudget {
+		t.Fatalf("expected %d audited rejections, got %d", tokenRejectedBudget, len(events.Events))
+	}
+
+	now = now.Add(tokenRejectedWindow)
+	uc.TokenRejected(ctx, "expired")
+	if last := events.Events[len(events.Events)-1]; string(last.Payload) != `{"reason":"expired","suppressed":5}` {
+		t.Fatalf("expected the next window to report dropped rejections, got %s", last.Payload)
+	}
+}
+
+func TestAuthUseCaseActive(t *testing.T) {
+	users := testhelpers.NewUserRepositoryStub()
+	uc := NewAuthUseCase(users, testhelpers.HasherStub{}, newStrategyStub(), newTestAudit())
+	ctx := context.Background()
+	if _, _, err := uc.Register(ctx, "erin", "secret"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if active, err := uc.Active(ctx, 1); err != nil || !active {
+		t.Fatalf("expected open account, got %v err=%v", active, err)
+	}
+	if active, err := uc.Active(ctx, 2); err != nil || active {
+		t.Fatalf("expected unknown account inactive, got %v err=%v", active, err)
+	}
+	if _, err := users.Anonymize(ctx, 1, "deleted-x"); err != nil {
+		t.Fatalf("anonymize: %v", err)
+	}
+	if active, err := uc.Active(ctx, 1); err != nil || active {
+		t.Fatalf("expected closed account inactive, got %v err=%v", active, err)
+	}
+
+	users.Err = fmt.Errorf("down")
+	if _, err := uc.Active(ctx, 1); err == nil {
+		t.Fatal("expected repository error")
+	}
+}
@@ -2,21 +2,45 @@ package usecase
 
 import (
 	"context"
+	"errors"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
 	"github.com/polkiloo/gophermart/internal/domain/repository"
 )
 
+// withdrawAttempts bounds how often Withdraw reruns a unit of work that lost
+// a race with a concurrent retry of the same request.
+const withdrawAttempts = 3
+
 // BalanceUseCase manages operations with loyalty balance.
 type BalanceUseCase struct {
 	balances    repository.BalanceRepository
 	withdrawals repository.WithdrawalRepository
+	audit       *AuditUseCase
 }
 
 // NewBalanceUseCase constructs BalanceUseCase.
-func NewBalanceUseCase(b repository.BalanceRepository, w repository.WithdrawalRepository) *BalanceUseCase {
-	return &BalanceUseCase{balances: b, withdrawals: w}
+func NewBalanceUseCase(b repository.BalanceRepository, w repository.WithdrawalRepository, audit *AuditUseCase) *BalanceUseCase {
+	return &BalanceUseCase{balances: b, withdrawals: w, audit: audit}
+}
+
+type withdrawalPayload struct {
+	WithdrawalID int64       `json:"withdrawal_id"`
+	OrderNumber  string      `json:"order_number"`
+	Sum          model.Money `json:"sum"`
+}
+
+type balancePayload struct {
+	Current   model.Money `json:"current"`
+	Withdrawn model.Money `json:"withdrawn"`
+}
+
+type adjustmentPayload struct {
+	AdjustmentID int64          `json:"adjustment_id"`
+	Before       balancePayload `json:"before"`
+	After        balancePayload `json:"after"`
+	Reason       string         `json:"reason"`
 }
 
 // Summary returns aggregated balance info for user.
@@ -24,21 +48,119 @@ func (u *BalanceUseCase) Summary(ctx context.Context, userID int64) (*model.Bala
 	return u.balances.GetSummary(ctx, userID)
 }
 
-// Withdraw performs withdrawal transaction for user.
-func (u *BalanceUseCase) Withdraw(ctx context.Context, userID int64, order string, sum float64) error {
-	if !ValidateOrderNumber(order) {
-		return domainErrors.ErrInvalidOrderNumber
+// Withdraw performs withdrawal transaction for user. Returns whether the
+// balance was debited now or the request replayed an earlier withdrawal. A
+// unit of work that collides with a concurrent retry is rerun, so the retry
+// replays the winner instead of failing.
+func (u *BalanceUseCase) Withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+	if !ValidateOrderNumber(req.OrderNumber) {
+		return nil, false, domainErrors.ErrInvalidOrderNumber
+	}
+	if req.Sum <= 0 {
+		return nil, false, domainErrors.ErrInvalidAmount
+	}
+
+	var (
+		withdrawal *model.Withdrawal
+		created    bool
+		err        error
+	)
+	for attempt := 0; attempt < withdrawAttempts; attempt++ {
+		withdrawal, created, err = u.withdraw(ctx, req)
+		if !errors.Is(err, domainErrors.ErrConcurrentUpdate) {
+			break
+		}
 	}
-	if sum <= 0 {
-		return domainErrors.ErrInvalidAmount
+	return withdrawal, created, err
+}
+
+func (u *BalanceUseCase) withdraw(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+	var (
+		withdrawal *model.Withdrawal
+		created    bool
+		rejection  error
+	)
+	err := u.audit.Track(ctx, func(ctx context.Context) (*AuditEntry, error) {
+		var err error
+		withdrawal, created, err = u.balances.Withdraw(ctx, req)
+		if errors.Is(err, domainErrors.ErrInsufficientBalance) {
+			// Commit, so the rejection is replayed to retries.
+			rejection = err
+			return nil, nil
+		}
+		if err != nil || !created {
+			return nil, err
+		}
+		return &AuditEntry{Action: model.AuditPointsWithdrawn, UserID: req.UserID, Payload: withdrawalPayload{
+			WithdrawalID: withdrawal.ID, OrderNumber: withdrawal.OrderNumber, Sum: withdrawal.Sum,
+		}}, nil
+	})
+	if err == nil {
+		err = rejection
 	}
-	if err := u.balances.Withdraw(ctx, userID, order, sum); err != nil {
-		return err
+	if err != nil {
+		return nil, false, err
 	}
-	return nil
+	return withdrawal, created, nil
+}
+
+// History returns balance ledger postings, newest first.
+func (u *BalanceUseCase) History(ctx context.Context, userID int64) ([]model.LedgerEntry, error) {
+	return u.balances.History(ctx, userID)
 }
 
 // WithdrawalsHistory returns withdrawals sorted by time.
 func (u *BalanceUseCase) WithdrawalsHistory(ctx context.Context, userID int64) ([]model.Withdrawal, error) {
 	return u.withdrawals.ListByUser(ctx, userID)
 }
+
+// WithdrawalsPage returns one page of withdrawals, newest first, and the
+// cursor of the next page when more withdrawals remain.
+func (u *BalanceUseCase) WithdrawalsPage(ctx context.Context, userID int64, page model.Page) ([]model.Withdrawal, *model.Cursor, error) {
+	withdrawals, err := u.withdrawals.ListPageByUser(ctx, userID, model.Page{Limit: page.Limit + 1, After: page.After})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(withdrawals) <= page.Limit {
+		return withdrawals, nil, nil
+	}
+	withdrawals = withdrawals[:page.Limit]
+	last := withdrawals[len(withdrawals)-1]
+	return withdrawals, &model.Cursor{Time: last.ProcessedAt, ID: last.ID}, nil
+}
+
+// Reconcile finds balances that drifted from the orders and withdrawals they
+// derive from or from their ledger postings and, when repair is set, rewrites them with reason recorded in
+// the audit trail. On a repair error the report covers the work done so far.
+func (u *BalanceUseCase) Reconcile(ctx context.Context, repair bool, reason string) (*model.ReconcileReport, error) {
+	drifts, err := u.balances.FindDrifts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &model.ReconcileReport{Drifts: drifts}
+	if !repair {
+		return report, nil
+	}
+	for _, drift := range drifts {
+		var adjustment *model.BalanceAdjustment
+		err := u.audit.Track(ctx, func(ctx context.Context) (*AuditEntry, error) {
+			var err error
+			if adjustment, err = u.balances.Repair(ctx, drift.UserID, reason); err != nil || adjustment == nil {
+				return nil, err
+			}
+			return &AuditEntry{Action: model.AuditBalanceAdjusted, UserID: drift.UserID, Payload: adjustmentPayload{
+				AdjustmentID: adjustment.ID,
+				Before:       balancePayload(adjustment.Before),
+				After:        balancePayload(adjustment.After),
+				Reason:       reason,
+			}}, nil
+		})
+		if err != nil {
+			return report, err
+		}
+		if adjustment != nil {
+			report.Repairs = append(report.Repairs, *adjustment)
+		}
+	}
+	return report, nil
+}
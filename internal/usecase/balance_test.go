@@ -2,42 +2,48 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
 	"testing"
 	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
 	testhelpers "github.com/polkiloo/gophermart/internal/test"
 )
 
 func TestBalanceUseCaseWithdrawValidation(t *testing.T) {
 	uc := NewBalanceUseCase(
-		&testhelpers.BalanceRepositoryStub{WithdrawFn: func(context.Context, int64, string, float64) error {
+		&testhelpers.BalanceRepositoryStub{WithdrawFn: func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
 			t.Fatal("withdraw should not be called on validation errors")
-			return nil
+			return nil, false, nil
 		}, GetSummaryFn: func(context.Context, int64) (*model.BalanceSummary, error) {
 			return &model.BalanceSummary{}, nil
 		}},
-		&testhelpers.WithdrawalRepositoryStub{})
+		&testhelpers.WithdrawalRepositoryStub{}, newTestAudit())
 
-	if err := uc.Withdraw(context.Background(), 1, "123", 10); err != domainErrors.ErrInvalidOrderNumber {
+	if _, _, err := uc.Withdraw(context.Background(), model.WithdrawalRequest{UserID: 1, OrderNumber: "123", Sum: 10}); err != domainErrors.ErrInvalidOrderNumber {
 		t.Fatalf("expected invalid order error, got %v", err)
 	}
-	if err := uc.Withdraw(context.Background(), 1, "79927398713", -5); err != domainErrors.ErrInvalidAmount {
+	if _, _, err := uc.Withdraw(context.Background(), model.WithdrawalRequest{UserID: 1, OrderNumber: "79927398713", Sum: -5}); err != domainErrors.ErrInvalidAmount {
 		t.Fatalf("expected invalid amount error, got %v", err)
 	}
 }
 
 func TestBalanceUseCaseWithdrawPropagatesError(t *testing.T) {
 	uc := NewBalanceUseCase(
-		&testhelpers.BalanceRepositoryStub{WithdrawFn: func(context.Context, int64, string, float64) error {
-			return domainErrors.ErrInsufficientBalance
+		&testhelpers.BalanceRepositoryStub{WithdrawFn: func(context.Context, model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+			return nil, false, domainErrors.ErrInsufficientBalance
 		}, GetSummaryFn: func(context.Context, int64) (*model.BalanceSummary, error) {
 			return &model.BalanceSummary{}, nil
 		}},
-		&testhelpers.WithdrawalRepositoryStub{})
+		&testhelpers.WithdrawalRepositoryStub{}, newTestAudit())
 
-	if err := uc.Withdraw(context.Background(), 1, "79927398713", 5); err != domainErrors.ErrInsufficientBalance {
+	if _, _, err := uc.Withdraw(context.Background(), model.WithdrawalRequest{UserID: 1, OrderNumber: "79927398713", Sum: 5}); err != domainErrors.ErrInsufficientBalance {
 		t.Fatalf("expected insufficient balance error, got %v", err)
 	}
 }
@@ -45,18 +51,18 @@ func TestBalanceUseCaseWithdrawPropagatesError(t *testing.T) {
 func TestBalanceUseCaseWithdrawSuccess(t *testing.T) {
 	called := false
 	uc := NewBalanceUseCase(
-		&testhelpers.BalanceRepositoryStub{WithdrawFn: func(ctx context.Context, userID int64, order string, sum float64) error {
+		&testhelpers.BalanceRepositoryStub{WithdrawFn: func(ctx context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
 			called = true
-			if userID != 42 || order != "79927398713" || sum != 5 {
-				t.Fatalf("unexpected arguments: %d %s %f", userID, order, sum)
+			if req.UserID != 42 || req.OrderNumber != "79927398713" || req.Sum != 5 || req.IdempotencyKey != "key" {
+				t.Fatalf("unexpected request: %+v", req)
 			}
-			return nil
+			return &model.Withdrawal{OrderNumber: req.OrderNumber, Sum: req.Sum}, true, nil
 		}, GetSummaryFn: func(context.Context, int64) (*model.BalanceSummary, error) {
 			return &model.BalanceSummary{}, nil
 		}},
-		&testhelpers.WithdrawalRepositoryStub{})
+		&testhelpers.WithdrawalRepositoryStub{}, newTestAudit())
 
-	if err := uc.Withdraw(context.Background(), 42, "79927398713", 5); err != nil {
+	if _, _, err := uc.Withdraw(context.Background(), model.WithdrawalRequest{UserID: 42, OrderNumber: "79927398713", Sum: 5, IdempotencyKey: "key"}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if !called {
@@ -67,9 +73,11 @@ func TestBalanceUseCaseWithdrawSuccess(t *testing.T) {
 func TestBalanceUseCaseSummaryAndHistory(t *testing.T) {
 	summary := &model.BalanceSummary{Current: 10, Withdrawn: 2}
 	withdrawals := []model.Withdrawal{{OrderNumber: "1", Sum: 1, ProcessedAt: time.Now()}}
+	entries := []model.LedgerEntry{{Kind: model.LedgerEntryAccrual, Amount: 10, BalanceAfter: 10}}
 	uc := NewBalanceUseCase(
-		&testhelpers.BalanceRepositoryStub{Summary: summary},
+		&testhelpers.BalanceRepositoryStub{Summary: summary, Entries: entries},
 		&testhelpers.WithdrawalRepositoryStub{Items: withdrawals},
+		newTestAudit(),
 	)
 
 	gotSummary, err := uc.Summary(context.Background(), 1)
@@ -87,4 +95,196 @@ func TestBalanceUseCaseSummaryAndHistory(t *testing.T) {
 	if len(gotWithdrawals) != len(withdrawals) {
 		t.Fatalf("expected %d withdrawals, got %d", len(withdrawals), len(gotWithdrawals))
 	}
+
+	gotEntries, err := uc.History(context.Background(), 1)
+	if err != nil || len(gotEntries) != len(entries) {
+		t.Fatalf("unexpected ledger entries: %v err=%v", gotEntries, err)
+	}
+}
+
+func TestBalanceUseCaseWithdrawalsPage(t *testing.T) {
+	now := time.Now()
+	repo := &testhelpers.WithdrawalRepositoryStub{Items: []model.Withdrawal{
+		{ID: 2, OrderNumber: "2", ProcessedAt: now},
+		{ID: 1, OrderNumber: "1", ProcessedAt: now.Add(-time.Minute)},
+	}}
+	uc := NewBalanceUseCase(&testhelpers.BalanceRepositoryStub{}, repo, newTestAudit())
+
+	items, next, err := uc.WithdrawalsPage(context.Background(), 1, model.Page{Limit: 1})
+	if err != nil || len(items) != 1 || next == nil || next.ID != 2 {
+		t.Fatalf("unexpected page %+v next=%v err=%v", items, next, err)
+	}
+
+	items, next, err = uc.WithdrawalsPage(context.Background(), 1, model.Page{Limit: 5})
+	if err != nil || len(items) != 2 || next != nil {
+		t.Fatalf("expected final page, got %+v next=%v err=%v", items, next, err)
+	}
+
+	repo.ListPageFn = func(context.Context, int64, model.Page) ([]model.Withdrawal, error) {
+		return nil, errors.New("boom")
+	}
+	if _, _, err := uc.WithdrawalsPage(context.Background(), 1, model.Page{Limit: 1}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBalanceUseCaseReconcile(t *testing.T) {
+	drifts := []model.BalanceDrift{
+		{UserID: 1, Expected: model.BalanceSummary{Current: 7}, Actual: model.BalanceSummary{Current: 100}},
+		{UserID: 2, Expected: model.BalanceSummary{Current: 1}},
+	}
+	repo := &testhelpers.BalanceRepositoryStub{Drifts: drifts}
+	uc := NewBalanceUseCase(repo, &testhelpers.WithdrawalRepositoryStub{}, newTestAudit())
+
+	repo.RepairFn = func(context.Context, int64, string) (*model.BalanceAdjustment, error) {
+		t.Fatal("repair should not run in check mode")
+		return nil, nil
+	}
+	report, err := uc.Reconcile(context.Background(), false, "check")
+	if err != nil || len(report.Drifts) != 2 || len(report.Repairs) != 0 {
+		t.Fatalf("unexpected check report %+v err=%v", report, err)
+	}
+
+	var reasons []string
+	repo.RepairFn = func(_ context.Context, userID int64, reason string) (*model.BalanceAdjustment, error) {
+		reasons = append(reasons, reason)
+		if userID == 2 {
+			return nil, nil
+		}
+		return &model.BalanceAdjustment{UserID: userID}, nil
+	}
+	report, err = uc.Reconcile(context.Background(), true, "manual")
+	if err != nil || len(report.Repairs) != 1 || report.Repairs[0].UserID != 1 || len(reasons) != 2 || reasons[0] != "manual" {
+		t.Fatalf("unexpected repair report %+v reasons=%v err=%v", report, reasons, err)
+	}
+
+	repo.RepairFn = func(_ context.Context, userID int64, _ string) (*model.BalanceAdjustment, error) {
+		if userID == 2 {
+			return nil, errors.New("locked")
+		}
+		return &model.BalanceAdjustment{UserID: userID}, nil
+	}
+	report, err = uc.Reconcile(context.Background(), true, "manual")
+	if err == nil || report == nil || len(report.Repairs) != 1 {
+		t.Fatalf("expected partial report with error, got %+v err=%v", report, err)
+	}
+
+	repo.DriftsErr = errors.New("query")
+	if _, err := uc.Reconcile(context.Background(), false, "check"); err == nil {
+		t.Fatal("expected drift query error")
+	}
+}
+
+func TestBalanceUseCaseWithdrawAudit(t *testing.T) {
+	audit, events := newRecordingAudit()
+	balances := &testhelpers.BalanceRepositoryStub{}
+	uc := NewBalanceUseCase(balances, &testhelpers.WithdrawalRepositoryStub{}, audit)
+	req := model.WithdrawalRequest{UserID: 4, OrderNumber: "79927398713", Sum: model.MustParseMoney("3")}
+
+	if _, _, err := uc.Withdraw(context.Background(), req); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	balances.WithdrawFn = func(_ context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+		return &model.Withdrawal{UserID: req.UserID, OrderNumber: req.OrderNumber, Sum: req.Sum}, false, nil
+	}
+	if _, created, err := uc.Withdraw(context.Background(), req); err != nil || created {
+		t.Fatalf("expected replay, got created=%v err=%v", created, err)
+	}
+
+	if len(events.Events) != 1 {
+		t.Fatalf("expected only the first withdrawal audited, got %d events", len(events.Events))
+	}
+	if e := events.Events[0]; e.Action != model.AuditPointsWithdrawn || e.UserID != 4 || string(e.Payload) != `{"withdrawal_id":0,"order_number":"79927398713","sum":3}` {
+		t.Fatalf("unexpected withdrawal event %+v payload=%s", e, e.Payload)
+	}
+
+	events.AppendErr = errors.New("down")
+	balances.WithdrawFn = nil
+	if _, _, err := uc.Withdraw(context.Background(), req); err == nil {
+		t.Fatal("expected withdrawal to fail when it cannot be audited")
+	}
+}
+
+func TestBalanceUseCaseWithdrawRetriesConcurrentDuplicate(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		winner   *model.Withdrawal
+		attempts int
+	)
+	balances := &testhelpers.BalanceRepositoryStub{WithdrawFn: func(_ context.Context, req model.WithdrawalRequest) (*model.Withdrawal, bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		switch {
+		case winner == nil:
+			winner = &model.Withdrawal{ID: 9, UserID: req.UserID, OrderNumber: req.OrderNumber, Sum: req.Sum}
+			return winner, true, nil
+		case attempts == 2:
+			// The loser's insert hit the unique index after the winner committed.
+			return nil, false, fmt.Errorf("%w: duplicate key", domainErrors.ErrConcurrentUpdate)
+		default:
+			return winner, false, nil
+		}
+	}}
+	events := &testhelpers.AuditRepositoryStub{}
+	audit := NewAuditUseCase(events, memory.New().Transactions(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	uc := NewBalanceUseCase(balances, &testhelpers.WithdrawalRepositoryStub{}, audit)
+	req := model.WithdrawalRequest{UserID: 1, OrderNumber: "79927398713", Sum: model.MustParseMoney("10"), IdempotencyKey: "pos-1"}
+
+	type outcome struct {
+		withdrawal *model.Withdrawal
+		created    bool
+		err        error
+	}
+	outcomes := make(chan outcome, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, created, err := uc.Withdraw(context.Background(), req)
+			outcomes <- outcome{w, created, err}
+		}()
+	}
+	wg.Wait()
+	close(outcomes)
+
+	created := 0
+	for o := range outcomes {
+		if o.err != nil || o.withdrawal == nil || o.withdrawal.ID != 9 {
+			t.Fatalf("expected both requests to resolve to the winner, got %+v", o)
+		}
+		if o.created {
+			created++
+		}
+	}
+	if created != 1 || attempts != 3 {
+		t.Fatalf("expected one debit and one retried replay, got created=%d attempts=%d", created, attempts)
+	}
+	if len(events.Events) != 1 {
+		t.Fatalf("expected a single audited withdrawal, got %d", len(events.Events))
+	}
+}
+
+func TestBalanceUseCaseWithdrawReplaysRejection(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	audit := NewAuditUseCase(storage.Audit(), storage.Transactions(), slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	uc := NewBalanceUseCase(storage.Balances(), storage.Withdrawals(), audit)
+	req := model.WithdrawalRequest{UserID: 1, OrderNumber: "79927398713", Sum: model.MustParseMoney("10"), IdempotencyKey: "pos-1"}
+
+	if _, _, err := uc.Withdraw(ctx, req); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
+		t.Fatalf("expected insufficient balance, got %v", err)
+	}
+	order, _, _ := storage.Orders().Create(ctx, 1, "12345678903")
+	if err := storage.Balances().AddAccrual(ctx, 1, order.ID, model.MustParseMoney("100")); err != nil {
+		t.Fatalf("add accrual: %v", err)
+	}
+	if _, _, err := uc.Withdraw(ctx, req); !errors.Is(err, domainErrors.ErrInsufficientBalance) {
+		t.Fatalf("expected the rejection to be replayed after top-up, got %v", err)
+	}
+	req.IdempotencyKey = "pos-2"
+	if _, created, err := uc.Withdraw(ctx, req); err != nil || !created {
+		t.Fatalf("expected a new key to withdraw, created=%v err=%v", created, err)
+	}
 }
@@ -4,7 +4,9 @@ import "go.uber.org/fx"
 
 // Module provides core business use cases to the fx container.
 var Module = fx.Provide(
+	NewAuditUseCase,
 	NewAuthUseCase,
 	NewOrderUseCase,
 	NewBalanceUseCase,
+	NewAccountUseCase,
 )
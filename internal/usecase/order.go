@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
@@ -11,11 +12,22 @@ import (
 // OrderUseCase encapsulates order lifecycle logic.
 type OrderUseCase struct {
 	orders repository.OrderRepository
+	audit  *AuditUseCase
 }
 
 // NewOrderUseCase constructs OrderUseCase.
-func NewOrderUseCase(orders repository.OrderRepository) *OrderUseCase {
-	return &OrderUseCase{orders: orders}
+func NewOrderUseCase(orders repository.OrderRepository, audit *AuditUseCase) *OrderUseCase {
+	return &OrderUseCase{orders: orders, audit: audit}
+}
+
+type orderUploadPayload struct {
+	Numbers []string `json:"numbers"`
+}
+
+type accrualPayload struct {
+	OrderID int64       `json:"order_id"`
+	Number  string      `json:"number"`
+	Amount  model.Money `json:"amount"`
 }
 
 // Register registers new order for processing. Returns whether order was newly created.
@@ -29,20 +41,178 @@ func (u *OrderUseCase) Register(ctx context.Context, userID int64, number string
 		return nil, false, err
 	}
 
+	if created {
+		u.audit.Notice(ctx, AuditEntry{Action: model.AuditOrderUploaded, UserID: userID, Payload: orderUploadPayload{Numbers: []string{number}}})
+	}
 	return order, created, nil
 }
 
+// RegisterBatch registers several orders at once and reports the outcome of
+// every number in input order. Invalid numbers are reported rather than
+// failing the batch, and a number repeated within the batch counts as
+// already uploaded after its first occurrence.
+func (u *OrderUseCase) RegisterBatch(ctx context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+	results := make([]model.OrderUpload, len(numbers))
+	var valid []string
+	seen := make(map[string]bool, len(numbers))
+	for i, number := range numbers {
+		results[i].Number = number
+		if !ValidateOrderNumber(number) {
+			results[i].Result = model.OrderUploadInvalid
+			continue
+		}
+		if !seen[number] {
+			seen[number] = true
+			valid = append(valid, number)
+		}
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	uploads, err := u.orders.CreateBatch(ctx, userID, valid)
+	if err != nil {
+		return nil, err
+	}
+	outcome := make(map[string]model.OrderUploadResult, len(uploads))
+	var accepted []string
+	for _, upload := range uploads {
+		outcome[upload.Number] = upload.Result
+		if upload.Result == model.OrderUploadAccepted {
+			accepted = append(accepted, upload.Number)
+		}
+	}
+	if len(accepted) > 0 {
+		u.audit.Notice(ctx, AuditEntry{Action: model.AuditOrderUploaded, UserID: userID, Payload: orderUploadPayload{Numbers: accepted}})
+	}
+	reported := make(map[string]bool, len(valid))
+	for i := range results {
+		if results[i].Result == model.OrderUploadInvalid {
+			continue
+		}
+		number := results[i].Number
+		results[i].Result = outcome[number]
+		if reported[number] && results[i].Result == model.OrderUploadAccepted {
+			results[i].Result = model.OrderUploadAlreadyYours
+		}
+		reported[number] = true
+	}
+	return results, nil
+}
+
 // ListByUser returns orders sorted by upload time.
 func (u *OrderUseCase) ListByUser(ctx context.Context, userID int64) ([]model.Order, error) {
 	return u.orders.ListByUser(ctx, userID)
 }
 
-// SelectBatchForProcessing returns pending orders to process.
-func (u *OrderUseCase) SelectBatchForProcessing(ctx context.Context, limit int) ([]model.Order, error) {
-	return u.orders.SelectBatchForProcessing(ctx, limit)
+// Find returns the user's orders matching filter. With a page limit it also
+// returns the cursor of the next page when more orders remain.
+func (u *OrderUseCase) Find(ctx context.Context, userID int64, filter model.OrderFilter, page model.Page) ([]model.Order, *model.Cursor, error) {
+	if page.Limit <= 0 {
+		orders, err := u.orders.FindByUser(ctx, userID, filter, page)
+		return orders, nil, err
+	}
+
+	orders, err := u.orders.FindByUser(ctx, userID, filter, model.Page{Limit: page.Limit + 1, After: page.After})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(orders) <= page.Limit {
+		return orders, nil, nil
+	}
+	orders = orders[:page.Limit]
+	next := filter.CursorFor(orders[len(orders)-1])
+	return orders, &next, nil
+}
+
+// SelectBatchForProcessing leases due orders to process.
+func (u *OrderUseCase) SelectBatchForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
+	return u.orders.SelectBatchForProcessing(ctx, claim)
+}
+
+// Backlog returns how many orders in shard are waiting to be processed.
+func (u *OrderUseCase) Backlog(ctx context.Context, shard model.Shard) (int64, error) {
+	return u.orders.CountDue(ctx, shard)
+}
+
+// Release hands a leased but unattempted order back to the queue.
+func (u *OrderUseCase) Release(ctx context.Context, orderID int64, owner string) error {
+	return u.orders.Release(ctx, orderID, owner)
+}
+
+// Reschedule releases a leased order and defers its next attempt.
+func (u *OrderUseCase) Reschedule(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	return u.orders.Reschedule(ctx, orderID, owner, delay, lastErr)
+}
+
+// RecordFailure releases a leased order after a failed attempt and defers
+// the next one.
+func (u *OrderUseCase) RecordFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error {
+	return u.orders.RecordFailure(ctx, orderID, owner, delay, lastErr)
+}
+
+// DeadLetter releases a leased order whose retries are exhausted and parks
+// it until an operator requeues it.
+func (u *OrderUseCase) DeadLetter(ctx context.Context, orderID int64, owner string, lastErr string) error {
+	return u.orders.DeadLetter(ctx, orderID, owner, lastErr)
+}
+
+// DeadLettered returns parked orders, most recently parked first. With a
+// page limit it also returns the cursor of the next page when more remain.
+func (u *OrderUseCase) DeadLettered(ctx context.Context, page model.Page) ([]model.Order, *model.Cursor, error) {
+	if page.Limit <= 0 {
+		orders, err := u.orders.FindDeadLettered(ctx, page)
+		return orders, nil, err
+	}
+
+	orders, err := u.orders.FindDeadLettered(ctx, model.Page{Limit: page.Limit + 1, After: page.After})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(orders) <= page.Limit {
+		return orders, nil, nil
+	}
+	orders = orders[:page.Limit]
+	last := orders[len(orders)-1]
+	next := model.Cursor{ID: last.ID}
+	if last.DeadLetteredAt != nil {
+		next.Time = *last.DeadLetteredAt
+	}
+	return orders, &next, nil
+}
+
+// Requeue gives a parked order a fresh retry budget and makes it due now.
+func (u *OrderUseCase) Requeue(ctx context.Context, number string) (*model.Order, error) {
+	return u.orders.Requeue(ctx, number)
+}
+
+// UpdateStatus applies a guarded status transition and reports its outcome.
+// A transition that credits points is audited in the same transaction.
+func (u *OrderUseCase) UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusUpdate, error) {
+	var change model.StatusChange
+	err := u.audit.Track(ctx, func(ctx context.Context) (*AuditEntry, error) {
+		var err error
+		if change, err = u.orders.UpdateStatus(ctx, orderID, status, accrual); err != nil {
+			return nil, err
+		}
+		if change.Update != model.StatusUpdateApplied || status != model.OrderStatusProcessed || accrual == nil || *accrual <= 0 {
+			return nil, nil
+		}
+		return &AuditEntry{
+			Action:  model.AuditAccrualCredited,
+			UserID:  change.UserID,
+			Payload: accrualPayload{OrderID: orderID, Number: change.Number, Amount: *accrual},
+		}, nil
+	})
+	if err != nil {
+		// The unit of work rolled back, whatever the repository reported.
+		return model.StatusUpdateUnknown, err
+	}
+	return change.Update, nil
 }
 
-// UpdateStatus persists status/accrual for order.
-func (u *OrderUseCase) UpdateStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *float64) error {
-	return u.orders.UpdateStatus(ctx, orderID, status, accrual)
+// Archive moves up to limit orders that have been final since before the
+// given time out of the active set.
+func (u *OrderUseCase) Archive(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return u.orders.Archive(ctx, before, limit)
 }
@@ -2,7 +2,10 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
 	domainErrors "github.com/polkiloo/gophermart/internal/domain/errors"
 	"github.com/polkiloo/gophermart/internal/domain/model"
@@ -13,7 +16,7 @@ func TestOrderUseCaseRegisterRejectsInvalidNumber(t *testing.T) {
 	uc := NewOrderUseCase(&testhelpers.OrderRepositoryStub{CreateFn: func(context.Context, int64, string) (*model.Order, bool, error) {
 		t.Fatal("create should not be called for invalid number")
 		return nil, false, nil
-	}})
+	}}, newTestAudit())
 
 	if _, _, err := uc.Register(context.Background(), 1, "123"); err != domainErrors.ErrInvalidOrderNumber {
 		t.Fatalf("expected invalid order number error, got %v", err)
@@ -28,7 +31,7 @@ func TestOrderUseCaseRegisterSuccess(t *testing.T) {
 		return &model.Order{ID: 1, UserID: userID, Number: number}, true, nil
 	}}
 
-	uc := NewOrderUseCase(repo)
+	uc := NewOrderUseCase(repo, newTestAudit())
 
 	order, created, err := uc.Register(context.Background(), 7, "79927398713")
 	if err != nil {
@@ -46,38 +49,259 @@ func TestOrderUseCaseRegisterPropagatesError(t *testing.T) {
 	repo := &testhelpers.OrderRepositoryStub{CreateFn: func(context.Context, int64, string) (*model.Order, bool, error) {
 		return nil, false, domainErrors.ErrAlreadyExists
 	}}
-	uc := NewOrderUseCase(repo)
+	uc := NewOrderUseCase(repo, newTestAudit())
 
 	if _, _, err := uc.Register(context.Background(), 1, "79927398713"); err != domainErrors.ErrAlreadyExists {
 		t.Fatalf("expected repository error to be returned, got %v", err)
 	}
 }
 
+func TestOrderUseCaseRegisterBatch(t *testing.T) {
+	repo := &testhelpers.OrderRepositoryStub{CreateBatchFn: func(_ context.Context, userID int64, numbers []string) ([]model.OrderUpload, error) {
+		if userID != 7 || len(numbers) != 2 || numbers[0] != "79927398713" || numbers[1] != "12345678903" {
+			t.Fatalf("unexpected arguments: %d %q", userID, numbers)
+		}
+		return []model.OrderUpload{
+			{Number: "12345678903", Result: model.OrderUploadOwnedByAnother},
+			{Number: "79927398713", Result: model.OrderUploadAccepted},
+		}, nil
+	}}
+	uc := NewOrderUseCase(repo, newTestAudit())
+
+	uploads, err := uc.RegisterBatch(context.Background(), 7, []string{"79927398713", "123", "12345678903", "79927398713"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []model.OrderUpload{
+		{Number: "79927398713", Result: model.OrderUploadAccepted},
+		{Number: "123", Result: model.OrderUploadInvalid},
+		{Number: "12345678903", Result: model.OrderUploadOwnedByAnother},
+		{Number: "79927398713", Result: model.OrderUploadAlreadyYours},
+	}
+	if len(uploads) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), uploads)
+	}
+	for i := range want {
+		if uploads[i] != want[i] {
+			t.Fatalf("result %d: expected %+v, got %+v", i, want[i], uploads[i])
+		}
+	}
+}
+
+func TestOrderUseCaseRegisterBatchSkipsRepositoryForInvalidOnly(t *testing.T) {
+	repo := &testhelpers.OrderRepositoryStub{CreateBatchFn: func(context.Context, int64, []string) ([]model.OrderUpload, error) {
+		t.Fatal("create batch should not be called without valid numbers")
+		return nil, nil
+	}}
+	uploads, err := NewOrderUseCase(repo, newTestAudit()).RegisterBatch(context.Background(), 1, []string{"123"})
+	if err != nil || len(uploads) != 1 || uploads[0].Result != model.OrderUploadInvalid {
+		t.Fatalf("expected single invalid result, got %+v err=%v", uploads, err)
+	}
+
+	repo.CreateBatchFn = func(context.Context, int64, []string) ([]model.OrderUpload, error) {
+		return nil, errors.New("boom")
+	}
+	if _, err := NewOrderUseCase(repo, newTestAudit()).RegisterBatch(context.Background(), 1, []string{"79927398713"}); err == nil {
+		t.Fatal("expected repository error to be returned")
+	}
+}
+
 func TestOrderUseCaseListAndProcessing(t *testing.T) {
 	repo := &testhelpers.OrderRepositoryStub{
 		Orders:     []model.Order{{Number: "1"}},
 		Processing: []model.Order{{Number: "2"}},
 	}
-	uc := NewOrderUseCase(repo)
+	uc := NewOrderUseCase(repo, newTestAudit())
 
 	orders, err := uc.ListByUser(context.Background(), 1)
 	if err != nil || len(orders) != 1 {
 		t.Fatalf("unexpected list result: %v %v", orders, err)
 	}
 
-	processing, err := uc.SelectBatchForProcessing(context.Background(), 1)
+	processing, err := uc.SelectBatchForProcessing(context.Background(), model.OrderClaim{Owner: "a", Limit: 1})
 	if err != nil || len(processing) != 1 {
 		t.Fatalf("unexpected processing result: %v %v", processing, err)
 	}
+
+	var counted model.Shard
+	repo.CountDueFn = func(_ context.Context, shard model.Shard) (int64, error) {
+		counted = shard
+		return 7, nil
+	}
+	backlog, err := uc.Backlog(context.Background(), model.Shard{Index: 1, Count: 2})
+	if err != nil || backlog != 7 || counted != (model.Shard{Index: 1, Count: 2}) {
+		t.Fatalf("unexpected backlog %d for %+v err=%v", backlog, counted, err)
+	}
 }
 
 func TestOrderUseCaseUpdateStatus(t *testing.T) {
 	repo := &testhelpers.OrderRepositoryStub{}
-	uc := NewOrderUseCase(repo)
-	if err := uc.UpdateStatus(context.Background(), 1, model.OrderStatusProcessed, nil); err != nil {
+	uc := NewOrderUseCase(repo, newTestAudit())
+	if _, err := uc.UpdateStatus(context.Background(), 1, model.OrderStatusProcessed, nil); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if len(repo.UpdateCalls) != 1 {
 		t.Fatalf("expected update call to be recorded")
 	}
 }
+
+func TestOrderUseCaseReschedule(t *testing.T) {
+	repo := &testhelpers.OrderRepositoryStub{}
+	uc := NewOrderUseCase(repo, newTestAudit())
+	if err := uc.Reschedule(context.Background(), 1, "a", time.Second, "boom"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.RescheduleCalls) != 1 || repo.RescheduleCalls[0].Owner != "a" || repo.RescheduleCalls[0].Delay != time.Second {
+		t.Fatalf("expected reschedule call to be recorded, got %+v", repo.RescheduleCalls)
+	}
+}
+
+func TestOrderUseCaseRelease(t *testing.T) {
+	repo := &testhelpers.OrderRepositoryStub{}
+	uc := NewOrderUseCase(repo, newTestAudit())
+	if err := uc.Release(context.Background(), 1, "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.ReleaseCalls) != 1 || repo.ReleaseCalls[0].OrderID != 1 || repo.ReleaseCalls[0].Owner != "a" {
+		t.Fatalf("expected release call to be recorded, got %+v", repo.ReleaseCalls)
+	}
+}
+
+func TestOrderUseCaseFailures(t *testing.T) {
+	repo := &testhelpers.OrderRepositoryStub{}
+	uc := NewOrderUseCase(repo, newTestAudit())
+	if err := uc.RecordFailure(context.Background(), 1, "a", time.Second, "boom"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := uc.DeadLetter(context.Background(), 2, "a", "boom"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.FailureCalls) != 1 || repo.FailureCalls[0].Delay != time.Second || len(repo.DeadLetterCalls) != 1 || repo.DeadLetterCalls[0].OrderID != 2 {
+		t.Fatalf("expected failure calls to be recorded, got %+v %+v", repo.FailureCalls, repo.DeadLetterCalls)
+	}
+}
+
+func TestOrderUseCaseDeadLettered(t *testing.T) {
+	parkedAt := time.Unix(100, 0)
+	repo := &testhelpers.OrderRepositoryStub{DeadLettered: []model.Order{
+		{ID: 3, Number: "3", DeadLetteredAt: &parkedAt},
+		{ID: 2, Number: "2", DeadLetteredAt: &parkedAt},
+	}}
+	uc := NewOrderUseCase(repo, newTestAudit())
+
+	all, next, err := uc.DeadLettered(context.Background(), model.Page{})
+	if err != nil || len(all) != 2 || next != nil {
+		t.Fatalf("expected every parked order, got %v next=%v err=%v", all, next, err)
+	}
+
+	page, next, err := uc.DeadLettered(context.Background(), model.Page{Limit: 1})
+	if err != nil || len(page) != 1 || next == nil || next.ID != 3 || !next.Time.Equal(parkedAt) {
+		t.Fatalf("expected page of one with next cursor, got %v next=%v err=%v", page, next, err)
+	}
+
+	repo.FindDeadLetteredFn = func(context.Context, model.Page) ([]model.Order, error) { return nil, errors.New("boom") }
+	if _, _, err := uc.DeadLettered(context.Background(), model.Page{Limit: 1}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	requeued, err := uc.Requeue(context.Background(), "2")
+	if err != nil || requeued.ID != 2 || requeued.NeedsAttention() {
+		t.Fatalf("expected requeued order, got %+v err=%v", requeued, err)
+	}
+	if _, err := uc.Requeue(context.Background(), "7"); !errors.Is(err, domainErrors.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestOrderUseCaseArchive(t *testing.T) {
+	before := time.Now()
+	repo := &testhelpers.OrderRepositoryStub{ArchiveFn: func(_ context.Context, got time.Time, limit int) (int64, error) {
+		if !got.Equal(before) || limit != 10 {
+			t.Fatalf("unexpected archive args %v %d", got, limit)
+		}
+		return 4, nil
+	}}
+	uc := NewOrderUseCase(repo, newTestAudit())
+	if archived, err := uc.Archive(context.Background(), before, 10); err != nil || archived != 4 {
+		t.Fatalf("expected four archived orders, got %d err=%v", archived, err)
+	}
+}
+
+func TestOrderUseCaseFind(t *testing.T) {
+	now := time.Now()
+	repo := &testhelpers.OrderRepositoryStub{Orders: []model.Order{
+		{ID: 3, Number: "3", UploadedAt: now},
+		{ID: 2, Number: "2", UploadedAt: now.Add(-time.Minute)},
+		{ID: 1, Number: "1", UploadedAt: now.Add(-2 * time.Minute)},
+	}}
+	uc := NewOrderUseCase(repo, newTestAudit())
+
+	orders, next, err := uc.Find(context.Background(), 1, model.OrderFilter{}, model.Page{Limit: 2})
+	if err != nil || len(orders) != 2 || next == nil {
+		t.Fatalf("unexpected page %+v next=%v err=%v", orders, next, err)
+	}
+	if next.ID != 2 || !next.Time.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("expected cursor at last item, got %+v", next)
+	}
+
+	orders, next, err = uc.Find(context.Background(), 1, model.OrderFilter{}, model.Page{Limit: 3})
+	if err != nil || len(orders) != 3 || next != nil {
+		t.Fatalf("expected final page, got %+v next=%v err=%v", orders, next, err)
+	}
+
+	accr := model.MustParseMoney("5")
+	repo.Orders[1].Accrual = &accr
+	_, next, err = uc.Find(context.Background(), 1, model.OrderFilter{SortBy: model.OrderSortAccrual}, model.Page{Limit: 2})
+	if err != nil || next == nil || next.Amount != accr || !next.Time.IsZero() {
+		t.Fatalf("expected accrual cursor, got %+v err=%v", next, err)
+	}
+
+	orders, next, err = uc.Find(context.Background(), 1, model.OrderFilter{}, model.Page{})
+	if err != nil || len(orders) != 3 || next != nil {
+		t.Fatalf("expected unpaged result, got %+v next=%v err=%v", orders, next, err)
+	}
+
+	repo.FindByUserFn = func(context.Context, int64, model.OrderFilter, model.Page) ([]model.Order, error) {
+		return nil, errors.New("boom")
+	}
+	if _, _, err := uc.Find(context.Background(), 1, model.OrderFilter{}, model.Page{Limit: 2}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestOrderUseCaseAudit(t *testing.T) {
+	audit, events := newRecordingAudit()
+	repo := &testhelpers.OrderRepositoryStub{
+		UpdateStatusFn: func(context.Context, int64, model.OrderStatus, *model.Money) (model.StatusChange, error) {
+			return model.StatusChange{Update: model.StatusUpdateApplied, UserID: 7, Number: "79927398713"}, nil
+		},
+	}
+	uc := NewOrderUseCase(repo, audit)
+	ctx := context.Background()
+
+	if _, _, err := uc.Register(ctx, 7, "79927398713"); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := uc.RegisterBatch(ctx, 7, []string{"12345678903", "123"}); err != nil {
+		t.Fatalf("register batch: %v", err)
+	}
+	accrual := model.MustParseMoney("15.5")
+	if _, err := uc.UpdateStatus(ctx, 1, model.OrderStatusProcessed, &accrual); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+	if _, err := uc.UpdateStatus(ctx, 2, model.OrderStatusProcessing, nil); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	want := []model.AuditAction{model.AuditOrderUploaded, model.AuditOrderUploaded, model.AuditAccrualCredited}
+	if got := events.Actions(); !slices.Equal(got, want) {
+		t.Fatalf("expected actions %v, got %v", want, got)
+	}
+	if batch := events.Events[1]; string(batch.Payload) != `{"numbers":["12345678903"]}` {
+		t.Fatalf("unexpected batch payload %s", batch.Payload)
+	}
+	if credit := events.Events[2]; credit.Actor != model.AuditActorSystem || credit.UserID != 7 ||
+		string(credit.Payload) != `{"order_id":1,"number":"79927398713","amount":15.5}` {
+		t.Fatalf("unexpected credit event %+v payload=%s", credit, credit.Payload)
+	}
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// ReconcileFacade exposes balance reconciliation to the reconciler.
+type ReconcileFacade interface {
+	ReconcileBalances(ctx context.Context, repair bool, reason string) (*model.ReconcileReport, error)
+}
+
+// Leadership tells whether this replica is the one running singleton jobs.
+type Leadership interface {
+	Leading() bool
+}
+
+const (
+	defaultReconcileInterval = time.Hour
+	reconcileJobReason       = "reconcile job"
+)
+
+// BalanceReconciler periodically checks stored balances against orders and
+// withdrawals, logs every drift and optionally repairs it. With a leadership
+// it only runs on the leader, so replicas never repair the same balance.
+type BalanceReconciler struct {
+	facade   ReconcileFacade
+	leader   Leadership
+	interval time.Duration
+	repair   bool
+	logger   *slog.Logger
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+// NewBalanceReconciler constructs the reconciler. A nil leader runs it on
+// every replica.
+func NewBalanceReconciler(facade ReconcileFacade, leader Leadership, interval time.Duration, repair bool, logger *slog.Logger) *BalanceReconciler {
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	return &BalanceReconciler{facade: facade, leader: leader, interval: interval, repair: repair, logger: logger}
+}
+
+// Start runs reconciliation every interval.
+func (r *BalanceReconciler) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+
+	r.wg.Add(1)
+	go r.run(runCtx)
+}
+
+// Stop waits for the current run to finish.
+func (r *BalanceReconciler) Stop() {
+	r.mu.Lock()
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+}
+
+func (r *BalanceReconciler) run(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconcile(ctx)
+		}
+	}
+}
+
+func (r *BalanceReconciler) reconcile(ctx context.Context) {
+	if r.leader != nil && !r.leader.Leading() {
+		return
+	}
+	report, err := r.facade.ReconcileBalances(ctx, r.repair, reconcileJobReason)
+	if report != nil {
+		repaired := make(map[int64]bool, len(report.Repairs))
+		for _, adj := range report.Repairs {
+			repaired[adj.UserID] = true
+		}
+		for _, drift := range report.Drifts {
+			r.logger.Warn("balance drift",
+				slog.Int64("user_id", drift.UserID),
+				slog.String("expected_current", drift.Expected.Current.String()),
+				slog.String("actual_current", drift.Actual.Current.String()),
+				slog.String("expected_withdrawn", drift.Expected.Withdrawn.String()),
+				slog.String("actual_withdrawn", drift.Actual.Withdrawn.String()),
+				slog.String("ledger_current", drift.Ledger.String()),
+				slog.Bool("repaired", repaired[drift.UserID]),
+			)
+		}
+	}
+	if err != nil && ctx.Err() == nil {
+		r.logger.Error("balance reconciliation failed", slog.String("error", err.Error()))
+	}
+}
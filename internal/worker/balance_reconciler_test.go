@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+type reconcileFacadeFunc func(ctx context.Context, repair bool, reason string) (*model.ReconcileReport, error)
+
+func (f reconcileFacadeFunc) ReconcileBalances(ctx context.Context, repair bool, reason string) (*model.ReconcileReport, error) {
+	return f(ctx, repair, reason)
+}
+
+func TestBalanceReconcilerLogsDrift(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	report := &model.ReconcileReport{
+		Drifts: []model.BalanceDrift{
+			{UserID: 1, Expected: model.BalanceSummary{Current: model.MustParseMoney("7")}, Actual: model.BalanceSummary{Current: model.MustParseMoney("100")}},
+			{UserID: 2},
+		},
+		Repairs: []model.BalanceAdjustment{{UserID: 1}},
+	}
+	reconciler := NewBalanceReconciler(reconcileFacadeFunc(func(_ context.Context, repair bool, reason string) (*model.ReconcileReport, error) {
+		if !repair || reason != reconcileJobReason {
+			t.Fatalf("unexpected call repair=%v reason=%q", repair, reason)
+		}
+		return report, errors.New("partial")
+	}), nil, time.Hour, true, logger)
+
+	reconciler.reconcile(context.Background())
+	out := logs.String()
+	if !strings.Contains(out, `"user_id":1,"expected_current":"7","actual_current":"100"`) || !strings.Contains(out, `"repaired":true`) ||
+		!strings.Contains(out, `"user_id":2`) || !strings.Contains(out, "balance reconciliation failed") {
+		t.Fatalf("unexpected log output: %s", out)
+	}
+}
+
+type leadershipFunc func() bool
+
+func (f leadershipFunc) Leading() bool { return f() }
+
+func TestBalanceReconcilerRunsOnlyOnLeader(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	var (
+		calls   int
+		leading bool
+	)
+	reconciler := NewBalanceReconciler(reconcileFacadeFunc(func(context.Context, bool, string) (*model.ReconcileReport, error) {
+		calls++
+		return &model.ReconcileReport{}, nil
+	}), leadershipFunc(func() bool { return leading }), time.Hour, true, logger)
+
+	reconciler.reconcile(context.Background())
+	if calls != 0 {
+		t.Fatal("expected a follower not to reconcile")
+	}
+	leading = true
+	reconciler.reconcile(context.Background())
+	if calls != 1 {
+		t.Fatalf("expected the leader to reconcile once, got %d", calls)
+	}
+}
+
+func TestBalanceReconcilerRunsOnInterval(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	reconciler := NewBalanceReconciler(reconcileFacadeFunc(func(context.Context, bool, string) (*model.ReconcileReport, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return &model.ReconcileReport{}, nil
+	}), nil, 10*time.Millisecond, false, logger)
+
+	reconciler.Start(context.Background())
+	deadline := time.After(time.Second)
+	for {
+		mu.Lock()
+		done := calls >= 2
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for reconciliation runs")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	reconciler.Stop()
+
+	if r := NewBalanceReconciler(nil, nil, 0, false, logger); r.interval != defaultReconcileInterval {
+		t.Fatalf("expected default interval, got %v", r.interval)
+	}
+}
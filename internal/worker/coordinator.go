@@ -0,0 +1,226 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// CoordinationMode decides how replicas sharing a database split polling.
+type CoordinationMode string
+
+const (
+	// CoordinationNone lets every replica poll all orders.
+	CoordinationNone CoordinationMode = "none"
+	// CoordinationLeader lets only the replica holding the leader lock poll;
+	// another one takes over when the leader goes away.
+	CoordinationLeader CoordinationMode = "leader"
+	// CoordinationSharded splits orders by hash of their ID between the
+	// replicas that keep sending heartbeats.
+	CoordinationSharded CoordinationMode = "sharded"
+)
+
+const (
+	defaultHeartbeatInterval = 5 * time.Second
+	// releaseTimeout bounds giving up the lock or registration on Stop.
+	releaseTimeout = 5 * time.Second
+)
+
+// LeaderLock elects a single poller.
+type LeaderLock interface {
+	TryAcquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+// InstanceRegistry tracks the live replicas in sharded mode.
+type InstanceRegistry interface {
+	Heartbeat(ctx context.Context, instanceID string) error
+	LiveInstances(ctx context.Context, ttl time.Duration) ([]string, error)
+	Deregister(ctx context.Context, instanceID string) error
+}
+
+// Coordinator tells the processor which orders this replica may poll. It
+// renews its leadership or registration every heartbeat and stops polling
+// as soon as it cannot, so that a replica cut off from the database yields
+// its work before the others take it over. Brief overlaps while membership
+// changes are harmless: order leases still keep two replicas off one order.
+type Coordinator struct {
+	mode       CoordinationMode
+	instanceID string
+	leader     LeaderLock
+	registry   InstanceRegistry
+	interval   time.Duration
+	ttl        time.Duration
+	logger     *slog.Logger
+
+	stateMu  sync.Mutex
+	shard    model.Shard
+	assigned bool
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+// NewCoordinator constructs a coordinator for mode. The leader lock is used
+// in leader mode and the registry in sharded mode; ttl is how long a silent
+// replica keeps its shard.
+func NewCoordinator(mode CoordinationMode, instanceID string, leader LeaderLock, registry InstanceRegistry, interval, ttl time.Duration, logger *slog.Logger) *Coordinator {
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	if ttl <= interval {
+		ttl = 3 * interval
+	}
+	return &Coordinator{
+		mode:       mode,
+		instanceID: instanceID,
+		leader:     leader,
+		registry:   registry,
+		interval:   interval,
+		ttl:        ttl,
+		logger:     logger,
+		assigned:   mode == CoordinationNone,
+	}
+}
+
+// Assignment returns the shard this replica polls and whether it polls at all.
+func (c *Coordinator) Assignment() (model.Shard, bool) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.shard, c.assigned
+}
+
+// Leading reports whether this replica runs the jobs that must not run on
+// several replicas at once: always without coordination, while it holds the
+// leader lock in leader mode and while it owns the first shard in sharded
+// mode.
+func (c *Coordinator) Leading() bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.mode == CoordinationSharded {
+		return c.assigned && c.shard.Index == 0
+	}
+	return c.assigned
+}
+
+// Start takes part in coordination right away and then every interval.
+func (c *Coordinator) Start(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.mode == CoordinationNone {
+		return
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+
+	c.beat(runCtx)
+	c.wg.Add(1)
+	go c.run(runCtx)
+}
+
+// Stop ends the heartbeats and hands the work over to the other replicas.
+func (c *Coordinator) Stop() {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	if c.mode == CoordinationNone {
+		return
+	}
+	c.assign(model.Shard{}, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	var err error
+	switch c.mode {
+	case CoordinationLeader:
+		err = c.leader.Release(ctx)
+	case CoordinationSharded:
+		err = c.registry.Deregister(ctx, c.instanceID)
+	}
+	if err != nil {
+		c.logger.Warn("worker coordination release failed", slog.String("error", err.Error()))
+	}
+}
+
+func (c *Coordinator) run(ctx context.Context) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.beat(ctx)
+		}
+	}
+}
+
+func (c *Coordinator) beat(ctx context.Context) {
+	switch c.mode {
+	case CoordinationLeader:
+		held, err := c.leader.TryAcquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.logger.Warn("leader election failed", slog.String("error", err.Error()))
+		}
+		c.assign(model.Shard{}, held)
+	case CoordinationSharded:
+		shard, ok, err := c.claimShard(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.logger.Warn("instance heartbeat failed", slog.String("error", err.Error()))
+		}
+		c.assign(shard, ok)
+	}
+}
+
+func (c *Coordinator) claimShard(ctx context.Context) (model.Shard, bool, error) {
+	if err := c.registry.Heartbeat(ctx, c.instanceID); err != nil {
+		return model.Shard{}, false, err
+	}
+	live, err := c.registry.LiveInstances(ctx, c.ttl)
+	if err != nil {
+		return model.Shard{}, false, err
+	}
+	index := slices.Index(live, c.instanceID)
+	if index < 0 {
+		return model.Shard{}, false, nil
+	}
+	return model.Shard{Index: index, Count: len(live)}, true, nil
+}
+
+func (c *Coordinator) assign(shard model.Shard, assigned bool) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	if shard == c.shard && assigned == c.assigned {
+		return
+	}
+	c.shard, c.assigned = shard, assigned
+
+	switch {
+	case c.mode == CoordinationLeader && assigned:
+		c.logger.Info("became order poller leader", slog.String("instance", c.instanceID))
+	case c.mode == CoordinationLeader:
+		c.logger.Info("stepped down as order poller leader", slog.String("instance", c.instanceID))
+	case assigned:
+		c.logger.Info("order shard assigned",
+			slog.String("instance", c.instanceID),
+			slog.Int("shard", shard.Index),
+			slog.Int("shards", shard.Count),
+		)
+	default:
+		c.logger.Info("order shard released", slog.String("instance", c.instanceID))
+	}
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
+	testhelpers "github.com/polkiloo/gophermart/internal/test"
+)
+
+func TestCoordinatorNoneAlwaysPolls(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	coordinator := NewCoordinator(CoordinationNone, "node-a", nil, nil, 0, 0, logger)
+	coordinator.Start(context.Background())
+	coordinator.Stop()
+
+	if shard, ok := coordinator.Assignment(); !ok || shard != (model.Shard{}) {
+		t.Fatalf("expected every order assigned, got %+v %v", shard, ok)
+	}
+	if !coordinator.Leading() {
+		t.Fatal("expected an uncoordinated replica to lead")
+	}
+	if coordinator.interval != defaultHeartbeatInterval || coordinator.ttl != 3*defaultHeartbeatInterval {
+		t.Fatalf("unexpected defaults %v %v", coordinator.interval, coordinator.ttl)
+	}
+}
+
+func TestCoordinatorLeaderFailover(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	storage := memory.New()
+	first := NewCoordinator(CoordinationLeader, "node-a", storage.Leader(), nil, time.Hour, 0, logger)
+	second := NewCoordinator(CoordinationLeader, "node-b", storage.Leader(), nil, time.Hour, 0, logger)
+
+	first.Start(context.Background())
+	second.Start(context.Background())
+	defer second.Stop()
+
+	if _, ok := first.Assignment(); !ok {
+		t.Fatal("expected first instance to become leader")
+	}
+	if _, ok := second.Assignment(); ok {
+		t.Fatal("expected second instance to stand by")
+	}
+	if !first.Leading() || second.Leading() {
+		t.Fatal("expected only the lock holder to lead")
+	}
+
+	first.Stop()
+	if _, ok := first.Assignment(); ok {
+		t.Fatal("expected stopped leader to stop polling")
+	}
+	second.beat(context.Background())
+	if _, ok := second.Assignment(); !ok {
+		t.Fatal("expected second instance to take over")
+	}
+}
+
+func TestCoordinatorLeaderStepsDownOnError(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	lock := &testhelpers.LeaderLockStub{Held: true}
+	coordinator := NewCoordinator(CoordinationLeader, "node-a", lock, nil, time.Hour, 0, logger)
+
+	coordinator.beat(context.Background())
+	if _, ok := coordinator.Assignment(); !ok {
+		t.Fatal("expected leadership")
+	}
+	lock.Err = errors.New("connection lost")
+	coordinator.beat(context.Background())
+	if _, ok := coordinator.Assignment(); ok {
+		t.Fatal("expected leadership to be dropped when the lock cannot be confirmed")
+	}
+
+	coordinator.Stop()
+	if lock.Releases != 1 {
+		t.Fatalf("expected lock released on stop, got %d", lock.Releases)
+	}
+}
+
+func TestCoordinatorShardsBetweenLiveInstances(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	storage := memory.New()
+	first := NewCoordinator(CoordinationSharded, "node-a", nil, storage.Instances(), time.Hour, 0, logger)
+	second := NewCoordinator(CoordinationSharded, "node-b", nil, storage.Instances(), time.Hour, 0, logger)
+
+	first.Start(context.Background())
+	second.Start(context.Background())
+	first.beat(context.Background())
+
+	if shard, ok := first.Assignment(); !ok || shard != (model.Shard{Index: 0, Count: 2}) {
+		t.Fatalf("unexpected first shard %+v %v", shard, ok)
+	}
+	if shard, ok := second.Assignment(); !ok || shard != (model.Shard{Index: 1, Count: 2}) {
+		t.Fatalf("unexpected second shard %+v %v", shard, ok)
+	}
+	if !first.Leading() || second.Leading() {
+		t.Fatal("expected only the first shard owner to lead")
+	}
+
+	second.Stop()
+	first.beat(context.Background())
+	if shard, ok := first.Assignment(); !ok || shard != (model.Shard{Index: 0, Count: 1}) {
+		t.Fatalf("expected remaining instance to take every order, got %+v %v", shard, ok)
+	}
+	first.Stop()
+
+	live, err := storage.Instances().LiveInstances(context.Background(), time.Hour)
+	if err != nil || len(live) != 0 {
+		t.Fatalf("expected stopped instances deregistered, got %v err=%v", live, err)
+	}
+}
+
+func TestCoordinatorReleasesShardWhenHeartbeatFails(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	registry := &testhelpers.InstanceRegistryStub{Live: []string{"node-a"}}
+	coordinator := NewCoordinator(CoordinationSharded, "node-a", nil, registry, time.Hour, 0, logger)
+
+	coordinator.beat(context.Background())
+	if _, ok := coordinator.Assignment(); !ok {
+		t.Fatal("expected shard assigned")
+	}
+	registry.HeartbeatErr = errors.New("database down")
+	coordinator.beat(context.Background())
+	if _, ok := coordinator.Assignment(); ok {
+		t.Fatal("expected shard released while heartbeats fail")
+	}
+}
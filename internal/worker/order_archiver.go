@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultArchiveInterval = time.Hour
+
+// ArchiveFacade exposes order archival to the archiver.
+type ArchiveFacade interface {
+	ArchiveOrders(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// OrderArchiver periodically moves orders that have been final for longer
+// than the retention age out of the active orders set.
+type OrderArchiver struct {
+	facade    ArchiveFacade
+	after     time.Duration
+	interval  time.Duration
+	batchSize int
+	logger    *slog.Logger
+	now       func() time.Time
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+// NewOrderArchiver constructs the archiver. Each run archives in batches of
+// batchSize until no eligible orders remain.
+func NewOrderArchiver(facade ArchiveFacade, after, interval time.Duration, batchSize int, logger *slog.Logger) *OrderArchiver {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	if interval <= 0 {
+		interval = defaultArchiveInterval
+	}
+	return &OrderArchiver{
+		facade:    facade,
+		after:     after,
+		interval:  interval,
+		batchSize: batchSize,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// Start runs archival once and then every interval.
+func (a *OrderArchiver) Start(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	a.cancel = cancel
+
+	a.wg.Add(1)
+	go a.run(runCtx)
+}
+
+// Stop waits for the current run to finish.
+func (a *OrderArchiver) Stop() {
+	a.mu.Lock()
+	if a.cancel != nil {
+		a.cancel()
+		a.cancel = nil
+	}
+	a.mu.Unlock()
+
+	a.wg.Wait()
+}
+
+func (a *OrderArchiver) run(ctx context.Context) {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.archive(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *OrderArchiver) archive(ctx context.Context) {
+	before := a.now().Add(-a.after)
+	var total int64
+	for ctx.Err() == nil {
+		moved, err := a.facade.ArchiveOrders(ctx, before, a.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				a.logger.Error("archive orders failed", slog.String("error", err.Error()))
+			}
+			break
+		}
+		total += moved
+		if moved < int64(a.batchSize) {
+			break
+		}
+	}
+	if total > 0 {
+		a.logger.Info("orders archived", slog.Int64("archived", total), slog.Time("before", before))
+	}
+}
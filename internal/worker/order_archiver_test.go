@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type archiveFacadeFunc func(ctx context.Context, before time.Time, limit int) (int64, error)
+
+func (f archiveFacadeFunc) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return f(ctx, before, limit)
+}
+
+func TestOrderArchiverArchivesInBatches(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	remaining := int64(5)
+	var calls int
+	archiver := NewOrderArchiver(archiveFacadeFunc(func(_ context.Context, before time.Time, limit int) (int64, error) {
+		calls++
+		if want := now.Add(-24 * time.Hour); !before.Equal(want) {
+			t.Fatalf("expected cutoff %v, got %v", want, before)
+		}
+		moved := min(remaining, int64(limit))
+		remaining -= moved
+		return moved, nil
+	}), 24*time.Hour, time.Hour, 2, logger)
+	archiver.now = func() time.Time { return now }
+
+	archiver.archive(context.Background())
+	if remaining != 0 || calls != 3 {
+		t.Fatalf("expected all orders archived in 3 batches, remaining=%d calls=%d", remaining, calls)
+	}
+
+	calls = 0
+	archiver.facade = archiveFacadeFunc(func(context.Context, time.Time, int) (int64, error) {
+		calls++
+		return 0, errors.New("db down")
+	})
+	archiver.archive(context.Background())
+	if calls != 1 {
+		t.Fatalf("expected archival to stop on error, got %d calls", calls)
+	}
+}
+
+func TestOrderArchiverStartStop(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	ran := make(chan struct{}, 1)
+	archiver := NewOrderArchiver(archiveFacadeFunc(func(context.Context, time.Time, int) (int64, error) {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return 0, nil
+	}), time.Hour, 0, 0, logger)
+	if archiver.interval != defaultArchiveInterval || archiver.batchSize != 1 {
+		t.Fatalf("unexpected defaults: interval=%v batch=%d", archiver.interval, archiver.batchSize)
+	}
+
+	archiver.Start(context.Background())
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("expected archival to run on start")
+	}
+	archiver.Stop()
+}
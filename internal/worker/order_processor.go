@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math/rand/v2"
 	"sync"
 	"time"
 
@@ -13,9 +14,178 @@ import (
 
 // LoyaltyFacade exposes the subset of application functionality required by the worker.
 type LoyaltyFacade interface {
-	OrdersForProcessing(ctx context.Context, limit int) ([]model.Order, error)
+	OrdersForProcessing(ctx context.Context, claim model.OrderClaim) ([]model.Order, error)
 	CheckAccrual(ctx context.Context, number string) (*model.Accrual, error)
-	UpdateOrderStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *float64) error
+	UpdateOrderStatus(ctx context.Context, orderID int64, status model.OrderStatus, accrual *model.Money) (model.StatusUpdate, error)
+	RescheduleOrder(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error
+	ReleaseOrder(ctx context.Context, orderID int64, owner string) error
+	RecordOrderFailure(ctx context.Context, orderID int64, owner string, delay time.Duration, lastErr string) error
+	DeadLetterOrder(ctx context.Context, orderID int64, owner string, lastErr string) error
+	OrderBacklog(ctx context.Context, shard model.Shard) (int64, error)
+}
+
+// Notifier wakes the processor when new orders arrive.
+type Notifier interface {
+	NewOrders(ctx context.Context) <-chan struct{}
+}
+
+// Breaker reports whether calls to the accrual system are being refused.
+type Breaker interface {
+	IsOpen() bool
+}
+
+// StateStore shares the state operators want between the processors of
+// every replica.
+type StateStore interface {
+	Desired(ctx context.Context) (model.ProcessorState, error)
+	SetDesired(ctx context.Context, state model.ProcessorState) error
+}
+
+// Assigner tells which orders this replica may poll, if any.
+type Assigner interface {
+	Assignment() (model.Shard, bool)
+}
+
+const (
+	defaultOwner         = "gophermart"
+	defaultLeaseDuration = time.Minute
+)
+
+// RetryPolicy spaces out failed accrual attempts of an order exponentially
+// and decides when to give up on it. A zero MaxFailures or MaxAge leaves
+// that limit off.
+type RetryPolicy struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxFailures int
+	MaxAge      time.Duration
+}
+
+// DefaultRetryPolicy gives up on an order after 20 failures or a day of failing.
+var DefaultRetryPolicy = RetryPolicy{
+	BaseDelay:   time.Second,
+	MaxDelay:    10 * time.Minute,
+	MaxFailures: 20,
+	MaxAge:      24 * time.Hour,
+}
+
+// Delay returns how long to wait after an attempt that follows the given
+// number of failures. It doubles with each failure up to MaxDelay, and the
+// upper half is jittered so retries of a failed batch spread out.
+func (p RetryPolicy) Delay(failures int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// Exhausted reports whether one more failure of order should park it.
+func (p RetryPolicy) Exhausted(order model.Order, now time.Time) bool {
+	if p.MaxFailures > 0 && order.Failures+1 >= p.MaxFailures {
+		return true
+	}
+	return p.MaxAge > 0 && order.FailingSince != nil && now.Sub(*order.FailingSince) >= p.MaxAge
+}
+
+// Option customizes OrderProcessor.
+type Option func(*OrderProcessor)
+
+// WithOwner sets the identity recorded on claimed orders.
+func WithOwner(owner string) Option {
+	return func(p *OrderProcessor) {
+		if owner != "" {
+			p.owner = owner
+		}
+	}
+}
+
+// WithLeaseDuration sets how long a claimed order stays reserved for this processor.
+func WithLeaseDuration(lease time.Duration) Option {
+	return func(p *OrderProcessor) {
+		if lease > 0 {
+			p.lease = lease
+		}
+	}
+}
+
+// WithRetryPolicy sets how failed orders are retried and when they are
+// dead-lettered. Non-positive delays keep the defaults.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(p *OrderProcessor) {
+		if policy.BaseDelay <= 0 {
+			policy.BaseDelay = DefaultRetryPolicy.BaseDelay
+		}
+		if policy.MaxDelay <= 0 {
+			policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+		}
+		p.retry = policy
+	}
+}
+
+// WithNotifier makes the processor fetch new orders as soon as they are
+// announced; the poll interval remains a safety net.
+func WithNotifier(notifier Notifier) Option {
+	return func(p *OrderProcessor) {
+		p.notifier = notifier
+	}
+}
+
+// WithBreaker makes the processor skip polling while breaker is open, so no
+// orders are leased only to be refused.
+func WithBreaker(breaker Breaker) Option {
+	return func(p *OrderProcessor) {
+		p.breaker = breaker
+	}
+}
+
+// WithAssigner restricts polling to the orders assigner hands this replica,
+// so that replicas sharing a database do not all poll the same orders.
+func WithAssigner(assigner Assigner) Option {
+	return func(p *OrderProcessor) {
+		p.assigner = assigner
+	}
+}
+
+// WithStateStore shares pause, resume and drain commands with the other
+// replicas: commands are recorded in store, and every poll tick brings the
+// processor in line with what it holds.
+func WithStateStore(store StateStore) Option {
+	return func(p *OrderProcessor) {
+		p.states = store
+	}
+}
+
+// WithScaling lets the pool grow and shrink between the policy bounds; the
+// size passed to NewOrderProcessor is where it starts. Zero fields keep the
+// defaults.
+func WithScaling(policy ScalingPolicy) Option {
+	return func(p *OrderProcessor) {
+		if policy.MinWorkers <= 0 {
+			policy.MinWorkers = 1
+		}
+		if policy.MaxWorkers < policy.MinWorkers {
+			policy.MaxWorkers = policy.MinWorkers
+		}
+		if policy.Interval <= 0 {
+			policy.Interval = DefaultScalingPolicy.Interval
+		}
+		if policy.BacklogPerWorker <= 0 {
+			policy.BacklogPerWorker = DefaultScalingPolicy.BacklogPerWorker
+		}
+		if policy.MaxLatency <= 0 {
+			policy.MaxLatency = DefaultScalingPolicy.MaxLatency
+		}
+		if policy.MaxRateLimited <= 0 {
+			policy.MaxRateLimited = DefaultScalingPolicy.MaxRateLimited
+		}
+		p.scaling = policy
+	}
 }
 
 // OrderProcessor polls accrual system and updates order statuses concurrently.
@@ -24,30 +194,77 @@ type OrderProcessor struct {
 	pollInterval time.Duration
 	batchSize    int
 	workers      int
+	owner        string
+	lease        time.Duration
+	retry        RetryPolicy
+	notifier     Notifier
+	breaker      Breaker
+	assigner     Assigner
+	states       StateStore
+	scaling      ScalingPolicy
 	logger       *slog.Logger
 
 	jobs   chan model.Order
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
 	mu     sync.Mutex
+	// quit stops claiming; pollers tracks the dispatcher and the scaler.
+	quit    chan struct{}
+	pollers sync.WaitGroup
+
+	// retire asks as many workers to exit as it holds tokens.
+	retire chan struct{}
+	poolMu sync.Mutex
+
+	statsMu     sync.Mutex
+	calls       int
+	rateLimited int
+	latency     time.Duration
+
+	// control wakes the dispatcher after Resume.
+	control     chan struct{}
+	stateMu     sync.Mutex
+	state       model.ProcessorState
+	started     bool
+	held        int
+	inFlight    int
+	lastPollAt  time.Time
+	lastError   string
+	lastErrorAt time.Time
+	finished    int
+	released    int
 }
 
 // NewOrderProcessor constructs order processor worker pool.
-func NewOrderProcessor(facade LoyaltyFacade, pollInterval time.Duration, batchSize, workers int, logger *slog.Logger) *OrderProcessor {
+func NewOrderProcessor(facade LoyaltyFacade, pollInterval time.Duration, batchSize, workers int, logger *slog.Logger, opts ...Option) *OrderProcessor {
 	if workers <= 0 {
 		workers = 1
 	}
 	if batchSize <= 0 {
 		batchSize = 1
 	}
-	return &OrderProcessor{
+	p := &OrderProcessor{
 		facade:       facade,
 		pollInterval: pollInterval,
 		batchSize:    batchSize,
 		workers:      workers,
+		owner:        defaultOwner,
+		lease:        defaultLeaseDuration,
+		retry:        DefaultRetryPolicy,
 		logger:       logger,
-		jobs:         make(chan model.Order, batchSize*workers),
+		jobs:         make(chan model.Order, batchSize),
+		control:      make(chan struct{}, 1),
+		state:        model.ProcessorRunning,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.scaling.MaxWorkers == 0 {
+		p.scaling.MinWorkers, p.scaling.MaxWorkers = workers, workers
 	}
+	p.workers = min(max(p.workers, p.scaling.MinWorkers), p.scaling.MaxWorkers)
+	p.retire = make(chan struct{}, p.scaling.MaxWorkers)
+	return p
 }
 
 // Start launches background processing.
@@ -57,104 +274,381 @@ func (p *OrderProcessor) Start(ctx context.Context) {
 
 	runCtx, cancel := context.WithCancel(ctx)
 	p.cancel = cancel
+	p.quit = make(chan struct{})
+	p.setStarted(true)
 
+	p.poolMu.Lock()
 	for i := 0; i < p.workers; i++ {
-		p.wg.Add(1)
-		go p.worker(runCtx)
+		p.spawn(runCtx)
 	}
+	p.poolMu.Unlock()
 
-	p.wg.Add(1)
+	p.pollers.Add(1)
 	go p.dispatch(runCtx)
+
+	if p.scaling.MaxWorkers > p.scaling.MinWorkers {
+		p.pollers.Add(1)
+		go p.scale(runCtx)
+	}
 }
 
-// Stop waits for all workers to finish.
-func (p *OrderProcessor) Stop() {
+// PoolSize returns the number of workers the pool currently aims for.
+func (p *OrderProcessor) PoolSize() int {
+	p.poolMu.Lock()
+	defer p.poolMu.Unlock()
+	return p.workers
+}
+
+// Health reports the pool size as the order processor component.
+func (p *OrderProcessor) Health(context.Context) model.ComponentHealth {
+	return model.ComponentHealth{
+		Name:   "order_processor",
+		Status: model.HealthUp,
+		Metrics: map[string]int64{
+			"pool_size": int64(p.PoolSize()),
+			"pool_min":  int64(p.scaling.MinWorkers),
+			"pool_max":  int64(p.scaling.MaxWorkers),
+		},
+	}
+}
+
+// Shutdown stops claiming orders and hands the claimed ones no worker has
+// started back to the queue. Workers finish the orders they are on until
+// ctx is done; calls still waiting on the accrual system then are aborted
+// and their orders released as well.
+func (p *OrderProcessor) Shutdown(ctx context.Context) {
 	p.mu.Lock()
-	if p.cancel != nil {
-		p.cancel()
-		p.cancel = nil
+	defer p.mu.Unlock()
+
+	if p.cancel == nil {
+		return
 	}
-	p.mu.Unlock()
+	cancel := p.cancel
+	p.cancel = nil
+	defer cancel()
+
+	finished, released := p.outcomes()
+	close(p.quit)
+	p.pollers.Wait()
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	p.releaseQueued(releaseCtx)
+	cancelRelease()
 
-	p.wg.Wait()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if inFlight := p.Status().InFlight; inFlight > 0 {
+			p.logger.Warn("order processor shutdown timed out, aborting in-flight orders", slog.Int("in_flight", inFlight))
+		}
+		cancel()
+		<-done
+	}
+	p.setStarted(false)
+
+	nowFinished, nowReleased := p.outcomes()
+	p.logger.Info("order processor stopped",
+		slog.Int("finished", nowFinished-finished),
+		slog.Int("released", nowReleased-released),
+	)
+}
+
+// Stop shuts the processor down without waiting for orders in flight.
+func (p *OrderProcessor) Stop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Shutdown(ctx)
 }
 
 func (p *OrderProcessor) dispatch(ctx context.Context) {
-	defer p.wg.Done()
-	defer close(p.jobs)
+	defer p.pollers.Done()
 	ticker := time.NewTicker(p.pollInterval)
 	defer ticker.Stop()
 
+	var wake <-chan struct{}
+	if p.notifier != nil {
+		wake = p.notifier.NewOrders(ctx)
+	}
+
+	p.syncState(ctx)
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-p.quit:
+			return
 		case <-ticker.C:
+			p.syncState(ctx)
+			p.fetchAndDispatch(ctx)
+		case <-wake:
+			p.fetchAndDispatch(ctx)
+		case <-p.control:
 			p.fetchAndDispatch(ctx)
 		}
 	}
 }
 
+// fetchAndDispatch claims batches until one comes back short. Handing a
+// batch over blocks while the workers are busy, so claiming keeps pace with
+// the pool instead of the poll interval. Orders of a batch not yet handed
+// over when the processor is paused, shut down or its context ends go
+// straight back to the queue.
 func (p *OrderProcessor) fetchAndDispatch(ctx context.Context) {
-	orders, err := p.facade.OrdersForProcessing(ctx, p.batchSize)
-	if err != nil {
-		p.logger.Error("fetch orders for processing failed", slog.String("error", err.Error()))
-		return
-	}
-	for _, order := range orders {
-		select {
-		case <-ctx.Done():
+	for {
+		if p.State() != model.ProcessorRunning {
+			return
+		}
+		if p.breaker != nil && p.breaker.IsOpen() {
+			// The breaker logs its transitions; the next tick checks again.
+			return
+		}
+		claim := model.OrderClaim{Owner: p.owner, Limit: p.batchSize, Lease: p.lease}
+		if p.assigner != nil {
+			shard, ok := p.assigner.Assignment()
+			if !ok {
+				return
+			}
+			claim.Shard = shard
+		}
+		orders, err := p.claim(ctx, claim)
+		if err != nil {
+			p.reportError("fetch orders for processing failed", err)
+			return
+		}
+		for i, order := range orders {
+			if p.State() == model.ProcessorPaused {
+				p.release(ctx, orders[i:])
+				p.releaseQueued(ctx)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				p.release(context.WithoutCancel(ctx), orders[i:])
+				return
+			case <-p.quit:
+				p.release(ctx, orders[i:])
+				return
+			case p.jobs <- order:
+			}
+		}
+		if len(orders) < claim.Limit {
 			return
-		case p.jobs <- order:
 		}
 	}
 }
 
+// spawn starts a worker; the caller holds poolMu.
+func (p *OrderProcessor) spawn(ctx context.Context) {
+	p.wg.Add(1)
+	go p.worker(ctx)
+}
+
 func (p *OrderProcessor) worker(ctx context.Context) {
 	defer p.wg.Done()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case order, ok := <-p.jobs:
-			if !ok {
-				return
-			}
-			p.handleOrder(ctx, order)
+		case <-p.retire:
+			return
+		case <-p.quit:
+			return
+		case order := <-p.jobs:
+			p.begin()
+			p.finish(ctx, order, p.handleOrder(ctx, order))
 		}
 	}
 }
 
-func (p *OrderProcessor) handleOrder(ctx context.Context, order model.Order) {
-	result, err := p.facade.CheckAccrual(ctx, order.Number)
+// handleOrder reports false when shutdown cut the order off before its
+// outcome was stored, so the order must be released rather than left leased.
+func (p *OrderProcessor) handleOrder(ctx context.Context, order model.Order) bool {
+	callCtx := accrual.WithCallTime(ctx)
+	result, err := p.facade.CheckAccrual(callCtx, order.Number)
+	if err != nil && ctx.Err() != nil {
+		return false
+	}
+	if latency, reached := accrual.CallTime(callCtx); reached {
+		p.observe(latency, err)
+	}
 	if err != nil {
-		switch e := err.(type) {
-		case accrual.TooManyRequestsError:
-			p.logger.Warn("accrual rate limited", slog.Duration("retry_after", e.RetryAfter))
-			time.Sleep(e.RetryAfter)
+		var rateLimited accrual.TooManyRequestsError
+		switch {
+		case errors.As(err, &rateLimited):
+			// The accrual client holds every worker until the pause ends.
+			return p.reschedule(ctx, order, rateLimited.RetryAfter, err.Error())
+		case errors.Is(err, accrual.ErrCircuitOpen):
+			// Refused without asking; the outage is not the order's fault.
+			return p.reschedule(ctx, order, p.pollInterval, err.Error())
+		case errors.Is(err, accrual.ErrOrderNotRegistered):
+			return p.fail(ctx, order, err)
 		default:
-			if errors.Is(err, accrual.ErrOrderNotRegistered) {
-				time.Sleep(p.pollInterval)
-				return
-			}
-			p.logger.Error("accrual fetch failed", slog.String("order", order.Number), slog.String("error", err.Error()))
+			p.reportError("accrual fetch failed", err, slog.String("order", order.Number))
+			return p.fail(ctx, order, err)
 		}
-		return
 	}
 
 	var status model.OrderStatus
 	switch result.Status {
-	case model.AccrualStatusRegistered, model.AccrualStatusProcessing:
-		status = model.OrderStatusProcessing
 	case model.AccrualStatusInvalid:
 		status = model.OrderStatusInvalid
 	case model.AccrualStatusProcessed:
 		status = model.OrderStatusProcessed
 	default:
-		status = model.OrderStatusProcessing
+		// Registered or still processing upstream: ask again once the order is due.
+		return p.reschedule(ctx, order, p.pollInterval, "")
+	}
+
+	update, err := p.facade.UpdateOrderStatus(ctx, order.ID, status, result.Accrual)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		p.reportError("update order status failed", err, slog.String("order", order.Number))
+		return true
+	}
+	if update != model.StatusUpdateApplied {
+		p.logger.Info("order status unchanged", slog.String("order", order.Number), slog.String("result", update.String()))
+	}
+	return true
+}
+
+// reschedule defers the order's next attempt. Like fail, it reports false
+// when shutdown cut the write off.
+func (p *OrderProcessor) reschedule(ctx context.Context, order model.Order, delay time.Duration, lastErr string) bool {
+	if err := p.facade.RescheduleOrder(ctx, order.ID, p.owner, delay, lastErr); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		p.reportError("reschedule order failed", err, slog.String("order", order.Number))
+	}
+	return true
+}
+
+// fail backs the order off after a failed attempt, or parks it once the
+// retry policy is exhausted.
+func (p *OrderProcessor) fail(ctx context.Context, order model.Order, cause error) bool {
+	if p.retry.Exhausted(order, time.Now()) {
+		if err := p.facade.DeadLetterOrder(ctx, order.ID, p.owner, cause.Error()); err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			p.reportError("dead-letter order failed", err, slog.String("order", order.Number))
+			return true
+		}
+		p.logger.Warn("order needs attention",
+			slog.String("order", order.Number),
+			slog.Int("failures", order.Failures+1),
+			slog.String("error", cause.Error()),
+		)
+		return true
+	}
+
+	delay := p.retry.Delay(order.Failures)
+	if err := p.facade.RecordOrderFailure(ctx, order.ID, p.owner, delay, cause.Error()); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		p.reportError("record order failure failed", err, slog.String("order", order.Number))
+	}
+	return true
+}
+
+// observe records an accrual call for the next scaling decision. latency is
+// the round trip alone, so queueing behind the limiter or a 429 pause does
+// not read as a slow accrual system.
+func (p *OrderProcessor) observe(latency time.Duration, err error) {
+	var rateLimited accrual.TooManyRequestsError
+
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	p.calls++
+	p.latency += latency
+	if errors.As(err, &rateLimited) {
+		p.rateLimited++
 	}
+}
 
-	if err := p.facade.UpdateOrderStatus(ctx, order.ID, status, result.Accrual); err != nil {
-		p.logger.Error("update order status failed", slog.String("order", order.Number), slog.String("error", err.Error()))
+// takeSample returns and resets the accrual call statistics.
+func (p *OrderProcessor) takeSample() PoolSample {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	sample := PoolSample{Calls: p.calls, RateLimited: p.rateLimited}
+	if p.calls > 0 {
+		sample.MeanLatency = p.latency / time.Duration(p.calls)
+	}
+	p.calls, p.rateLimited, p.latency = 0, 0, 0
+	return sample
+}
+
+func (p *OrderProcessor) scale(ctx context.Context) {
+	defer p.pollers.Done()
+	ticker := time.NewTicker(p.scaling.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.quit:
+			return
+		case <-ticker.C:
+			p.rescale(ctx)
+		}
+	}
+}
+
+// rescale resizes the pool according to the scaling policy.
+func (p *OrderProcessor) rescale(ctx context.Context) {
+	var backlog int64
+	shard, assigned := model.Shard{}, true
+	if p.assigner != nil {
+		shard, assigned = p.assigner.Assignment()
+	}
+	if assigned {
+		var err error
+		if backlog, err = p.facade.OrderBacklog(ctx, shard); err != nil {
+			if ctx.Err() == nil {
+				p.reportError("count order backlog failed", err)
+			}
+			return
+		}
+	}
+	sample := p.takeSample()
+	sample.Backlog = backlog
+
+	p.poolMu.Lock()
+	defer p.poolMu.Unlock()
+
+	current := p.workers
+	target, reason := p.scaling.Target(current, sample)
+	if target == current {
+		return
+	}
+	for ; p.workers < target; p.workers++ {
+		select {
+		case <-p.retire:
+			// A worker asked to exit has not yet; it stays.
+		default:
+			p.spawn(ctx)
+		}
+	}
+	for ; p.workers > target; p.workers-- {
+		p.retire <- struct{}{}
 	}
+	p.logger.Info("order worker pool resized",
+		slog.Int("from", current),
+		slog.Int("to", target),
+		slog.String("reason", reason),
+		slog.Int64("backlog", sample.Backlog),
+		slog.Int("calls", sample.Calls),
+		slog.Int("rate_limited", sample.RateLimited),
+		slog.Duration("mean_latency", sample.MeanLatency),
+	)
 }
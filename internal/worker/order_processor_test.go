@@ -2,8 +2,11 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -68,7 +71,7 @@ func TestOrderProcessorHandlesRateLimiting(t *testing.T) {
 			if atomic.AddInt32(&attempts, 1) == 1 {
 				return nil, accrual.TooManyRequestsError{RetryAfter: 10 * time.Millisecond}
 			}
-			accrualValue := 1.0
+			accrualValue := model.MustParseMoney("1")
 			return &model.Accrual{Status: model.AccrualStatusProcessed, Accrual: &accrualValue}, nil
 		},
 	}
@@ -94,3 +97,524 @@ func TestOrderProcessorHandlesRateLimiting(t *testing.T) {
 	}
 	proc.Stop()
 }
+
+func TestNewOrderProcessorOptions(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	proc := NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Second, 1, 1, logger, WithOwner("node-a"), WithLeaseDuration(5*time.Second))
+	if proc.owner != "node-a" || proc.lease != 5*time.Second {
+		t.Fatalf("unexpected options: owner=%q lease=%v", proc.owner, proc.lease)
+	}
+
+	proc = NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Second, 1, 1, logger, WithOwner(""), WithLeaseDuration(0))
+	if proc.owner != defaultOwner || proc.lease != defaultLeaseDuration {
+		t.Fatalf("expected defaults, got owner=%q lease=%v", proc.owner, proc.lease)
+	}
+}
+
+func TestWithScalingDefaults(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	proc := NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Second, 1, 8, logger, WithScaling(ScalingPolicy{MinWorkers: 2, MaxWorkers: 4}))
+	if proc.workers != 4 || proc.scaling.Interval != DefaultScalingPolicy.Interval || proc.scaling.BacklogPerWorker != DefaultScalingPolicy.BacklogPerWorker {
+		t.Fatalf("expected pool clamped to the bounds with default tuning, got %d %+v", proc.workers, proc.scaling)
+	}
+
+	proc = NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Second, 1, 3, logger)
+	if proc.scaling.MinWorkers != 3 || proc.scaling.MaxWorkers != 3 {
+		t.Fatalf("expected a fixed pool without scaling, got %+v", proc.scaling)
+	}
+	health := proc.Health(context.Background())
+	if health.Status != model.HealthUp || health.Metrics["pool_size"] != 3 || health.Metrics["pool_max"] != 3 {
+		t.Fatalf("unexpected health %+v", health)
+	}
+}
+
+func TestOrderProcessorRescalesPool(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	var backlog atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer upstream.Close()
+	client, err := accrual.NewHTTPClient(upstream.URL, logger)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	facade := &testhelpers.WorkerFacadeStub{
+		BacklogFn: func(context.Context, model.Shard) (int64, error) { return backlog.Load(), nil },
+		CheckFn:   client.Fetch,
+	}
+	proc := NewOrderProcessor(facade, time.Hour, 1, 2, logger, WithScaling(ScalingPolicy{MinWorkers: 1, MaxWorkers: 8, Interval: time.Hour}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	proc.Start(ctx)
+
+	backlog.Store(1000)
+	proc.rescale(ctx)
+	if size := proc.PoolSize(); size != 4 {
+		t.Fatalf("expected pool to double on backlog, got %d", size)
+	}
+	proc.rescale(ctx)
+	if size := proc.PoolSize(); size != 8 {
+		t.Fatalf("expected pool to grow to the maximum, got %d", size)
+	}
+
+	for i := 0; i < 4; i++ {
+		proc.handleOrder(ctx, model.Order{ID: int64(i), Number: "1"})
+	}
+	proc.rescale(ctx)
+	if size := proc.PoolSize(); size != 6 {
+		t.Fatalf("expected pool to shrink on rate limiting, got %d", size)
+	}
+
+	backlog.Store(0)
+	for i := 0; i < 10; i++ {
+		proc.rescale(ctx)
+	}
+	if size := proc.PoolSize(); size != 1 {
+		t.Fatalf("expected idle pool to shrink to the minimum, got %d", size)
+	}
+
+	backlog.Store(1000)
+	proc.rescale(ctx)
+	if size := proc.PoolSize(); size != 2 {
+		t.Fatalf("expected pool to grow again, got %d", size)
+	}
+	proc.Stop()
+}
+
+func TestOrderProcessorClaimsUntilBatchComesBackShort(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	facade := &testhelpers.WorkerFacadeStub{Orders: [][]model.Order{
+		{{ID: 1, Number: "1"}, {ID: 2, Number: "2"}},
+		{{ID: 3, Number: "3"}, {ID: 4, Number: "4"}},
+		{{ID: 5, Number: "5"}},
+		{{ID: 6, Number: "6"}},
+	}}
+	proc := NewOrderProcessor(facade, time.Hour, 2, 1, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	proc.Start(ctx)
+	defer proc.Stop()
+	proc.fetchAndDispatch(ctx)
+
+	deadline := time.After(time.Second)
+	for {
+		facade.Lock()
+		updates := len(facade.Updates)
+		facade.Unlock()
+		if updates == 5 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("expected full batches to be followed up until a short one, got %d updates", updates)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if orders, _ := facade.OrdersForProcessing(ctx, model.OrderClaim{}); len(orders) != 1 || orders[0].ID != 6 {
+		t.Fatalf("expected claiming to stop after the short batch, next batch was %+v", orders)
+	}
+}
+
+func TestOrderProcessorReschedulesPendingOrders(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	facade := &testhelpers.WorkerFacadeStub{
+		CheckFn: func(ctx context.Context, number string) (*model.Accrual, error) {
+			if number == "1" {
+				return nil, accrual.ErrOrderNotRegistered
+			}
+			return &model.Accrual{Status: model.AccrualStatusProcessing}, nil
+		},
+	}
+	proc := NewOrderProcessor(facade, time.Second, 2, 1, logger, WithOwner("node-a"))
+
+	ctx := context.Background()
+	proc.handleOrder(ctx, model.Order{ID: 1, Number: "1"})
+	proc.handleOrder(ctx, model.Order{ID: 2, Number: "2"})
+
+	facade.Lock()
+	defer facade.Unlock()
+	if len(facade.Updates) != 0 {
+		t.Fatalf("expected no status updates, got %+v", facade.Updates)
+	}
+	if len(facade.Failures) != 1 || len(facade.Reschedules) != 1 {
+		t.Fatalf("expected one failure and one reschedule, got %+v %+v", facade.Failures, facade.Reschedules)
+	}
+	failure, pending := facade.Failures[0], facade.Reschedules[0]
+	if failure.Owner != "node-a" || failure.Delay <= 0 || failure.LastError != accrual.ErrOrderNotRegistered.Error() {
+		t.Fatalf("unexpected failure for unregistered order: %+v", failure)
+	}
+	if pending.OrderID != 2 || pending.Delay != time.Second || pending.LastError != "" {
+		t.Fatalf("unexpected reschedule for processing order: %+v", pending)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for failures, ceiling := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if delay := policy.Delay(failures); delay < ceiling/2 || delay > ceiling {
+				t.Fatalf("delay after %d failures = %v, want within [%v, %v]", failures, delay, ceiling/2, ceiling)
+			}
+		}
+	}
+	if delay := policy.Delay(1000); delay > policy.MaxDelay {
+		t.Fatalf("expected delay capped at %v, got %v", policy.MaxDelay, delay)
+	}
+	if delay := (RetryPolicy{}).Delay(3); delay != 0 {
+		t.Fatalf("expected zero policy not to wait, got %v", delay)
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	now := time.Now()
+	recent, old := now.Add(-time.Minute), now.Add(-2*time.Hour)
+	policy := RetryPolicy{MaxFailures: 3, MaxAge: time.Hour}
+	tests := []struct {
+		name  string
+		order model.Order
+		want  bool
+	}{
+		{name: "first failure", order: model.Order{}, want: false},
+		{name: "below limit", order: model.Order{Failures: 1, FailingSince: &recent}, want: false},
+		{name: "attempt limit", order: model.Order{Failures: 2, FailingSince: &recent}, want: true},
+		{name: "age limit", order: model.Order{Failures: 1, FailingSince: &old}, want: true},
+	}
+	for _, tt := range tests {
+		if got := policy.Exhausted(tt.order, now); got != tt.want {
+			t.Errorf("%s: Exhausted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if (RetryPolicy{}).Exhausted(model.Order{Failures: 1000, FailingSince: &old}, now) {
+		t.Error("expected zero limits to retry forever")
+	}
+}
+
+func TestOrderProcessorBacksOffAndDeadLetters(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	facade := &testhelpers.WorkerFacadeStub{
+		CheckFn: func(context.Context, string) (*model.Accrual, error) {
+			return nil, errors.New("accrual error: 503 Service Unavailable")
+		},
+	}
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 3}
+	proc := NewOrderProcessor(facade, time.Second, 1, 1, logger, WithOwner("node-a"), WithRetryPolicy(policy))
+
+	ctx := context.Background()
+	proc.handleOrder(ctx, model.Order{ID: 1, Number: "1", Failures: 1})
+	proc.handleOrder(ctx, model.Order{ID: 2, Number: "2", Failures: 2})
+
+	facade.Lock()
+	defer facade.Unlock()
+	if len(facade.Failures) != 1 || facade.Failures[0].OrderID != 1 || facade.Failures[0].Delay < time.Second || facade.Failures[0].Delay > 2*time.Second {
+		t.Fatalf("expected second failure to back off up to 2s, got %+v", facade.Failures)
+	}
+	if len(facade.DeadLetters) != 1 || facade.DeadLetters[0].OrderID != 2 || facade.DeadLetters[0].Owner != "node-a" || facade.DeadLetters[0].LastError == "" {
+		t.Fatalf("expected third failure to dead-letter the order, got %+v", facade.DeadLetters)
+	}
+	if len(facade.Reschedules) != 0 {
+		t.Fatalf("expected no plain reschedules, got %+v", facade.Reschedules)
+	}
+}
+
+type breakerStub struct{ open atomic.Bool }
+
+func (b *breakerStub) IsOpen() bool { return b.open.Load() }
+
+func TestOrderProcessorSkipsPollingWhileBreakerOpen(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	var polls atomic.Int32
+	facade := &testhelpers.WorkerFacadeStub{
+		OrdersFn: func(context.Context, model.OrderClaim) ([]model.Order, error) {
+			polls.Add(1)
+			return nil, nil
+		},
+	}
+	breaker := &breakerStub{}
+	breaker.open.Store(true)
+	proc := NewOrderProcessor(facade, time.Second, 1, 1, logger, WithBreaker(breaker))
+
+	proc.fetchAndDispatch(context.Background())
+	if polls.Load() != 0 {
+		t.Fatal("expected no orders leased while the breaker is open")
+	}
+	breaker.open.Store(false)
+	proc.fetchAndDispatch(context.Background())
+	if polls.Load() != 1 {
+		t.Fatal("expected polling to resume once the breaker closes")
+	}
+}
+
+func TestOrderProcessorPollsOnlyAssignedShard(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	var claims []model.OrderClaim
+	facade := &testhelpers.WorkerFacadeStub{
+		OrdersFn: func(_ context.Context, claim model.OrderClaim) ([]model.Order, error) {
+			claims = append(claims, claim)
+			return nil, nil
+		},
+	}
+	registry := &testhelpers.InstanceRegistryStub{}
+	coordinator := NewCoordinator(CoordinationSharded, "node-b", nil, registry, time.Hour, 0, logger)
+	proc := NewOrderProcessor(facade, time.Second, 1, 1, logger, WithAssigner(coordinator))
+
+	coordinator.beat(context.Background())
+	proc.fetchAndDispatch(context.Background())
+	if len(claims) != 0 {
+		t.Fatal("expected no orders leased before the instance is registered")
+	}
+
+	registry.SetLive("node-a", "node-b", "node-c")
+	coordinator.beat(context.Background())
+	proc.fetchAndDispatch(context.Background())
+	if len(claims) != 1 || claims[0].Shard != (model.Shard{Index: 1, Count: 3}) {
+		t.Fatalf("expected claim restricted to the assigned shard, got %+v", claims)
+	}
+}
+
+func TestOrderProcessorReschedulesRefusedOrders(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	facade := &testhelpers.WorkerFacadeStub{
+		CheckFn: func(context.Context, string) (*model.Accrual, error) { return nil, accrual.ErrCircuitOpen },
+	}
+	proc := NewOrderProcessor(facade, time.Second, 1, 1, logger)
+	proc.handleOrder(context.Background(), model.Order{ID: 1, Number: "1", Failures: 100})
+
+	facade.Lock()
+	defer facade.Unlock()
+	if len(facade.Failures) != 0 || len(facade.DeadLetters) != 0 {
+		t.Fatalf("expected refused call not to count against the order, got %+v %+v", facade.Failures, facade.DeadLetters)
+	}
+	if len(facade.Reschedules) != 1 || facade.Reschedules[0].Delay != time.Second {
+		t.Fatalf("expected order rescheduled by the poll interval, got %+v", facade.Reschedules)
+	}
+}
+
+func TestWithRetryPolicyDefaults(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	proc := NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Second, 1, 1, logger, WithRetryPolicy(RetryPolicy{MaxFailures: 5}))
+	if proc.retry.BaseDelay != DefaultRetryPolicy.BaseDelay || proc.retry.MaxDelay != DefaultRetryPolicy.MaxDelay || proc.retry.MaxFailures != 5 || proc.retry.MaxAge != 0 {
+		t.Fatalf("unexpected retry policy %+v", proc.retry)
+	}
+}
+
+func TestOrderProcessorClaimsWithLease(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	claims := make(chan model.OrderClaim, 1)
+	facade := &testhelpers.WorkerFacadeStub{
+		OrdersFn: func(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
+			select {
+			case claims <- claim:
+			default:
+			}
+			return nil, nil
+		},
+	}
+	proc := NewOrderProcessor(facade, 5*time.Millisecond, 3, 1, logger, WithOwner("node-a"), WithLeaseDuration(time.Minute))
+	proc.Start(context.Background())
+	defer proc.Stop()
+
+	select {
+	case claim := <-claims:
+		if claim.Owner != "node-a" || claim.Limit != 3 || claim.Lease != time.Minute {
+			t.Fatalf("unexpected claim %+v", claim)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for claim")
+	}
+}
+
+type notifierStub chan struct{}
+
+func (n notifierStub) NewOrders(context.Context) <-chan struct{} { return n }
+
+func TestOrderProcessorWakesOnNewOrders(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	claims := make(chan model.OrderClaim, 1)
+	facade := &testhelpers.WorkerFacadeStub{
+		OrdersFn: func(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
+			claims <- claim
+			return nil, nil
+		},
+	}
+	wake := make(notifierStub, 1)
+	proc := NewOrderProcessor(facade, time.Hour, 1, 1, logger, WithNotifier(wake))
+	proc.Start(context.Background())
+	defer proc.Stop()
+
+	wake <- struct{}{}
+	select {
+	case <-claims:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification to trigger a fetch before the poll interval")
+	}
+}
+
+func TestOrderProcessorShutdownFinishesInFlightAndReleasesQueued(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	started, unblock := make(chan struct{}), make(chan struct{})
+	facade := &testhelpers.WorkerFacadeStub{
+		Orders: [][]model.Order{{{ID: 1, Number: "1"}, {ID: 2, Number: "2"}, {ID: 3, Number: "3"}}},
+		CheckFn: func(ctx context.Context, number string) (*model.Accrual, error) {
+			close(started)
+			<-unblock
+			return &model.Accrual{Status: model.AccrualStatusInvalid}, nil
+		},
+	}
+	proc := NewOrderProcessor(facade, time.Hour, 3, 1, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	proc.Start(ctx)
+	proc.fetchAndDispatch(ctx)
+	<-started
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShutdown()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proc.Shutdown(shutdownCtx)
+	}()
+
+	deadline := time.After(time.Second)
+	for {
+		facade.Lock()
+		releases := len(facade.Releases)
+		facade.Unlock()
+		if releases == 2 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("expected queued orders to be released, got %d", releases)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	close(unblock)
+	<-done
+
+	facade.Lock()
+	defer facade.Unlock()
+	if len(facade.Updates) != 1 || facade.Updates[0].OrderID != 1 {
+		t.Fatalf("expected in-flight order to finish, got %+v", facade.Updates)
+	}
+	if facade.Releases[0].OrderID != 2 || facade.Releases[1].OrderID != 3 {
+		t.Fatalf("expected queued orders released, got %+v", facade.Releases)
+	}
+	if status := proc.Status(); status.State != model.ProcessorStopped || status.InFlight != 0 {
+		t.Fatalf("unexpected status after shutdown: %+v", status)
+	}
+}
+
+func TestOrderProcessorShutdownReleasesAbortedOrders(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	started := make(chan struct{})
+	facade := &testhelpers.WorkerFacadeStub{
+		Orders: [][]model.Order{{{ID: 1, Number: "1"}}},
+		CheckFn: func(ctx context.Context, number string) (*model.Accrual, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	proc := NewOrderProcessor(facade, time.Hour, 1, 1, logger)
+	proc.Start(context.Background())
+	proc.fetchAndDispatch(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	proc.Shutdown(ctx)
+
+	facade.Lock()
+	defer facade.Unlock()
+	if len(facade.Releases) != 1 || facade.Releases[0].OrderID != 1 {
+		t.Fatalf("expected aborted order to be released, got %+v", facade.Releases)
+	}
+	if len(facade.Failures) != 0 || len(facade.Reschedules) != 0 {
+		t.Fatalf("expected aborted order not to count as attempted, got %+v %+v", facade.Failures, facade.Reschedules)
+	}
+	if status := proc.Status(); status.LastError != "" {
+		t.Fatalf("expected shutdown not to report an error, got %q", status.LastError)
+	}
+}
+
+func TestOrderProcessorShutdownReleasesOrdersCutOffWhileStoring(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	started := make(chan struct{})
+	facade := &testhelpers.WorkerFacadeStub{
+		Orders: [][]model.Order{{{ID: 1, Number: "1"}}},
+		CheckFn: func(context.Context, string) (*model.Accrual, error) {
+			return &model.Accrual{Status: model.AccrualStatusProcessed}, nil
+		},
+		UpdateFn: func(ctx context.Context, _ int64, _ model.OrderStatus, _ *model.Money) (model.StatusUpdate, error) {
+			close(started)
+			<-ctx.Done()
+			return model.StatusUpdateUnknown, ctx.Err()
+		},
+	}
+	proc := NewOrderProcessor(facade, time.Hour, 1, 1, logger)
+	proc.Start(context.Background())
+	proc.fetchAndDispatch(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	proc.Shutdown(ctx)
+
+	facade.Lock()
+	defer facade.Unlock()
+	if len(facade.Releases) != 1 || facade.Releases[0].OrderID != 1 {
+		t.Fatalf("expected the cut-off order to be released, got %+v", facade.Releases)
+	}
+	if status := proc.Status(); status.LastError != "" {
+		t.Fatalf("expected shutdown not to report an error, got %q", status.LastError)
+	}
+}
+
+func TestOrderProcessorReleasesOrdersCutOffByCancellation(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	started, unblock := make(chan struct{}, 4), make(chan struct{})
+	facade := &testhelpers.WorkerFacadeStub{
+		Orders: [][]model.Order{{{ID: 1, Number: "1"}, {ID: 2, Number: "2"}, {ID: 3, Number: "3"}, {ID: 4, Number: "4"}}},
+		CheckFn: func(context.Context, string) (*model.Accrual, error) {
+			started <- struct{}{}
+			<-unblock
+			return &model.Accrual{Status: model.AccrualStatusInvalid}, nil
+		},
+	}
+	proc := NewOrderProcessor(facade, time.Hour, 1, 1, logger)
+	proc.Start(context.Background())
+	defer func() {
+		close(unblock)
+		proc.Stop()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proc.fetchAndDispatch(ctx)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected dispatching to stop once the context ends")
+	}
+
+	facade.Lock()
+	defer facade.Unlock()
+	if len(facade.Releases) != 2 || facade.Releases[0].OrderID != 3 || facade.Releases[1].OrderID != 4 {
+		t.Fatalf("expected orders not handed over to be released, got %+v", facade.Releases)
+	}
+}
+
+func TestOrderProcessorShutdownBeforeStart(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	proc := NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Second, 1, 1, logger)
+	proc.Shutdown(context.Background())
+	proc.Stop()
+}
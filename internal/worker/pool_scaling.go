@@ -0,0 +1,57 @@
+package worker
+
+import "time"
+
+// ScalingPolicy sizes the worker pool between MinWorkers and MaxWorkers.
+// Every Interval the pool grows while the backlog outpaces the workers and
+// shrinks when they idle, when the accrual system slows down or when it
+// starts answering with 429.
+type ScalingPolicy struct {
+	MinWorkers int
+	MaxWorkers int
+	Interval   time.Duration
+	// BacklogPerWorker is the number of due orders per worker above which
+	// the pool grows.
+	BacklogPerWorker int
+	// MaxLatency is the mean accrual call time above which the pool shrinks.
+	MaxLatency time.Duration
+	// MaxRateLimited is the share of accrual calls answered with 429 above
+	// which the pool shrinks.
+	MaxRateLimited float64
+}
+
+// DefaultScalingPolicy reconsiders the pool size every 10s. Its bounds are
+// taken from the configured pool size.
+var DefaultScalingPolicy = ScalingPolicy{
+	Interval:         10 * time.Second,
+	BacklogPerWorker: 10,
+	MaxLatency:       2 * time.Second,
+	MaxRateLimited:   0.05,
+}
+
+// PoolSample is what the pool observed since the previous scaling decision.
+type PoolSample struct {
+	Backlog     int64
+	Calls       int
+	RateLimited int
+	MeanLatency time.Duration
+}
+
+// Target returns the pool size for the next interval and why it differs
+// from current. Pressure on the accrual system takes precedence over the
+// backlog: more workers would only collect more 429s.
+func (p ScalingPolicy) Target(current int, sample PoolSample) (int, string) {
+	target, reason := current, ""
+	switch {
+	case sample.Calls > 0 && float64(sample.RateLimited) > p.MaxRateLimited*float64(sample.Calls):
+		target, reason = current-max(1, current/4), "accrual rate limited"
+	case sample.Calls > 0 && sample.MeanLatency > p.MaxLatency:
+		target, reason = current-1, "accrual slow"
+	case sample.Backlog > int64(current*p.BacklogPerWorker):
+		needed := (sample.Backlog + int64(p.BacklogPerWorker) - 1) / int64(p.BacklogPerWorker)
+		target, reason = int(min(int64(current*2), needed)), "backlog growing"
+	case sample.Backlog < int64(current):
+		target, reason = current-1, "workers idle"
+	}
+	return min(max(target, p.MinWorkers), p.MaxWorkers), reason
+}
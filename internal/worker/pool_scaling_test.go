@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScalingPolicyTarget(t *testing.T) {
+	policy := ScalingPolicy{MinWorkers: 2, MaxWorkers: 16, BacklogPerWorker: 10, MaxLatency: time.Second, MaxRateLimited: 0.1}
+	cases := []struct {
+		name    string
+		current int
+		sample  PoolSample
+		want    int
+		reason  string
+	}{
+		{"steady", 4, PoolSample{Backlog: 20, Calls: 10, MeanLatency: 100 * time.Millisecond}, 4, ""},
+		{"backlog doubles pool", 4, PoolSample{Backlog: 500, Calls: 10, MeanLatency: 100 * time.Millisecond}, 8, "backlog growing"},
+		{"backlog grows to need", 4, PoolSample{Backlog: 55}, 6, "backlog growing"},
+		{"growth capped", 12, PoolSample{Backlog: 1000}, 16, "backlog growing"},
+		{"idle shrinks", 4, PoolSample{Backlog: 1}, 3, "workers idle"},
+		{"idle keeps minimum", 2, PoolSample{}, 2, "workers idle"},
+		{"slow accrual shrinks", 8, PoolSample{Backlog: 1000, Calls: 10, MeanLatency: 2 * time.Second}, 7, "accrual slow"},
+		{"rate limits shrink by a quarter", 8, PoolSample{Backlog: 1000, Calls: 10, RateLimited: 2}, 6, "accrual rate limited"},
+		{"rare rate limits tolerated", 8, PoolSample{Backlog: 80, Calls: 100, RateLimited: 5}, 8, ""},
+	}
+	for _, tt := range cases {
+		got, reason := policy.Target(tt.current, tt.sample)
+		if got != tt.want || reason != tt.reason {
+			t.Errorf("%s: expected %d (%q), got %d (%q)", tt.name, tt.want, tt.reason, got, reason)
+		}
+	}
+}
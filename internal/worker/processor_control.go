@@ -0,0 +1,270 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+)
+
+// Pause stops claiming orders and hands the claimed ones no worker has
+// picked up yet back to the queue. Orders being worked on are finished.
+// A processor paused before Start stays paused once started. With a state
+// store the other replicas pause on their next tick.
+func (p *OrderProcessor) Pause(ctx context.Context) error {
+	if err := p.setDesired(ctx, model.ProcessorPaused); err != nil {
+		return err
+	}
+	p.pause(ctx)
+	return nil
+}
+
+// Resume claims orders again, starting with an immediate poll.
+func (p *OrderProcessor) Resume(ctx context.Context) error {
+	if err := p.setDesired(ctx, model.ProcessorRunning); err != nil {
+		return err
+	}
+	p.resume()
+	return nil
+}
+
+// Drain stops claiming orders but works off the claimed ones; the processor
+// is paused once none are left.
+func (p *OrderProcessor) Drain(ctx context.Context) error {
+	if err := p.setDesired(ctx, model.ProcessorDraining); err != nil {
+		return err
+	}
+	p.drain()
+	return nil
+}
+
+// setDesired records a command for the other replicas.
+func (p *OrderProcessor) setDesired(ctx context.Context, state model.ProcessorState) error {
+	if p.states == nil {
+		return nil
+	}
+	return p.states.SetDesired(ctx, state)
+}
+
+// syncState applies the command last recorded by any replica.
+func (p *OrderProcessor) syncState(ctx context.Context) {
+	if p.states == nil {
+		return
+	}
+	desired, err := p.states.Desired(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.reportError("load processor state failed", err)
+		}
+		return
+	}
+	switch desired {
+	case model.ProcessorRunning:
+		p.resume()
+	case model.ProcessorPaused:
+		p.pause(ctx)
+	case model.ProcessorDraining:
+		p.drain()
+	}
+}
+
+// pause releases the queued orders even if ctx, such as an operator's
+// request, ends meanwhile.
+func (p *OrderProcessor) pause(ctx context.Context) {
+	if p.transition(model.ProcessorPaused) {
+		p.logger.Info("order processor paused")
+	}
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	defer cancel()
+	p.releaseQueued(releaseCtx)
+}
+
+func (p *OrderProcessor) resume() {
+	if !p.transition(model.ProcessorRunning) {
+		return
+	}
+	p.logger.Info("order processor resumed")
+	select {
+	case p.control <- struct{}{}:
+	default:
+	}
+}
+
+func (p *OrderProcessor) drain() {
+	p.stateMu.Lock()
+	if p.state != model.ProcessorRunning {
+		p.stateMu.Unlock()
+		return
+	}
+	p.state = model.ProcessorDraining
+	p.stateMu.Unlock()
+
+	p.logger.Info("order processor draining")
+	p.settle()
+}
+
+// State returns what the processor is allowed to do, regardless of whether
+// it has been started.
+func (p *OrderProcessor) State() model.ProcessorState {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.state
+}
+
+// Status returns a snapshot of the processor.
+func (p *OrderProcessor) Status() model.ProcessorStatus {
+	workers := p.PoolSize()
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	status := model.ProcessorStatus{
+		State:      p.state,
+		Workers:    workers,
+		QueueDepth: len(p.jobs),
+		InFlight:   p.inFlight,
+		LastError:  p.lastError,
+	}
+	if !p.started {
+		status.State = model.ProcessorStopped
+	}
+	if !p.lastPollAt.IsZero() {
+		polled := p.lastPollAt
+		status.LastPollAt = &polled
+	}
+	if !p.lastErrorAt.IsZero() {
+		failed := p.lastErrorAt
+		status.LastErrorAt = &failed
+	}
+	return status
+}
+
+func (p *OrderProcessor) transition(state model.ProcessorState) bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if p.state == state {
+		return false
+	}
+	p.state = state
+	return true
+}
+
+func (p *OrderProcessor) setStarted(started bool) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.started = started
+}
+
+// claim leases a batch and counts it as held until each order is finished
+// or released.
+func (p *OrderProcessor) claim(ctx context.Context, claim model.OrderClaim) ([]model.Order, error) {
+	p.stateMu.Lock()
+	p.lastPollAt = time.Now()
+	p.stateMu.Unlock()
+
+	orders, err := p.facade.OrdersForProcessing(ctx, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	p.stateMu.Lock()
+	p.held += len(orders)
+	p.stateMu.Unlock()
+	return orders, nil
+}
+
+func (p *OrderProcessor) begin() {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.inFlight++
+}
+
+// finish settles an order a worker took; one whose accrual call shutdown
+// aborted goes back to the queue.
+func (p *OrderProcessor) finish(ctx context.Context, order model.Order, done bool) {
+	p.stateMu.Lock()
+	p.inFlight--
+	if done {
+		p.held--
+		p.finished++
+	}
+	p.stateMu.Unlock()
+
+	if !done {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+		defer cancel()
+		p.release(releaseCtx, []model.Order{order})
+		return
+	}
+	p.settle()
+}
+
+// release hands orders back to the queue unattempted.
+func (p *OrderProcessor) release(ctx context.Context, orders []model.Order) {
+	released := 0
+	for _, order := range orders {
+		if err := p.facade.ReleaseOrder(ctx, order.ID, p.owner); err != nil {
+			p.reportError("release order failed", err, slog.String("order", order.Number))
+			continue
+		}
+		released++
+	}
+
+	p.stateMu.Lock()
+	p.held -= len(orders)
+	p.released += released
+	p.stateMu.Unlock()
+	p.settle()
+}
+
+// releaseQueued releases the claimed orders waiting for a worker.
+func (p *OrderProcessor) releaseQueued(ctx context.Context) {
+	if queued := p.takeQueued(); len(queued) > 0 {
+		p.release(ctx, queued)
+	}
+}
+
+// takeQueued empties the jobs queue without waiting.
+func (p *OrderProcessor) takeQueued() []model.Order {
+	var queued []model.Order
+	for {
+		select {
+		case order := <-p.jobs:
+			queued = append(queued, order)
+		default:
+			return queued
+		}
+	}
+}
+
+// outcomes returns how many orders were finished and released so far.
+func (p *OrderProcessor) outcomes() (int, int) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.finished, p.released
+}
+
+// settle pauses a draining processor once it holds no orders.
+func (p *OrderProcessor) settle() {
+	p.stateMu.Lock()
+	drained := p.state == model.ProcessorDraining && p.held <= 0
+	if drained {
+		p.state = model.ProcessorPaused
+	}
+	p.stateMu.Unlock()
+
+	if drained {
+		p.logger.Info("order processor drained")
+	}
+}
+
+// reportError logs err and keeps it for Status.
+func (p *OrderProcessor) reportError(msg string, err error, attrs ...any) {
+	p.logger.Error(msg, append(attrs, slog.String("error", err.Error()))...)
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.lastError = msg + ": " + err.Error()
+	p.lastErrorAt = time.Now()
+}
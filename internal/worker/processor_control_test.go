@@ -0,0 +1,239 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/gophermart/internal/domain/model"
+	"github.com/polkiloo/gophermart/internal/storage/memory"
+	testhelpers "github.com/polkiloo/gophermart/internal/test"
+)
+
+func TestOrderProcessorStatusBeforeStart(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	proc := NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Second, 1, 2, logger)
+
+	status := proc.Status()
+	if status.State != model.ProcessorStopped || status.Workers != 2 {
+		t.Fatalf("unexpected status before start: %+v", status)
+	}
+	if status.LastPollAt != nil || status.LastErrorAt != nil {
+		t.Fatalf("expected no poll or error yet, got %+v", status)
+	}
+	if proc.State() != model.ProcessorRunning {
+		t.Fatalf("expected processor to be allowed to run, got %s", proc.State())
+	}
+}
+
+func TestOrderProcessorPauseReleasesQueuedOrders(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	facade := &testhelpers.WorkerFacadeStub{Orders: [][]model.Order{{{ID: 1, Number: "1"}, {ID: 2, Number: "2"}}}}
+	proc := NewOrderProcessor(facade, time.Hour, 2, 1, logger, WithOwner("node-a"))
+	ctx := context.Background()
+
+	orders, err := proc.claim(ctx, model.OrderClaim{Limit: 2})
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	for _, order := range orders {
+		proc.jobs <- order
+	}
+	// The operator's request may end before the orders are released.
+	requestCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := proc.Pause(requestCtx); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	if proc.State() != model.ProcessorPaused {
+		t.Fatalf("expected paused, got %s", proc.State())
+	}
+	if depth := proc.Status().QueueDepth; depth != 0 {
+		t.Fatalf("expected queue emptied, got %d", depth)
+	}
+	facade.Lock()
+	releases := facade.Releases
+	facade.Unlock()
+	if len(releases) != 2 || releases[0].OrderID != 1 || releases[1].Owner != "node-a" {
+		t.Fatalf("expected both queued orders released, got %+v", releases)
+	}
+
+	var claims int32
+	facade.OrdersFn = func(context.Context, model.OrderClaim) ([]model.Order, error) {
+		atomic.AddInt32(&claims, 1)
+		return nil, nil
+	}
+	proc.fetchAndDispatch(ctx)
+	if atomic.LoadInt32(&claims) != 0 {
+		t.Fatal("expected paused processor not to claim orders")
+	}
+}
+
+func TestOrderProcessorResumePollsImmediately(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	polled := make(chan struct{}, 1)
+	facade := &testhelpers.WorkerFacadeStub{
+		OrdersFn: func(context.Context, model.OrderClaim) ([]model.Order, error) {
+			select {
+			case polled <- struct{}{}:
+			default:
+			}
+			return nil, nil
+		},
+	}
+	proc := NewOrderProcessor(facade, time.Hour, 1, 1, logger)
+	if err := proc.Pause(context.Background()); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	proc.Start(ctx)
+	defer proc.Stop()
+
+	if state := proc.Status().State; state != model.ProcessorPaused {
+		t.Fatalf("expected processor paused before start to stay paused, got %s", state)
+	}
+	if err := proc.Resume(context.Background()); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	select {
+	case <-polled:
+	case <-time.After(time.Second):
+		t.Fatal("expected resume to poll right away")
+	}
+	if proc.Status().LastPollAt == nil {
+		t.Fatal("expected last poll time to be reported")
+	}
+}
+
+func TestOrderProcessorDrainPausesOnceIdle(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	facade := &testhelpers.WorkerFacadeStub{Orders: [][]model.Order{{{ID: 1, Number: "1"}, {ID: 2, Number: "2"}}}}
+	proc := NewOrderProcessor(facade, time.Hour, 2, 1, logger)
+	ctx := context.Background()
+
+	if _, err := proc.claim(ctx, model.OrderClaim{Limit: 2}); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if err := proc.Drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if proc.State() != model.ProcessorDraining {
+		t.Fatalf("expected draining while orders are held, got %s", proc.State())
+	}
+
+	proc.begin()
+	proc.finish(ctx, model.Order{ID: 1}, true)
+	if proc.State() != model.ProcessorDraining {
+		t.Fatalf("expected draining with one order left, got %s", proc.State())
+	}
+	proc.begin()
+	proc.finish(ctx, model.Order{ID: 2}, true)
+	if proc.State() != model.ProcessorPaused {
+		t.Fatalf("expected paused once drained, got %s", proc.State())
+	}
+
+	if err := proc.Drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if proc.State() != model.ProcessorPaused {
+		t.Fatalf("expected drain of a paused processor to be a no-op, got %s", proc.State())
+	}
+}
+
+func TestOrderProcessorFollowsSharedState(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	store := memory.New().ProcessorState()
+	operated := NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Hour, 1, 1, logger, WithStateStore(store))
+	facade := &testhelpers.WorkerFacadeStub{Orders: [][]model.Order{{{ID: 1, Number: "1"}}}}
+	other := NewOrderProcessor(facade, time.Hour, 1, 1, logger, WithOwner("node-b"), WithStateStore(store))
+	ctx := context.Background()
+
+	orders, err := other.claim(ctx, model.OrderClaim{Limit: 1})
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	other.jobs <- orders[0]
+
+	if err := operated.Pause(ctx); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	other.syncState(ctx)
+	if other.State() != model.ProcessorPaused {
+		t.Fatalf("expected the other replica paused, got %s", other.State())
+	}
+	facade.Lock()
+	releases := facade.Releases
+	facade.Unlock()
+	if len(releases) != 1 || releases[0].Owner != "node-b" {
+		t.Fatalf("expected the other replica to release its queue, got %+v", releases)
+	}
+
+	if err := operated.Resume(ctx); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	other.syncState(ctx)
+	if other.State() != model.ProcessorRunning {
+		t.Fatalf("expected the other replica resumed, got %s", other.State())
+	}
+
+	if err := operated.Drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	other.syncState(ctx)
+	if other.State() != model.ProcessorPaused {
+		t.Fatalf("expected the idle replica drained, got %s", other.State())
+	}
+}
+
+type failingStateStore struct{}
+
+func (failingStateStore) Desired(context.Context) (model.ProcessorState, error) {
+	return "", errors.New("db down")
+}
+
+func (failingStateStore) SetDesired(context.Context, model.ProcessorState) error {
+	return errors.New("db down")
+}
+
+func TestOrderProcessorKeepsStateWhenStoreFails(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	proc := NewOrderProcessor(&testhelpers.WorkerFacadeStub{}, time.Hour, 1, 1, logger, WithStateStore(failingStateStore{}))
+
+	if err := proc.Pause(context.Background()); err == nil {
+		t.Fatal("expected pause to fail when it cannot be recorded")
+	}
+	proc.syncState(context.Background())
+	if proc.State() != model.ProcessorRunning {
+		t.Fatalf("expected state kept, got %s", proc.State())
+	}
+	if status := proc.Status(); !strings.Contains(status.LastError, "load processor state failed") {
+		t.Fatalf("expected sync failure reported, got %+v", status)
+	}
+}
+
+func TestOrderProcessorStatusReportsLastError(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	facade := &testhelpers.WorkerFacadeStub{
+		OrdersFn: func(context.Context, model.OrderClaim) ([]model.Order, error) {
+			return nil, errors.New("db down")
+		},
+	}
+	proc := NewOrderProcessor(facade, time.Hour, 1, 1, logger)
+	proc.fetchAndDispatch(context.Background())
+
+	status := proc.Status()
+	if !strings.Contains(status.LastError, "db down") || status.LastErrorAt == nil {
+		t.Fatalf("expected last error reported, got %+v", status)
+	}
+	if status.LastPollAt == nil {
+		t.Fatal("expected failed poll to count as a poll")
+	}
+}